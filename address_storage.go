@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/djschnei21/vault-plugin-btc/wallet"
 )
 
 const addressStoragePrefix = "addresses/"
@@ -14,14 +17,39 @@ const addressStoragePrefix = "addresses/"
 type storedAddress struct {
 	Address        string `json:"address"`
 	Index          uint32 `json:"index"`
+	Account        uint32 `json:"account,omitempty"`
+	Change         bool   `json:"change,omitempty"` // True for internal (change chain) addresses
+	AddressType    string `json:"address_type,omitempty"`
 	DerivationPath string `json:"derivation_path"`
 	ScriptHash     string `json:"scripthash"`
 	Spent          bool   `json:"spent,omitempty"` // True if this address has been used as an input
 }
 
-// getStoredAddresses retrieves all stored addresses for a wallet, sorted by index
-func getStoredAddresses(ctx context.Context, s logical.Storage, walletName string) ([]storedAddress, error) {
-	prefix := addressStoragePrefix + walletName + "/"
+// chain returns the BIP44 change level of the address (0 external, 1 internal)
+func (a *storedAddress) chain() uint32 {
+	if a.Change {
+		return 1
+	}
+	return 0
+}
+
+// addressStoragePath returns the storage prefix holding an account's addresses.
+// Account 0 keeps the original addresses/<wallet>/ layout.
+func addressStoragePath(walletName string, account uint32) string {
+	if account == 0 {
+		return addressStoragePrefix + walletName + "/"
+	}
+	return fmt.Sprintf("%s%s/accounts/%d/", addressStoragePrefix, walletName, account)
+}
+
+// addressStorageKey returns the storage key of a single address
+func addressStorageKey(walletName string, account, index uint32) string {
+	return fmt.Sprintf("%s%d", addressStoragePath(walletName, account), index)
+}
+
+// getStoredAddresses retrieves all stored addresses for a wallet account, sorted by index
+func getStoredAddresses(ctx context.Context, s logical.Storage, walletName string, account uint32) ([]storedAddress, error) {
+	prefix := addressStoragePath(walletName, account)
 	entries, err := s.List(ctx, prefix)
 	if err != nil {
 		return nil, fmt.Errorf("error listing addresses: %w", err)
@@ -29,6 +57,11 @@ func getStoredAddresses(ctx context.Context, s logical.Storage, walletName strin
 
 	addresses := make([]storedAddress, 0, len(entries))
 	for _, entry := range entries {
+		// Skip the accounts/ folder nested under account 0
+		if strings.HasSuffix(entry, "/") {
+			continue
+		}
+
 		stored, err := s.Get(ctx, prefix+entry)
 		if err != nil {
 			continue
@@ -42,6 +75,16 @@ func getStoredAddresses(ctx context.Context, s logical.Storage, walletName strin
 			continue
 		}
 
+		// Records written before the change flag and address type existed only carry the path
+		if !addr.Change {
+			if _, change, _, err := wallet.ParseDerivationPath(addr.DerivationPath); err == nil && change == 1 {
+				addr.Change = true
+			}
+		}
+		if addr.AddressType == "" {
+			addr.AddressType = wallet.AddressTypeForDerivationPath(addr.DerivationPath)
+		}
+
 		addresses = append(addresses, addr)
 	}
 
@@ -53,9 +96,23 @@ func getStoredAddresses(ctx context.Context, s logical.Storage, walletName strin
 	return addresses, nil
 }
 
+// storeAddress writes an address record under its wallet account
+func storeAddress(ctx context.Context, s logical.Storage, walletName string, addr *storedAddress) error {
+	entry, err := logical.StorageEntryJSON(addressStorageKey(walletName, addr.Account, addr.Index), addr)
+	if err != nil {
+		return fmt.Errorf("failed to create storage entry: %w", err)
+	}
+
+	if err := s.Put(ctx, entry); err != nil {
+		return fmt.Errorf("failed to store address %d: %w", addr.Index, err)
+	}
+
+	return nil
+}
+
 // markAddressSpent marks an address as spent (used as transaction input)
-func markAddressSpent(ctx context.Context, s logical.Storage, walletName string, addressIndex uint32) error {
-	storageKey := fmt.Sprintf("%s%s/%d", addressStoragePrefix, walletName, addressIndex)
+func markAddressSpent(ctx context.Context, s logical.Storage, walletName string, account, addressIndex uint32) error {
+	storageKey := addressStorageKey(walletName, account, addressIndex)
 
 	entry, err := s.Get(ctx, storageKey)
 	if err != nil {
@@ -85,11 +142,48 @@ func markAddressSpent(ctx context.Context, s logical.Storage, walletName string,
 }
 
 // markAddressesSpent marks multiple addresses as spent
-func markAddressesSpent(ctx context.Context, s logical.Storage, walletName string, addressIndices []uint32) error {
+func markAddressesSpent(ctx context.Context, s logical.Storage, walletName string, account uint32, addressIndices []uint32) error {
 	for _, idx := range addressIndices {
-		if err := markAddressSpent(ctx, s, walletName, idx); err != nil {
+		if err := markAddressSpent(ctx, s, walletName, account, idx); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// deleteStoredAddresses removes every address record of a wallet, across all
+// accounts, and returns how many were deleted
+func deleteStoredAddresses(ctx context.Context, s logical.Storage, walletName string) (int, error) {
+	accountsPrefix := addressStoragePrefix + walletName + "/accounts/"
+	accounts, err := s.List(ctx, accountsPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("error listing accounts: %w", err)
+	}
+
+	prefixes := []string{addressStoragePath(walletName, 0)}
+	for _, account := range accounts {
+		prefixes = append(prefixes, accountsPrefix+account)
+	}
+
+	deleted := 0
+	for _, prefix := range prefixes {
+		if !strings.HasSuffix(prefix, "/") {
+			continue
+		}
+		entries, err := s.List(ctx, prefix)
+		if err != nil {
+			return deleted, fmt.Errorf("error listing addresses: %w", err)
+		}
+		for _, entry := range entries {
+			if strings.HasSuffix(entry, "/") {
+				continue
+			}
+			if err := s.Delete(ctx, prefix+entry); err != nil {
+				return deleted, fmt.Errorf("error deleting address: %w", err)
+			}
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
@@ -9,15 +9,20 @@ import (
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 
+	"github.com/djschnei21/vault-plugin-btc/bitcoind"
 	"github.com/djschnei21/vault-plugin-btc/electrum"
+	"github.com/djschnei21/vault-plugin-btc/esplora"
 )
 
 // btcBackend defines the backend for the Bitcoin secrets engine
 type btcBackend struct {
 	*framework.Backend
-	lock   sync.RWMutex
-	client *electrum.Client
-	cache  *WalletCacheManager
+	lock    sync.RWMutex
+	clients map[string]ChainBackend // keyed by network
+	cache   *WalletCacheManager
+
+	walletLocksMu sync.Mutex
+	walletLocks   map[string]*sync.Mutex // keyed by wallet name
 }
 
 // Factory creates a new backend instance
@@ -31,7 +36,8 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 
 func backend() *btcBackend {
 	b := &btcBackend{
-		cache: NewWalletCacheManager(),
+		cache:       NewWalletCacheManager(),
+		walletLocks: make(map[string]*sync.Mutex),
 	}
 
 	b.Backend = &framework.Backend{
@@ -39,45 +45,86 @@ func backend() *btcBackend {
 		PathsSpecial: &logical.Paths{
 			SealWrapStorage: []string{
 				"config",
+				seedEncryptionStoragePath,
+				seedKeyringStoragePath,
 				"wallets/*",
+				deletedWalletsStoragePrefix,
+				// Pending channel fundings hold signed transactions
+				channelFundingStoragePrefix,
+			},
+			// Cached chain data is specific to this cluster's view of the backend
+			LocalStorage: []string{
+				cacheStoragePrefix,
 			},
 		},
 		Paths: framework.PathAppend(
 			pathConfig(b),
+			pathConfigSeedEncryption(b),
+			pathWalletBackup(b),
 			pathWallets(b),
+			pathWalletAccounts(b),
 			pathWalletAddresses(b),
 			pathWalletUTXOs(b),
 			pathWalletQR(b),
 			pathWalletXpub(b),
+			pathWalletShares(b),
+			pathWalletMessage(b),
+			pathWalletReserves(b),
+			pathWalletSilentPayments(b),
+			pathWalletChannelFunding(b),
 			pathWalletSend(b),
 			pathWalletPSBT(b),
 			pathWalletConsolidate(b),
 			pathWalletCompact(b),
 			pathWalletScan(b),
+			pathDeletedWallets(b),
 		),
-		Secrets:     []*framework.Secret{},
-		BackendType: logical.TypeLogical,
-		Invalidate:  b.invalidate,
+		Secrets:      []*framework.Secret{},
+		BackendType:  logical.TypeLogical,
+		Invalidate:   b.invalidate,
+		PeriodicFunc: b.periodicFunc,
 	}
 
 	return b
 }
 
-// invalidate resets the client when configuration changes
+// invalidate resets the client when configuration changes and drops
+// in-memory wallet caches whose persisted snapshot changed
 func (b *btcBackend) invalidate(ctx context.Context, key string) {
-	if key == "config" {
+	switch {
+	case key == "config":
 		b.reset()
+	case strings.HasPrefix(key, cacheStoragePrefix):
+		b.cache.InvalidateWallet(strings.TrimPrefix(key, cacheStoragePrefix))
+	}
+}
+
+// lockWallet serializes the requests that select a wallet's UTXOs, so two
+// requests cannot spend the same outputs, and returns the unlock function.
+// The lock is held until the spend is recorded: the broadcast marks the
+// inputs spent, a channel funding record locks them. Seed rewrites take it
+// too, so they don't race the wallet saves of a spend.
+func (b *btcBackend) lockWallet(name string) func() {
+	b.walletLocksMu.Lock()
+	l, ok := b.walletLocks[name]
+	if !ok {
+		l = new(sync.Mutex)
+		b.walletLocks[name] = l
 	}
+	b.walletLocksMu.Unlock()
+
+	l.Lock()
+	return l.Unlock
 }
 
-// reset clears the cached Electrum client
+// reset clears the cached chain backend clients of every network
 func (b *btcBackend) reset() {
 	b.lock.Lock()
 	defer b.lock.Unlock()
-	if b.client != nil {
-		b.Logger().Debug("closing Electrum connection")
-		b.client.Close()
-		b.client = nil
+	for network, client := range b.clients {
+		b.Logger().Debug("closing chain backend connection", "network", network)
+		client.Close()
+		delete(b.clients, network)
 	}
 }
 
@@ -106,12 +153,14 @@ func (b *btcBackend) handleClientError(err error) bool {
 	return false
 }
 
-// getClient returns the Electrum client, creating one if necessary
-func (b *btcBackend) getClient(ctx context.Context, s logical.Storage) (*electrum.Client, error) {
+// getClient returns the chain backend client for a network, creating one if
+// necessary. Clients are kept per network so wallets on different networks
+// can be served by the same mount.
+func (b *btcBackend) getClient(ctx context.Context, s logical.Storage, network string) (ChainBackend, error) {
 	b.lock.RLock()
-	if b.client != nil && !b.client.IsDead() {
+	if client := b.clients[network]; client != nil && !client.IsDead() {
 		b.lock.RUnlock()
-		return b.client, nil
+		return client, nil
 	}
 	b.lock.RUnlock()
 
@@ -119,15 +168,15 @@ func (b *btcBackend) getClient(ctx context.Context, s logical.Storage) (*electru
 	defer b.lock.Unlock()
 
 	// Double-check after acquiring write lock
-	if b.client != nil && !b.client.IsDead() {
-		return b.client, nil
+	if client := b.clients[network]; client != nil && !client.IsDead() {
+		return client, nil
 	}
 
 	// Close dead client if exists
-	if b.client != nil {
-		b.Logger().Warn("closing dead Electrum connection, will reconnect")
-		b.client.Close()
-		b.client = nil
+	if client := b.clients[network]; client != nil {
+		b.Logger().Warn("closing dead chain backend connection, will reconnect", "network", network)
+		client.Close()
+		delete(b.clients, network)
 	}
 
 	config, err := getConfig(ctx, s)
@@ -135,25 +184,97 @@ func (b *btcBackend) getClient(ctx context.Context, s logical.Storage) (*electru
 		return nil, err
 	}
 
+	defaultNetwork, err := config.networkID()
+	if err != nil {
+		return nil, err
+	}
+
+	var client ChainBackend
+	if network == defaultNetwork {
+		client, err = b.connectDefault(ctx, s, config, network)
+	} else {
+		client, err = b.connectElectrum(ctx, config, network, network, config.electrumURLFor(network))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if b.clients == nil {
+		b.clients = make(map[string]ChainBackend)
+	}
+	b.clients[network] = client
+	return client, nil
+}
+
+// connectDefault connects to the configured chain backend of the mount network
+func (b *btcBackend) connectDefault(ctx context.Context, s logical.Storage, config *btcConfig, addressNetwork string) (ChainBackend, error) {
 	network := "mainnet"
 	if config != nil && config.Network != "" {
 		network = config.Network
 	}
 
+	if config.backendType() == backendBitcoind {
+		b.Logger().Debug("connecting to bitcoind", "url", config.BitcoindURL, "wallet", config.BitcoindWallet, "network", network)
+		rpc, err := bitcoind.NewClient(config.bitcoindOptions())
+		if err != nil {
+			return nil, err
+		}
+
+		// Addresses imported on lookup may have history from any wallet
+		since, err := oldestWalletCreation(ctx, s, network)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Logger().Info("using bitcoind backend", "url", config.BitcoindURL, "network", network)
+		return newBitcoindBackend(rpc, since), nil
+	}
+
+	if config.backendType() == backendEsplora {
+		esploraURL := config.esploraURL(network)
+		if esploraURL == "" {
+			return nil, fmt.Errorf("no default Esplora API for network %q - please set esplora_url in config", network)
+		}
+		b.Logger().Debug("using Esplora API", "url", esploraURL, "network", network)
+		api, err := esplora.NewClient(esploraURL, config.esploraOptions())
+		if err != nil {
+			return nil, err
+		}
+
+		b.Logger().Info("using Esplora backend", "url", esploraURL, "network", network)
+		return newEsploraBackend(api), nil
+	}
+
+	var serverURL string
+	if config != nil {
+		serverURL = config.ElectrumURL
+	}
+	return b.connectElectrum(ctx, config, network, addressNetwork, serverURL)
+}
+
+// connectElectrum connects to serverURL, or to a random server from the pool
+// of network when serverURL is empty. Electrum looks up addresses by script
+// hash, which needs the address encoding of addressNetwork (including custom
+// signet parameters).
+func (b *btcBackend) connectElectrum(ctx context.Context, config *btcConfig, network, addressNetwork, serverURL string) (ChainBackend, error) {
+	opts := config.electrumOptions()
+	if network == "mainnet" {
+		// tls_skip_verify is only validated against the mount network
+		opts.TLSSkipVerify = false
+	}
+
 	// Determine which server(s) to try
-	if config != nil && config.ElectrumURL != "" {
+	if serverURL != "" {
 		// User explicitly configured a server - only try that one
-		serverURL := config.ElectrumURL
 		b.Logger().Debug("connecting to Electrum server", "url", serverURL, "network", network)
-		client, err := electrum.NewClient(serverURL)
+		client, err := electrum.NewClientWithOptions(ctx, serverURL, opts)
 		if err != nil {
 			b.Logger().Warn("failed to connect to Electrum server", "url", serverURL, "error", err)
 			return nil, err
 		}
 
 		b.Logger().Info("connected to Electrum server", "url", serverURL, "network", network)
-		b.client = client
-		return b.client, nil
+		return newElectrumBackend(client, addressNetwork), nil
 	}
 
 	// No explicit server - try servers from pool with failover
@@ -165,7 +286,7 @@ func (b *btcBackend) getClient(ctx context.Context, s logical.Storage) (*electru
 	var lastErr error
 	for _, serverURL := range servers {
 		b.Logger().Debug("trying Electrum server", "url", serverURL, "network", network)
-		client, err := electrum.NewClient(serverURL)
+		client, err := electrum.NewClientWithOptions(ctx, serverURL, opts)
 		if err != nil {
 			b.Logger().Warn("failed to connect to Electrum server, trying next", "url", serverURL, "error", err)
 			lastErr = err
@@ -173,8 +294,7 @@ func (b *btcBackend) getClient(ctx context.Context, s logical.Storage) (*electru
 		}
 
 		b.Logger().Info("connected to Electrum server", "url", serverURL, "network", network)
-		b.client = client
-		return b.client, nil
+		return newElectrumBackend(client, addressNetwork), nil
 	}
 
 	return nil, fmt.Errorf("failed to connect to any Electrum server: %w", lastErr)
@@ -188,24 +308,54 @@ Each wallet is an HD wallet with automatic address management. The engine
 supports:
 
   - Wallet creation and balance queries
+  - Multiple BIP44 accounts per wallet seed
   - Receiving with automatic address reuse prevention
   - Sending with fee estimation
   - PSBT (Partially Signed Bitcoin Transaction) for complex operations
   - UTXO management and consolidation
+  - Optional envelope encryption of seeds, wrapped by a Transit key
+  - Encrypted wallet backup and restore
+  - Soft-deleted wallets with a recovery window
+  - SLIP-39 Shamir shares of wallet seeds
+  - BIP322 and legacy message signing and verification
+  - BIP127 proof of reserves for auditors
+  - BIP352 silent payments, received and sent
+  - Lightning channel funding from withheld, input-locked transactions
 
-Configure the engine with an Electrum server URL and choose between mainnet,
-testnet4, or custom signet networks.
+Configure the engine with an Electrum server, a Bitcoin Core node, or an
+Esplora REST API and choose between mainnet, testnet4, custom signet, or
+local regtest networks.
 
 Endpoints:
+  btc/config                      - Chain backend and network
+  btc/config/seed-encryption      - Envelope encryption of wallet seeds
   btc/wallets                     - List/create/delete wallets
   btc/wallets/:name               - Wallet info, balance, and receive address
+  btc/wallets/:name/backup        - Export an age-encrypted wallet backup
+  btc/wallets/restore             - Import a wallet from an encrypted backup
+  btc/wallets/:name/undelete      - Restore a deleted wallet
+  btc/deleted-wallets             - List, inspect, or purge deleted wallets
+  btc/wallets/:name/accounts/:n   - BIP44 sub-accounts; wallet paths below also
+                                    accept an accounts/:n/ prefix
   btc/wallets/:name/addresses     - List/generate addresses
   btc/wallets/:name/utxos         - List all UTXOs
   btc/wallets/:name/qr            - QR code for receive address
   btc/wallets/:name/xpub          - Export extended public key for watch-only wallets
+  btc/wallets/:name/shares        - Split the seed into SLIP-39 shares, or recover it
+  btc/wallets/:name/sign-message  - Sign a message with an address key
+  btc/verify-message              - Verify a signed message for any address
+  btc/wallets/:name/proof-of-reserves
+                                  - Prove holdings with a BIP127 proof
+  btc/proof-of-reserves/verify    - Verify a proof of reserves
+  btc/wallets/:name/silent-payments
+                                  - Silent payment address, scan for payments
   btc/wallets/:name/send          - Send bitcoin
   btc/wallets/:name/estimate      - Estimate send fee
   btc/wallets/:name/consolidate   - Consolidate UTXOs
+  btc/wallets/:name/channel-funding
+                                  - Create or list pending channel fundings
+  btc/wallets/:name/channel-funding/:txid
+                                  - Read or cancel (delete) a pending funding
   btc/wallets/:name/compact       - Remove spent empty address records
   btc/wallets/:name/scan          - Scan retired addresses for errant funds
   btc/wallets/:name/psbt/*        - PSBT operations
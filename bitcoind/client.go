@@ -0,0 +1,430 @@
+package bitcoind
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+const (
+	// RequestTimeout is the default timeout for individual RPC calls
+	RequestTimeout = 30 * time.Second
+)
+
+// Client is a Bitcoin Core JSON-RPC client
+type Client struct {
+	url        string
+	user       string
+	password   string
+	wallet     string
+	httpClient *http.Client
+	id         atomic.Uint64
+}
+
+// Options holds connection settings for a Client
+type Options struct {
+	// URL is the RPC endpoint, e.g. http://127.0.0.1:8332
+	URL      string
+	User     string
+	Password string
+	// Wallet is the descriptor watch-only wallet used for address tracking.
+	// Empty means wallet-less operation using scantxoutset.
+	Wallet string
+	// RequestTimeout bounds a single RPC call (default: 30s)
+	RequestTimeout time.Duration
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// RPCError is an error returned by bitcoind
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("bitcoind error %d: %s", e.Code, e.Message)
+}
+
+// Unspent is an unspent output reported by listunspent or scantxoutset
+type Unspent struct {
+	TxID          string
+	Vout          int
+	Value         int64 // satoshis
+	Confirmations int64 // listunspent only
+	Height        int64 // scantxoutset only
+}
+
+// Received is a listreceivedbyaddress entry
+type Received struct {
+	Address string
+	TxIDs   []string
+}
+
+// NewClient creates a new Bitcoin Core RPC client
+func NewClient(opts Options) (*Client, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("bitcoind RPC URL is required")
+	}
+	if !strings.HasPrefix(opts.URL, "http://") && !strings.HasPrefix(opts.URL, "https://") {
+		return nil, fmt.Errorf("invalid bitcoind URL %q: must start with http:// or https://", opts.URL)
+	}
+
+	timeout := opts.RequestTimeout
+	if timeout <= 0 {
+		timeout = RequestTimeout
+	}
+
+	return &Client{
+		url:        strings.TrimSuffix(opts.URL, "/"),
+		user:       opts.User,
+		password:   opts.Password,
+		wallet:     opts.Wallet,
+		httpClient: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Wallet returns the configured watch-only wallet name (empty if none)
+func (c *Client) Wallet() string {
+	return c.wallet
+}
+
+// Close releases idle HTTP connections
+func (c *Client) Close() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// call performs a node-level RPC call
+func (c *Client) call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	return c.do(ctx, c.url, method, result, params...)
+}
+
+// walletCall performs an RPC call against the configured wallet endpoint
+func (c *Client) walletCall(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	if c.wallet == "" {
+		return fmt.Errorf("%s requires a bitcoind wallet", method)
+	}
+	return c.do(ctx, c.url+"/wallet/"+c.wallet, method, result, params...)
+}
+
+func (c *Client) do(ctx context.Context, endpoint, method string, result interface{}, params ...interface{}) error {
+	// Ensure params is never nil - bitcoind rejects null params
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	body, err := json.Marshal(rpcRequest{
+		JSONRPC: "1.0",
+		ID:      c.id.Add(1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.user != "" || c.password != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%s failed: bitcoind rejected RPC credentials", method)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", method, err)
+	}
+
+	// bitcoind returns HTTP 404/500 with a JSON body for RPC-level errors
+	var rpcResp rpcResponse
+	if err := json.Unmarshal(respBody, &rpcResp); err != nil {
+		return fmt.Errorf("%s failed: HTTP %d: %s", method, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if rpcResp.Error != nil {
+		return rpcResp.Error
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(rpcResp.Result, result); err != nil {
+		return fmt.Errorf("failed to parse %s result: %w", method, err)
+	}
+	return nil
+}
+
+// GetBlockCount returns the height of the most-work chain tip
+func (c *Client) GetBlockCount(ctx context.Context) (int64, error) {
+	var height int64
+	if err := c.call(ctx, "getblockcount", &height); err != nil {
+		return 0, err
+	}
+	return height, nil
+}
+
+// GetBlockHash returns the hash of the block at a height on the active chain
+func (c *Client) GetBlockHash(ctx context.Context, height int64) (string, error) {
+	var hash string
+	if err := c.call(ctx, "getblockhash", &hash, height); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// GetBlockTxIDs returns the txids of a block in block order
+func (c *Client) GetBlockTxIDs(ctx context.Context, hash string) ([]string, error) {
+	var block struct {
+		Tx []string `json:"tx"`
+	}
+	if err := c.call(ctx, "getblock", &block, hash, 1); err != nil {
+		return nil, err
+	}
+	return block.Tx, nil
+}
+
+// GetRawTransaction returns a transaction as hex.
+// Without -txindex this only finds mempool transactions, so wallet
+// transactions fall back to gettransaction.
+func (c *Client) GetRawTransaction(ctx context.Context, txid string) (string, error) {
+	var rawtx string
+	err := c.call(ctx, "getrawtransaction", &rawtx, txid)
+	if err == nil {
+		return rawtx, nil
+	}
+	if c.wallet == "" {
+		return "", err
+	}
+
+	var walletTx struct {
+		Hex string `json:"hex"`
+	}
+	if walletErr := c.walletCall(ctx, "gettransaction", &walletTx, txid, true); walletErr != nil {
+		return "", err
+	}
+	return walletTx.Hex, nil
+}
+
+// GetTransactionHeight returns the block height of a wallet transaction, or 0 if unconfirmed
+func (c *Client) GetTransactionHeight(ctx context.Context, txid string) (int64, error) {
+	var walletTx struct {
+		BlockHeight int64 `json:"blockheight"`
+	}
+	if err := c.walletCall(ctx, "gettransaction", &walletTx, txid, true); err != nil {
+		return 0, err
+	}
+	return walletTx.BlockHeight, nil
+}
+
+// SendRawTransaction broadcasts a raw transaction and returns its txid
+func (c *Client) SendRawTransaction(ctx context.Context, rawtx string) (string, error) {
+	var txid string
+	if err := c.call(ctx, "sendrawtransaction", &txid, rawtx); err != nil {
+		return "", err
+	}
+	return txid, nil
+}
+
+// EstimateSmartFee returns the estimated fee rate in BTC/kvB, or -1 if
+// the node has no estimate yet (matching Electrum's estimatefee)
+func (c *Client) EstimateSmartFee(ctx context.Context, blocks int) (float64, error) {
+	var result struct {
+		FeeRate *float64 `json:"feerate"`
+		Errors  []string `json:"errors"`
+	}
+	if err := c.call(ctx, "estimatesmartfee", &result, blocks); err != nil {
+		return 0, err
+	}
+	if result.FeeRate == nil {
+		return -1, nil
+	}
+	return *result.FeeRate, nil
+}
+
+// GetDescriptorInfo returns the checksummed form of a descriptor
+func (c *Client) GetDescriptorInfo(ctx context.Context, descriptor string) (string, error) {
+	var result struct {
+		Descriptor string `json:"descriptor"`
+	}
+	if err := c.call(ctx, "getdescriptorinfo", &result, descriptor); err != nil {
+		return "", err
+	}
+	return result.Descriptor, nil
+}
+
+// IsWatched reports whether the wallet already tracks an address
+func (c *Client) IsWatched(ctx context.Context, address string) (bool, error) {
+	var result struct {
+		IsMine      bool `json:"ismine"`
+		IsWatchOnly bool `json:"iswatchonly"`
+	}
+	if err := c.walletCall(ctx, "getaddressinfo", &result, address); err != nil {
+		return false, err
+	}
+	return result.IsMine || result.IsWatchOnly, nil
+}
+
+// ImportAddress imports an addr() descriptor into the watch-only wallet.
+// The timestamp "now" skips a rescan, so only activity after import is seen;
+// use ImportAddresses for addresses that may already have history.
+func (c *Client) ImportAddress(ctx context.Context, address, label string) error {
+	return c.ImportAddresses(ctx, []string{address}, label, time.Time{})
+}
+
+// ImportAddresses imports addr() descriptors into the watch-only wallet in a
+// single call. bitcoind rescans the blocks since the given time (less its
+// two-hour timestamp window) so earlier outputs are found, and the call does
+// not return until the rescan ends. A zero time imports as of now, without a
+// rescan.
+func (c *Client) ImportAddresses(ctx context.Context, addresses []string, label string, since time.Time) error {
+	var timestamp interface{} = "now"
+	if !since.IsZero() {
+		timestamp = since.Unix()
+	}
+
+	request := make([]map[string]interface{}, 0, len(addresses))
+	for _, address := range addresses {
+		descriptor, err := c.GetDescriptorInfo(ctx, "addr("+address+")")
+		if err != nil {
+			return err
+		}
+		request = append(request, map[string]interface{}{
+			"desc":      descriptor,
+			"timestamp": timestamp,
+			"label":     label,
+		})
+	}
+
+	var results []struct {
+		Success bool      `json:"success"`
+		Error   *RPCError `json:"error"`
+	}
+	if err := c.walletCall(ctx, "importdescriptors", &results, request); err != nil {
+		return err
+	}
+	if len(results) != len(addresses) {
+		return fmt.Errorf("importdescriptors returned %d results for %d addresses", len(results), len(addresses))
+	}
+	for i, result := range results {
+		if result.Success {
+			continue
+		}
+		if result.Error != nil {
+			return fmt.Errorf("%s: %w", addresses[i], result.Error)
+		}
+		return fmt.Errorf("importdescriptors failed for %s", addresses[i])
+	}
+	return nil
+}
+
+// ListUnspent returns the wallet's unspent outputs (including mempool) for an address
+func (c *Client) ListUnspent(ctx context.Context, address string) ([]Unspent, error) {
+	var results []struct {
+		TxID          string  `json:"txid"`
+		Vout          int     `json:"vout"`
+		Amount        float64 `json:"amount"`
+		Confirmations int64   `json:"confirmations"`
+	}
+	if err := c.walletCall(ctx, "listunspent", &results, 0, 9999999, []string{address}, true); err != nil {
+		return nil, err
+	}
+
+	unspent := make([]Unspent, 0, len(results))
+	for _, r := range results {
+		value, err := btcutil.NewAmount(r.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount for %s:%d: %w", r.TxID, r.Vout, err)
+		}
+		unspent = append(unspent, Unspent{
+			TxID:          r.TxID,
+			Vout:          r.Vout,
+			Value:         int64(value),
+			Confirmations: r.Confirmations,
+		})
+	}
+	return unspent, nil
+}
+
+// ListReceivedByAddress returns the txids that paid to an address
+func (c *Client) ListReceivedByAddress(ctx context.Context, address string) (*Received, error) {
+	var results []struct {
+		Address string   `json:"address"`
+		TxIDs   []string `json:"txids"`
+	}
+	if err := c.walletCall(ctx, "listreceivedbyaddress", &results, 0, true, true, address); err != nil {
+		return nil, err
+	}
+
+	for _, r := range results {
+		if r.Address == address {
+			return &Received{Address: r.Address, TxIDs: r.TxIDs}, nil
+		}
+	}
+	return &Received{Address: address}, nil
+}
+
+// ScanTxOutSet scans the UTXO set for outputs paying to an address.
+// This needs no wallet but only sees confirmed outputs: mempool payments are
+// missing, and outputs spent by a mempool transaction are still reported.
+// Each scan walks the full UTXO set.
+func (c *Client) ScanTxOutSet(ctx context.Context, address string) ([]Unspent, error) {
+	var result struct {
+		Success  bool `json:"success"`
+		Unspents []struct {
+			TxID   string  `json:"txid"`
+			Vout   int     `json:"vout"`
+			Amount float64 `json:"amount"`
+			Height int64   `json:"height"`
+		} `json:"unspents"`
+	}
+	if err := c.call(ctx, "scantxoutset", &result, "start", []string{"addr(" + address + ")"}); err != nil {
+		return nil, err
+	}
+	if !result.Success {
+		return nil, fmt.Errorf("scantxoutset did not complete")
+	}
+
+	unspent := make([]Unspent, 0, len(result.Unspents))
+	for _, r := range result.Unspents {
+		value, err := btcutil.NewAmount(r.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount for %s:%d: %w", r.TxID, r.Vout, err)
+		}
+		unspent = append(unspent, Unspent{
+			TxID:   r.TxID,
+			Vout:   r.Vout,
+			Value:  int64(value),
+			Height: r.Height,
+		})
+	}
+	return unspent, nil
+}
@@ -0,0 +1,485 @@
+package bitcoind
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAddress = "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080"
+
+// rpcHandler answers one RPC method: a result to encode, or an RPC error
+type rpcHandler func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError)
+
+// testRequest is a request seen by the test server
+type testRequest struct {
+	Path   string
+	Method string
+	Params []json.RawMessage
+}
+
+// newTestServer returns an in-process bitcoind stand-in that dispatches on
+// the RPC method and records every request
+func newTestServer(t *testing.T, wallet string, handlers map[string]rpcHandler) (*Client, *[]testRequest) {
+	t.Helper()
+
+	var requests []testRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "rpcuser" || pass != "rpcpass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			ID     uint64            `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, testRequest{Path: r.URL.Path, Method: req.Method, Params: req.Params})
+
+		resp := map[string]interface{}{"id": req.ID, "result": nil, "error": nil}
+		handler, ok := handlers[req.Method]
+		if !ok {
+			// bitcoind answers unknown methods with HTTP 404 and a JSON error
+			w.WriteHeader(http.StatusNotFound)
+			resp["error"] = &RPCError{Code: -32601, Message: "Method not found"}
+		} else if result, rpcErr := handler(t, req.Params); rpcErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			resp["error"] = rpcErr
+		} else {
+			resp["result"] = result
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(Options{URL: srv.URL, User: "rpcuser", Password: "rpcpass", Wallet: wallet})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client, &requests
+}
+
+// param decodes a request parameter
+func param(t *testing.T, params []json.RawMessage, i int, v interface{}) {
+	t.Helper()
+	if i >= len(params) {
+		t.Fatalf("missing param %d in %d params", i, len(params))
+	}
+	if err := json.Unmarshal(params[i], v); err != nil {
+		t.Fatalf("param %d: %v", i, err)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{"http", "http://127.0.0.1:8332", false},
+		{"https trailing slash", "https://node.example.com/", false},
+		{"missing scheme", "127.0.0.1:8332", true},
+		{"tcp scheme", "tcp://127.0.0.1:8332", true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(Options{URL: tt.url})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClient(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	client, _ := newTestServer(t, "", map[string]rpcHandler{
+		"getblockcount": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			return 812345, nil
+		},
+	})
+
+	height, err := client.GetBlockCount(context.Background())
+	if err != nil {
+		t.Fatalf("GetBlockCount() error = %v", err)
+	}
+	if height != 812345 {
+		t.Errorf("GetBlockCount() = %d, want 812345", height)
+	}
+
+	client.password = "wrong"
+	_, err = client.GetBlockCount(context.Background())
+	if err == nil {
+		t.Fatal("GetBlockCount() should fail with bad credentials")
+	}
+	if !strings.Contains(err.Error(), "rejected RPC credentials") {
+		t.Errorf("GetBlockCount() error = %v, want a credentials error", err)
+	}
+}
+
+func TestRPCErrors(t *testing.T) {
+	client, _ := newTestServer(t, "", map[string]rpcHandler{
+		"sendrawtransaction": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			return nil, &RPCError{Code: -26, Message: "min relay fee not met"}
+		},
+	})
+
+	_, err := client.SendRawTransaction(context.Background(), "0200000001")
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("SendRawTransaction() error = %v, want *RPCError", err)
+	}
+	if rpcErr.Code != -26 || rpcErr.Message != "min relay fee not met" {
+		t.Errorf("SendRawTransaction() error = %+v", rpcErr)
+	}
+
+	// Unknown methods come back as HTTP 404 with a JSON error body
+	_, err = client.GetBlockHash(context.Background(), 1)
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32601 {
+		t.Errorf("GetBlockHash() error = %v, want method not found", err)
+	}
+}
+
+func TestNonJSONError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Work queue depth exceeded", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(Options{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	_, err = client.GetBlockCount(context.Background())
+	if err == nil {
+		t.Fatal("GetBlockCount() should fail on HTTP 503")
+	}
+	if !strings.Contains(err.Error(), "HTTP 503") || !strings.Contains(err.Error(), "Work queue depth exceeded") {
+		t.Errorf("GetBlockCount() error = %v, want status and body", err)
+	}
+}
+
+func TestWalletCalls(t *testing.T) {
+	client, requests := newTestServer(t, "watch", map[string]rpcHandler{
+		"getaddressinfo": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			return map[string]interface{}{"ismine": false, "iswatchonly": true}, nil
+		},
+	})
+
+	watched, err := client.IsWatched(context.Background(), testAddress)
+	if err != nil {
+		t.Fatalf("IsWatched() error = %v", err)
+	}
+	if !watched {
+		t.Error("IsWatched() = false, want true")
+	}
+	if got := (*requests)[0].Path; got != "/wallet/watch" {
+		t.Errorf("wallet call sent to %q, want /wallet/watch", got)
+	}
+
+	noWallet, _ := newTestServer(t, "", nil)
+	if _, err := noWallet.IsWatched(context.Background(), testAddress); err == nil {
+		t.Error("IsWatched() should fail without a wallet")
+	}
+}
+
+func TestListUnspent(t *testing.T) {
+	client, _ := newTestServer(t, "watch", map[string]rpcHandler{
+		"listunspent": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			var minconf int
+			var addresses []string
+			param(t, params, 0, &minconf)
+			param(t, params, 2, &addresses)
+			if minconf != 0 {
+				t.Errorf("listunspent minconf = %d, want 0 to include the mempool", minconf)
+			}
+			if len(addresses) != 1 || addresses[0] != testAddress {
+				t.Errorf("listunspent addresses = %v", addresses)
+			}
+			return json.RawMessage(`[
+				{"txid":"aa","vout":1,"amount":0.0015,"confirmations":3},
+				{"txid":"bb","vout":0,"amount":0.00002,"confirmations":0}
+			]`), nil
+		},
+	})
+
+	utxos, err := client.ListUnspent(context.Background(), testAddress)
+	if err != nil {
+		t.Fatalf("ListUnspent() error = %v", err)
+	}
+
+	if len(utxos) != 2 {
+		t.Fatalf("ListUnspent() returned %d UTXOs, want 2", len(utxos))
+	}
+	if utxos[0].TxID != "aa" || utxos[0].Vout != 1 || utxos[0].Value != 150000 || utxos[0].Confirmations != 3 {
+		t.Errorf("utxos[0] = %+v", utxos[0])
+	}
+	if utxos[1].Value != 2000 || utxos[1].Confirmations != 0 {
+		t.Errorf("utxos[1] = %+v", utxos[1])
+	}
+}
+
+func TestListReceivedByAddress(t *testing.T) {
+	client, _ := newTestServer(t, "watch", map[string]rpcHandler{
+		"listreceivedbyaddress": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			var filter string
+			param(t, params, 3, &filter)
+			if filter != testAddress {
+				return []interface{}{}, nil
+			}
+			return json.RawMessage(`[{"address":"` + testAddress + `","amount":0.001,"txids":["aa","bb"]}]`), nil
+		},
+	})
+
+	received, err := client.ListReceivedByAddress(context.Background(), testAddress)
+	if err != nil {
+		t.Fatalf("ListReceivedByAddress() error = %v", err)
+	}
+	if len(received.TxIDs) != 2 || received.TxIDs[0] != "aa" || received.TxIDs[1] != "bb" {
+		t.Errorf("ListReceivedByAddress() txids = %v, want [aa bb]", received.TxIDs)
+	}
+
+	// An address with nothing received is omitted by bitcoind
+	received, err = client.ListReceivedByAddress(context.Background(), "bcrt1qother")
+	if err != nil {
+		t.Fatalf("ListReceivedByAddress() error = %v", err)
+	}
+	if received.Address != "bcrt1qother" || len(received.TxIDs) != 0 {
+		t.Errorf("ListReceivedByAddress() = %+v, want no txids", received)
+	}
+}
+
+func TestScanTxOutSet(t *testing.T) {
+	complete := true
+	client, _ := newTestServer(t, "", map[string]rpcHandler{
+		"scantxoutset": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			var action string
+			var descriptors []string
+			param(t, params, 0, &action)
+			param(t, params, 1, &descriptors)
+			if action != "start" || len(descriptors) != 1 || descriptors[0] != "addr("+testAddress+")" {
+				t.Errorf("scantxoutset params = %s %v", action, descriptors)
+			}
+			return map[string]interface{}{
+				"success": complete,
+				"unspents": []map[string]interface{}{
+					{"txid": "cc", "vout": 2, "amount": 0.5, "height": 120},
+				},
+			}, nil
+		},
+	})
+
+	utxos, err := client.ScanTxOutSet(context.Background(), testAddress)
+	if err != nil {
+		t.Fatalf("ScanTxOutSet() error = %v", err)
+	}
+	if len(utxos) != 1 || utxos[0].TxID != "cc" || utxos[0].Vout != 2 || utxos[0].Value != 50000000 || utxos[0].Height != 120 {
+		t.Errorf("ScanTxOutSet() = %+v", utxos)
+	}
+
+	complete = false
+	if _, err := client.ScanTxOutSet(context.Background(), testAddress); err == nil {
+		t.Error("ScanTxOutSet() should fail when the scan did not complete")
+	}
+}
+
+func TestGetBlockTxIDs(t *testing.T) {
+	const hash = "0000000000000000000212f0a6cf8a5eb0b9e9d4c3b3e7b0d1a1c1f1e1d1c1b1"
+	client, _ := newTestServer(t, "", map[string]rpcHandler{
+		"getblockhash": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			var height int64
+			param(t, params, 0, &height)
+			if height != 840000 {
+				return nil, &RPCError{Code: -8, Message: "Block height out of range"}
+			}
+			return hash, nil
+		},
+		"getblock": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			var verbosity int
+			param(t, params, 1, &verbosity)
+			if verbosity != 1 {
+				t.Errorf("getblock verbosity = %d, want 1", verbosity)
+			}
+			return map[string]interface{}{"hash": hash, "tx": []string{"aa", "bb"}}, nil
+		},
+	})
+
+	got, err := client.GetBlockHash(context.Background(), 840000)
+	if err != nil {
+		t.Fatalf("GetBlockHash() error = %v", err)
+	}
+	if got != hash {
+		t.Errorf("GetBlockHash() = %q, want %q", got, hash)
+	}
+
+	txids, err := client.GetBlockTxIDs(context.Background(), hash)
+	if err != nil {
+		t.Fatalf("GetBlockTxIDs() error = %v", err)
+	}
+	if len(txids) != 2 || txids[0] != "aa" || txids[1] != "bb" {
+		t.Errorf("GetBlockTxIDs() = %v, want [aa bb]", txids)
+	}
+
+	if _, err := client.GetBlockHash(context.Background(), 900000); err == nil {
+		t.Error("GetBlockHash() beyond the tip succeeded")
+	}
+}
+
+func TestImportAddresses(t *testing.T) {
+	const other = "bcrt1qother"
+	var imported []map[string]interface{}
+	failFor := ""
+	client, requests := newTestServer(t, "watch", map[string]rpcHandler{
+		"getdescriptorinfo": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			var desc string
+			param(t, params, 0, &desc)
+			return map[string]interface{}{"descriptor": desc + "#checksum"}, nil
+		},
+		"importdescriptors": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			param(t, params, 0, &imported)
+			results := make([]map[string]interface{}, len(imported))
+			for i, req := range imported {
+				results[i] = map[string]interface{}{"success": true}
+				if req["desc"] == "addr("+failFor+")#checksum" {
+					results[i] = map[string]interface{}{
+						"success": false,
+						"error":   map[string]interface{}{"code": -5, "message": "Invalid address"},
+					}
+				}
+			}
+			return results, nil
+		},
+	})
+
+	created := time.Unix(1700000000, 0)
+	if err := client.ImportAddresses(context.Background(), []string{testAddress, other}, "vault", created); err != nil {
+		t.Fatalf("ImportAddresses() error = %v", err)
+	}
+	if len(imported) != 2 {
+		t.Fatalf("importdescriptors got %d descriptors, want 2", len(imported))
+	}
+	if imported[0]["desc"] != "addr("+testAddress+")#checksum" || imported[0]["label"] != "vault" {
+		t.Errorf("imported[0] = %v", imported[0])
+	}
+	if ts, ok := imported[1]["timestamp"].(float64); !ok || int64(ts) != created.Unix() {
+		t.Errorf("imported[1] timestamp = %v, want %d", imported[1]["timestamp"], created.Unix())
+	}
+	// One importdescriptors call for all addresses, sent to the wallet
+	var imports int
+	for _, r := range *requests {
+		if r.Method == "importdescriptors" {
+			imports++
+			if r.Path != "/wallet/watch" {
+				t.Errorf("importdescriptors sent to %q", r.Path)
+			}
+		}
+	}
+	if imports != 1 {
+		t.Errorf("importdescriptors called %d times, want 1", imports)
+	}
+
+	// A single import starts from now and skips the rescan
+	if err := client.ImportAddress(context.Background(), testAddress, "vault"); err != nil {
+		t.Fatalf("ImportAddress() error = %v", err)
+	}
+	if imported[0]["timestamp"] != "now" {
+		t.Errorf("ImportAddress() timestamp = %v, want now", imported[0]["timestamp"])
+	}
+
+	failFor = other
+	err := client.ImportAddresses(context.Background(), []string{testAddress, other}, "vault", created)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -5 {
+		t.Fatalf("ImportAddresses() error = %v, want the per-descriptor error", err)
+	}
+	if !strings.Contains(err.Error(), other) {
+		t.Errorf("ImportAddresses() error = %v, want the failing address", err)
+	}
+}
+
+func TestEstimateSmartFee(t *testing.T) {
+	var feerate interface{}
+	client, _ := newTestServer(t, "", map[string]rpcHandler{
+		"estimatesmartfee": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			if feerate == nil {
+				return map[string]interface{}{"errors": []string{"Insufficient data or no feerate found"}, "blocks": 2}, nil
+			}
+			return map[string]interface{}{"feerate": feerate, "blocks": 6}, nil
+		},
+	})
+
+	got, err := client.EstimateSmartFee(context.Background(), 6)
+	if err != nil {
+		t.Fatalf("EstimateSmartFee() error = %v", err)
+	}
+	if got != -1 {
+		t.Errorf("EstimateSmartFee() without an estimate = %v, want -1", got)
+	}
+
+	feerate = 0.00012
+	got, err = client.EstimateSmartFee(context.Background(), 6)
+	if err != nil {
+		t.Fatalf("EstimateSmartFee() error = %v", err)
+	}
+	if got != 0.00012 {
+		t.Errorf("EstimateSmartFee() = %v, want 0.00012", got)
+	}
+}
+
+func TestGetRawTransactionWalletFallback(t *testing.T) {
+	client, _ := newTestServer(t, "watch", map[string]rpcHandler{
+		"getrawtransaction": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			return nil, &RPCError{Code: -5, Message: "No such mempool transaction. Use -txindex"}
+		},
+		"gettransaction": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			var txid string
+			param(t, params, 0, &txid)
+			if txid != "aa" {
+				return nil, &RPCError{Code: -5, Message: "Invalid or non-wallet transaction id"}
+			}
+			return map[string]interface{}{"hex": "0200000001", "blockheight": 101}, nil
+		},
+	})
+
+	rawtx, err := client.GetRawTransaction(context.Background(), "aa")
+	if err != nil {
+		t.Fatalf("GetRawTransaction() error = %v", err)
+	}
+	if rawtx != "0200000001" {
+		t.Errorf("GetRawTransaction() = %q, want the wallet copy", rawtx)
+	}
+
+	// The node error is reported when the wallet does not know the tx either
+	_, err = client.GetRawTransaction(context.Background(), "bb")
+	if err == nil || !strings.Contains(err.Error(), "-txindex") {
+		t.Errorf("GetRawTransaction() error = %v, want the getrawtransaction error", err)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	client, _ := newTestServer(t, "", map[string]rpcHandler{
+		"getblockcount": func(t *testing.T, params []json.RawMessage) (interface{}, *RPCError) {
+			return 1, nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := client.GetBlockCount(ctx); err == nil {
+		t.Error("GetBlockCount() should fail with a cancelled context")
+	}
+}
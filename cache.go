@@ -9,6 +9,11 @@ const (
 	// MaxCacheAge is the maximum age before we force a status check
 	// This is a safety net - normally we rely on status hash validation
 	MaxCacheAge = 5 * time.Minute
+
+	// PersistedCacheMaxAge is the maximum age of an entry restored from
+	// storage. Restored entries are still validated by status hash; the longer
+	// window lets them survive plugin restarts and standby promotion.
+	PersistedCacheMaxAge = 24 * time.Hour
 )
 
 // AddressCache holds cached data for a single address
@@ -18,6 +23,7 @@ type AddressCache struct {
 	History     []TxHistoryItem
 	UTXOs       []CachedUTXO
 	LastUpdated time.Time
+	Restored    bool // loaded from persistent storage rather than fetched by this process
 }
 
 // BalanceInfo holds balance data for an address
@@ -46,6 +52,8 @@ type WalletCache struct {
 	BlockHeight int64                    // cached block height for confirmations
 	HeightTime  time.Time                // when block height was fetched
 	LastUpdated time.Time
+	loaded      bool // persisted snapshot has been loaded (or persistence is off)
+	dirty       bool // changed since the last persisted snapshot
 	mu          sync.RWMutex
 }
 
@@ -117,7 +125,11 @@ func (c *WalletCache) GetAddressCacheIfValid(address string, currentStatus *stri
 	}
 
 	// Safety check: don't use cache older than MaxCacheAge regardless of status
-	if time.Since(addrCache.LastUpdated) > MaxCacheAge {
+	maxAge := MaxCacheAge
+	if addrCache.Restored {
+		maxAge = PersistedCacheMaxAge
+	}
+	if time.Since(addrCache.LastUpdated) > maxAge {
 		return nil
 	}
 
@@ -142,6 +154,7 @@ func (c *WalletCache) SetAddressCache(address string, status *string, balance Ba
 		LastUpdated: time.Now(),
 	}
 	c.LastUpdated = time.Now()
+	c.dirty = true
 }
 
 // InvalidateAddress removes a single address from cache
@@ -149,6 +162,7 @@ func (c *WalletCache) InvalidateAddress(address string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	delete(c.Addresses, address)
+	c.dirty = true
 }
 
 // GetBlockHeight returns cached block height if recent, 0 otherwise
@@ -177,3 +191,16 @@ func (c *WalletCache) GetAddressCount() int {
 	defer c.mu.RUnlock()
 	return len(c.Addresses)
 }
+
+// TotalBalance returns the sum of the cached balances of all addresses
+func (c *WalletCache) TotalBalance() BalanceInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var total BalanceInfo
+	for _, addrCache := range c.Addresses {
+		total.Confirmed += addrCache.Balance.Confirmed
+		total.Unconfirmed += addrCache.Balance.Unconfirmed
+	}
+	return total
+}
@@ -0,0 +1,174 @@
+package btc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// cacheStoragePrefix holds persisted wallet cache snapshots. It contains only
+// public chain data, so it is neither seal-wrapped nor replicated.
+const cacheStoragePrefix = "cache/"
+
+// persistedAddressCache is the storage form of AddressCache
+type persistedAddressCache struct {
+	StatusHash  *string         `json:"status_hash"`
+	Confirmed   int64           `json:"confirmed"`
+	Unconfirmed int64           `json:"unconfirmed"`
+	History     []TxHistoryItem `json:"history,omitempty"`
+	UTXOs       []CachedUTXO    `json:"utxos,omitempty"`
+	LastUpdated time.Time       `json:"last_updated"`
+}
+
+// persistedWalletCache is the storage form of a WalletCache snapshot
+type persistedWalletCache struct {
+	Addresses map[string]*persistedAddressCache `json:"addresses"`
+}
+
+// cachePersistenceEnabled reports whether persist_cache is set in config
+func cachePersistenceEnabled(ctx context.Context, s logical.Storage) bool {
+	config, err := getConfig(ctx, s)
+	if err != nil || config == nil {
+		return false
+	}
+	return config.PersistCache
+}
+
+// getWalletCache returns the in-memory cache for a wallet, loading the
+// persisted snapshot on first access when persist_cache is enabled
+func (b *btcBackend) getWalletCache(ctx context.Context, s logical.Storage, walletName string) *WalletCache {
+	cache := b.cache.GetWalletCache(walletName)
+
+	cache.mu.RLock()
+	loaded := cache.loaded
+	cache.mu.RUnlock()
+	if loaded {
+		return cache
+	}
+
+	var snapshot *persistedWalletCache
+	if cachePersistenceEnabled(ctx, s) {
+		var err error
+		snapshot, err = loadWalletCache(ctx, s, walletName)
+		if err != nil {
+			// The cache is an optimization - fall back to fetching from the chain backend
+			b.Logger().Warn("failed to load persisted cache", "wallet", walletName, "error", err)
+		}
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.loaded {
+		return cache
+	}
+	cache.loaded = true
+
+	if snapshot != nil {
+		restored := 0
+		for address, entry := range snapshot.Addresses {
+			// Entries fetched by this process take precedence over the snapshot
+			if _, exists := cache.Addresses[address]; exists || entry == nil {
+				continue
+			}
+			cache.Addresses[address] = &AddressCache{
+				StatusHash:  entry.StatusHash,
+				Balance:     BalanceInfo{Confirmed: entry.Confirmed, Unconfirmed: entry.Unconfirmed},
+				History:     entry.History,
+				UTXOs:       entry.UTXOs,
+				LastUpdated: entry.LastUpdated,
+				Restored:    true,
+			}
+			restored++
+		}
+		b.Logger().Debug("restored persisted cache", "wallet", walletName, "addresses", restored)
+	}
+
+	return cache
+}
+
+// saveWalletCache writes the wallet cache to storage if it changed and
+// persist_cache is enabled. Failures are logged, not returned: nodes that
+// cannot write storage (performance standbys) simply skip persistence.
+func (b *btcBackend) saveWalletCache(ctx context.Context, s logical.Storage, walletName string, cache *WalletCache) {
+	if !cachePersistenceEnabled(ctx, s) {
+		return
+	}
+
+	cache.mu.Lock()
+	if !cache.dirty {
+		cache.mu.Unlock()
+		return
+	}
+	snapshot := &persistedWalletCache{
+		Addresses: make(map[string]*persistedAddressCache, len(cache.Addresses)),
+	}
+	for address, entry := range cache.Addresses {
+		snapshot.Addresses[address] = &persistedAddressCache{
+			StatusHash:  entry.StatusHash,
+			Confirmed:   entry.Balance.Confirmed,
+			Unconfirmed: entry.Balance.Unconfirmed,
+			History:     entry.History,
+			UTXOs:       entry.UTXOs,
+			LastUpdated: entry.LastUpdated,
+		}
+	}
+	cache.dirty = false
+	cache.mu.Unlock()
+
+	entry, err := logical.StorageEntryJSON(cacheStoragePrefix+walletName, snapshot)
+	if err != nil {
+		b.Logger().Warn("failed to encode persisted cache", "wallet", walletName, "error", err)
+		return
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		b.Logger().Debug("failed to persist cache", "wallet", walletName, "error", err)
+		cache.mu.Lock()
+		cache.dirty = true
+		cache.mu.Unlock()
+	}
+}
+
+// invalidateWalletCache clears both the in-memory and persisted cache for a wallet
+func (b *btcBackend) invalidateWalletCache(ctx context.Context, s logical.Storage, walletName string) {
+	b.cache.InvalidateWallet(walletName)
+	if err := s.Delete(ctx, cacheStoragePrefix+walletName); err != nil {
+		b.Logger().Warn("failed to delete persisted cache", "wallet", walletName, "error", err)
+	}
+}
+
+// loadWalletCache reads a persisted wallet cache snapshot, or nil if none exists
+func loadWalletCache(ctx context.Context, s logical.Storage, walletName string) (*persistedWalletCache, error) {
+	entry, err := s.Get(ctx, cacheStoragePrefix+walletName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cache: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	snapshot := new(persistedWalletCache)
+	if err := entry.DecodeJSON(snapshot); err != nil {
+		return nil, fmt.Errorf("error decoding cache: %w", err)
+	}
+	return snapshot, nil
+}
+
+// purgePersistedCaches deletes every persisted wallet cache snapshot
+func purgePersistedCaches(ctx context.Context, s logical.Storage) error {
+	entries, err := s.List(ctx, cacheStoragePrefix)
+	if err != nil {
+		return fmt.Errorf("error listing caches: %w", err)
+	}
+	for _, walletName := range entries {
+		if strings.HasSuffix(walletName, "/") {
+			continue
+		}
+		if err := s.Delete(ctx, cacheStoragePrefix+walletName); err != nil {
+			return fmt.Errorf("error deleting cache for %q: %w", walletName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package btc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// newCacheTestBackend returns a backend over in-memory storage with
+// persist_cache set as given
+func newCacheTestBackend(t *testing.T, persist bool) (*btcBackend, logical.Storage) {
+	t.Helper()
+
+	ctx := context.Background()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b := backend()
+	if err := b.Setup(ctx, config); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+
+	entry, err := logical.StorageEntryJSON(configStoragePath, &btcConfig{Network: "regtest", PersistCache: persist})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.StorageView.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+// restart drops in-memory state, as a plugin restart or standby promotion would
+func (b *btcBackend) restart() {
+	b.cache = NewWalletCacheManager()
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestPersistedCacheRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	b, s := newCacheTestBackend(t, true)
+
+	cache := b.getWalletCache(ctx, s, "hot")
+	cache.SetAddressCache("addr1", strPtr("status1"), BalanceInfo{Confirmed: 5000, Unconfirmed: 200},
+		[]TxHistoryItem{{TxHash: "aa", Height: 100}},
+		[]CachedUTXO{{TxID: "aa", Vout: 1, Value: 5000, Height: 100}})
+	cache.SetAddressCache("addr2", nil, BalanceInfo{}, nil, nil)
+	b.saveWalletCache(ctx, s, "hot", cache)
+
+	b.restart()
+	restored := b.getWalletCache(ctx, s, "hot")
+	if got := restored.GetAddressCount(); got != 2 {
+		t.Fatalf("restored %d addresses, want 2", got)
+	}
+
+	entry := restored.GetAddressCacheIfValid("addr1", strPtr("status1"))
+	if entry == nil {
+		t.Fatal("restored entry not valid for its own status")
+	}
+	if !entry.Restored {
+		t.Error("restored entry not marked Restored")
+	}
+	if entry.Balance.Confirmed != 5000 || entry.Balance.Unconfirmed != 200 {
+		t.Errorf("restored balance = %+v", entry.Balance)
+	}
+	if len(entry.History) != 1 || entry.History[0].TxHash != "aa" || entry.History[0].Height != 100 {
+		t.Errorf("restored history = %+v", entry.History)
+	}
+	if len(entry.UTXOs) != 1 || entry.UTXOs[0].Vout != 1 || entry.UTXOs[0].Value != 5000 {
+		t.Errorf("restored UTXOs = %+v", entry.UTXOs)
+	}
+
+	// An address without history round-trips its nil status
+	if restored.GetAddressCacheIfValid("addr2", nil) == nil {
+		t.Error("restored entry without history not valid for a nil status")
+	}
+
+	// Unchanged caches are not written again
+	if err := s.Delete(ctx, cacheStoragePrefix+"hot"); err != nil {
+		t.Fatal(err)
+	}
+	b.saveWalletCache(ctx, s, "hot", restored)
+	if snapshot, _ := loadWalletCache(ctx, s, "hot"); snapshot != nil {
+		t.Error("a cache restored without changes was persisted again")
+	}
+}
+
+func TestPersistedCacheDisabled(t *testing.T) {
+	ctx := context.Background()
+	b, s := newCacheTestBackend(t, false)
+
+	cache := b.getWalletCache(ctx, s, "hot")
+	cache.SetAddressCache("addr1", strPtr("status1"), BalanceInfo{Confirmed: 5000}, nil, nil)
+	b.saveWalletCache(ctx, s, "hot", cache)
+
+	if snapshot, err := loadWalletCache(ctx, s, "hot"); err != nil || snapshot != nil {
+		t.Errorf("loadWalletCache() = %v, %v, want nothing persisted", snapshot, err)
+	}
+}
+
+func TestPersistedCacheRevalidation(t *testing.T) {
+	ctx := context.Background()
+	b, s := newCacheTestBackend(t, true)
+
+	cache := b.getWalletCache(ctx, s, "hot")
+	cache.SetAddressCache("addr1", strPtr("status1"), BalanceInfo{Confirmed: 5000}, nil, nil)
+	b.saveWalletCache(ctx, s, "hot", cache)
+
+	b.restart()
+	restored := b.getWalletCache(ctx, s, "hot")
+
+	// A new transaction changes the status, so the snapshot is not used
+	if restored.GetAddressCacheIfValid("addr1", strPtr("status2")) != nil {
+		t.Error("restored entry used after the status changed")
+	}
+	if restored.GetAddressCacheIfValid("addr1", nil) != nil {
+		t.Error("restored entry used after the history disappeared")
+	}
+	if restored.GetAddressCacheIfValid("addr1", strPtr("status1")) == nil {
+		t.Error("restored entry not used with a matching status")
+	}
+
+	// Entries fetched by this process replace the snapshot and age normally
+	restored.SetAddressCache("addr1", strPtr("status2"), BalanceInfo{Confirmed: 7000}, nil, nil)
+	entry := restored.GetAddressCacheIfValid("addr1", strPtr("status2"))
+	if entry == nil || entry.Restored || entry.Balance.Confirmed != 7000 {
+		t.Errorf("refreshed entry = %+v", entry)
+	}
+}
+
+func TestPersistedCacheMaxAge(t *testing.T) {
+	ctx := context.Background()
+	b, s := newCacheTestBackend(t, true)
+
+	// Write a snapshot directly with entries of different ages
+	snapshot := &persistedWalletCache{Addresses: map[string]*persistedAddressCache{
+		"fresh": {StatusHash: strPtr("s"), LastUpdated: time.Now().Add(-time.Hour)},
+		"stale": {StatusHash: strPtr("s"), LastUpdated: time.Now().Add(-PersistedCacheMaxAge - time.Minute)},
+	}}
+	entry, err := logical.StorageEntryJSON(cacheStoragePrefix+"hot", snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := b.getWalletCache(ctx, s, "hot")
+
+	// Restored entries outlive MaxCacheAge but not PersistedCacheMaxAge
+	if cache.GetAddressCacheIfValid("fresh", strPtr("s")) == nil {
+		t.Errorf("restored entry older than MaxCacheAge (%s) but within PersistedCacheMaxAge rejected", MaxCacheAge)
+	}
+	if cache.GetAddressCacheIfValid("stale", strPtr("s")) != nil {
+		t.Error("restored entry older than PersistedCacheMaxAge used")
+	}
+}
+
+func TestInvalidateWalletCacheDeletesSnapshot(t *testing.T) {
+	ctx := context.Background()
+	b, s := newCacheTestBackend(t, true)
+
+	for _, name := range []string{"hot", "cold"} {
+		cache := b.getWalletCache(ctx, s, name)
+		cache.SetAddressCache("addr1", strPtr("status1"), BalanceInfo{Confirmed: 5000}, nil, nil)
+		b.saveWalletCache(ctx, s, name, cache)
+	}
+
+	b.invalidateWalletCache(ctx, s, "hot")
+
+	if snapshot, err := loadWalletCache(ctx, s, "hot"); err != nil || snapshot != nil {
+		t.Errorf("loadWalletCache(hot) = %v, %v, want the snapshot deleted", snapshot, err)
+	}
+	if got := b.getWalletCache(ctx, s, "hot").GetAddressCount(); got != 0 {
+		t.Errorf("invalidated wallet still has %d cached addresses", got)
+	}
+
+	// Other wallets keep their snapshots
+	if snapshot, err := loadWalletCache(ctx, s, "cold"); err != nil || snapshot == nil {
+		t.Errorf("loadWalletCache(cold) = %v, %v, want the snapshot kept", snapshot, err)
+	}
+}
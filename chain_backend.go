@@ -0,0 +1,569 @@
+package btc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/djschnei21/vault-plugin-btc/bitcoind"
+	"github.com/djschnei21/vault-plugin-btc/electrum"
+	"github.com/djschnei21/vault-plugin-btc/esplora"
+	"github.com/djschnei21/vault-plugin-btc/wallet"
+)
+
+// bitcoindWatchLabel labels the addresses imported into a bitcoind wallet
+const bitcoindWatchLabel = "vault-plugin-btc"
+
+const (
+	backendElectrum = "electrum"
+	backendBitcoind = "bitcoind"
+	backendEsplora  = "esplora"
+)
+
+// ChainBackend is the blockchain data source used by the wallet paths.
+// Lookups are keyed by address; each implementation maps the address to
+// whatever its server indexes (an Electrum scripthash, a bitcoind descriptor).
+// Results reuse the Electrum response types so the paths and cache are
+// independent of the backend in use.
+type ChainBackend interface {
+	// AddressStatus returns a hash that changes whenever the address's
+	// history changes, or nil if the address has no history
+	AddressStatus(ctx context.Context, address string) (*string, error)
+	GetBalance(ctx context.Context, address string) (*electrum.Balance, error)
+	ListUnspent(ctx context.Context, address string) ([]electrum.UTXO, error)
+	GetHistory(ctx context.Context, address string) ([]electrum.Transaction, error)
+	GetTransaction(ctx context.Context, txid string) (string, error)
+	BroadcastTransaction(ctx context.Context, rawtx string) (string, error)
+	// EstimateFee returns a fee rate in BTC/kvB, or -1 if unavailable
+	EstimateFee(ctx context.Context, blocks int) (float64, error)
+	GetBlockHeight(ctx context.Context) (int64, error)
+	IsDead() bool
+	Close()
+}
+
+// blockSource is implemented by backends that can list the transactions in
+// a block. Electrum servers index by scripthash only and cannot, so callers
+// type-assert and fall back to caller-supplied txids.
+type blockSource interface {
+	// BlockTransactions returns the txids of the block at height
+	BlockTransactions(ctx context.Context, height int64) ([]string, error)
+}
+
+// addressWatcher is implemented by backends that only report on addresses
+// registered with them. Addresses registered lazily on first lookup are new
+// and need no history; addresses that may have received funds already are
+// registered with a time to look back to.
+type addressWatcher interface {
+	WatchAddresses(ctx context.Context, addresses []string, since time.Time) error
+}
+
+// electrumBackend adapts an Electrum client to ChainBackend
+type electrumBackend struct {
+	client  *electrum.Client
+	network string
+}
+
+func newElectrumBackend(client *electrum.Client, network string) *electrumBackend {
+	return &electrumBackend{client: client, network: network}
+}
+
+func (e *electrumBackend) scriptHash(address string) (string, error) {
+	scripthash, err := wallet.AddressToScriptHash(address, e.network)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute scripthash for %s: %w", address, err)
+	}
+	return scripthash, nil
+}
+
+func (e *electrumBackend) AddressStatus(ctx context.Context, address string) (*string, error) {
+	scripthash, err := e.scriptHash(address)
+	if err != nil {
+		return nil, err
+	}
+	return e.client.Subscribe(ctx, scripthash)
+}
+
+func (e *electrumBackend) GetBalance(ctx context.Context, address string) (*electrum.Balance, error) {
+	scripthash, err := e.scriptHash(address)
+	if err != nil {
+		return nil, err
+	}
+	return e.client.GetBalance(ctx, scripthash)
+}
+
+func (e *electrumBackend) ListUnspent(ctx context.Context, address string) ([]electrum.UTXO, error) {
+	scripthash, err := e.scriptHash(address)
+	if err != nil {
+		return nil, err
+	}
+	return e.client.ListUnspent(ctx, scripthash)
+}
+
+func (e *electrumBackend) GetHistory(ctx context.Context, address string) ([]electrum.Transaction, error) {
+	scripthash, err := e.scriptHash(address)
+	if err != nil {
+		return nil, err
+	}
+	return e.client.GetHistory(ctx, scripthash)
+}
+
+func (e *electrumBackend) GetTransaction(ctx context.Context, txid string) (string, error) {
+	return e.client.GetTransaction(ctx, txid)
+}
+
+func (e *electrumBackend) BroadcastTransaction(ctx context.Context, rawtx string) (string, error) {
+	return e.client.BroadcastTransaction(ctx, rawtx)
+}
+
+func (e *electrumBackend) EstimateFee(ctx context.Context, blocks int) (float64, error) {
+	return e.client.EstimateFee(ctx, blocks)
+}
+
+func (e *electrumBackend) GetBlockHeight(ctx context.Context) (int64, error) {
+	return e.client.GetBlockHeight(ctx)
+}
+
+func (e *electrumBackend) IsDead() bool {
+	return e.client.IsDead()
+}
+
+func (e *electrumBackend) Close() {
+	e.client.Close()
+}
+
+// bitcoindBackend adapts a Bitcoin Core RPC client to ChainBackend.
+//
+// With a wallet configured, addresses are imported into the descriptor
+// watch-only wallet when they are stored and queried with listunspent and
+// listreceivedbyaddress. An address looked up before it was imported is
+// imported then, rescanning from since: the creation of the oldest wallet
+// the backend serves. Without a wallet, scantxoutset is used, which sees only
+// confirmed outputs and reconstructs history from the current UTXO set.
+type bitcoindBackend struct {
+	client *bitcoind.Client
+	since  time.Time
+}
+
+func newBitcoindBackend(client *bitcoind.Client, since time.Time) *bitcoindBackend {
+	return &bitcoindBackend{client: client, since: since}
+}
+
+// unspent returns the address's unspent outputs in Electrum form
+func (d *bitcoindBackend) unspent(ctx context.Context, address string) ([]electrum.UTXO, error) {
+	if d.client.Wallet() == "" {
+		outputs, err := d.client.ScanTxOutSet(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		utxos := make([]electrum.UTXO, 0, len(outputs))
+		for _, o := range outputs {
+			utxos = append(utxos, electrum.UTXO{TxHash: o.TxID, TxPos: o.Vout, Height: o.Height, Value: o.Value})
+		}
+		return utxos, nil
+	}
+
+	if err := d.ensureWatched(ctx, address); err != nil {
+		return nil, err
+	}
+
+	outputs, err := d.client.ListUnspent(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	var tip int64
+	utxos := make([]electrum.UTXO, 0, len(outputs))
+	for _, o := range outputs {
+		// listunspent reports confirmations, Electrum reports height
+		var height int64
+		if o.Confirmations > 0 {
+			if tip == 0 {
+				if tip, err = d.client.GetBlockCount(ctx); err != nil {
+					return nil, err
+				}
+			}
+			height = tip - o.Confirmations + 1
+		}
+		utxos = append(utxos, electrum.UTXO{TxHash: o.TxID, TxPos: o.Vout, Height: height, Value: o.Value})
+	}
+	return utxos, nil
+}
+
+// ensureWatched imports an address into the watch-only wallet if needed
+func (d *bitcoindBackend) ensureWatched(ctx context.Context, address string) error {
+	watched, err := d.client.IsWatched(ctx, address)
+	if err != nil {
+		return err
+	}
+	if watched {
+		return nil
+	}
+	if err := d.client.ImportAddresses(ctx, []string{address}, bitcoindWatchLabel, d.since); err != nil {
+		return fmt.Errorf("failed to import %s into bitcoind wallet: %w", address, err)
+	}
+	return nil
+}
+
+// WatchAddresses imports addresses into the watch-only wallet, rescanning
+// from since. Without a wallet, scantxoutset needs no registration.
+func (d *bitcoindBackend) WatchAddresses(ctx context.Context, addresses []string, since time.Time) error {
+	if d.client.Wallet() == "" || len(addresses) == 0 {
+		return nil
+	}
+	if err := d.client.ImportAddresses(ctx, addresses, bitcoindWatchLabel, since); err != nil {
+		return fmt.Errorf("failed to import addresses into bitcoind wallet: %w", err)
+	}
+	return nil
+}
+
+func (d *bitcoindBackend) AddressStatus(ctx context.Context, address string) (*string, error) {
+	history, err := d.GetHistory(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	utxos, err := d.unspent(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return historyStatusHash(history, utxos), nil
+}
+
+func (d *bitcoindBackend) GetBalance(ctx context.Context, address string) (*electrum.Balance, error) {
+	utxos, err := d.unspent(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := &electrum.Balance{}
+	for _, u := range utxos {
+		if u.Height > 0 {
+			balance.Confirmed += u.Value
+		} else {
+			balance.Unconfirmed += u.Value
+		}
+	}
+	return balance, nil
+}
+
+func (d *bitcoindBackend) ListUnspent(ctx context.Context, address string) ([]electrum.UTXO, error) {
+	return d.unspent(ctx, address)
+}
+
+// GetHistory returns the transactions that paid to the address. Spending
+// transactions are not tracked by bitcoind per address, so the status hash
+// also covers the current UTXO set to notice spends.
+func (d *bitcoindBackend) GetHistory(ctx context.Context, address string) ([]electrum.Transaction, error) {
+	if d.client.Wallet() == "" {
+		utxos, err := d.unspent(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		var history []electrum.Transaction
+		for _, u := range utxos {
+			if !seen[u.TxHash] {
+				seen[u.TxHash] = true
+				history = append(history, electrum.Transaction{TxHash: u.TxHash, Height: u.Height})
+			}
+		}
+		return history, nil
+	}
+
+	if err := d.ensureWatched(ctx, address); err != nil {
+		return nil, err
+	}
+
+	received, err := d.client.ListReceivedByAddress(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]electrum.Transaction, 0, len(received.TxIDs))
+	for _, txid := range received.TxIDs {
+		height, err := d.client.GetTransactionHeight(ctx, txid)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, electrum.Transaction{TxHash: txid, Height: height})
+	}
+	return history, nil
+}
+
+func (d *bitcoindBackend) GetTransaction(ctx context.Context, txid string) (string, error) {
+	return d.client.GetRawTransaction(ctx, txid)
+}
+
+func (d *bitcoindBackend) BroadcastTransaction(ctx context.Context, rawtx string) (string, error) {
+	return d.client.SendRawTransaction(ctx, rawtx)
+}
+
+func (d *bitcoindBackend) EstimateFee(ctx context.Context, blocks int) (float64, error) {
+	return d.client.EstimateSmartFee(ctx, blocks)
+}
+
+func (d *bitcoindBackend) GetBlockHeight(ctx context.Context) (int64, error) {
+	return d.client.GetBlockCount(ctx)
+}
+
+func (d *bitcoindBackend) BlockTransactions(ctx context.Context, height int64) ([]string, error) {
+	hash, err := d.client.GetBlockHash(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	return d.client.GetBlockTxIDs(ctx, hash)
+}
+
+// IsDead always reports false; each RPC is an independent HTTP request
+func (d *bitcoindBackend) IsDead() bool {
+	return false
+}
+
+func (d *bitcoindBackend) Close() {
+	d.client.Close()
+}
+
+// esploraBackend adapts an Esplora REST client to ChainBackend.
+// Esplora indexes by address and includes spending transactions in address
+// history, so the status hash is derived from history alone.
+type esploraBackend struct {
+	client *esplora.Client
+}
+
+func newEsploraBackend(client *esplora.Client) *esploraBackend {
+	return &esploraBackend{client: client}
+}
+
+func (e *esploraBackend) AddressStatus(ctx context.Context, address string) (*string, error) {
+	history, err := e.GetHistory(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return historyStatusHash(history, nil), nil
+}
+
+func (e *esploraBackend) GetBalance(ctx context.Context, address string) (*electrum.Balance, error) {
+	info, err := e.client.GetAddress(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return &electrum.Balance{
+		Confirmed:   info.ChainStats.FundedTxoSum - info.ChainStats.SpentTxoSum,
+		Unconfirmed: info.MempoolStats.FundedTxoSum - info.MempoolStats.SpentTxoSum,
+	}, nil
+}
+
+func (e *esploraBackend) ListUnspent(ctx context.Context, address string) ([]electrum.UTXO, error) {
+	outputs, err := e.client.GetAddressUTXOs(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	utxos := make([]electrum.UTXO, 0, len(outputs))
+	for _, o := range outputs {
+		var height int64
+		if o.Status.Confirmed {
+			height = o.Status.BlockHeight
+		}
+		utxos = append(utxos, electrum.UTXO{TxHash: o.TxID, TxPos: o.Vout, Height: height, Value: o.Value})
+	}
+	return utxos, nil
+}
+
+func (e *esploraBackend) GetHistory(ctx context.Context, address string) ([]electrum.Transaction, error) {
+	txs, err := e.client.GetAddressTxs(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]electrum.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		var height int64
+		if tx.Status.Confirmed {
+			height = tx.Status.BlockHeight
+		}
+		history = append(history, electrum.Transaction{TxHash: tx.TxID, Height: height, Fee: tx.Fee})
+	}
+	return history, nil
+}
+
+func (e *esploraBackend) GetTransaction(ctx context.Context, txid string) (string, error) {
+	return e.client.GetTransactionHex(ctx, txid)
+}
+
+func (e *esploraBackend) BroadcastTransaction(ctx context.Context, rawtx string) (string, error) {
+	return e.client.BroadcastTransaction(ctx, rawtx)
+}
+
+func (e *esploraBackend) EstimateFee(ctx context.Context, blocks int) (float64, error) {
+	return e.client.EstimateFee(ctx, blocks)
+}
+
+func (e *esploraBackend) GetBlockHeight(ctx context.Context) (int64, error) {
+	return e.client.GetTipHeight(ctx)
+}
+
+func (e *esploraBackend) BlockTransactions(ctx context.Context, height int64) ([]string, error) {
+	hash, err := e.client.GetBlockHash(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	return e.client.GetBlockTxIDs(ctx, hash)
+}
+
+// IsDead always reports false; each call is an independent HTTP request
+func (e *esploraBackend) IsDead() bool {
+	return false
+}
+
+func (e *esploraBackend) Close() {
+	e.client.Close()
+}
+
+// historyStatusHash computes an Electrum-style status hash for backends that
+// have no native equivalent: the SHA-256 of "txid:height:" for each history
+// entry, extended with the unspent outpoints so spends change the status.
+// Returns nil when there is no history.
+func historyStatusHash(history []electrum.Transaction, utxos []electrum.UTXO) *string {
+	if len(history) == 0 && len(utxos) == 0 {
+		return nil
+	}
+
+	entries := make([]string, 0, len(history)+len(utxos))
+	for _, tx := range history {
+		entries = append(entries, fmt.Sprintf("%s:%d:", tx.TxHash, tx.Height))
+	}
+	sort.Strings(entries)
+
+	outpoints := make([]string, 0, len(utxos))
+	for _, u := range utxos {
+		outpoints = append(outpoints, fmt.Sprintf("%s:%d:%d:", u.TxHash, u.TxPos, u.Height))
+	}
+	sort.Strings(outpoints)
+
+	h := sha256.New()
+	for _, e := range entries {
+		h.Write([]byte(e))
+	}
+	for _, o := range outpoints {
+		h.Write([]byte(o))
+	}
+	status := hex.EncodeToString(h.Sum(nil))
+	return &status
+}
+
+// watchWalletAddresses registers addresses of a wallet that may already have
+// history with a backend that needs it, looking back to the wallet's creation
+func watchWalletAddresses(ctx context.Context, client ChainBackend, w *btcWallet, addresses []string) error {
+	watcher, ok := client.(addressWatcher)
+	if !ok {
+		return nil
+	}
+	return watcher.WatchAddresses(ctx, addresses, w.CreatedAt)
+}
+
+// registerAddresses registers newly stored addresses of w with a backend
+// that needs it. A failure is only logged, since the backend imports an
+// address on its first lookup anyway.
+func (b *btcBackend) registerAddresses(ctx context.Context, s logical.Storage, w *btcWallet, network string, addresses ...string) {
+	if len(addresses) == 0 {
+		return
+	}
+
+	// Only bitcoind, which serves the mount network, tracks addresses; don't
+	// connect to another backend just to find that out
+	config, err := getConfig(ctx, s)
+	if err != nil || config.backendType() != backendBitcoind {
+		return
+	}
+	if mountNetwork, err := config.networkID(); err != nil || mountNetwork != network {
+		return
+	}
+
+	client, err := b.getClient(ctx, s, network)
+	if err == nil {
+		err = watchWalletAddresses(ctx, client, w, addresses)
+	}
+	if err != nil {
+		b.Logger().Warn("failed to register addresses with the chain backend", "wallet", w.Name, "error", err)
+	}
+}
+
+// oldestWalletCreation returns when the oldest wallet on network was
+// created, or the zero time if there is none
+func oldestWalletCreation(ctx context.Context, s logical.Storage, network string) (time.Time, error) {
+	wallets, err := listWallets(ctx, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var oldest time.Time
+	for _, w := range wallets {
+		walletNet, err := walletNetwork(ctx, s, w)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if walletNet != network || w.CreatedAt.IsZero() {
+			continue
+		}
+		if oldest.IsZero() || w.CreatedAt.Before(oldest) {
+			oldest = w.CreatedAt
+		}
+	}
+	return oldest, nil
+}
+
+// watchAllWallets registers the stored addresses of every wallet on a network
+// with a backend that needs it, for a mount switching to that backend.
+// Returns how many addresses were registered.
+func watchAllWallets(ctx context.Context, s logical.Storage, client ChainBackend, network string) (int, error) {
+	if _, ok := client.(addressWatcher); !ok {
+		return 0, nil
+	}
+
+	wallets, err := listWallets(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+
+	watched := 0
+	for _, w := range wallets {
+		walletNet, err := walletNetwork(ctx, s, w)
+		if err != nil {
+			return watched, err
+		}
+		if walletNet != network {
+			continue
+		}
+
+		var addresses []string
+		for _, account := range w.accountIndices() {
+			stored, err := getStoredAddresses(ctx, s, w.Name, account)
+			if err != nil {
+				return watched, err
+			}
+			for _, addr := range stored {
+				addresses = append(addresses, addr.Address)
+			}
+			payments, err := getSilentPayments(ctx, s, w.Name, account)
+			if err != nil {
+				return watched, err
+			}
+			for _, p := range payments {
+				addresses = append(addresses, p.Address)
+			}
+		}
+		if len(addresses) == 0 {
+			continue
+		}
+		if err := watchWalletAddresses(ctx, client, w, addresses); err != nil {
+			return watched, fmt.Errorf("wallet %q: %w", w.Name, err)
+		}
+		watched += len(addresses)
+	}
+	return watched, nil
+}
@@ -0,0 +1,275 @@
+package btc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/djschnei21/vault-plugin-btc/bitcoind"
+	"github.com/djschnei21/vault-plugin-btc/electrum"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const testBitcoindAddress = "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080"
+
+// fakeBitcoind is an in-process bitcoind stand-in for one watched address
+type fakeBitcoind struct {
+	watched  bool
+	imports  []map[string]interface{}
+	unspent  string
+	received []string
+	heights  map[string]int64
+}
+
+// serve starts the node and returns its RPC URL
+func (f *fakeBitcoind) serve(t *testing.T) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+			return
+		}
+
+		var result interface{}
+		switch req.Method {
+		case "getblockcount":
+			result = 200
+		case "getaddressinfo":
+			result = map[string]bool{"iswatchonly": f.watched}
+		case "getdescriptorinfo":
+			var desc string
+			json.Unmarshal(req.Params[0], &desc)
+			result = map[string]string{"descriptor": desc + "#checksum"}
+		case "importdescriptors":
+			var imports []map[string]interface{}
+			json.Unmarshal(req.Params[0], &imports)
+			f.imports = append(f.imports, imports...)
+			f.watched = true
+			results := make([]map[string]bool, len(imports))
+			for i := range results {
+				results[i] = map[string]bool{"success": true}
+			}
+			result = results
+		case "listunspent":
+			result = json.RawMessage(f.unspent)
+		case "scantxoutset":
+			result = json.RawMessage(`{"success":true,"unspents":[{"txid":"cc","vout":0,"amount":0.001,"height":150}]}`)
+		case "listreceivedbyaddress":
+			result = []map[string]interface{}{{"address": testBitcoindAddress, "txids": f.received}}
+		case "gettransaction":
+			var txid string
+			json.Unmarshal(req.Params[0], &txid)
+			result = map[string]int64{"blockheight": f.heights[txid]}
+		default:
+			t.Errorf("unexpected RPC %s", req.Method)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "error": nil})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func newFakeBitcoind(t *testing.T, f *fakeBitcoind, wallet string, since time.Time) *bitcoindBackend {
+	t.Helper()
+
+	client, err := bitcoind.NewClient(bitcoind.Options{URL: f.serve(t), Wallet: wallet})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return newBitcoindBackend(client, since)
+}
+
+func TestBitcoindBackendWallet(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeBitcoind{
+		unspent: `[
+			{"txid":"aa","vout":1,"amount":0.0015,"confirmations":3},
+			{"txid":"bb","vout":0,"amount":0.00002,"confirmations":0}
+		]`,
+		received: []string{"aa", "bb"},
+		heights:  map[string]int64{"aa": 198},
+	}
+	created := time.Unix(1700000000, 0)
+	backend := newFakeBitcoind(t, fake, "watch", created)
+
+	utxos, err := backend.ListUnspent(ctx, testBitcoindAddress)
+	if err != nil {
+		t.Fatalf("ListUnspent() error = %v", err)
+	}
+
+	// An address not imported when it was stored is imported on the first
+	// lookup, rescanning from the oldest wallet
+	if len(fake.imports) != 1 || fake.imports[0]["label"] != bitcoindWatchLabel {
+		t.Fatalf("imports = %v, want one import", fake.imports)
+	}
+	if ts, ok := fake.imports[0]["timestamp"].(float64); !ok || int64(ts) != created.Unix() {
+		t.Errorf("first lookup timestamp = %v, want %d", fake.imports[0]["timestamp"], created.Unix())
+	}
+
+	// Confirmations are converted to heights against the tip
+	if len(utxos) != 2 || utxos[0].Height != 198 || utxos[0].Value != 150000 || utxos[1].Height != 0 {
+		t.Errorf("ListUnspent() = %+v", utxos)
+	}
+
+	balance, err := backend.GetBalance(ctx, testBitcoindAddress)
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	if balance.Confirmed != 150000 || balance.Unconfirmed != 2000 {
+		t.Errorf("GetBalance() = %+v, want 150000 confirmed and 2000 unconfirmed", balance)
+	}
+
+	history, err := backend.GetHistory(ctx, testBitcoindAddress)
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+	if len(history) != 2 || history[0].Height != 198 || history[1].Height != 0 {
+		t.Errorf("GetHistory() = %+v", history)
+	}
+	if len(fake.imports) != 1 {
+		t.Errorf("watched address imported again: %v", fake.imports)
+	}
+
+	// Spending the output changes the status even though bitcoind's
+	// received history does not
+	before, err := backend.AddressStatus(ctx, testBitcoindAddress)
+	if err != nil || before == nil {
+		t.Fatalf("AddressStatus() = %v, %v", before, err)
+	}
+	fake.unspent = `[{"txid":"bb","vout":0,"amount":0.00002,"confirmations":0}]`
+	after, err := backend.AddressStatus(ctx, testBitcoindAddress)
+	if err != nil || after == nil {
+		t.Fatalf("AddressStatus() = %v, %v", after, err)
+	}
+	if *before == *after {
+		t.Error("AddressStatus() did not change after a spend")
+	}
+
+	// Addresses are imported with a rescan from a given time
+	if err := backend.WatchAddresses(ctx, []string{testBitcoindAddress}, created); err != nil {
+		t.Fatalf("WatchAddresses() error = %v", err)
+	}
+	if ts, ok := fake.imports[1]["timestamp"].(float64); !ok || int64(ts) != created.Unix() {
+		t.Errorf("WatchAddresses() timestamp = %v, want %d", fake.imports[1]["timestamp"], created.Unix())
+	}
+}
+
+func TestBitcoindBackendScanTxOutSet(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeBitcoind{}
+	backend := newFakeBitcoind(t, fake, "", time.Time{})
+
+	utxos, err := backend.ListUnspent(ctx, testBitcoindAddress)
+	if err != nil {
+		t.Fatalf("ListUnspent() error = %v", err)
+	}
+	if len(utxos) != 1 || utxos[0].TxHash != "cc" || utxos[0].Height != 150 || utxos[0].Value != 100000 {
+		t.Errorf("ListUnspent() = %+v", utxos)
+	}
+
+	history, err := backend.GetHistory(ctx, testBitcoindAddress)
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+	if len(history) != 1 || history[0].TxHash != "cc" || history[0].Height != 150 {
+		t.Errorf("GetHistory() = %+v", history)
+	}
+
+	// Without a wallet there is nothing to import into
+	if err := backend.WatchAddresses(ctx, []string{testBitcoindAddress}, time.Now()); err != nil {
+		t.Fatalf("WatchAddresses() error = %v", err)
+	}
+	if len(fake.imports) != 0 {
+		t.Errorf("imports = %v, want none without a wallet", fake.imports)
+	}
+}
+
+func TestStoredAddressesWatchedByBitcoind(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeBitcoind{unspent: "[]"}
+	b, s := newCacheTestBackend(t, false)
+
+	entry, err := logical.StorageEntryJSON(configStoragePath, &btcConfig{
+		Network:        "regtest",
+		Backend:        backendBitcoind,
+		BitcoindURL:    fake.serve(t),
+		BitcoindWallet: "watch",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(ctx, &logical.Request{Operation: op, Path: path, Data: data, Storage: s})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s %s = %v, %v", op, path, resp, err)
+		}
+		return resp
+	}
+
+	// The initial addresses are imported with the wallet, rescanning from
+	// its creation
+	request(logical.CreateOperation, "wallets/hot", nil)
+	w, err := getWallet(ctx, s, "hot")
+	if err != nil || w == nil {
+		t.Fatalf("getWallet() = %v, %v", w, err)
+	}
+	if len(fake.imports) != initialAddressCount {
+		t.Fatalf("wallet creation imported %d addresses, want %d", len(fake.imports), initialAddressCount)
+	}
+	for _, imported := range fake.imports {
+		if ts, ok := imported["timestamp"].(float64); !ok || int64(ts) != w.CreatedAt.Unix() {
+			t.Errorf("import timestamp = %v, want the wallet creation %d", imported["timestamp"], w.CreatedAt.Unix())
+		}
+	}
+
+	// Generating past the stored addresses imports the new ones
+	request(logical.UpdateOperation, "wallets/hot/addresses", map[string]interface{}{"count": initialAddressCount + 2})
+	if len(fake.imports) != initialAddressCount+2 {
+		t.Errorf("%d addresses imported after generating 2 more, want %d", len(fake.imports), initialAddressCount+2)
+	}
+}
+
+func TestHistoryStatusHash(t *testing.T) {
+	history := []electrum.Transaction{{TxHash: "aa", Height: 100}, {TxHash: "bb", Height: 0}}
+	utxos := []electrum.UTXO{{TxHash: "aa", TxPos: 1, Height: 100}}
+
+	if got := historyStatusHash(nil, nil); got != nil {
+		t.Errorf("historyStatusHash() with no history = %q, want nil", *got)
+	}
+
+	base := historyStatusHash(history, utxos)
+	if base == nil {
+		t.Fatal("historyStatusHash() = nil")
+	}
+
+	// Order does not matter
+	reordered := []electrum.Transaction{history[1], history[0]}
+	if got := historyStatusHash(reordered, utxos); *got != *base {
+		t.Error("historyStatusHash() depends on history order")
+	}
+
+	changes := map[string]*string{
+		"confirmation": historyStatusHash([]electrum.Transaction{history[0], {TxHash: "bb", Height: 101}}, utxos),
+		"new tx":       historyStatusHash(append(history, electrum.Transaction{TxHash: "cc"}), utxos),
+		"spend":        historyStatusHash(history, nil),
+		"utxo height":  historyStatusHash(history, []electrum.UTXO{{TxHash: "aa", TxPos: 1, Height: 99}}),
+	}
+	for name, got := range changes {
+		if got == nil || *got == *base {
+			t.Errorf("historyStatusHash() unchanged after %s", name)
+		}
+	}
+}
@@ -1,17 +1,22 @@
 package electrum
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/url"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"golang.org/x/net/proxy"
 )
 
 // Client represents an Electrum protocol client
@@ -27,17 +32,59 @@ type Client struct {
 	respMu   sync.Mutex
 	closed   bool
 	dead     bool // connection is broken, should reconnect
+	opts     Options
 }
 
 const (
-	// ConnectTimeout is the timeout for establishing a connection
+	// ConnectTimeout is the default timeout for establishing a connection
 	ConnectTimeout = 10 * time.Second
-	// RequestTimeout is the timeout for individual RPC calls
+	// RequestTimeout is the default timeout for individual RPC calls
 	RequestTimeout = 15 * time.Second
 	// WriteTimeout is the timeout for writing to the connection
 	WriteTimeout = 5 * time.Second
 )
 
+// Options holds tunable connection settings for a Client
+// Zero values fall back to the package defaults
+type Options struct {
+	// ConnectTimeout bounds dialing and the TLS handshake
+	ConnectTimeout time.Duration
+	// RequestTimeout bounds a single RPC call when the caller's context has no
+	// earlier deadline. Exceeding it marks the connection dead.
+	RequestTimeout time.Duration
+
+	// TLSCAPEM is a PEM bundle of CA certificates trusted instead of the
+	// system roots, for servers using a private CA
+	TLSCAPEM string
+	// TLSCertFingerprint pins the server's leaf certificate by its SHA-256
+	// fingerprint (hex, colons optional). On its own the pin replaces chain
+	// verification so self-signed server certificates can be used safely;
+	// with TLSCAPEM the certificate must also chain to that bundle.
+	TLSCertFingerprint string
+	// TLSSkipVerify disables certificate verification entirely.
+	// Callers must restrict this to test networks.
+	TLSSkipVerify bool
+
+	// SOCKS5Proxy routes the connection through a SOCKS5 proxy such as Tor.
+	// Accepts host:port or socks5://[user:pass@]host:port. Hostnames are
+	// resolved by the proxy, so .onion servers work.
+	SOCKS5Proxy string
+}
+
+func (o Options) connectTimeout() time.Duration {
+	if o.ConnectTimeout > 0 {
+		return o.ConnectTimeout
+	}
+	return ConnectTimeout
+}
+
+func (o Options) requestTimeout() time.Duration {
+	if o.RequestTimeout > 0 {
+		return o.RequestTimeout
+	}
+	return RequestTimeout
+}
+
 type rpcRequest struct {
 	JSONRPC string        `json:"jsonrpc"`
 	ID      uint64        `json:"id"`
@@ -78,18 +125,25 @@ type Transaction struct {
 	Fee    int64  `json:"fee,omitempty"`
 }
 
-// NewClient creates a new Electrum client
-func NewClient(url string) (*Client, error) {
+// NewClient creates a new Electrum client with default options
+func NewClient(ctx context.Context, url string) (*Client, error) {
+	return NewClientWithOptions(ctx, url, Options{})
+}
+
+// NewClientWithOptions creates a new Electrum client with the given options.
+// The context bounds connection setup only; the returned client outlives it.
+func NewClientWithOptions(ctx context.Context, url string, opts Options) (*Client, error) {
 	c := &Client{
 		url:      url,
 		respChan: make(map[uint64]chan *rpcResponse),
+		opts:     opts,
 	}
 
 	if err := c.parseURL(url); err != nil {
 		return nil, err
 	}
 
-	if err := c.connect(); err != nil {
+	if err := c.connect(ctx); err != nil {
 		return nil, err
 	}
 
@@ -97,7 +151,7 @@ func NewClient(url string) (*Client, error) {
 	go c.readResponses()
 
 	// Negotiate protocol version
-	if err := c.negotiateVersion(); err != nil {
+	if err := c.negotiateVersion(ctx); err != nil {
 		c.Close()
 		return nil, err
 	}
@@ -128,35 +182,163 @@ func (c *Client) parseURL(url string) error {
 	return nil
 }
 
-func (c *Client) connect() error {
+func (c *Client) connect(ctx context.Context) error {
 	addr := net.JoinHostPort(c.host, c.port)
 
-	dialer := &net.Dialer{
-		Timeout:   ConnectTimeout,
-		KeepAlive: 30 * time.Second, // Enable TCP keep-alive for faster dead connection detection
-	}
-
-	var conn net.Conn
-	var err error
+	ctx, cancel := context.WithTimeout(ctx, c.opts.connectTimeout())
+	defer cancel()
 
-	if c.useTLS {
-		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
-			MinVersion: tls.VersionTLS12,
-			ServerName: c.host, // Explicit ServerName for proper certificate validation
-		})
-	} else {
-		conn, err = dialer.Dial("tcp", addr)
+	dialer, err := c.dialer()
+	if err != nil {
+		return err
 	}
 
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return fmt.Errorf("failed to connect to Electrum server: %w", err)
 	}
 
+	if c.useTLS {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			conn.Close()
+			return err
+		}
+
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to connect to Electrum server: TLS handshake: %w", err)
+		}
+		conn = tlsConn
+	}
+
 	c.conn = conn
 	c.dead = false
 	return nil
 }
 
+// dialer returns the TCP dialer, wrapped in a SOCKS5 proxy if configured
+func (c *Client) dialer() (proxy.ContextDialer, error) {
+	direct := &net.Dialer{
+		Timeout:   c.opts.connectTimeout(),
+		KeepAlive: 30 * time.Second, // Enable TCP keep-alive for faster dead connection detection
+	}
+
+	if c.opts.SOCKS5Proxy == "" {
+		return direct, nil
+	}
+
+	proxyAddr, auth, err := parseProxyURL(c.opts.SOCKS5Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := proxy.SOCKS5("tcp", proxyAddr, auth, direct)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SOCKS5 dialer: %w", err)
+	}
+
+	contextDialer, ok := d.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("SOCKS5 dialer does not support contexts")
+	}
+
+	return contextDialer, nil
+}
+
+// tlsConfig builds the TLS configuration from the client options
+func (c *Client) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.host, // Explicit ServerName for proper certificate validation
+	}
+
+	if c.opts.TLSCAPEM != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.opts.TLSCAPEM)) {
+			return nil, fmt.Errorf("no valid certificates found in CA PEM")
+		}
+		config.RootCAs = pool
+	}
+
+	if c.opts.TLSCertFingerprint != "" {
+		pin, err := ParseFingerprint(c.opts.TLSCertFingerprint)
+		if err != nil {
+			return nil, err
+		}
+
+		// The pin is checked in VerifyConnection. Without a CA bundle it
+		// replaces the default chain verification, which would reject
+		// self-signed server certificates; with one, both must pass.
+		config.InsecureSkipVerify = c.opts.TLSCAPEM == ""
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("server presented no certificate")
+			}
+			got := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			if !bytes.Equal(got[:], pin) {
+				return fmt.Errorf("server certificate fingerprint %s does not match pinned fingerprint", hex.EncodeToString(got[:]))
+			}
+			return nil
+		}
+	} else if c.opts.TLSSkipVerify {
+		config.InsecureSkipVerify = true
+	}
+
+	return config, nil
+}
+
+// ParseFingerprint decodes a hex SHA-256 certificate fingerprint.
+// Colons and spaces between bytes are ignored (e.g. "AB:CD:...").
+func ParseFingerprint(fingerprint string) ([]byte, error) {
+	cleaned := strings.NewReplacer(":", "", " ", "").Replace(fingerprint)
+	pin, err := hex.DecodeString(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate fingerprint: %w", err)
+	}
+	if len(pin) != sha256.Size {
+		return nil, fmt.Errorf("invalid certificate fingerprint: expected %d bytes, got %d", sha256.Size, len(pin))
+	}
+	return pin, nil
+}
+
+// parseProxyURL parses a SOCKS5 proxy address in host:port or
+// socks5://[user:pass@]host:port form
+func parseProxyURL(proxyURL string) (string, *proxy.Auth, error) {
+	if !strings.Contains(proxyURL, "://") {
+		if _, _, err := net.SplitHostPort(proxyURL); err != nil {
+			return "", nil, fmt.Errorf("invalid SOCKS5 proxy address: %w", err)
+		}
+		return proxyURL, nil, nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid SOCKS5 proxy URL: %w", err)
+	}
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return "", nil, fmt.Errorf("unsupported proxy scheme %q: must be socks5", u.Scheme)
+	}
+	if u.Port() == "" {
+		return "", nil, fmt.Errorf("invalid SOCKS5 proxy URL: missing port")
+	}
+
+	var auth *proxy.Auth
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: password}
+	}
+
+	return u.Host, auth, nil
+}
+
+// ValidateProxyURL checks that a SOCKS5 proxy address is well formed
+func ValidateProxyURL(proxyURL string) error {
+	_, _, err := parseProxyURL(proxyURL)
+	return err
+}
+
 func (c *Client) readResponses() {
 	decoder := json.NewDecoder(c.conn)
 	for {
@@ -189,7 +371,15 @@ func (c *Client) readResponses() {
 	}
 }
 
-func (c *Client) call(method string, params ...interface{}) (json.RawMessage, error) {
+// call sends an RPC request and waits for its response.
+// If ctx is cancelled or its deadline passes, the pending call is dropped and
+// the connection stays usable. Only the client's own RequestTimeout expiring
+// marks the connection dead, since that indicates an unresponsive server.
+func (c *Client) call(ctx context.Context, method string, params ...interface{}) (json.RawMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	c.mu.Lock()
 	if c.closed {
 		c.mu.Unlock()
@@ -249,9 +439,9 @@ func (c *Client) call(method string, params ...interface{}) (json.RawMessage, er
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
-	// Wait for response with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
-	defer cancel()
+	// Wait for response, the caller's context, or our own request timeout
+	timer := time.NewTimer(c.opts.requestTimeout())
+	defer timer.Stop()
 
 	select {
 	case resp, ok := <-respCh:
@@ -264,14 +454,24 @@ func (c *Client) call(method string, params ...interface{}) (json.RawMessage, er
 		}
 		return resp.Result, nil
 	case <-ctx.Done():
-		c.respMu.Lock()
-		delete(c.respChan, id)
-		c.respMu.Unlock()
+		// Caller gave up - drop the pending call but keep the connection.
+		// A late response for this ID is discarded by readResponses.
+		c.dropPending(id)
+		return nil, fmt.Errorf("%s cancelled: %w", method, ctx.Err())
+	case <-timer.C:
+		c.dropPending(id)
 		c.markDead()
 		return nil, fmt.Errorf("request timeout")
 	}
 }
 
+// dropPending removes the response channel for a request ID
+func (c *Client) dropPending(id uint64) {
+	c.respMu.Lock()
+	delete(c.respChan, id)
+	c.respMu.Unlock()
+}
+
 // markDead marks the connection as dead (thread-safe)
 func (c *Client) markDead() {
 	c.mu.Lock()
@@ -286,8 +486,8 @@ func (c *Client) IsDead() bool {
 	return c.dead
 }
 
-func (c *Client) negotiateVersion() error {
-	result, err := c.call("server.version", "vault-plugin-btc", "1.4")
+func (c *Client) negotiateVersion(ctx context.Context) error {
+	result, err := c.call(ctx, "server.version", "vault-plugin-btc", "1.4")
 	if err != nil {
 		return fmt.Errorf("version negotiation failed: %w", err)
 	}
@@ -313,8 +513,8 @@ func (c *Client) Close() {
 }
 
 // GetBalance returns the balance for a scripthash
-func (c *Client) GetBalance(scripthash string) (*Balance, error) {
-	result, err := c.call("blockchain.scripthash.get_balance", scripthash)
+func (c *Client) GetBalance(ctx context.Context, scripthash string) (*Balance, error) {
+	result, err := c.call(ctx, "blockchain.scripthash.get_balance", scripthash)
 	if err != nil {
 		return nil, err
 	}
@@ -328,8 +528,8 @@ func (c *Client) GetBalance(scripthash string) (*Balance, error) {
 }
 
 // ListUnspent returns unspent outputs for a scripthash
-func (c *Client) ListUnspent(scripthash string) ([]UTXO, error) {
-	result, err := c.call("blockchain.scripthash.listunspent", scripthash)
+func (c *Client) ListUnspent(ctx context.Context, scripthash string) ([]UTXO, error) {
+	result, err := c.call(ctx, "blockchain.scripthash.listunspent", scripthash)
 	if err != nil {
 		return nil, err
 	}
@@ -343,8 +543,8 @@ func (c *Client) ListUnspent(scripthash string) ([]UTXO, error) {
 }
 
 // GetHistory returns transaction history for a scripthash
-func (c *Client) GetHistory(scripthash string) ([]Transaction, error) {
-	result, err := c.call("blockchain.scripthash.get_history", scripthash)
+func (c *Client) GetHistory(ctx context.Context, scripthash string) ([]Transaction, error) {
+	result, err := c.call(ctx, "blockchain.scripthash.get_history", scripthash)
 	if err != nil {
 		return nil, err
 	}
@@ -358,8 +558,8 @@ func (c *Client) GetHistory(scripthash string) ([]Transaction, error) {
 }
 
 // GetTransaction returns raw transaction data
-func (c *Client) GetTransaction(txhash string) (string, error) {
-	result, err := c.call("blockchain.transaction.get", txhash)
+func (c *Client) GetTransaction(ctx context.Context, txhash string) (string, error) {
+	result, err := c.call(ctx, "blockchain.transaction.get", txhash)
 	if err != nil {
 		return "", err
 	}
@@ -373,8 +573,8 @@ func (c *Client) GetTransaction(txhash string) (string, error) {
 }
 
 // BroadcastTransaction broadcasts a raw transaction and returns the txid
-func (c *Client) BroadcastTransaction(rawtx string) (string, error) {
-	result, err := c.call("blockchain.transaction.broadcast", rawtx)
+func (c *Client) BroadcastTransaction(ctx context.Context, rawtx string) (string, error) {
+	result, err := c.call(ctx, "blockchain.transaction.broadcast", rawtx)
 	if err != nil {
 		return "", err
 	}
@@ -388,8 +588,8 @@ func (c *Client) BroadcastTransaction(rawtx string) (string, error) {
 }
 
 // EstimateFee returns the estimated fee in BTC per kilobyte
-func (c *Client) EstimateFee(blocks int) (float64, error) {
-	result, err := c.call("blockchain.estimatefee", blocks)
+func (c *Client) EstimateFee(ctx context.Context, blocks int) (float64, error) {
+	result, err := c.call(ctx, "blockchain.estimatefee", blocks)
 	if err != nil {
 		return 0, err
 	}
@@ -403,8 +603,8 @@ func (c *Client) EstimateFee(blocks int) (float64, error) {
 }
 
 // GetBlockHeader returns the block header at the given height
-func (c *Client) GetBlockHeader(height int64) (string, error) {
-	result, err := c.call("blockchain.block.header", height)
+func (c *Client) GetBlockHeader(ctx context.Context, height int64) (string, error) {
+	result, err := c.call(ctx, "blockchain.block.header", height)
 	if err != nil {
 		return "", err
 	}
@@ -418,8 +618,8 @@ func (c *Client) GetBlockHeader(height int64) (string, error) {
 }
 
 // Ping sends a ping to keep the connection alive
-func (c *Client) Ping() error {
-	_, err := c.call("server.ping")
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.call(ctx, "server.ping")
 	return err
 }
 
@@ -427,8 +627,8 @@ func (c *Client) Ping() error {
 // The status hash is a hash of the address's transaction history - it changes
 // whenever any transaction involving this address is added or confirmed.
 // Returns nil if the address has no transaction history.
-func (c *Client) Subscribe(scripthash string) (*string, error) {
-	result, err := c.call("blockchain.scripthash.subscribe", scripthash)
+func (c *Client) Subscribe(ctx context.Context, scripthash string) (*string, error) {
+	result, err := c.call(ctx, "blockchain.scripthash.subscribe", scripthash)
 	if err != nil {
 		return nil, err
 	}
@@ -447,9 +647,9 @@ func (c *Client) Subscribe(scripthash string) (*string, error) {
 }
 
 // GetBlockHeight returns the current block height from server
-func (c *Client) GetBlockHeight() (int64, error) {
+func (c *Client) GetBlockHeight(ctx context.Context) (int64, error) {
 	// Subscribe to headers to get current height
-	result, err := c.call("blockchain.headers.subscribe")
+	result, err := c.call(ctx, "blockchain.headers.subscribe")
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,394 @@
+package electrum
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate and key for a local TLS listener
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  string
+}
+
+// newTestCert issues a certificate for 127.0.0.1, signed by parent or
+// self-signed when parent is nil
+func newTestCert(t *testing.T, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("serial: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "electrum test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pem:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+}
+
+func (c *testCert) fingerprint() string {
+	sum := sha256.Sum256(c.cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// newTLSServer starts an Electrum stand-in on a local TLS listener that
+// answers server.version, and returns its ssl:// URL
+func newTLSServer(t *testing.T, cert *testCert) string {
+	t.Helper()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{cert.cert.Raw}, PrivateKey: cert.key}},
+	})
+	if err != nil {
+		t.Fatalf("tls.Listen() error = %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveVersion(conn)
+		}
+	}()
+	return "ssl://" + ln.Addr().String()
+}
+
+// serveVersion answers every request on conn with a server.version result
+func serveVersion(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req rpcRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return
+		}
+		resp, _ := json.Marshal(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: json.RawMessage(`["ElectrumX 1.16","1.4"]`)})
+		conn.Write(append(resp, '\n'))
+	}
+}
+
+func TestTLSVerification(t *testing.T) {
+	ca := newTestCert(t, nil, true)
+	otherCA := newTestCert(t, nil, true)
+	signed := newTestCert(t, ca, false)
+	selfSigned := newTestCert(t, nil, false)
+
+	signedURL := newTLSServer(t, signed)
+	selfSignedURL := newTLSServer(t, selfSigned)
+
+	tests := []struct {
+		name    string
+		url     string
+		opts    Options
+		wantErr string
+	}{
+		{"system roots reject self-signed", selfSignedURL, Options{}, "certificate"},
+		{"pin accepts self-signed", selfSignedURL, Options{TLSCertFingerprint: selfSigned.fingerprint()}, ""},
+		{"pin with colons", selfSignedURL, Options{TLSCertFingerprint: colonHex(selfSigned.fingerprint())}, ""},
+		{"mismatched pin", selfSignedURL, Options{TLSCertFingerprint: signed.fingerprint()}, "does not match pinned fingerprint"},
+		{"CA bundle", signedURL, Options{TLSCAPEM: ca.pem}, ""},
+		{"wrong CA bundle", signedURL, Options{TLSCAPEM: otherCA.pem}, "unknown authority"},
+		{"CA bundle and matching pin", signedURL, Options{TLSCAPEM: ca.pem, TLSCertFingerprint: signed.fingerprint()}, ""},
+		{"CA bundle and mismatched pin", signedURL, Options{TLSCAPEM: ca.pem, TLSCertFingerprint: selfSigned.fingerprint()}, "does not match pinned fingerprint"},
+		{"pin does not bypass CA bundle", signedURL, Options{TLSCAPEM: otherCA.pem, TLSCertFingerprint: signed.fingerprint()}, "unknown authority"},
+		{"skip verify", selfSignedURL, Options{TLSSkipVerify: true}, ""},
+		{"pin overrides skip verify", selfSignedURL, Options{TLSSkipVerify: true, TLSCertFingerprint: signed.fingerprint()}, "does not match pinned fingerprint"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			client, err := NewClientWithOptions(ctx, tt.url, tt.opts)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("NewClientWithOptions() error = %v", err)
+				}
+				client.Close()
+				return
+			}
+			if err == nil {
+				client.Close()
+				t.Fatalf("NewClientWithOptions() succeeded, want error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewClientWithOptions() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func colonHex(s string) string {
+	parts := make([]string, 0, len(s)/2)
+	for i := 0; i < len(s); i += 2 {
+		parts = append(parts, strings.ToUpper(s[i:i+2]))
+	}
+	return strings.Join(parts, ":")
+}
+
+func TestParseFingerprint(t *testing.T) {
+	const fp = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"hex", fp, false},
+		{"colons", colonHex(fp), false},
+		{"too short", fp[:62], true},
+		{"not hex", strings.Repeat("zz", 32), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pin, err := ParseFingerprint(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFingerprint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && hex.EncodeToString(pin) != fp {
+				t.Errorf("ParseFingerprint() = %x, want %s", pin, fp)
+			}
+		})
+	}
+}
+
+// pipeServer is the far end of a client connected over net.Pipe. Requests
+// are delivered on requests and answered explicitly with respond.
+type pipeServer struct {
+	conn     net.Conn
+	requests chan rpcRequest
+}
+
+// newPipeClient returns a client wired to an in-memory server connection
+func newPipeClient(t *testing.T, opts Options) (*Client, *pipeServer) {
+	t.Helper()
+
+	clientConn, serverConn := net.Pipe()
+	c := &Client{
+		conn:     clientConn,
+		respChan: make(map[uint64]chan *rpcResponse),
+		opts:     opts,
+	}
+	go c.readResponses()
+	t.Cleanup(c.Close)
+
+	srv := &pipeServer{conn: serverConn, requests: make(chan rpcRequest, 16)}
+	go func() {
+		defer close(srv.requests)
+		scanner := bufio.NewScanner(serverConn)
+		for scanner.Scan() {
+			var req rpcRequest
+			if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+				return
+			}
+			srv.requests <- req
+		}
+	}()
+	t.Cleanup(func() { serverConn.Close() })
+	return c, srv
+}
+
+// next waits for the next request the client sends
+func (s *pipeServer) next(t *testing.T) rpcRequest {
+	t.Helper()
+	select {
+	case req := <-s.requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a request")
+		return rpcRequest{}
+	}
+}
+
+func (s *pipeServer) respond(t *testing.T, id uint64, result string) {
+	t.Helper()
+	resp, _ := json.Marshal(rpcResponse{JSONRPC: "2.0", ID: id, Result: json.RawMessage(result)})
+	if _, err := s.conn.Write(append(resp, '\n')); err != nil {
+		t.Fatalf("write response: %v", err)
+	}
+}
+
+func (c *Client) pending() int {
+	c.respMu.Lock()
+	defer c.respMu.Unlock()
+	return len(c.respChan)
+}
+
+func TestCallCancelledKeepsConnection(t *testing.T) {
+	c, srv := newPipeClient(t, Options{RequestTimeout: 5 * time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.call(ctx, "blockchain.scripthash.get_history", "aa")
+		errCh <- err
+	}()
+
+	stale := srv.next(t)
+	cancel()
+	err := <-errCh
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("call() error = %v, want context.Canceled", err)
+	}
+	if c.IsDead() {
+		t.Error("a cancelled call marked the connection dead")
+	}
+	if n := c.pending(); n != 0 {
+		t.Errorf("%d requests still pending after cancellation", n)
+	}
+
+	// The late response to the cancelled request is discarded and the
+	// connection keeps serving new calls
+	srv.respond(t, stale.ID, `"late"`)
+
+	done := make(chan struct{})
+	var result json.RawMessage
+	go func() {
+		defer close(done)
+		result, err = c.call(context.Background(), "server.ping")
+	}()
+	req := srv.next(t)
+	if req.ID == stale.ID {
+		t.Fatal("request ID reused after cancellation")
+	}
+	srv.respond(t, req.ID, `null`)
+	<-done
+
+	if err != nil {
+		t.Fatalf("call() after cancellation error = %v", err)
+	}
+	if string(result) != "null" {
+		t.Errorf("call() result = %s, want the new response", result)
+	}
+}
+
+func TestCallAlreadyCancelled(t *testing.T) {
+	c, _ := newPipeClient(t, Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.call(ctx, "server.ping"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("call() error = %v, want context.Canceled", err)
+	}
+	if c.IsDead() || c.pending() != 0 {
+		t.Error("a call with a cancelled context touched the connection")
+	}
+}
+
+func TestCallRequestTimeoutMarksDead(t *testing.T) {
+	c, srv := newPipeClient(t, Options{RequestTimeout: 50 * time.Millisecond})
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.call(context.Background(), "blockchain.estimatefee", 6)
+		errCh <- err
+	}()
+	srv.next(t) // never answered
+
+	err := <-errCh
+	if err == nil || !strings.Contains(err.Error(), "request timeout") {
+		t.Fatalf("call() error = %v, want request timeout", err)
+	}
+	if !c.IsDead() {
+		t.Error("request_timeout did not mark the connection dead")
+	}
+	if n := c.pending(); n != 0 {
+		t.Errorf("%d requests still pending after timeout", n)
+	}
+
+	if _, err := c.call(context.Background(), "server.ping"); err == nil || !strings.Contains(err.Error(), "connection is dead") {
+		t.Errorf("call() on a dead connection error = %v", err)
+	}
+}
+
+func TestCallConnectionClosed(t *testing.T) {
+	c, srv := newPipeClient(t, Options{RequestTimeout: 5 * time.Second})
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.call(context.Background(), "server.ping")
+		errCh <- err
+	}()
+	srv.next(t)
+	srv.conn.Close()
+
+	err := <-errCh
+	if err == nil || !strings.Contains(err.Error(), "connection closed") {
+		t.Fatalf("call() error = %v, want connection closed", err)
+	}
+	if !c.IsDead() {
+		t.Error("a closed connection was not marked dead")
+	}
+}
+
+func TestCallServerError(t *testing.T) {
+	c, srv := newPipeClient(t, Options{})
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.call(context.Background(), "blockchain.transaction.broadcast", "00")
+		errCh <- err
+	}()
+	req := srv.next(t)
+	resp, _ := json.Marshal(rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: 1, Message: "TX decode failed"}})
+	srv.conn.Write(append(resp, '\n'))
+
+	err := <-errCh
+	if err == nil || !strings.Contains(err.Error(), "TX decode failed") {
+		t.Fatalf("call() error = %v, want the server error", err)
+	}
+	if c.IsDead() {
+		t.Error("an RPC error marked the connection dead")
+	}
+}
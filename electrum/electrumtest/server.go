@@ -0,0 +1,513 @@
+// Package electrumtest provides an in-memory Electrum server for tests.
+//
+// The server speaks the same newline-delimited JSON-RPC protocol as a real
+// Electrum server and implements every method electrum.Client calls. Chain
+// state is an in-memory UTXO set: tests fund scripts with Fund, confirm the
+// mempool with Mine, and broadcast transactions are checked with the script
+// engine before their inputs are spent and their outputs added.
+package electrumtest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/djschnei21/vault-plugin-btc/electrum"
+)
+
+const (
+	// DefaultHeight is the chain tip of a new server
+	DefaultHeight = 100
+
+	// DefaultFeeRate is the estimatefee result of a new server in BTC/kvB (10 sat/vB)
+	DefaultFeeRate = 0.0001
+
+	// maxLineSize bounds a single JSON-RPC request line
+	maxLineSize = 4 << 20
+)
+
+// Server is an in-memory Electrum server listening on a loopback TCP port
+type Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu         sync.Mutex
+	conns      map[net.Conn]struct{}
+	txs        map[chainhash.Hash]*txEntry
+	order      []chainhash.Hash // transactions in the order they were added
+	coins      map[wire.OutPoint]*coin
+	broadcasts []*wire.MsgTx
+	height     int64
+	feeRate    float64
+	nonce      uint32
+	closed     bool
+}
+
+// txEntry is a known transaction and the height it confirmed at (0 = mempool)
+type txEntry struct {
+	tx     *wire.MsgTx
+	height int64
+}
+
+// coin is a transaction output, spent or not
+type coin struct {
+	out     *wire.TxOut
+	spentBy *chainhash.Hash
+}
+
+type request struct {
+	ID     uint64            `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type response struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      uint64      `json:"id"`
+	Result  interface{} `json:"result"`
+	Error   *rpcError   `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewServer starts a server on a random loopback port
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	s := &Server{
+		ln:      ln,
+		conns:   make(map[net.Conn]struct{}),
+		txs:     make(map[chainhash.Hash]*txEntry),
+		coins:   make(map[wire.OutPoint]*coin),
+		height:  DefaultHeight,
+		feeRate: DefaultFeeRate,
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// URL returns the tcp:// URL clients connect to
+func (s *Server) URL() string {
+	return "tcp://" + s.ln.Addr().String()
+}
+
+// Close stops the server and drops all client connections
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+// Fund adds an unconfirmed transaction paying value satoshis to pkScript and
+// returns the funded outpoint. Call Mine to confirm it.
+func (s *Server) Fund(pkScript []byte, value int64) wire.OutPoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Spend a unique fake outpoint so every funding transaction has its own txid
+	s.nonce++
+	var seed [4]byte
+	binary.LittleEndian.PutUint32(seed[:], s.nonce)
+	prev := wire.OutPoint{Hash: chainhash.HashH(seed[:]), Index: 0}
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&prev, seed[:], nil))
+	tx.AddTxOut(wire.NewTxOut(value, pkScript))
+
+	s.addTx(tx)
+	return wire.OutPoint{Hash: tx.TxHash(), Index: 0}
+}
+
+// Mine confirms every mempool transaction in the next block and then advances
+// the tip by the remaining blocks
+func (s *Server) Mine(blocks int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if blocks <= 0 {
+		return
+	}
+	s.height++
+	for _, entry := range s.txs {
+		if entry.height == 0 {
+			entry.height = s.height
+		}
+	}
+	s.height += int64(blocks - 1)
+}
+
+// Height returns the current chain tip
+func (s *Server) Height() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.height
+}
+
+// BlockTransactions returns the txids confirmed at height in the order they
+// were added. Electrum cannot list block transactions, so tests use this to
+// stand in for a backend that can.
+func (s *Server) BlockTransactions(height int64) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var txids []string
+	for _, txid := range s.order {
+		if s.txs[txid].height == height {
+			txids = append(txids, txid.String())
+		}
+	}
+	return txids
+}
+
+// SetFeeRate sets the estimatefee result in BTC/kvB; -1 reports no estimate
+func (s *Server) SetFeeRate(btcPerKvB float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.feeRate = btcPerKvB
+}
+
+// Broadcasts returns the transactions accepted through
+// blockchain.transaction.broadcast, oldest first
+func (s *Server) Broadcasts() []*wire.MsgTx {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*wire.MsgTx(nil), s.broadcasts...)
+}
+
+// Unspent returns the total unspent value paid to pkScript, including mempool outputs
+func (s *Server) Unspent(pkScript []byte) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total int64
+	for _, c := range s.coins {
+		if c.spentBy == nil && bytes.Equal(c.out.PkScript, pkScript) {
+			total += c.out.Value
+		}
+	}
+	return total
+}
+
+// addTx records a transaction in the mempool, spending its inputs and adding its outputs.
+// Caller must hold s.mu.
+func (s *Server) addTx(tx *wire.MsgTx) {
+	txid := tx.TxHash()
+	s.txs[txid] = &txEntry{tx: tx}
+	s.order = append(s.order, txid)
+
+	for _, in := range tx.TxIn {
+		if c, ok := s.coins[in.PreviousOutPoint]; ok {
+			c.spentBy = &txid
+		}
+	}
+	for i, out := range tx.TxOut {
+		s.coins[wire.OutPoint{Hash: txid, Index: uint32(i)}] = &coin{out: out}
+	}
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	encoder := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return
+		}
+
+		resp := response{JSONRPC: "2.0", ID: req.ID}
+		result, err := s.dispatch(req.Method, req.Params)
+		if err != nil {
+			resp.Error = err
+		} else {
+			resp.Result = result
+		}
+
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// dispatch runs one JSON-RPC method against the chain state
+func (s *Server) dispatch(method string, params []json.RawMessage) (interface{}, *rpcError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch method {
+	case "server.version":
+		return []string{"electrumtest", "1.4"}, nil
+	case "server.ping":
+		return nil, nil
+	case "blockchain.headers.subscribe":
+		return map[string]interface{}{
+			"height": s.height,
+			"hex":    emptyHeaderHex,
+		}, nil
+	case "blockchain.block.header":
+		return emptyHeaderHex, nil
+	case "blockchain.estimatefee":
+		return s.feeRate, nil
+	}
+
+	var arg string
+	if len(params) < 1 || json.Unmarshal(params[0], &arg) != nil {
+		if _, known := paramMethods[method]; known {
+			return nil, &rpcError{Code: -32602, Message: "invalid params"}
+		}
+		return nil, &rpcError{Code: -32601, Message: "unknown method " + method}
+	}
+
+	switch method {
+	case "blockchain.scripthash.get_balance":
+		return s.balance(arg), nil
+	case "blockchain.scripthash.listunspent":
+		return s.listUnspent(arg), nil
+	case "blockchain.scripthash.get_history":
+		return s.history(arg), nil
+	case "blockchain.scripthash.subscribe":
+		return s.status(arg), nil
+	case "blockchain.transaction.get":
+		hash, err := chainhash.NewHashFromStr(arg)
+		if err != nil {
+			return nil, &rpcError{Code: 1, Message: "invalid tx hash"}
+		}
+		entry, ok := s.txs[*hash]
+		if !ok {
+			return nil, &rpcError{Code: 1, Message: "No such mempool or blockchain transaction"}
+		}
+		var buf bytes.Buffer
+		if err := entry.tx.Serialize(&buf); err != nil {
+			return nil, &rpcError{Code: 1, Message: err.Error()}
+		}
+		return hex.EncodeToString(buf.Bytes()), nil
+	case "blockchain.transaction.broadcast":
+		txid, err := s.broadcast(arg)
+		if err != nil {
+			return nil, &rpcError{Code: 1, Message: err.Error()}
+		}
+		return txid, nil
+	default:
+		return nil, &rpcError{Code: -32601, Message: "unknown method " + method}
+	}
+}
+
+// paramMethods are the methods that take a string parameter
+var paramMethods = map[string]struct{}{
+	"blockchain.scripthash.get_balance": {},
+	"blockchain.scripthash.listunspent": {},
+	"blockchain.scripthash.get_history": {},
+	"blockchain.scripthash.subscribe":   {},
+	"blockchain.transaction.get":        {},
+	"blockchain.transaction.broadcast":  {},
+}
+
+// emptyHeaderHex is an all-zero 80-byte block header
+var emptyHeaderHex = hex.EncodeToString(make([]byte, 80))
+
+// matches reports whether pkScript hashes to the Electrum scripthash
+func matches(pkScript []byte, scripthash string) bool {
+	return electrum.AddressToScriptHash(pkScript) == scripthash
+}
+
+// balance splits the scripthash balance into confirmed and mempool parts the
+// way Electrum does: confirmed ignores mempool spends, unconfirmed is the
+// mempool delta
+func (s *Server) balance(scripthash string) electrum.Balance {
+	var bal electrum.Balance
+	for op, c := range s.coins {
+		if !matches(c.out.PkScript, scripthash) {
+			continue
+		}
+		if s.txs[op.Hash].height > 0 {
+			bal.Confirmed += c.out.Value
+			if c.spentBy != nil {
+				if s.txs[*c.spentBy].height > 0 {
+					bal.Confirmed -= c.out.Value
+				} else {
+					bal.Unconfirmed -= c.out.Value
+				}
+			}
+		} else if c.spentBy == nil {
+			bal.Unconfirmed += c.out.Value
+		}
+	}
+	return bal
+}
+
+func (s *Server) listUnspent(scripthash string) []electrum.UTXO {
+	utxos := []electrum.UTXO{}
+	for _, txid := range s.order {
+		entry := s.txs[txid]
+		for i, out := range entry.tx.TxOut {
+			c := s.coins[wire.OutPoint{Hash: txid, Index: uint32(i)}]
+			if c.spentBy != nil || !matches(out.PkScript, scripthash) {
+				continue
+			}
+			utxos = append(utxos, electrum.UTXO{
+				TxHash: txid.String(),
+				TxPos:  i,
+				Height: entry.height,
+				Value:  out.Value,
+			})
+		}
+	}
+	return utxos
+}
+
+// history lists every transaction paying to or spending from the scripthash,
+// confirmed ones first in block order
+func (s *Server) history(scripthash string) []electrum.Transaction {
+	history := []electrum.Transaction{}
+	for _, txid := range s.order {
+		entry := s.txs[txid]
+		if s.touches(entry.tx, scripthash) {
+			history = append(history, electrum.Transaction{
+				TxHash: txid.String(),
+				Height: entry.height,
+			})
+		}
+	}
+	return history
+}
+
+func (s *Server) touches(tx *wire.MsgTx, scripthash string) bool {
+	for _, out := range tx.TxOut {
+		if matches(out.PkScript, scripthash) {
+			return true
+		}
+	}
+	for _, in := range tx.TxIn {
+		if c, ok := s.coins[in.PreviousOutPoint]; ok && matches(c.out.PkScript, scripthash) {
+			return true
+		}
+	}
+	return false
+}
+
+// status is the Electrum status hash: sha256 over "txid:height:" for every
+// history entry, or nil when the scripthash has no history
+func (s *Server) status(scripthash string) *string {
+	history := s.history(scripthash)
+	if len(history) == 0 {
+		return nil
+	}
+
+	var preimage bytes.Buffer
+	for _, tx := range history {
+		fmt.Fprintf(&preimage, "%s:%d:", tx.TxHash, tx.Height)
+	}
+	sum := sha256.Sum256(preimage.Bytes())
+	status := hex.EncodeToString(sum[:])
+	return &status
+}
+
+// broadcast validates a raw transaction against the UTXO set and the script
+// engine and adds it to the mempool
+func (s *Server) broadcast(rawHex string) (string, error) {
+	raw, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return "", fmt.Errorf("TX decode failed: %w", err)
+	}
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return "", fmt.Errorf("TX decode failed: %w", err)
+	}
+
+	txid := tx.TxHash()
+	if _, ok := s.txs[txid]; ok {
+		return "", fmt.Errorf("txn-already-known")
+	}
+
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	var inputTotal int64
+	for _, in := range tx.TxIn {
+		c, ok := s.coins[in.PreviousOutPoint]
+		if !ok || c.spentBy != nil {
+			return "", fmt.Errorf("bad-txns-inputs-missingorspent")
+		}
+		prevOuts.AddPrevOut(in.PreviousOutPoint, c.out)
+		inputTotal += c.out.Value
+	}
+
+	var outputTotal int64
+	for _, out := range tx.TxOut {
+		outputTotal += out.Value
+	}
+	if outputTotal > inputTotal {
+		return "", fmt.Errorf("bad-txns-in-belowout")
+	}
+
+	sigHashes := txscript.NewTxSigHashes(tx, prevOuts)
+	for i, in := range tx.TxIn {
+		prevOut := prevOuts.FetchPrevOutput(in.PreviousOutPoint)
+		engine, err := txscript.NewEngine(prevOut.PkScript, tx, i,
+			txscript.StandardVerifyFlags, nil, sigHashes, prevOut.Value, prevOuts)
+		if err != nil {
+			return "", fmt.Errorf("mandatory-script-verify-flag-failed (input %d): %w", i, err)
+		}
+		if err := engine.Execute(); err != nil {
+			return "", fmt.Errorf("mandatory-script-verify-flag-failed (input %d): %w", i, err)
+		}
+	}
+
+	s.addTx(tx)
+	s.broadcasts = append(s.broadcasts, tx)
+	return txid.String(), nil
+}
@@ -0,0 +1,187 @@
+package electrumtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/djschnei21/vault-plugin-btc/electrum"
+)
+
+// newTestClient starts a server and connects a real Electrum client to it
+func newTestClient(t *testing.T) (*Server, *electrum.Client) {
+	t.Helper()
+
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(srv.Close)
+
+	client, err := electrum.NewClient(context.Background(), srv.URL())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(client.Close)
+
+	return srv, client
+}
+
+// p2wpkhScript returns a fresh key and its P2WPKH scriptPubKey
+func p2wpkhScript(t *testing.T) (*btcec.PrivateKey, []byte) {
+	t.Helper()
+
+	key, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(
+		btcutil.Hash160(key.PubKey().SerializeCompressed()), &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, script
+}
+
+func TestFundAndMine(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestClient(t)
+	_, script := p2wpkhScript(t)
+	scripthash := electrum.AddressToScriptHash(script)
+
+	status, err := client.Subscribe(ctx, scripthash)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if status != nil {
+		t.Errorf("Subscribe() = %q, want nil before funding", *status)
+	}
+
+	srv.Fund(script, 50000)
+
+	bal, err := client.GetBalance(ctx, scripthash)
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	if bal.Confirmed != 0 || bal.Unconfirmed != 50000 {
+		t.Errorf("GetBalance() = %+v, want 0 confirmed, 50000 unconfirmed", bal)
+	}
+
+	mempoolStatus, _ := client.Subscribe(ctx, scripthash)
+	srv.Mine(1)
+
+	bal, err = client.GetBalance(ctx, scripthash)
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	if bal.Confirmed != 50000 || bal.Unconfirmed != 0 {
+		t.Errorf("GetBalance() = %+v, want 50000 confirmed", bal)
+	}
+
+	confirmedStatus, _ := client.Subscribe(ctx, scripthash)
+	if mempoolStatus == nil || confirmedStatus == nil || *mempoolStatus == *confirmedStatus {
+		t.Error("status hash should change when the funding transaction confirms")
+	}
+
+	height, err := client.GetBlockHeight(ctx)
+	if err != nil {
+		t.Fatalf("GetBlockHeight() error = %v", err)
+	}
+	if height != DefaultHeight+1 {
+		t.Errorf("GetBlockHeight() = %d, want %d", height, DefaultHeight+1)
+	}
+
+	utxos, err := client.ListUnspent(ctx, scripthash)
+	if err != nil {
+		t.Fatalf("ListUnspent() error = %v", err)
+	}
+	if len(utxos) != 1 || utxos[0].Height != height || utxos[0].Value != 50000 {
+		t.Errorf("ListUnspent() = %+v, want one confirmed 50000 sat UTXO", utxos)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestClient(t)
+	key, script := p2wpkhScript(t)
+	_, destScript := p2wpkhScript(t)
+
+	funded := srv.Fund(script, 100000)
+	srv.Mine(1)
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&funded, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(99000, destScript))
+
+	prevOuts := txscript.NewCannedPrevOutputFetcher(script, 100000)
+	sigHashes := txscript.NewTxSigHashes(tx, prevOuts)
+
+	encode := func(tx *wire.MsgTx) string {
+		var buf bytes.Buffer
+		if err := tx.Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return hex.EncodeToString(buf.Bytes())
+	}
+
+	// Unsigned transactions fail script verification
+	if _, err := client.BroadcastTransaction(ctx, encode(tx)); err == nil ||
+		!strings.Contains(err.Error(), "script-verify") {
+		t.Fatalf("BroadcastTransaction(unsigned) error = %v, want script verification failure", err)
+	}
+
+	witness, err := txscript.WitnessSignature(tx, sigHashes, 0, 100000, script, txscript.SigHashAll, key, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.TxIn[0].Witness = witness
+
+	txid, err := client.BroadcastTransaction(ctx, encode(tx))
+	if err != nil {
+		t.Fatalf("BroadcastTransaction() error = %v", err)
+	}
+	if txid != tx.TxHash().String() {
+		t.Errorf("BroadcastTransaction() = %s, want %s", txid, tx.TxHash())
+	}
+
+	if got := srv.Unspent(script); got != 0 {
+		t.Errorf("Unspent(source) = %d, want 0", got)
+	}
+	if got := srv.Unspent(destScript); got != 99000 {
+		t.Errorf("Unspent(dest) = %d, want 99000", got)
+	}
+
+	// Confirmed balance ignores the mempool spend, unconfirmed carries the delta
+	bal, err := client.GetBalance(ctx, electrum.AddressToScriptHash(script))
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	if bal.Confirmed != 100000 || bal.Unconfirmed != -100000 {
+		t.Errorf("GetBalance() = %+v, want 100000 confirmed, -100000 unconfirmed", bal)
+	}
+
+	raw, err := client.GetTransaction(ctx, txid)
+	if err != nil {
+		t.Fatalf("GetTransaction() error = %v", err)
+	}
+	if raw != encode(tx) {
+		t.Error("GetTransaction() did not return the broadcast transaction")
+	}
+
+	// Double spends are rejected
+	if _, err := client.BroadcastTransaction(ctx, encode(tx)); err == nil {
+		t.Error("BroadcastTransaction() accepted a duplicate transaction")
+	}
+}
@@ -0,0 +1,294 @@
+package esplora
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// RequestTimeout is the default timeout for individual HTTP requests
+	RequestTimeout = 30 * time.Second
+
+	// chainPageSize is the number of confirmed transactions Esplora returns per page
+	chainPageSize = 25
+)
+
+// Client is an Esplora REST API client (mempool.space, blockstream.info)
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// Options holds connection settings for a Client
+type Options struct {
+	// RequestTimeout bounds a single HTTP request (default: 30s)
+	RequestTimeout time.Duration
+	// SOCKS5Proxy routes requests through a SOCKS5 proxy such as Tor.
+	// Accepts host:port or socks5://[user:pass@]host:port.
+	SOCKS5Proxy string
+}
+
+// TxStatus is the confirmation status of a transaction or output
+type TxStatus struct {
+	Confirmed   bool  `json:"confirmed"`
+	BlockHeight int64 `json:"block_height"`
+}
+
+// UTXO is an unspent output returned by /address/:addr/utxo
+type UTXO struct {
+	TxID   string   `json:"txid"`
+	Vout   int      `json:"vout"`
+	Value  int64    `json:"value"`
+	Status TxStatus `json:"status"`
+}
+
+// Tx is a transaction summary returned by /address/:addr/txs
+type Tx struct {
+	TxID   string   `json:"txid"`
+	Fee    int64    `json:"fee"`
+	Status TxStatus `json:"status"`
+}
+
+// Stats holds funded/spent totals for one side (chain or mempool) of an address
+type Stats struct {
+	FundedTxoSum int64 `json:"funded_txo_sum"`
+	SpentTxoSum  int64 `json:"spent_txo_sum"`
+	TxCount      int64 `json:"tx_count"`
+}
+
+// AddressInfo is returned by /address/:addr
+type AddressInfo struct {
+	Address      string `json:"address"`
+	ChainStats   Stats  `json:"chain_stats"`
+	MempoolStats Stats  `json:"mempool_stats"`
+}
+
+// NewClient creates a new Esplora client for the given API base URL,
+// e.g. https://mempool.space/api
+func NewClient(baseURL string, opts Options) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Esplora URL %q: must be an http:// or https:// URL", baseURL)
+	}
+
+	timeout := opts.RequestTimeout
+	if timeout <= 0 {
+		timeout = RequestTimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.SOCKS5Proxy != "" {
+		proxyURL := opts.SOCKS5Proxy
+		if !strings.Contains(proxyURL, "://") {
+			proxyURL = "socks5://" + proxyURL
+		}
+		parsed, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOCKS5 proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(parsed)
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout, Transport: transport},
+	}, nil
+}
+
+// Close releases idle HTTP connections
+func (c *Client) Close() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// do performs a request and returns the response body, failing on non-2xx status
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s failed: HTTP %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	return respBody, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, result interface{}) error {
+	body, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("failed to parse %s response: %w", path, err)
+	}
+	return nil
+}
+
+// GetAddress returns funded/spent totals for an address
+func (c *Client) GetAddress(ctx context.Context, address string) (*AddressInfo, error) {
+	var info AddressInfo
+	if err := c.getJSON(ctx, "/address/"+url.PathEscape(address), &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetAddressUTXOs returns the unspent outputs of an address, including mempool
+func (c *Client) GetAddressUTXOs(ctx context.Context, address string) ([]UTXO, error) {
+	var utxos []UTXO
+	if err := c.getJSON(ctx, "/address/"+url.PathEscape(address)+"/utxo", &utxos); err != nil {
+		return nil, err
+	}
+	return utxos, nil
+}
+
+// GetAddressTxs returns the full transaction history of an address.
+// The first page holds mempool transactions plus the newest confirmed ones;
+// older confirmed transactions are paged via /txs/chain/:last_seen_txid.
+func (c *Client) GetAddressTxs(ctx context.Context, address string) ([]Tx, error) {
+	base := "/address/" + url.PathEscape(address) + "/txs"
+
+	var txs []Tx
+	if err := c.getJSON(ctx, base, &txs); err != nil {
+		return nil, err
+	}
+
+	// A full page of confirmed transactions means there may be more
+	lastPage := 0
+	for _, tx := range txs {
+		if tx.Status.Confirmed {
+			lastPage++
+		}
+	}
+
+	for lastPage >= chainPageSize {
+		var page []Tx
+		if err := c.getJSON(ctx, base+"/chain/"+txs[len(txs)-1].TxID, &page); err != nil {
+			return nil, err
+		}
+		txs = append(txs, page...)
+		lastPage = len(page)
+	}
+
+	return txs, nil
+}
+
+// GetTransactionHex returns a raw transaction as hex
+func (c *Client) GetTransactionHex(ctx context.Context, txid string) (string, error) {
+	body, err := c.do(ctx, http.MethodGet, "/tx/"+url.PathEscape(txid)+"/hex", nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// BroadcastTransaction submits a raw transaction and returns its txid
+func (c *Client) BroadcastTransaction(ctx context.Context, rawtx string) (string, error) {
+	body, err := c.do(ctx, http.MethodPost, "/tx", strings.NewReader(rawtx))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// GetFeeEstimates returns fee rates in sat/vB keyed by confirmation target
+func (c *Client) GetFeeEstimates(ctx context.Context) (map[int]float64, error) {
+	var raw map[string]float64
+	if err := c.getJSON(ctx, "/fee-estimates", &raw); err != nil {
+		return nil, err
+	}
+
+	estimates := make(map[int]float64, len(raw))
+	for target, rate := range raw {
+		blocks, err := strconv.Atoi(target)
+		if err != nil {
+			continue
+		}
+		estimates[blocks] = rate
+	}
+	return estimates, nil
+}
+
+// EstimateFee returns the fee rate in BTC/kvB for a confirmation target,
+// or -1 if no estimate is available (matching Electrum's estimatefee).
+// Uses the closest target at or below the requested one.
+func (c *Client) EstimateFee(ctx context.Context, blocks int) (float64, error) {
+	estimates, err := c.GetFeeEstimates(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(estimates) == 0 {
+		return -1, nil
+	}
+
+	targets := make([]int, 0, len(estimates))
+	for target := range estimates {
+		targets = append(targets, target)
+	}
+	sort.Ints(targets)
+
+	chosen := targets[0]
+	for _, target := range targets {
+		if target > blocks {
+			break
+		}
+		chosen = target
+	}
+
+	// sat/vB -> BTC/kvB
+	return estimates[chosen] / 1e5, nil
+}
+
+// GetTipHeight returns the current block height
+func (c *Client) GetTipHeight(ctx context.Context) (int64, error) {
+	body, err := c.do(ctx, http.MethodGet, "/blocks/tip/height", nil)
+	if err != nil {
+		return 0, err
+	}
+	height, err := strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse tip height: %w", err)
+	}
+	return height, nil
+}
+
+// GetBlockHash returns the hash of the block at a height on the active chain
+func (c *Client) GetBlockHash(ctx context.Context, height int64) (string, error) {
+	body, err := c.do(ctx, http.MethodGet, "/block-height/"+strconv.FormatInt(height, 10), nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// GetBlockTxIDs returns the txids of a block in block order
+func (c *Client) GetBlockTxIDs(ctx context.Context, hash string) ([]string, error) {
+	var txids []string
+	if err := c.getJSON(ctx, "/block/"+url.PathEscape(hash)+"/txids", &txids); err != nil {
+		return nil, err
+	}
+	return txids, nil
+}
@@ -0,0 +1,299 @@
+package esplora
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testAddress = "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx"
+
+// newTestServer returns an in-process Esplora stand-in
+func newTestServer(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(srv.URL+"/api", Options{})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{"https", "https://mempool.space/api", false},
+		{"http", "http://127.0.0.1:3002", false},
+		{"missing scheme", "mempool.space/api", true},
+		{"tcp scheme", "tcp://mempool.space", true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(tt.url, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClient(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetAddress(t *testing.T) {
+	client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/address/"+testAddress {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"address":"`+testAddress+`",
+			"chain_stats":{"funded_txo_sum":150000,"spent_txo_sum":50000,"tx_count":3},
+			"mempool_stats":{"funded_txo_sum":2000,"spent_txo_sum":0,"tx_count":1}}`)
+	})
+
+	info, err := client.GetAddress(context.Background(), testAddress)
+	if err != nil {
+		t.Fatalf("GetAddress() error = %v", err)
+	}
+
+	if got := info.ChainStats.FundedTxoSum - info.ChainStats.SpentTxoSum; got != 100000 {
+		t.Errorf("confirmed balance = %d, want 100000", got)
+	}
+	if got := info.MempoolStats.FundedTxoSum - info.MempoolStats.SpentTxoSum; got != 2000 {
+		t.Errorf("unconfirmed balance = %d, want 2000", got)
+	}
+}
+
+func TestGetAddressUTXOs(t *testing.T) {
+	client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/address/"+testAddress+"/utxo" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `[
+			{"txid":"aa","vout":0,"value":50000,"status":{"confirmed":true,"block_height":100}},
+			{"txid":"bb","vout":2,"value":2000,"status":{"confirmed":false}}
+		]`)
+	})
+
+	utxos, err := client.GetAddressUTXOs(context.Background(), testAddress)
+	if err != nil {
+		t.Fatalf("GetAddressUTXOs() error = %v", err)
+	}
+
+	if len(utxos) != 2 {
+		t.Fatalf("GetAddressUTXOs() returned %d UTXOs, want 2", len(utxos))
+	}
+	if utxos[0].TxID != "aa" || utxos[0].Value != 50000 || !utxos[0].Status.Confirmed || utxos[0].Status.BlockHeight != 100 {
+		t.Errorf("utxos[0] = %+v", utxos[0])
+	}
+	if utxos[1].Vout != 2 || utxos[1].Status.Confirmed {
+		t.Errorf("utxos[1] = %+v", utxos[1])
+	}
+}
+
+func TestGetAddressTxsPagination(t *testing.T) {
+	// 1 mempool tx + 25 confirmed on the first page, then 25 and 3 on chain pages
+	page := func(prefix string, n int, confirmed bool) []Tx {
+		txs := make([]Tx, n)
+		for i := range txs {
+			txs[i] = Tx{TxID: fmt.Sprintf("%s%02d", prefix, i), Status: TxStatus{Confirmed: confirmed, BlockHeight: 100}}
+		}
+		return txs
+	}
+	first := append(page("m", 1, false), page("a", 25, true)...)
+	pages := map[string][]Tx{
+		"/api/address/" + testAddress + "/txs":           first,
+		"/api/address/" + testAddress + "/txs/chain/a24": page("b", 25, true),
+		"/api/address/" + testAddress + "/txs/chain/b24": page("c", 3, true),
+	}
+
+	client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		txs, ok := pages[r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(txs)
+	})
+
+	txs, err := client.GetAddressTxs(context.Background(), testAddress)
+	if err != nil {
+		t.Fatalf("GetAddressTxs() error = %v", err)
+	}
+
+	if len(txs) != 54 {
+		t.Errorf("GetAddressTxs() returned %d transactions, want 54", len(txs))
+	}
+	if txs[0].Status.Confirmed {
+		t.Error("GetAddressTxs() should keep mempool transactions first")
+	}
+}
+
+func TestGetTransactionHex(t *testing.T) {
+	client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tx/abcd/hex" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "0200000001\n")
+	})
+
+	rawtx, err := client.GetTransactionHex(context.Background(), "abcd")
+	if err != nil {
+		t.Fatalf("GetTransactionHex() error = %v", err)
+	}
+	if rawtx != "0200000001" {
+		t.Errorf("GetTransactionHex() = %q, want %q", rawtx, "0200000001")
+	}
+}
+
+func TestBroadcastTransaction(t *testing.T) {
+	client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/tx" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "bad" {
+			http.Error(w, "sendrawtransaction RPC error: TX decode failed", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, "f00d")
+	})
+
+	txid, err := client.BroadcastTransaction(context.Background(), "0200000001")
+	if err != nil {
+		t.Fatalf("BroadcastTransaction() error = %v", err)
+	}
+	if txid != "f00d" {
+		t.Errorf("BroadcastTransaction() = %q, want %q", txid, "f00d")
+	}
+
+	_, err = client.BroadcastTransaction(context.Background(), "bad")
+	if err == nil {
+		t.Fatal("BroadcastTransaction() should fail on HTTP 400")
+	}
+	if !strings.Contains(err.Error(), "TX decode failed") {
+		t.Errorf("BroadcastTransaction() error = %v, want server message", err)
+	}
+}
+
+func TestEstimateFee(t *testing.T) {
+	client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"1":20.5,"2":15,"3":12,"6":8,"144":1.2}`)
+	})
+
+	tests := []struct {
+		blocks int
+		want   float64 // BTC/kvB
+	}{
+		{1, 20.5 / 1e5},
+		{3, 12.0 / 1e5},
+		{5, 12.0 / 1e5}, // closest target below
+		{6, 8.0 / 1e5},
+		{1008, 1.2 / 1e5},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d blocks", tt.blocks), func(t *testing.T) {
+			got, err := client.EstimateFee(context.Background(), tt.blocks)
+			if err != nil {
+				t.Fatalf("EstimateFee() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("EstimateFee(%d) = %v, want %v", tt.blocks, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateFeeUnavailable(t *testing.T) {
+	client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+
+	got, err := client.EstimateFee(context.Background(), 6)
+	if err != nil {
+		t.Fatalf("EstimateFee() error = %v", err)
+	}
+	if got != -1 {
+		t.Errorf("EstimateFee() = %v, want -1", got)
+	}
+}
+
+func TestGetTipHeight(t *testing.T) {
+	client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/blocks/tip/height" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "875123")
+	})
+
+	height, err := client.GetTipHeight(context.Background())
+	if err != nil {
+		t.Fatalf("GetTipHeight() error = %v", err)
+	}
+	if height != 875123 {
+		t.Errorf("GetTipHeight() = %d, want 875123", height)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := client.GetTipHeight(ctx); err == nil {
+		t.Error("GetTipHeight() should fail with a cancelled context")
+	}
+}
+
+func TestGetBlockTxIDs(t *testing.T) {
+	const hash = "0000000000000000000212f0a6cf8a5eb0b9e9d4c3b3e7b0d1a1c1f1e1d1c1b1"
+	client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/block-height/840000":
+			fmt.Fprint(w, hash+"\n")
+		case "/api/block/" + hash + "/txids":
+			fmt.Fprint(w, `["aa","bb"]`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	got, err := client.GetBlockHash(context.Background(), 840000)
+	if err != nil {
+		t.Fatalf("GetBlockHash() error = %v", err)
+	}
+	if got != hash {
+		t.Errorf("GetBlockHash() = %q, want %q", got, hash)
+	}
+
+	txids, err := client.GetBlockTxIDs(context.Background(), hash)
+	if err != nil {
+		t.Fatalf("GetBlockTxIDs() error = %v", err)
+	}
+	if len(txids) != 2 || txids[0] != "aa" || txids[1] != "bb" {
+		t.Errorf("GetBlockTxIDs() = %v, want [aa bb]", txids)
+	}
+
+	if _, err := client.GetBlockHash(context.Background(), 1); err == nil {
+		t.Error("GetBlockHash() of an unknown height succeeded")
+	}
+}
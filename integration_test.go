@@ -0,0 +1,2070 @@
+package btc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/djschnei21/vault-plugin-btc/electrum"
+	"github.com/djschnei21/vault-plugin-btc/electrum/electrumtest"
+	"github.com/djschnei21/vault-plugin-btc/wallet"
+)
+
+// regtestEnv is a backend connected to an in-memory Electrum server
+type regtestEnv struct {
+	t       *testing.T
+	b       logical.Backend
+	storage logical.Storage
+	chain   *electrumtest.Server
+	network string // address network of the configured chain
+}
+
+// newRegtestEnv returns a backend configured for regtest
+func newRegtestEnv(t *testing.T) *regtestEnv {
+	t.Helper()
+	return newChainEnv(t, map[string]interface{}{"network": "regtest"})
+}
+
+// newChainEnv returns a backend with the given config, pointed at a new in-memory Electrum server
+func newChainEnv(t *testing.T, config map[string]interface{}) *regtestEnv {
+	t.Helper()
+
+	chain, err := electrumtest.NewServer()
+	if err != nil {
+		t.Fatalf("failed to start Electrum server: %v", err)
+	}
+	t.Cleanup(chain.Close)
+
+	backendConfig := logical.TestBackendConfig()
+	backendConfig.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), backendConfig)
+	if err != nil {
+		t.Fatalf("Factory() error = %v", err)
+	}
+	t.Cleanup(func() { b.Cleanup(context.Background()) })
+
+	env := &regtestEnv{t: t, b: b, storage: backendConfig.StorageView, chain: chain}
+	config["electrum_url"] = chain.URL()
+	env.write("config", config)
+
+	env.network, err = getNetwork(context.Background(), env.storage)
+	if err != nil {
+		t.Fatalf("getNetwork() error = %v", err)
+	}
+	return env
+}
+
+// request runs an operation and fails the test on any error response
+func (e *regtestEnv) request(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	e.t.Helper()
+
+	resp, err := e.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: op,
+		Path:      path,
+		Data:      data,
+		Storage:   e.storage,
+	})
+	if err != nil {
+		e.t.Fatalf("%s %s: error = %v", op, path, err)
+	}
+	if resp != nil && resp.IsError() {
+		e.t.Fatalf("%s %s: error response = %v", op, path, resp.Error())
+	}
+	return resp
+}
+
+func (e *regtestEnv) write(path string, data map[string]interface{}) *logical.Response {
+	e.t.Helper()
+	return e.request(logical.CreateOperation, path, data)
+}
+
+// createWallet creates a wallet and returns count fresh receive addresses
+func (e *regtestEnv) createWallet(name, addressType string, count int) []string {
+	e.t.Helper()
+
+	e.write("wallets/"+name, map[string]interface{}{"address_type": addressType})
+	resp := e.request(logical.UpdateOperation, "wallets/"+name+"/addresses", map[string]interface{}{"count": count})
+
+	var addresses []string
+	for _, entry := range resp.Data["addresses"].([]map[string]interface{}) {
+		addresses = append(addresses, entry["address"].(string))
+	}
+	if len(addresses) != count {
+		e.t.Fatalf("got %d addresses, want %d", len(addresses), count)
+	}
+	return addresses
+}
+
+func (e *regtestEnv) script(address string) []byte {
+	e.t.Helper()
+	script, err := wallet.GetScriptPubKey(address, e.network)
+	if err != nil {
+		e.t.Fatalf("GetScriptPubKey(%s) error = %v", address, err)
+	}
+	return script
+}
+
+// fund pays value to address in a new block
+func (e *regtestEnv) fund(address string, value int64) wire.OutPoint {
+	e.t.Helper()
+	outpoint := e.chain.Fund(e.script(address), value)
+	e.chain.Mine(1)
+	return outpoint
+}
+
+func TestRegtestAddresses(t *testing.T) {
+	env := newRegtestEnv(t)
+
+	addresses := env.createWallet("hot", "p2wpkh", 1)
+	if !strings.HasPrefix(addresses[0], "bcrt1q") {
+		t.Errorf("p2wpkh address = %s, want bcrt1q prefix", addresses[0])
+	}
+
+	resp := env.request(logical.ReadOperation, "wallets/hot/xpub", nil)
+	if got := resp.Data["derivation_path"]; got != "m/84'/1'/0'" {
+		t.Errorf("derivation_path = %v, want m/84'/1'/0'", got)
+	}
+
+	taproot := env.createWallet("taproot", "p2tr", 1)
+	if !strings.HasPrefix(taproot[0], "bcrt1p") {
+		t.Errorf("p2tr address = %s, want bcrt1p prefix", taproot[0])
+	}
+}
+
+func TestCustomSignet(t *testing.T) {
+	env := newChainEnv(t, map[string]interface{}{
+		"network":          "signet",
+		"signet_challenge": "51",
+		"signet_hrp":       "sbx",
+	})
+
+	config := env.request(logical.ReadOperation, "config", nil)
+	if config.Data["network_id"] != env.network || !strings.HasSuffix(env.network, "-sbx") {
+		t.Errorf("network_id = %v, want %s", config.Data["network_id"], env.network)
+	}
+
+	from := env.createWallet("hot", "p2wpkh", 1)
+	to := env.createWallet("cold", "p2tr", 1)
+	if !strings.HasPrefix(from[0], "sbx1q") || !strings.HasPrefix(to[0], "sbx1p") {
+		t.Fatalf("addresses %s, %s do not use the custom prefix", from[0], to[0])
+	}
+
+	env.fund(from[0], 100000)
+	env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+		"to":       to[0],
+		"amount":   25000,
+		"fee_rate": 2,
+	})
+	if got := env.chain.Unspent(env.script(to[0])); got != 25000 {
+		t.Errorf("destination received %d, want 25000", got)
+	}
+
+	// Public signet addresses are rejected
+	resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "wallets/hot/send",
+		Data:      map[string]interface{}{"to": "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", "amount": 10000},
+		Storage:   env.storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Errorf("send to a tb1 address = %v, %v, want error response", resp, err)
+	}
+}
+
+func TestCustomSignetConfigValidation(t *testing.T) {
+	env := newRegtestEnv(t)
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+	}{
+		{"challenge on regtest", map[string]interface{}{"network": "regtest", "signet_challenge": "51"}},
+		{"prefix without challenge", map[string]interface{}{"network": "signet", "signet_hrp": "sb"}},
+		{"non-hex challenge", map[string]interface{}{"network": "signet", "signet_challenge": "xyz"}},
+		{"mainnet prefix", map[string]interface{}{"network": "signet", "signet_challenge": "51", "signet_hrp": "bc"}},
+		{"short magic", map[string]interface{}{"network": "signet", "signet_challenge": "51", "signet_magic": "0a03"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Data:      tt.data,
+				Storage:   env.storage,
+			})
+			if err != nil || resp == nil || !resp.IsError() {
+				t.Errorf("config write = %v, %v, want error response", resp, err)
+			}
+		})
+	}
+}
+
+func TestRegtestSend(t *testing.T) {
+	for _, addressType := range []string{"p2wpkh", "p2tr", "p2sh-p2wpkh", "p2pkh"} {
+		t.Run(addressType, func(t *testing.T) {
+			env := newRegtestEnv(t)
+			from := env.createWallet("hot", addressType, 1)
+			to := env.createWallet("cold", "p2wpkh", 1)
+
+			env.fund(from[0], 100000)
+
+			dryRun := env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+				"to":       to[0],
+				"amount":   30000,
+				"fee_rate": 2,
+				"dry_run":  true,
+			})
+
+			resp := env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+				"to":       to[0],
+				"amount":   30000,
+				"fee_rate": 2,
+			})
+			if resp.Data["broadcast"] != true {
+				t.Fatalf("send was not broadcast: %v", resp.Data)
+			}
+
+			broadcasts := env.chain.Broadcasts()
+			if len(broadcasts) != 1 || broadcasts[0].TxHash().String() != resp.Data["txid"] {
+				t.Fatalf("server saw %d broadcasts, want the send transaction", len(broadcasts))
+			}
+			if got := env.chain.Unspent(env.script(to[0])); got != 30000 {
+				t.Errorf("destination received %d, want 30000", got)
+			}
+
+			fee := resp.Data["fee"].(int64)
+			change := env.chain.Unspent(env.script(resp.Data["change_address"].(string)))
+			if change+fee != 70000 {
+				t.Errorf("change %d + fee %d = %d, want 70000", change, fee, change+fee)
+			}
+
+			// The dry run sizes the fee on the same transaction that is sent
+			if dryRun.Data["estimated_fee"] != fee || dryRun.Data["change_amount"] != change {
+				t.Errorf("dry run fee %v and change %v, sent fee %d and change %d",
+					dryRun.Data["estimated_fee"], dryRun.Data["change_amount"], fee, change)
+			}
+			vsize := int64(dryRun.Data["estimated_vsize"].(int))
+			signed := int64(broadcasts[0].SerializeSizeStripped()*3+broadcasts[0].SerializeSize()+3) / 4
+			if signed > vsize || fee != 2*vsize {
+				t.Errorf("fee %d for estimated vsize %d, signed vsize %d", fee, vsize, signed)
+			}
+		})
+	}
+}
+
+func TestRegtestSendRequiresConfirmations(t *testing.T) {
+	env := newRegtestEnv(t)
+	from := env.createWallet("hot", "p2wpkh", 1)
+	to := env.createWallet("cold", "p2wpkh", 1)
+
+	env.chain.Fund(env.script(from[0]), 100000)
+
+	resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "wallets/hot/send",
+		Data:      map[string]interface{}{"to": to[0], "amount": 30000},
+		Storage:   env.storage,
+	})
+	if err != nil {
+		t.Fatalf("send error = %v", err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("send with only unconfirmed funds succeeded: %v", resp)
+	}
+	if len(env.chain.Broadcasts()) != 0 {
+		t.Error("unconfirmed funds were spent")
+	}
+}
+
+func TestRegtestConsolidate(t *testing.T) {
+	env := newRegtestEnv(t)
+	addresses := env.createWallet("hot", "p2wpkh", 3)
+	for _, address := range addresses {
+		env.fund(address, 20000)
+	}
+
+	resp := env.request(logical.UpdateOperation, "wallets/hot/consolidate", map[string]interface{}{
+		"fee_rate": 2,
+	})
+	if got := resp.Data["inputs_consolidated"]; got != 3 {
+		t.Fatalf("inputs_consolidated = %v, want 3", got)
+	}
+
+	tx := env.chain.Broadcasts()[0]
+	if len(tx.TxIn) != 3 || len(tx.TxOut) != 1 {
+		t.Errorf("consolidation has %d inputs and %d outputs, want 3 and 1", len(tx.TxIn), len(tx.TxOut))
+	}
+
+	output := env.chain.Unspent(env.script(resp.Data["output_address"].(string)))
+	if output != resp.Data["output_value"].(int64) || output+resp.Data["fee"].(int64) != 60000 {
+		t.Errorf("consolidated output %d with fee %v, want a total of 60000", output, resp.Data["fee"])
+	}
+}
+
+func TestRegtestScan(t *testing.T) {
+	env := newRegtestEnv(t)
+	env.createWallet("hot", "p2wpkh", 1)
+
+	// A deposit to an address the wallet has not handed out yet
+	w, err := getWallet(context.Background(), env.storage, "hot")
+	if err != nil || w == nil {
+		t.Fatalf("getWallet() = %v, %v", w, err)
+	}
+	index := w.account(0).NextAddressIndex + 2
+	untracked, err := wallet.GenerateAddressForAccount(w.Seed, env.network, 0, 0, index, "p2wpkh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.fund(untracked, 42000)
+
+	resp := env.request(logical.UpdateOperation, "wallets/hot/scan", map[string]interface{}{
+		"gap": 5,
+	})
+	if got := resp.Data["gap_found"].([]map[string]interface{}); len(got) != 1 || got[0]["index"] != index {
+		t.Fatalf("gap_found = %v, want index %d", got, index)
+	}
+	if got := resp.Data["gap_total"]; got != int64(42000) {
+		t.Errorf("gap_total = %v, want 42000", got)
+	}
+
+	// The registered deposit is now spendable through the wallet
+	to := env.createWallet("cold", "p2wpkh", 1)
+	env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+		"to":       to[0],
+		"max_send": true,
+		"fee_rate": 2,
+	})
+	if got := env.chain.Unspent(env.script(untracked)); got != 0 {
+		t.Errorf("scanned deposit still unspent: %d", got)
+	}
+}
+
+func TestRegtestPSBT(t *testing.T) {
+	for _, addressType := range []string{"p2wpkh", "p2tr"} {
+		t.Run(addressType, func(t *testing.T) {
+			env := newRegtestEnv(t)
+			from := env.createWallet("hot", addressType, 1)
+			to := env.createWallet("cold", "p2wpkh", 1)
+
+			outpoint := env.fund(from[0], 50000)
+
+			// Build the PSBT the way an external coordinator would
+			tx := wire.NewMsgTx(2)
+			tx.AddTxIn(wire.NewTxIn(&outpoint, nil, nil))
+			tx.AddTxOut(wire.NewTxOut(49000, env.script(to[0])))
+			packet, err := psbt.NewFromUnsignedTx(tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			packet.Inputs[0].WitnessUtxo = wire.NewTxOut(50000, env.script(from[0]))
+
+			var buf bytes.Buffer
+			if err := packet.Serialize(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			signed := env.request(logical.UpdateOperation, "wallets/hot/psbt/sign", map[string]interface{}{
+				"psbt": base64.StdEncoding.EncodeToString(buf.Bytes()),
+			})
+			if got := signed.Data["inputs_signed"]; got != 1 {
+				t.Fatalf("inputs_signed = %v, want 1", got)
+			}
+
+			final := env.request(logical.UpdateOperation, "wallets/hot/psbt/finalize", map[string]interface{}{
+				"psbt": signed.Data["psbt"],
+			})
+			if final.Data["broadcast"] != true {
+				t.Fatalf("PSBT was not broadcast: %v", final.Data)
+			}
+
+			txid, err := chainhash.NewHashFromStr(final.Data["txid"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *txid != tx.TxHash() {
+				t.Errorf("broadcast txid %s, want %s", txid, tx.TxHash())
+			}
+			if got := env.chain.Unspent(env.script(to[0])); got != 49000 {
+				t.Errorf("destination received %d, want 49000", got)
+			}
+		})
+	}
+}
+
+func TestWalletNetworks(t *testing.T) {
+	env := newRegtestEnv(t)
+
+	// A second chain serves wallets created on signet
+	signet, err := electrumtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(signet.Close)
+	env.request(logical.UpdateOperation, "config", map[string]interface{}{
+		"electrum_urls": map[string]interface{}{"signet": signet.URL()},
+	})
+
+	regtestWallet := env.createWallet("rt", "p2wpkh", 1)
+	env.write("wallets/sn", map[string]interface{}{"address_type": "p2wpkh", "network": "signet"})
+	resp := env.request(logical.UpdateOperation, "wallets/sn/addresses", map[string]interface{}{"count": 2})
+	signetWallet := resp.Data["addresses"].([]map[string]interface{})
+	if !strings.HasPrefix(regtestWallet[0], "bcrt1") || !strings.HasPrefix(signetWallet[0]["address"].(string), "tb1") {
+		t.Fatalf("addresses %s and %s are not on their wallet networks", regtestWallet[0], signetWallet[0]["address"])
+	}
+
+	read := env.request(logical.ReadOperation, "wallets/sn", nil)
+	if read.Data["network"] != "signet" {
+		t.Errorf("signet wallet network = %v, want signet", read.Data["network"])
+	}
+
+	// Each wallet is funded and spends on its own chain
+	signetFrom := signetWallet[0]["address"].(string)
+	signetScript, err := wallet.GetScriptPubKey(signetFrom, "signet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signet.Fund(signetScript, 80000)
+	signet.Mine(1)
+	env.fund(regtestWallet[0], 60000)
+
+	env.request(logical.UpdateOperation, "wallets/sn/send", map[string]interface{}{
+		"to":       signetWallet[1]["address"],
+		"amount":   30000,
+		"fee_rate": 2,
+	})
+	if len(signet.Broadcasts()) != 1 || len(env.chain.Broadcasts()) != 0 {
+		t.Fatalf("signet send reached %d signet and %d regtest broadcasts, want 1 and 0",
+			len(signet.Broadcasts()), len(env.chain.Broadcasts()))
+	}
+
+	to := env.createWallet("rt2", "p2wpkh", 1)
+	env.request(logical.UpdateOperation, "wallets/rt/send", map[string]interface{}{
+		"to":       to[0],
+		"amount":   30000,
+		"fee_rate": 2,
+	})
+	if len(env.chain.Broadcasts()) != 1 {
+		t.Fatalf("regtest send reached %d regtest broadcasts, want 1", len(env.chain.Broadcasts()))
+	}
+
+	// The network is fixed at creation
+	update, err := env.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "wallets/sn",
+		Data:      map[string]interface{}{"network": "regtest"},
+		Storage:   env.storage,
+	})
+	if err != nil || update == nil || !update.IsError() {
+		t.Errorf("changing the wallet network = %v, %v, want error response", update, err)
+	}
+}
+
+func TestMountNetworkChangePinsWallets(t *testing.T) {
+	env := newRegtestEnv(t)
+	addresses := env.createWallet("legacy", "p2wpkh", 1)
+
+	// Simulate a wallet written before wallets recorded their network
+	w, err := getWallet(context.Background(), env.storage, "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Network = ""
+	if err := saveWallet(context.Background(), env.storage, w); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := env.request(logical.UpdateOperation, "config", map[string]interface{}{
+		"network":       "testnet4",
+		"electrum_urls": map[string]interface{}{"regtest": env.chain.URL()},
+	})
+	if resp == nil || len(resp.Warnings) == 0 {
+		t.Errorf("network change returned no warning about pinned wallets")
+	}
+
+	w, err = getWallet(context.Background(), env.storage, "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Network != "regtest" {
+		t.Errorf("legacy wallet network = %q, want regtest", w.Network)
+	}
+
+	// The pinned wallet keeps resolving its regtest addresses
+	read := env.request(logical.ReadOperation, "wallets/legacy/addresses", nil)
+	if got := read.Data["addresses"].([]map[string]interface{})[0]["address"]; got != addresses[0] {
+		t.Errorf("first address = %v, want %s", got, addresses[0])
+	}
+
+	// New wallets default to the new mount network
+	env.write("wallets/fresh", map[string]interface{}{})
+	w, err = getWallet(context.Background(), env.storage, "fresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Network != "testnet4" {
+		t.Errorf("new wallet network = %q, want testnet4", w.Network)
+	}
+}
+
+func TestMountNetworkChangeKeepsCustomSignet(t *testing.T) {
+	env := newChainEnv(t, map[string]interface{}{
+		"network":          "signet",
+		"signet_challenge": "52",
+		"signet_hrp":       "sby",
+	})
+	env.createWallet("private", "p2wpkh", 1)
+
+	resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Data:      map[string]interface{}{"network": "regtest", "signet_challenge": "", "signet_hrp": ""},
+		Storage:   env.storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("moving away from a custom signet with wallets = %v, %v, want error response", resp, err)
+	}
+	if !strings.Contains(resp.Error().Error(), "private") {
+		t.Errorf("error %q does not name the affected wallet", resp.Error())
+	}
+}
+
+// fakeTransit serves the encrypt and decrypt endpoints of a Transit key. Its
+// "encryption" inverts the bytes so wrapped keys differ from plaintext ones.
+type fakeTransit struct {
+	*httptest.Server
+	version  atomic.Int32
+	decrypts atomic.Int32
+}
+
+func newFakeTransit(t *testing.T, mount, key, token string) *fakeTransit {
+	t.Helper()
+
+	f := &fakeTransit{}
+	f.version.Store(1)
+	invert := func(b []byte) []byte {
+		out := make([]byte, len(b))
+		for i := range b {
+			out[i] = ^b[i]
+		}
+		return out
+	}
+
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, `{"errors":["bad request"]}`, http.StatusBadRequest)
+			return
+		}
+
+		var data map[string]string
+		switch r.URL.Path {
+		case "/v1/" + mount + "/encrypt/" + key:
+			plaintext, _ := base64.StdEncoding.DecodeString(body["plaintext"])
+			data = map[string]string{"ciphertext": fmt.Sprintf("vault:v%d:%s", f.version.Load(),
+				base64.StdEncoding.EncodeToString(invert(plaintext)))}
+		case "/v1/" + mount + "/decrypt/" + key:
+			f.decrypts.Add(1)
+			parts := strings.SplitN(body["ciphertext"], ":", 3)
+			ciphertext, err := base64.StdEncoding.DecodeString(parts[len(parts)-1])
+			if len(parts) != 3 || err != nil {
+				http.Error(w, `{"errors":["invalid ciphertext"]}`, http.StatusBadRequest)
+				return
+			}
+			data = map[string]string{"plaintext": base64.StdEncoding.EncodeToString(invert(ciphertext))}
+		default:
+			http.Error(w, `{"errors":["unsupported path"]}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// storedWalletJSON returns the raw storage entry of a wallet
+func (e *regtestEnv) storedWalletJSON(name string) map[string]interface{} {
+	e.t.Helper()
+	entry, err := e.storage.Get(context.Background(), walletsStoragePrefix+name)
+	if err != nil || entry == nil {
+		e.t.Fatalf("wallet %q entry = %v, %v", name, entry, err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(entry.Value, &raw); err != nil {
+		e.t.Fatal(err)
+	}
+	return raw
+}
+
+func TestSeedEncryption(t *testing.T) {
+	env := newRegtestEnv(t)
+	env.createWallet("legacy", "p2wpkh", 1)
+	plain, err := getWallet(context.Background(), env.storage, "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub := env.request(logical.ReadOperation, "wallets/legacy/xpub", nil).Data["xpub"]
+
+	resp := env.write("config/seed-encryption", map[string]interface{}{"enabled": true})
+	if got := resp.Data["wallets_updated"]; got != 1 {
+		t.Errorf("wallets_updated = %v, want 1", got)
+	}
+
+	raw := env.storedWalletJSON("legacy")
+	if _, ok := raw["seed"]; ok {
+		t.Error("sealed wallet still stores its seed")
+	}
+	if sealed, _ := raw["sealed_seed"].(string); !strings.HasPrefix(sealed, "v1:") {
+		t.Errorf("sealed_seed = %q, want a version 1 ciphertext", sealed)
+	}
+
+	// Addresses and the xpub come from the cached account keys
+	if got := env.request(logical.ReadOperation, "wallets/legacy/xpub", nil).Data["xpub"]; got != xpub {
+		t.Errorf("xpub after sealing = %v, want %v", got, xpub)
+	}
+	next := env.createWallet("sealed", "p2tr", 1)
+	resp = env.request(logical.UpdateOperation, "wallets/legacy/addresses", map[string]interface{}{"count": 1})
+	generated := resp.Data["addresses"].([]map[string]interface{})[0]
+	want, err := wallet.GenerateAddressInfoForAccount(plain.Seed, env.network, 0, 0, generated["index"].(uint32), "p2wpkh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := generated["address"]; got != want.Address {
+		t.Errorf("address of sealed wallet = %v, want %s", got, want.Address)
+	}
+	if raw := env.storedWalletJSON("sealed"); raw["seed"] != nil || raw["sealed_seed"] == nil {
+		t.Error("wallet created with seed encryption enabled was not sealed")
+	}
+
+	// Signing decrypts the seed
+	env.fund(next[0], 100000)
+	env.request(logical.UpdateOperation, "wallets/sealed/send", map[string]interface{}{
+		"to": want.Address, "amount": 30000, "fee_rate": 2,
+	})
+	if got := env.chain.Unspent(env.script(want.Address)); got != 30000 {
+		t.Errorf("destination received %d, want 30000", got)
+	}
+
+	resp = env.request(logical.UpdateOperation, "config/seed-encryption/rotate", nil)
+	if resp.Data["key_version"] != 2 || resp.Data["wallets_reencrypted"] != 2 {
+		t.Errorf("rotate = %v, want key_version 2 and 2 wallets re-encrypted", resp.Data)
+	}
+	if sealed, _ := env.storedWalletJSON("legacy")["sealed_seed"].(string); !strings.HasPrefix(sealed, "v2:") {
+		t.Errorf("sealed_seed after rotation = %q, want a version 2 ciphertext", sealed)
+	}
+
+	resp = env.write("config/seed-encryption", map[string]interface{}{"enabled": false})
+	if got := resp.Data["wallets_updated"]; got != 2 {
+		t.Errorf("wallets_updated = %v, want 2", got)
+	}
+	unsealed, err := getWallet(context.Background(), env.storage, "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unsealed.Seed, plain.Seed) || unsealed.SealedSeed != "" || unsealed.AccountKeys != nil {
+		t.Error("disabling seed encryption did not restore the plaintext seed")
+	}
+}
+
+func TestSeedRewriteWaitsForWalletLock(t *testing.T) {
+	ctx := context.Background()
+	env := newRegtestEnv(t)
+	env.createWallet("hot", "p2wpkh", 1)
+	env.write("config/seed-encryption", map[string]interface{}{"enabled": true})
+
+	// A spend in progress holds the wallet lock
+	b := env.b.(*btcBackend)
+	unlock := b.lockWallet("hot")
+
+	done := make(chan *logical.Response)
+	go func() {
+		resp, err := env.b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config/seed-encryption/rotate",
+			Storage:   env.storage,
+		})
+		if err != nil {
+			t.Errorf("rotate error = %v", err)
+		}
+		done <- resp
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("rotation rewrote a wallet locked by a spend")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The spend saves its counters before releasing the lock
+	w, err := getWallet(ctx, env.storage, "hot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := w.account(0).NextAddressIndex + 10
+	w.account(0).NextAddressIndex = next
+	if err := saveWallet(ctx, env.storage, w); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	resp := <-done
+	if resp == nil || resp.Data["wallets_reencrypted"] != 1 {
+		t.Fatalf("rotate = %v, want 1 wallet re-encrypted", resp)
+	}
+	w, err = getWallet(ctx, env.storage, "hot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := w.account(0).NextAddressIndex; got != next {
+		t.Errorf("next address index after rotation = %d, want %d saved by the spend", got, next)
+	}
+	if !strings.HasPrefix(w.SealedSeed, "v2:") {
+		t.Errorf("sealed_seed after rotation = %q, want a version 2 ciphertext", w.SealedSeed)
+	}
+}
+
+func TestSeedEncryptionTransit(t *testing.T) {
+	env := newRegtestEnv(t)
+	transit := newFakeTransit(t, "transit", "btc-seeds", "s.token")
+
+	config := map[string]interface{}{
+		"enabled":         true,
+		"transit_address": transit.URL,
+		"transit_token":   "s.wrong",
+		"transit_key":     "btc-seeds",
+	}
+	resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/seed-encryption",
+		Data:      config,
+		Storage:   env.storage,
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("seed encryption was enabled with a token Transit rejects")
+	}
+
+	config["transit_token"] = "s.token"
+	env.write("config/seed-encryption", config)
+
+	keyring, err := getSeedKeyring(context.Background(), env.storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current := keyring.current(); current == nil || current.Key != nil || !strings.HasPrefix(current.WrappedKey, "vault:v1:") {
+		t.Fatalf("data key = %+v, want only a Transit ciphertext", current)
+	}
+
+	from := env.createWallet("hot", "p2wpkh", 3)
+	to := env.createWallet("cold", "p2wpkh", 1)
+	decrypts := transit.decrypts.Load()
+	env.request(logical.UpdateOperation, "wallets/hot/addresses", map[string]interface{}{"count": 2})
+	if transit.decrypts.Load() != decrypts {
+		t.Error("deriving addresses decrypted the seed")
+	}
+
+	// The silent payment keys are stored when the feature is enabled, so the
+	// address and scans need no decryption
+	env.request(logical.UpdateOperation, "wallets/hot", map[string]interface{}{"silent_payments": true})
+	decrypts = transit.decrypts.Load()
+	env.request(logical.ReadOperation, "wallets/hot/silent-payments", nil)
+	env.request(logical.UpdateOperation, "wallets/hot/silent-payments", map[string]interface{}{"txids": env.fund(from[2], 1000).Hash.String()})
+	if transit.decrypts.Load() != decrypts {
+		t.Error("silent payment address and scan decrypted the seed")
+	}
+
+	env.fund(from[0], 100000)
+	env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+		"to": to[0], "amount": 30000, "fee_rate": 2,
+	})
+	if got := transit.decrypts.Load() - decrypts; got != 1 {
+		t.Errorf("send made %d Transit decrypt calls, want 1", got)
+	}
+
+	// Rotating the Transit key and then the data key rewraps every version
+	transit.version.Store(2)
+	env.request(logical.UpdateOperation, "config/seed-encryption/rotate", nil)
+	keyring, err = getSeedKeyring(context.Background(), env.storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for version, dataKey := range keyring.Keys {
+		if !strings.HasPrefix(dataKey.WrappedKey, "vault:v2:") {
+			t.Errorf("data key version %d wrapped as %q, want Transit key version 2", version, dataKey.WrappedKey)
+		}
+	}
+	env.chain.Mine(1)
+	env.request(logical.UpdateOperation, "wallets/cold/send", map[string]interface{}{
+		"to": from[1], "amount": 20000, "fee_rate": 2,
+	})
+
+	read := env.request(logical.ReadOperation, "config/seed-encryption", nil)
+	if _, ok := read.Data["transit_token"]; ok {
+		t.Error("config read returned the Transit token")
+	}
+	if read.Data["key_version"] != 2 {
+		t.Errorf("key_version = %v, want 2", read.Data["key_version"])
+	}
+}
+
+func TestWalletBackupRestore(t *testing.T) {
+	env := newRegtestEnv(t)
+	env.write("config/seed-encryption", map[string]interface{}{"enabled": true})
+
+	from := env.createWallet("treasury", "p2wpkh", 2)
+	to := env.createWallet("cold", "p2tr", 1)
+	env.request(logical.UpdateOperation, "wallets/treasury", map[string]interface{}{
+		"description": "ops treasury", "change_policy": "match_destination",
+	})
+	env.write("wallets/treasury/accounts/1", map[string]interface{}{"description": "payroll"})
+	env.fund(from[0], 100000)
+	env.request(logical.UpdateOperation, "wallets/treasury/send", map[string]interface{}{
+		"to": to[0], "amount": 30000, "fee_rate": 2,
+	})
+
+	// A spent silent payment output has no address record to restore from
+	env.request(logical.UpdateOperation, "wallets/treasury", map[string]interface{}{"silent_payments": true})
+	treasury, err := getWallet(context.Background(), env.storage, "treasury")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := walletSeed(context.Background(), env.storage, treasury)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := bytes.Repeat([]byte{0x07}, 32)
+	spendKey, err := wallet.SilentPaymentSpendKey(seed, env.network, 1, tweak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, _ := wallet.NetworkParams(env.network)
+	spOutput, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(spendKey.PubKey()), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storeSilentPayment(context.Background(), env.storage, "treasury", &storedSilentPayment{
+		TxID: strings.Repeat("ab", 32), Vout: 1, Value: 5000, Address: spOutput.EncodeAddress(),
+		Account: 1, Tweak: hex.EncodeToString(tweak), Spent: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xpub := env.request(logical.ReadOperation, "wallets/treasury/xpub", nil).Data["xpub"]
+	before, err := getStoredAddresses(context.Background(), env.storage, "treasury", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payroll, err := getStoredAddresses(context.Background(), env.storage, "treasury", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := len(before) + len(payroll)
+
+	resp := env.request(logical.UpdateOperation, "wallets/treasury/backup", map[string]interface{}{
+		"recipients": identity.Recipient().String() + "," + other.Recipient().String(),
+	})
+	backup := resp.Data["backup"].(string)
+	if !strings.HasPrefix(backup, "-----BEGIN AGE ENCRYPTED FILE-----") {
+		t.Fatalf("backup is not an armored age file: %.40s", backup)
+	}
+	if resp.Data["address_count"] != total {
+		t.Errorf("address_count = %v, want %d", resp.Data["address_count"], total)
+	}
+	if resp.Data["silent_payment_count"] != 1 {
+		t.Errorf("silent_payment_count = %v, want 1", resp.Data["silent_payment_count"])
+	}
+
+	restoreError := func(data map[string]interface{}) string {
+		t.Helper()
+		resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "wallets/restore",
+			Data:      data,
+			Storage:   env.storage,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("restore with %v succeeded", data)
+		}
+		return resp.Error().Error()
+	}
+
+	if msg := restoreError(map[string]interface{}{"backup": backup, "identity": identity.String()}); !strings.Contains(msg, "already exists") {
+		t.Errorf("restoring over an existing wallet: %s", msg)
+	}
+
+	env.request(logical.DeleteOperation, "wallets/treasury", map[string]interface{}{"force": true})
+	env.request(logical.DeleteOperation, "deleted-wallets/treasury", nil)
+
+	unknown, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := restoreError(map[string]interface{}{"backup": backup, "identity": unknown.String()}); !strings.Contains(msg, "decrypt") {
+		t.Errorf("restoring with a foreign identity: %s", msg)
+	}
+	if msg := restoreError(map[string]interface{}{"backup": backup, "identity": identity.String(), "network": "mainnet"}); !strings.Contains(msg, "regtest") {
+		t.Errorf("restoring with the wrong network: %s", msg)
+	}
+
+	// Either recipient can restore, under the original or a new name
+	resp = env.request(logical.UpdateOperation, "wallets/restore", map[string]interface{}{
+		"backup": backup, "identity": identity.String(), "network": "regtest",
+	})
+	if resp.Data["name"] != "treasury" || resp.Data["verified_addresses"] != total {
+		t.Errorf("restore = %v", resp.Data)
+	}
+	env.request(logical.UpdateOperation, "wallets/restore", map[string]interface{}{
+		"backup": backup, "identity": other.String(), "name": "treasury-copy",
+	})
+
+	for _, name := range []string{"treasury", "treasury-copy"} {
+		if got := env.request(logical.ReadOperation, "wallets/"+name+"/xpub", nil).Data["xpub"]; got != xpub {
+			t.Errorf("%s xpub = %v, want %v", name, got, xpub)
+		}
+		if raw := env.storedWalletJSON(name); raw["seed"] != nil || raw["sealed_seed"] == nil {
+			t.Errorf("restored wallet %s was not sealed", name)
+		}
+
+		restored, err := getWallet(context.Background(), env.storage, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored.Description != "ops treasury" || restored.ChangePolicy != "match_destination" ||
+			restored.Network != "regtest" || restored.account(1) == nil || restored.account(1).Description != "payroll" {
+			t.Errorf("restored wallet %s = %+v", name, restored)
+		}
+
+		payments, err := getSilentPayments(context.Background(), env.storage, name, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(payments) != 1 || payments[0].Address != spOutput.EncodeAddress() || !payments[0].Spent {
+			t.Errorf("%s: restored silent payments = %+v, want the spent output", name, payments)
+		}
+
+		after, err := getStoredAddresses(context.Background(), env.storage, name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spent := make(map[string]bool)
+		for _, addr := range after {
+			spent[addr.Address] = addr.Spent
+		}
+		for _, addr := range before {
+			if s, ok := spent[addr.Address]; !ok || s != addr.Spent {
+				t.Errorf("%s: address %s restored = %v, spent = %v; want spent = %v", name, addr.Address, ok, s, addr.Spent)
+			}
+		}
+	}
+
+	// The restored wallet spends the change of the original
+	env.chain.Mine(1)
+	env.request(logical.UpdateOperation, "wallets/treasury/send", map[string]interface{}{
+		"to": to[0], "amount": 20000, "fee_rate": 2,
+	})
+	if got := env.chain.Unspent(env.script(to[0])); got != 50000 {
+		t.Errorf("destination received %d, want 50000", got)
+	}
+}
+
+func TestWalletRestoreRejectsForeignSeed(t *testing.T) {
+	env := newRegtestEnv(t)
+	env.createWallet("victim", "p2wpkh", 1)
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := env.request(logical.UpdateOperation, "wallets/victim/backup", map[string]interface{}{
+		"recipients": identity.Recipient().String(),
+	})
+	first := env.request(logical.ReadOperation, "wallets/victim/addresses", nil).Data["addresses"].([]map[string]interface{})[0]["address"]
+	if resp.Data["first_address"] != first {
+		t.Errorf("backup first_address = %v, want %v", resp.Data["first_address"], first)
+	}
+
+	decode := func() walletBackup {
+		decrypted, err := age.Decrypt(armor.NewReader(strings.NewReader(resp.Data["backup"].(string))), identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var backup walletBackup
+		if err := json.NewDecoder(decrypted).Decode(&backup); err != nil {
+			t.Fatal(err)
+		}
+		return backup
+	}
+	foreignSeed, err := wallet.GenerateSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*walletBackup)
+		wantErr string
+	}{
+		{"foreign seed", func(b *walletBackup) {
+			b.Wallet.Seed = foreignSeed
+		}, "mismatch"},
+		// Without address records the seed is still checked against first_address
+		{"foreign seed without addresses", func(b *walletBackup) {
+			b.Wallet.Seed = foreignSeed
+			b.Addresses = nil
+		}, "seed mismatch"},
+		{"no first address", func(b *walletBackup) {
+			b.FirstAddress = ""
+			b.Addresses = nil
+		}, "no first_address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backup := decode()
+			tt.modify(&backup)
+
+			var buf bytes.Buffer
+			armored := armor.NewWriter(&buf)
+			encrypted, err := age.Encrypt(armored, identity.Recipient())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.NewEncoder(encrypted).Encode(&backup); err != nil {
+				t.Fatal(err)
+			}
+			encrypted.Close()
+			armored.Close()
+
+			restore, err := env.b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "wallets/restore",
+				Data:      map[string]interface{}{"backup": buf.String(), "identity": identity.String(), "name": "forged"},
+				Storage:   env.storage,
+			})
+			if err != nil || restore == nil || !restore.IsError() || !strings.Contains(restore.Error().Error(), tt.wantErr) {
+				t.Fatalf("restore = %v, %v, want error containing %q", restore, err, tt.wantErr)
+			}
+			if w, _ := getWallet(context.Background(), env.storage, "forged"); w != nil {
+				t.Error("rejected restore left a wallet behind")
+			}
+		})
+	}
+
+	// An unmodified backup without address records restores
+	env.request(logical.DeleteOperation, "wallets/victim", map[string]interface{}{"force": true})
+	env.request(logical.DeleteOperation, "deleted-wallets/victim", nil)
+	backup := decode()
+	backup.Addresses = nil
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+	encrypted, err := age.Encrypt(armored, identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(encrypted).Encode(&backup); err != nil {
+		t.Fatal(err)
+	}
+	encrypted.Close()
+	armored.Close()
+	restored := env.request(logical.UpdateOperation, "wallets/restore", map[string]interface{}{
+		"backup": buf.String(), "identity": identity.String(),
+	})
+	if restored.Data["first_address"] != first {
+		t.Errorf("restore first_address = %v, want %v", restored.Data["first_address"], first)
+	}
+}
+
+func TestWalletCreateRejectsRestoreName(t *testing.T) {
+	env := newRegtestEnv(t)
+
+	// Names are lowercased, so this reaches the wallet create handler as "restore"
+	resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "wallets/Restore",
+		Data:      map[string]interface{}{"address_type": "p2wpkh"},
+		Storage:   env.storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "reserved") {
+		t.Fatalf("creating a wallet named restore = %v, %v", resp, err)
+	}
+	if w, _ := getWallet(context.Background(), env.storage, restoreWalletName); w != nil {
+		t.Error("a wallet named restore was created")
+	}
+}
+
+func TestWalletShares(t *testing.T) {
+	env := newRegtestEnv(t)
+	env.write("config/seed-encryption", map[string]interface{}{"enabled": true})
+	from := env.createWallet("vault", "p2wpkh", 1)
+	to := env.createWallet("other", "p2wpkh", 1)
+	xpub := env.request(logical.ReadOperation, "wallets/vault/xpub", nil).Data["xpub"]
+
+	resp := env.request(logical.UpdateOperation, "wallets/vault/shares", map[string]interface{}{
+		"groups": "2-of-3,3-of-5,1-of-1", "group_threshold": 2, "passphrase": "drill",
+	})
+	if len(resp.Warnings) == 0 {
+		t.Error("share export did not warn that shares are not stored")
+	}
+	groups := resp.Data["groups"].([]map[string]interface{})
+	executives := groups[0]["shares"].([]string)
+	board := groups[1]["shares"].([]string)
+	offsite := groups[2]["shares"].([]string)
+	if len(executives) != 3 || len(board) != 5 || len(offsite) != 1 {
+		t.Fatalf("share groups = %v", groups)
+	}
+
+	// A seed that can no longer be decrypted, as after losing the Transit key
+	raw := env.storedWalletJSON("vault")
+	raw["sealed_seed"] = "v9:" + base64.StdEncoding.EncodeToString(make([]byte, 60))
+	entry, err := logical.StorageEntryJSON(walletsStoragePrefix+"vault", raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.storage.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+
+	importError := func(data map[string]interface{}) string {
+		t.Helper()
+		resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "wallets/vault/shares/import",
+			Data:      data,
+			Storage:   env.storage,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("import with %v succeeded", data)
+		}
+		return resp.Error().Error()
+	}
+
+	if msg := importError(map[string]interface{}{"shares": executives, "passphrase": "drill"}); !strings.Contains(msg, "1 of 3 groups are complete") {
+		t.Errorf("import with one group: %s", msg)
+	}
+	if msg := importError(map[string]interface{}{"shares": append(executives[:2:2], offsite...), "passphrase": "wrong"}); !strings.Contains(msg, "do not recover") {
+		t.Errorf("import with a wrong passphrase: %s", msg)
+	}
+	otherShares := env.request(logical.UpdateOperation, "wallets/other/shares", nil).Data["groups"].([]map[string]interface{})[0]["shares"].([]string)
+	if msg := importError(map[string]interface{}{"shares": otherShares[:2]}); !strings.Contains(msg, "do not recover") {
+		t.Errorf("import of another wallet's shares: %s", msg)
+	}
+
+	resp = env.request(logical.UpdateOperation, "wallets/vault/shares/import", map[string]interface{}{
+		"shares": []string{board[4], executives[2], board[0], offsite[0], board[2]}, "passphrase": "drill",
+	})
+	if resp.Data["verified_address"] != from[0] || resp.Data["sealed"] != true {
+		t.Errorf("import = %v", resp.Data)
+	}
+	if sealed, _ := env.storedWalletJSON("vault")["sealed_seed"].(string); !strings.HasPrefix(sealed, "v1:") {
+		t.Errorf("recovered seed was not sealed with the current data key: %q", sealed)
+	}
+	if got := env.request(logical.ReadOperation, "wallets/vault/xpub", nil).Data["xpub"]; got != xpub {
+		t.Errorf("xpub after import = %v, want %v", got, xpub)
+	}
+
+	// The recovered seed signs again
+	env.fund(from[0], 100000)
+	env.request(logical.UpdateOperation, "wallets/vault/send", map[string]interface{}{
+		"to": to[0], "amount": 30000, "fee_rate": 2,
+	})
+	if got := env.chain.Unspent(env.script(to[0])); got != 30000 {
+		t.Errorf("destination received %d, want 30000", got)
+	}
+}
+
+func TestWalletSoftDelete(t *testing.T) {
+	env := newRegtestEnv(t)
+	env.write("config/seed-encryption", map[string]interface{}{"enabled": true})
+	received := env.createWallet("ops", "p2wpkh", 1)
+	xpub := env.request(logical.ReadOperation, "wallets/ops/xpub", nil).Data["xpub"]
+	before, err := getStoredAddresses(context.Background(), env.storage, "ops", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The balance is checked with the chain backend, not the cache
+	env.fund(received[0], 50000)
+	resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "wallets/ops",
+		Storage:   env.storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "50000 sats") {
+		t.Fatalf("delete of a funded wallet = %v, %v", resp, err)
+	}
+
+	resp = env.request(logical.DeleteOperation, "wallets/ops", map[string]interface{}{"force": true})
+	if resp == nil || resp.Data["purge_after"] == nil {
+		t.Fatalf("delete = %v, want a purge time", resp)
+	}
+	if resp := env.request(logical.ReadOperation, "wallets/ops", nil); resp != nil {
+		t.Errorf("deleted wallet is still readable: %v", resp.Data)
+	}
+	if keys := env.request(logical.ListOperation, "deleted-wallets/", nil).Data["keys"]; len(keys.([]string)) != 1 {
+		t.Errorf("deleted wallets = %v, want [ops]", keys)
+	}
+	resp, err = env.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "wallets/ops",
+		Storage:   env.storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "undelete") {
+		t.Fatalf("create over a deleted wallet = %v, %v", resp, err)
+	}
+
+	// Disabling seed encryption also unseals deleted wallets
+	if got := env.write("config/seed-encryption", map[string]interface{}{"enabled": false}).Data["wallets_updated"]; got != 1 {
+		t.Errorf("wallets_updated = %v, want 1", got)
+	}
+
+	env.request(logical.UpdateOperation, "wallets/ops/undelete", nil)
+	if got := env.request(logical.ReadOperation, "wallets/ops/xpub", nil).Data["xpub"]; got != xpub {
+		t.Errorf("xpub after undelete = %v, want %v", got, xpub)
+	}
+	after, err := getStoredAddresses(context.Background(), env.storage, "ops", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("undeleted wallet has %d addresses, want %d", len(after), len(before))
+	}
+	if resp := env.request(logical.ReadOperation, "deleted-wallets/ops", nil); resp != nil {
+		t.Errorf("tombstone left after undelete: %v", resp.Data)
+	}
+
+	// Expired tombstones are purged with their addresses
+	env.request(logical.UpdateOperation, "config", map[string]interface{}{"deleted_wallet_retention": "1h"})
+	env.request(logical.DeleteOperation, "wallets/ops", map[string]interface{}{"force": true})
+	b := env.b.(*btcBackend)
+	if purged, err := b.purgeExpiredWallets(context.Background(), env.storage, time.Now()); err != nil || purged != 0 {
+		t.Errorf("purge before the retention ended = %d, %v", purged, err)
+	}
+	if purged, err := b.purgeExpiredWallets(context.Background(), env.storage, time.Now().Add(2*time.Hour)); err != nil || purged != 1 {
+		t.Errorf("purge after the retention ended = %d, %v", purged, err)
+	}
+	if remaining, _ := getStoredAddresses(context.Background(), env.storage, "ops", 0); len(remaining) != 0 {
+		t.Errorf("%d addresses left after purge", len(remaining))
+	}
+	env.createWallet("ops", "p2tr", 1)
+
+	// Without retention, wallets are deleted right away
+	env.request(logical.UpdateOperation, "config", map[string]interface{}{"deleted_wallet_retention": 0})
+	env.createWallet("scratch", "p2tr", 1)
+	if resp := env.request(logical.DeleteOperation, "wallets/scratch", nil); resp != nil {
+		t.Errorf("immediate delete = %v", resp.Data)
+	}
+	if resp := env.request(logical.ReadOperation, "deleted-wallets/scratch", nil); resp != nil {
+		t.Errorf("wallet deleted without retention left a tombstone: %v", resp.Data)
+	}
+
+	// A balance that can't be checked needs force
+	env.chain.Close()
+	resp, err = env.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "wallets/ops",
+		Storage:   env.storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "failed to check the balance") {
+		t.Fatalf("delete without a chain backend = %v, %v, want an error response", resp, err)
+	}
+	env.request(logical.DeleteOperation, "wallets/ops", map[string]interface{}{"force": true})
+}
+
+func TestWalletSignMessage(t *testing.T) {
+	env := newRegtestEnv(t)
+	addresses := env.createWallet("signer", "p2wpkh", 1)
+	env.createWallet("other", "p2wpkh", 1)
+	env.write("wallets/signer/accounts/1", nil)
+
+	verify := func(address, message, signature string) map[string]interface{} {
+		t.Helper()
+		return env.request(logical.UpdateOperation, "verify-message", map[string]interface{}{
+			"address": address, "message": message, "signature": signature,
+		}).Data
+	}
+
+	resp := env.request(logical.UpdateOperation, "wallets/signer/sign-message", map[string]interface{}{
+		"address": addresses[0], "message": "withdrawal whitelist",
+	})
+	for _, field := range []string{"bip322_signature", "legacy_signature"} {
+		sig, _ := resp.Data[field].(string)
+		if result := verify(addresses[0], "withdrawal whitelist", sig); result["valid"] != true {
+			t.Errorf("%s did not verify: %v", field, result)
+		}
+		if result := verify(addresses[0], "another message", sig); result["valid"] != false {
+			t.Errorf("%s verified for another message", field)
+		}
+	}
+
+	// An index on another account and address type, which only has a BIP322
+	// signature
+	resp = env.request(logical.UpdateOperation, "wallets/signer/accounts/1/sign-message", map[string]interface{}{
+		"index": 3, "address_type": "p2tr", "message": "proof of reserves",
+	})
+	if resp.Data["derivation_path"] != "m/86'/1'/1'/0/3" || resp.Data["legacy_signature"] != nil {
+		t.Fatalf("sign-message by index = %v", resp.Data)
+	}
+	if result := verify(resp.Data["address"].(string), "proof of reserves", resp.Data["bip322_signature"].(string)); result["valid"] != true || result["format"] != "bip322" {
+		t.Errorf("p2tr signature did not verify: %v", result)
+	}
+
+	// Addresses of other wallets are not signed for
+	other := env.request(logical.ReadOperation, "wallets/other/addresses", nil).Data["addresses"].([]map[string]interface{})
+	for _, data := range []map[string]interface{}{
+		{"address": other[0]["address"], "message": "x"},
+		{"message": "x"},
+		{"address": addresses[0], "index": 0, "message": "x"},
+	} {
+		resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "wallets/signer/sign-message",
+			Data:      data,
+			Storage:   env.storage,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Errorf("sign-message with %v succeeded", data)
+		}
+	}
+}
+
+func TestWalletProofOfReserves(t *testing.T) {
+	env := newRegtestEnv(t)
+	addresses := env.createWallet("reserve", "p2tr", 2)
+	other := env.createWallet("other", "p2wpkh", 1)
+	p2wpkh := env.request(logical.UpdateOperation, "wallets/reserve/addresses", map[string]interface{}{
+		"count": 1, "address_type": "p2wpkh",
+	}).Data["addresses"].([]map[string]interface{})[0]["address"].(string)
+
+	env.fund(addresses[0], 40000)
+	env.fund(addresses[1], 25000)
+	env.fund(p2wpkh, 35000)
+
+	resp := env.request(logical.UpdateOperation, "wallets/reserve/proof-of-reserves", map[string]interface{}{
+		"message": "audit 2026-Q3",
+	})
+	if resp.Data["total"] != int64(100000) || resp.Data["utxo_count"] != 3 {
+		t.Fatalf("proof of reserves = %v", resp.Data)
+	}
+	proof := resp.Data["psbt"].(string)
+	if len(env.chain.Broadcasts()) != 0 {
+		t.Fatal("proof of reserves broadcast a transaction")
+	}
+
+	verify := func(message string) map[string]interface{} {
+		t.Helper()
+		return env.request(logical.UpdateOperation, "proof-of-reserves/verify", map[string]interface{}{
+			"psbt": proof, "message": message,
+		}).Data
+	}
+
+	if result := verify("audit 2026-Q3"); result["valid"] != true || result["total"] != int64(100000) {
+		t.Fatalf("verify = %v", result)
+	}
+	if result := verify("audit 2026-Q4"); result["valid"] != false {
+		t.Errorf("proof verified for another challenge: %v", result)
+	}
+
+	// Funds that move after the proof no longer count
+	env.request(logical.UpdateOperation, "wallets/reserve/send", map[string]interface{}{
+		"to": other[0], "amount": 50000, "fee_rate": 2,
+	})
+	result := verify("audit 2026-Q3")
+	if result["valid"] != false || len(result["spent"].([]string)) == 0 || result["unspent_total"].(int64) >= 100000 {
+		t.Errorf("verify after spending = %v", result)
+	}
+}
+
+func TestWalletSendTimelocks(t *testing.T) {
+	env := newRegtestEnv(t)
+	from := env.createWallet("heir", "p2wpkh", 1)
+	to := env.createWallet("estate", "p2tr", 1)
+	outpoint := env.fund(from[0], 100000)
+	height := env.chain.Height()
+
+	sendError := func(data map[string]interface{}) string {
+		t.Helper()
+		resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "wallets/heir/send",
+			Data:      data,
+			Storage:   env.storage,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("send with %v succeeded", data)
+		}
+		return resp.Error().Error()
+	}
+
+	// A locktime in the future is signed but not broadcast
+	dryRun := env.request(logical.UpdateOperation, "wallets/heir/send", map[string]interface{}{
+		"to": to[0], "amount": 30000, "fee_rate": 2, "locktime": height + 10, "dry_run": true,
+	}).Data
+	if dryRun["valid_from_height"] != height+11 || dryRun["timelocked"] != true || dryRun["locktime_type"] != "height" {
+		t.Fatalf("dry run = %v", dryRun)
+	}
+
+	resp := env.request(logical.UpdateOperation, "wallets/heir/send", map[string]interface{}{
+		"to": to[0], "amount": 30000, "fee_rate": 2, "locktime": height + 10,
+	})
+	if resp.Data["broadcast"] != false || resp.Data["hex"] == nil || len(resp.Warnings) == 0 {
+		t.Fatalf("timelocked send = %v", resp.Data)
+	}
+	if len(env.chain.Broadcasts()) != 0 {
+		t.Fatal("timelocked transaction was broadcast")
+	}
+	raw, _ := hex.DecodeString(resp.Data["hex"].(string))
+	tx := wire.NewMsgTx(0)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if tx.LockTime != uint32(height+10) || tx.TxIn[0].Sequence != wallet.SequenceRBF {
+		t.Errorf("locktime %d, sequence 0x%x", tx.LockTime, tx.TxIn[0].Sequence)
+	}
+
+	// A relative timelock counts from the confirmation of its input
+	csv := map[string]interface{}{
+		"to": to[0], "amount": 30000, "fee_rate": 2, "dry_run": true,
+		"sequences": map[string]interface{}{outpoint.String(): "3"},
+	}
+	dryRun = env.request(logical.UpdateOperation, "wallets/heir/send", csv).Data
+	if dryRun["valid_from_height"] != height+3 || dryRun["blocks_remaining"] != int64(2) {
+		t.Errorf("relative timelock dry run = %v", dryRun)
+	}
+	env.chain.Mine(2)
+	dryRun = env.request(logical.UpdateOperation, "wallets/heir/send", csv).Data
+	if dryRun["timelocked"] != false {
+		t.Errorf("relative timelock after 2 blocks = %v", dryRun)
+	}
+
+	if msg := sendError(map[string]interface{}{
+		"to": to[0], "amount": 30000, "locktime": height,
+		"sequences": map[string]interface{}{outpoint.String(): "0xffffffff"},
+	}); !strings.Contains(msg, "disables locktime") {
+		t.Errorf("final sequence error = %s", msg)
+	}
+	if msg := sendError(map[string]interface{}{
+		"to": to[0], "amount": 30000,
+		"sequences": map[string]interface{}{strings.Repeat("ab", 32) + ":0": "3"},
+	}); !strings.Contains(msg, "not a spendable UTXO") {
+		t.Errorf("unknown outpoint error = %s", msg)
+	}
+
+	// A locktime that has passed is broadcast as usual
+	resp = env.request(logical.UpdateOperation, "wallets/heir/send", map[string]interface{}{
+		"to": to[0], "amount": 30000, "fee_rate": 2, "locktime": height,
+	})
+	if resp.Data["broadcast"] != true {
+		t.Fatalf("send with past locktime = %v", resp.Data)
+	}
+}
+
+func TestWalletAntiFeeSniping(t *testing.T) {
+	env := newRegtestEnv(t)
+	from := env.createWallet("hot", "p2wpkh", 1)
+	to := env.createWallet("cold", "p2tr", 1)
+	env.fund(from[0], 100000)
+	env.chain.Mine(150)
+	height := uint32(env.chain.Height())
+
+	send := func() *wire.MsgTx {
+		t.Helper()
+		env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+			"to": to[0], "amount": 20000, "fee_rate": 2,
+		})
+		broadcasts := env.chain.Broadcasts()
+		env.chain.Mine(1)
+		return broadcasts[len(broadcasts)-1]
+	}
+
+	if env.request(logical.ReadOperation, "config", nil).Data["anti_fee_sniping"] != true {
+		t.Error("anti_fee_sniping is not enabled by default")
+	}
+	if tx := send(); tx.LockTime > height || tx.LockTime+100 <= height {
+		t.Errorf("locktime %d is not within 100 blocks below the tip %d", tx.LockTime, height)
+	}
+
+	env.write("config", map[string]interface{}{
+		"network": "regtest", "electrum_url": env.chain.URL(), "anti_fee_sniping": false,
+	})
+	if tx := send(); tx.LockTime != 0 {
+		t.Errorf("locktime %d with anti_fee_sniping=false, want 0", tx.LockTime)
+	}
+}
+
+func TestWalletSendFee(t *testing.T) {
+	env := newRegtestEnv(t)
+	from := env.createWallet("hot", "p2tr", 2)
+	to := env.createWallet("cold", "p2wpkh", 1)
+	env.fund(from[0], 100000)
+	env.fund(from[1], 50000)
+
+	requestError := func(path string, data map[string]interface{}) string {
+		t.Helper()
+		resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+			Storage:   env.storage,
+		})
+		if err != nil {
+			t.Fatalf("%s error = %v", path, err)
+		}
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%s succeeded: %v", path, resp)
+		}
+		return resp.Error().Error()
+	}
+
+	// A decimal fee rate is paid to the millisatoshi, rounded up
+	dryRun := env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+		"to": to[0], "amount": 30000, "fee_rate": "1.5", "dry_run": true,
+	})
+	vsize := dryRun.Data["estimated_vsize"].(int)
+	if want := (int64(vsize)*1500 + 999) / 1000; dryRun.Data["estimated_fee"] != want || dryRun.Data["fee_rate"] != 1.5 {
+		t.Errorf("dry run fee %v at %v sat/vB for %d vbytes, want %d at 1.5", dryRun.Data["estimated_fee"], dryRun.Data["fee_rate"], vsize, want)
+	}
+	resp := env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+		"to": to[0], "amount": 30000, "fee_rate": 1.5,
+	})
+	if resp.Data["fee"] != dryRun.Data["estimated_fee"] {
+		t.Errorf("sent fee %v, dry run %v", resp.Data["fee"], dryRun.Data["estimated_fee"])
+	}
+	env.chain.Mine(1)
+
+	// An absolute fee is paid as given
+	resp = env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+		"to": to[0], "amount": 20000, "fee": 2000,
+	})
+	if resp.Data["fee"] != int64(2000) {
+		t.Errorf("sent fee %v, want 2000", resp.Data["fee"])
+	}
+	env.chain.Mine(1)
+
+	// Change below the dust limit raises an absolute fee, with a warning
+	total := env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+		"to": to[0], "max_send": true, "dry_run": true,
+	}).Data["total_available"].(int64)
+	dryRun = env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+		"to": to[0], "amount": total - 2300, "fee": 2000, "dry_run": true,
+	})
+	if dryRun.Data["estimated_fee"] != int64(2300) || dryRun.Data["change_amount"] != int64(0) || len(dryRun.Warnings) != 1 {
+		t.Errorf("dry run with dust change = %v, warnings %v, want a 2300 fee and a warning", dryRun.Data, dryRun.Warnings)
+	}
+
+	consolidate := env.request(logical.UpdateOperation, "wallets/hot/consolidate", map[string]interface{}{
+		"fee": 1000, "dry_run": true,
+	})
+	if consolidate.Data["estimated_fee"] != int64(1000) {
+		t.Errorf("consolidation fee %v, want 1000", consolidate.Data["estimated_fee"])
+	}
+
+	for _, tt := range []struct {
+		data map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"fee": 100, "fee_rate": 2}, "mutually exclusive"},
+		{map[string]interface{}{"fee_rate": "0.5"}, "minimum relay fee rate"},
+		{map[string]interface{}{"fee_rate": "1.0001"}, "millisatoshi precision"},
+		{map[string]interface{}{"fee": 50}, "minimum relay fee"},
+		{map[string]interface{}{"fee": -5}, "fee must be positive"},
+	} {
+		tt.data["to"], tt.data["amount"] = to[0], 10000
+		if msg := requestError("wallets/hot/send", tt.data); !strings.Contains(msg, tt.want) {
+			t.Errorf("send with %v error = %s, want %q", tt.data, msg, tt.want)
+		}
+	}
+	if msg := requestError("wallets/hot/consolidate", map[string]interface{}{"fee_rate": "0.9"}); !strings.Contains(msg, "minimum relay fee rate") {
+		t.Errorf("consolidate error = %s", msg)
+	}
+}
+
+func TestWalletSendOpReturn(t *testing.T) {
+	env := newRegtestEnv(t)
+	from := env.createWallet("hot", "p2wpkh", 2)
+	to := env.createWallet("cold", "p2wpkh", 1)
+	env.fund(from[0], 100000)
+
+	memo := hex.EncodeToString([]byte("invoice 2026-0042"))
+	dryRun := env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+		"to": to[0], "amount": 30000, "fee_rate": 2, "op_return": memo, "dry_run": true,
+	})
+	if dryRun.Data["op_return"] != memo {
+		t.Errorf("dry run op_return = %v, want %s", dryRun.Data["op_return"], memo)
+	}
+
+	resp := env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+		"to": to[0], "amount": 30000, "fee_rate": 2, "op_return": memo,
+	})
+	if resp.Data["broadcast"] != true || resp.Data["fee"] != dryRun.Data["estimated_fee"] {
+		t.Fatalf("send = %v, dry run fee %v", resp.Data, dryRun.Data["estimated_fee"])
+	}
+	tx := env.chain.Broadcasts()[0]
+	if len(tx.TxOut) != 3 || tx.TxOut[1].Value != 0 || hex.EncodeToString(tx.TxOut[1].PkScript[2:]) != memo {
+		t.Errorf("outputs %v, want payment, OP_RETURN %s and change", tx.TxOut, memo)
+	}
+	env.chain.Mine(1)
+
+	// max_send pays everything but the fee, next to the data output
+	resp = env.request(logical.UpdateOperation, "wallets/hot/send", map[string]interface{}{
+		"to": to[0], "max_send": true, "fee_rate": 2, "op_return": memo,
+	})
+	tx = env.chain.Broadcasts()[1]
+	if len(tx.TxOut) != 2 || tx.TxOut[0].Value != resp.Data["amount"] || tx.TxOut[1].Value != 0 {
+		t.Errorf("max_send outputs %v, amount %v", tx.TxOut, resp.Data["amount"])
+	}
+
+	for _, opReturn := range []string{"zz", strings.Repeat("ab", 81)} {
+		resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "wallets/hot/send",
+			Data:      map[string]interface{}{"to": to[0], "amount": 10000, "op_return": opReturn},
+			Storage:   env.storage,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Errorf("send with op_return %q = %v, %v", opReturn, resp, err)
+		}
+	}
+}
+
+func TestWalletSilentPayments(t *testing.T) {
+	env := newRegtestEnv(t)
+	ctx := context.Background()
+
+	resp := env.write("wallets/sp", map[string]interface{}{"silent_payments": true})
+	address, _ := resp.Data["silent_payment_address"].(string)
+	if !strings.HasPrefix(address, "tsp1q") {
+		t.Fatalf("silent_payment_address = %q, want tsp1q...", address)
+	}
+	scan, spend, err := wallet.DecodeSilentPaymentAddress(address, env.network)
+	if err != nil {
+		t.Fatalf("DecodeSilentPaymentAddress() error = %v", err)
+	}
+
+	// An outside sender pays the address from a P2WPKH output of its own seed
+	seed := bytes.Repeat([]byte{0x42}, 32)
+	sender, err := wallet.GenerateAddressInfoForType(seed, env.network, 0, wallet.AddressTypeP2WPKH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funding := env.fund(sender.Address, 100000)
+	key, err := wallet.DeriveKeyForAccount(seed, env.network, 0, 0, 0, wallet.AddressTypeP2WPKH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey, err := wallet.GetPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputKey, err := wallet.SilentPaymentOutputKey([]wallet.SilentPaymentInputKey{{Key: privKey}}, []wire.OutPoint{funding}, scan, spend, 0)
+	if err != nil {
+		t.Fatalf("SilentPaymentOutputKey() error = %v", err)
+	}
+	params, _ := wallet.NetworkParams(env.network)
+	output, err := btcutil.NewAddressTaproot(outputKey, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utxo := wallet.UTXO{
+		TxID:         funding.Hash.String(),
+		Vout:         int(funding.Index),
+		Value:        100000,
+		Address:      sender.Address,
+		ScriptPubKey: env.script(sender.Address),
+		AddressType:  wallet.AddressTypeP2WPKH,
+	}
+	payment, err := wallet.BuildTransactionWithFee(seed, env.network, []wallet.UTXO{utxo},
+		[]wallet.TxOutput{{Address: output.EncodeAddress(), Value: 60000}}, sender.Address, wallet.Fee{Rate: wallet.SatPerVByte(2)}, 0)
+	if err != nil {
+		t.Fatalf("BuildTransactionWithFee() error = %v", err)
+	}
+	client, err := electrum.NewClient(ctx, env.chain.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.BroadcastTransaction(ctx, payment.Hex); err != nil {
+		t.Fatalf("BroadcastTransaction() error = %v", err)
+	}
+	env.chain.Mine(1)
+
+	// The payment is invisible until its transaction is scanned
+	resp = env.request(logical.ReadOperation, "wallets/sp/silent-payments", nil)
+	if resp.Data["address"] != address || len(resp.Data["outputs"].([]map[string]interface{})) != 0 {
+		t.Fatalf("silent-payments = %v, want the address and no outputs", resp.Data)
+	}
+
+	resp = env.request(logical.UpdateOperation, "wallets/sp/silent-payments", map[string]interface{}{
+		"txids": payment.TxID,
+	})
+	found := resp.Data["found"].([]map[string]interface{})
+	if len(found) != 1 || found[0]["value"] != int64(60000) || found[0]["address"] != output.EncodeAddress() {
+		t.Fatalf("found = %v, want the 60000 sat output", found)
+	}
+
+	// Electrum cannot list blocks, so block scans need another backend
+	resp, err = env.b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "wallets/sp/silent-payments",
+		Data:      map[string]interface{}{"start_height": env.chain.Height()},
+		Storage:   env.storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "txids") {
+		t.Fatalf("block scan over electrum = %v, %v, want an error response", resp, err)
+	}
+
+	b := env.b.(*btcBackend)
+	b.lock.Lock()
+	b.clients[env.network] = &blockScanBackend{ChainBackend: b.clients[env.network], chain: env.chain}
+	b.lock.Unlock()
+
+	resp, err = env.b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "wallets/sp/silent-payments",
+		Storage:   env.storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "start_height is required") {
+		t.Fatalf("first block scan without start_height = %v, %v, want an error response", resp, err)
+	}
+
+	tip := env.chain.Height()
+	resp = env.request(logical.UpdateOperation, "wallets/sp/silent-payments", map[string]interface{}{
+		"start_height": tip - 1,
+	})
+	found = resp.Data["found"].([]map[string]interface{})
+	if len(found) != 1 || found[0]["txid"] != payment.TxID || resp.Data["end_height"] != tip {
+		t.Fatalf("block scan = %v, want the payment found up to height %d", resp.Data, tip)
+	}
+
+	// The next scan continues after the last block scanned
+	env.chain.Mine(1)
+	resp = env.request(logical.UpdateOperation, "wallets/sp/silent-payments", nil)
+	if resp.Data["start_height"] != tip+1 || resp.Data["end_height"] != tip+1 || len(resp.Data["found"].([]map[string]interface{})) != 0 {
+		t.Fatalf("continued block scan = %v, want block %d only", resp.Data, tip+1)
+	}
+
+	// The other account has its own address and sees nothing
+	env.write("wallets/sp/accounts/1", nil)
+	resp = env.request(logical.ReadOperation, "wallets/sp/accounts/1/silent-payments", nil)
+	if resp.Data["address"] == address || resp.Data["total"] != int64(0) {
+		t.Errorf("account 1 silent-payments = %v, want another address and no funds", resp.Data)
+	}
+
+	// Silent payment outputs count towards the balance checked on delete
+	resp, err = env.b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "wallets/sp",
+		Storage:   env.storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "holds") {
+		t.Fatalf("delete of a wallet holding a silent payment = %v, %v, want an error response", resp, err)
+	}
+
+	// Send spends the output with the tweaked spend key
+	to := env.createWallet("dest", "p2wpkh", 1)
+	env.write("wallets/sp/send", map[string]interface{}{"to": to[0], "amount": 30000})
+	if got := env.chain.Unspent(env.script(to[0])); got != 30000 {
+		t.Fatalf("destination received %d, want 30000", got)
+	}
+
+	resp = env.request(logical.ReadOperation, "wallets/sp/silent-payments", nil)
+	outputs := resp.Data["outputs"].([]map[string]interface{})
+	if len(outputs) != 1 || outputs[0]["spent"] != true || resp.Data["total"] != int64(0) {
+		t.Errorf("silent-payments after send = %v, want the output spent", resp.Data)
+	}
+
+	// Wallets without the option have no silent payment address
+	env.write("wallets/plain", nil)
+	resp, err = env.b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "wallets/plain/silent-payments",
+		Storage:   env.storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Errorf("silent-payments on a plain wallet = %v, %v, want an error response", resp, err)
+	}
+}
+
+// slowBackend delays address lookups of a chain backend
+type slowBackend struct {
+	ChainBackend
+	delay time.Duration
+}
+
+func (b *slowBackend) AddressStatus(ctx context.Context, address string) (*string, error) {
+	time.Sleep(b.delay)
+	return b.ChainBackend.AddressStatus(ctx, address)
+}
+
+// rejectingBackend fails every broadcast of a chain backend
+type rejectingBackend struct {
+	ChainBackend
+}
+
+func (b *rejectingBackend) BroadcastTransaction(ctx context.Context, txHex string) (string, error) {
+	return "", fmt.Errorf("bad-txns-rejected")
+}
+
+// blockScanBackend gives a chain backend the block listing that Electrum
+// lacks, reading it from the test server
+type blockScanBackend struct {
+	ChainBackend
+	chain *electrumtest.Server
+}
+
+func (b *blockScanBackend) BlockTransactions(ctx context.Context, height int64) ([]string, error) {
+	return b.chain.BlockTransactions(height), nil
+}
+
+func TestWalletSendSilentPayment(t *testing.T) {
+	env := newRegtestEnv(t)
+
+	resp := env.write("wallets/payee", map[string]interface{}{"silent_payments": true})
+	address := resp.Data["silent_payment_address"].(string)
+
+	from := env.createWallet("payer", "p2tr", 2)
+	env.fund(from[0], 50000)
+	env.fund(from[1], 50000)
+
+	// The dry run sizes the payment without the inputs' keys
+	resp = env.write("wallets/payer/send", map[string]interface{}{"to": address, "amount": 70000, "dry_run": true})
+	if resp.Data["to"] != address || resp.Data["inputs_used"] != 2 {
+		t.Fatalf("dry run = %v, want both inputs paying %s", resp.Data, address)
+	}
+	estimatedFee := resp.Data["estimated_fee"]
+
+	resp = env.write("wallets/payer/send", map[string]interface{}{"to": address, "amount": 70000})
+	output, _ := resp.Data["silent_payment_output"].(string)
+	if !strings.HasPrefix(output, "bcrt1p") || resp.Data["fee"] != estimatedFee {
+		t.Fatalf("send = %v, want a bcrt1p... silent_payment_output and fee %v", resp.Data, estimatedFee)
+	}
+	if got := env.chain.Unspent(env.script(output)); got != 70000 {
+		t.Fatalf("silent payment output holds %d, want 70000", got)
+	}
+
+	resp = env.request(logical.UpdateOperation, "wallets/payee/silent-payments", map[string]interface{}{"txids": resp.Data["txid"]})
+	found := resp.Data["found"].([]map[string]interface{})
+	if len(found) != 1 || found[0]["address"] != output || found[0]["value"] != int64(70000) {
+		t.Errorf("found = %v, want the 70000 sat output at %s", found, output)
+	}
+
+	// Silent payment addresses of other networks are rejected
+	resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "wallets/payer/send",
+		Data:      map[string]interface{}{"to": "sp1" + strings.TrimPrefix(address, "tsp1"), "amount": 1000},
+		Storage:   env.storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Errorf("send to a mainnet silent payment address = %v, %v, want an error response", resp, err)
+	}
+}
+
+func TestWalletChannelFunding(t *testing.T) {
+	env := newRegtestEnv(t)
+
+	from := env.createWallet("treasury", "p2wpkh", 2)
+	env.fund(from[0], 60000)
+	env.fund(from[1], 60000)
+
+	// A P2WSH output of the channel's 2-of-2 multisig script
+	witnessScript := []byte("channel funding witness script")
+	scriptHash := chainhash.HashB(witnessScript)
+	fundingScript := append([]byte{0x00, 0x20}, scriptHash...)
+
+	available := func() interface{} {
+		t.Helper()
+		resp := env.write("wallets/treasury/send", map[string]interface{}{"to": from[0], "max_send": true, "dry_run": true})
+		return resp.Data["total_available"]
+	}
+
+	create := func() *logical.Response {
+		t.Helper()
+		return env.request(logical.UpdateOperation, "wallets/treasury/channel-funding", map[string]interface{}{
+			"funding_script": hex.EncodeToString(fundingScript),
+			"amount":         50000,
+			"fee_rate":       "2",
+		})
+	}
+
+	resp := create()
+	txid := resp.Data["txid"].(string)
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(resp.Data["psbt"].(string)), true)
+	if err != nil {
+		t.Fatalf("invalid funding PSBT: %v", err)
+	}
+	if got := packet.UnsignedTx.TxHash().String(); got != txid {
+		t.Errorf("PSBT txid = %s, want %s", got, txid)
+	}
+	out := packet.UnsignedTx.TxOut[resp.Data["output_index"].(int)]
+	if !bytes.Equal(out.PkScript, fundingScript) || out.Value != 50000 {
+		t.Errorf("funding output = %x of %d, want %x of 50000", out.PkScript, out.Value, fundingScript)
+	}
+	if len(packet.Inputs[0].FinalScriptWitness) != 0 || len(packet.Inputs[0].PartialSigs) != 0 || len(env.chain.Broadcasts()) != 0 {
+		t.Fatal("funding transaction was released before finalization")
+	}
+
+	// The funding's input is locked until it is finalized or cancelled
+	if got := available(); got != int64(60000) {
+		t.Errorf("available with a pending funding = %v, want 60000", got)
+	}
+	list := env.request(logical.ListOperation, "wallets/treasury/channel-funding", nil)
+	if keys := list.Data["keys"].([]string); len(keys) != 1 || keys[0] != txid {
+		t.Errorf("pending fundings = %v, want [%s]", keys, txid)
+	}
+
+	cancel := env.request(logical.DeleteOperation, "wallets/treasury/channel-funding/"+txid, nil)
+	if cancel.Data["cancelled"] != true {
+		t.Errorf("cancel = %v", cancel.Data)
+	}
+	if got := available(); got != int64(120000) {
+		t.Errorf("available after cancelling = %v, want 120000", got)
+	}
+
+	// A failed broadcast keeps the funding pending and its transaction withheld
+	resp = create()
+	b := env.b.(*btcBackend)
+	b.lock.Lock()
+	electrumClient := b.clients[env.network]
+	b.clients[env.network] = &rejectingBackend{ChainBackend: electrumClient}
+	b.lock.Unlock()
+
+	final := env.request(logical.UpdateOperation, "wallets/treasury/psbt/finalize", map[string]interface{}{
+		"psbt": resp.Data["psbt"],
+	})
+	if final.Data["broadcast"] != false || final.Data["hex"] != nil || len(final.Warnings) == 0 {
+		t.Errorf("finalize with a failed broadcast = %v, want the hex withheld and a warning", final.Data)
+	}
+	list = env.request(logical.ListOperation, "wallets/treasury/channel-funding", nil)
+	if keys, _ := list.Data["keys"].([]string); len(keys) != 1 {
+		t.Errorf("pending fundings after a failed broadcast = %v, want the funding kept", keys)
+	}
+	if got := available(); got != int64(60000) {
+		t.Errorf("available after a failed broadcast = %v, want 60000", got)
+	}
+
+	b.lock.Lock()
+	b.clients[env.network] = electrumClient
+	b.lock.Unlock()
+
+	// Finalizing hands out the withheld signatures and broadcasts
+	final = env.request(logical.UpdateOperation, "wallets/treasury/psbt/finalize", map[string]interface{}{
+		"psbt": resp.Data["psbt"],
+	})
+	if final.Data["broadcast"] != true || final.Data["txid"] != resp.Data["txid"] || final.Data["channel_funding"] != true {
+		t.Fatalf("finalize = %v, want the funding %s broadcast", final.Data, resp.Data["txid"])
+	}
+	if got := env.chain.Unspent(fundingScript); got != 50000 {
+		t.Errorf("funding output holds %d, want 50000", got)
+	}
+	list = env.request(logical.ListOperation, "wallets/treasury/channel-funding", nil)
+	if keys, _ := list.Data["keys"].([]string); len(keys) != 0 {
+		t.Errorf("pending fundings after finalizing = %v, want none", keys)
+	}
+
+	// Only channel outputs are funded
+	resp, err = env.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "wallets/treasury/channel-funding",
+		Data:      map[string]interface{}{"funding_script": hex.EncodeToString(env.script(from[0])), "amount": 10000},
+		Storage:   env.storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Errorf("funding a p2wpkh script = %v, %v, want an error response", resp, err)
+	}
+}
+
+func TestWalletSpendsDoNotShareInputs(t *testing.T) {
+	env := newRegtestEnv(t)
+
+	from := env.createWallet("treasury", "p2wpkh", 1)
+	env.fund(from[0], 60000)
+	fundingScript := append([]byte{0x00, 0x20}, chainhash.HashB([]byte("witness script"))...)
+
+	// Slow lookups let every request read the UTXOs before any records a spend
+	b := env.b.(*btcBackend)
+	b.lock.Lock()
+	b.clients[env.network] = &slowBackend{ChainBackend: b.clients[env.network], delay: 50 * time.Millisecond}
+	b.lock.Unlock()
+
+	// Funding and send requests race for the only UTXO; each would spend it
+	paths := []struct {
+		path string
+		data map[string]interface{}
+	}{
+		{"wallets/treasury/channel-funding", map[string]interface{}{"funding_script": hex.EncodeToString(fundingScript), "amount": 50000, "fee_rate": "2"}},
+		{"wallets/treasury/send", map[string]interface{}{"to": from[0], "amount": 50000, "fee_rate": 2}},
+		{"wallets/treasury/channel-funding", map[string]interface{}{"funding_script": hex.EncodeToString(fundingScript), "amount": 40000, "fee_rate": "2"}},
+		{"wallets/treasury/send", map[string]interface{}{"to": from[0], "amount": 40000, "fee_rate": 2}},
+	}
+
+	var wg sync.WaitGroup
+	succeeded := make([]bool, len(paths))
+	for i, p := range paths {
+		wg.Add(1)
+		go func(i int, path string, data map[string]interface{}) {
+			defer wg.Done()
+			resp, err := env.b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      path,
+				Data:      data,
+				Storage:   env.storage,
+			})
+			if err != nil {
+				t.Errorf("%s: error = %v", path, err)
+				return
+			}
+			succeeded[i] = resp != nil && !resp.IsError()
+		}(i, p.path, p.data)
+	}
+	wg.Wait()
+
+	spends := 0
+	for _, ok := range succeeded {
+		if ok {
+			spends++
+		}
+	}
+	if spends != 1 {
+		t.Errorf("%d requests spent the single UTXO, want 1", spends)
+	}
+
+	fundings := env.request(logical.ListOperation, "wallets/treasury/channel-funding", nil)
+	pending := 0
+	if keys, ok := fundings.Data["keys"].([]string); ok {
+		pending = len(keys)
+	}
+	if pending+len(env.chain.Broadcasts()) != 1 {
+		t.Errorf("%d pending fundings and %d broadcasts, want one spend", pending, len(env.chain.Broadcasts()))
+	}
+}
@@ -3,11 +3,21 @@ package btc
 import (
 	"context"
 	cryptorand "crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
 	"math/big"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/djschnei21/vault-plugin-btc/bitcoind"
+	"github.com/djschnei21/vault-plugin-btc/electrum"
+	"github.com/djschnei21/vault-plugin-btc/esplora"
+	"github.com/djschnei21/vault-plugin-btc/wallet"
 )
 
 const configStoragePath = "config"
@@ -28,8 +38,28 @@ var (
 
 	// Signet has no default servers - requires explicit configuration
 	SignetElectrumServers = []string{}
+
+	// Regtest is a local chain - requires explicit configuration
+	RegtestElectrumServers = []string{}
+
+	// Default Esplora API per network, used when backend=esplora and no
+	// esplora_url is configured
+	DefaultEsploraURLs = map[string]string{
+		"mainnet":  "https://mempool.space/api",
+		"testnet4": "https://mempool.space/testnet4/api",
+	}
 )
 
+// validNetwork reports whether n is a supported network name
+func validNetwork(n string) bool {
+	switch n {
+	case "mainnet", "testnet4", "signet", "regtest":
+		return true
+	default:
+		return false
+	}
+}
+
 // getServersForNetwork returns the server list for the given network
 func getServersForNetwork(network string) []string {
 	switch network {
@@ -39,6 +69,8 @@ func getServersForNetwork(network string) []string {
 		return Testnet4ElectrumServers
 	case "signet":
 		return SignetElectrumServers
+	case "regtest":
+		return RegtestElectrumServers
 	default:
 		return MainnetElectrumServers
 	}
@@ -87,9 +119,162 @@ func shuffleServers(servers []string) []string {
 
 // btcConfig stores the secrets engine configuration
 type btcConfig struct {
-	ElectrumURL      string `json:"electrum_url"`
-	Network          string `json:"network"`
-	MinConfirmations int    `json:"min_confirmations"`
+	ElectrumURL string `json:"electrum_url"`
+	// ElectrumURLs maps other networks to the Electrum server used for wallets
+	// created on them; networks without an entry use their default pool
+	ElectrumURLs     map[string]string `json:"electrum_urls,omitempty"`
+	Network          string            `json:"network"`
+	MinConfirmations int               `json:"min_confirmations"`
+	ConnectTimeout   int               `json:"connect_timeout,omitempty"` // seconds, 0 = client default
+	RequestTimeout   int               `json:"request_timeout,omitempty"` // seconds, 0 = client default
+
+	// TLS and transport hardening for Electrum connections
+	TLSCAPEM                 string `json:"tls_ca_pem,omitempty"`
+	TLSCertFingerprintSHA256 string `json:"tls_cert_fingerprint_sha256,omitempty"`
+	TLSSkipVerify            bool   `json:"tls_skip_verify,omitempty"` // test networks only
+	SOCKS5Proxy              string `json:"socks5_proxy,omitempty"`
+
+	// Custom signet parameters (network=signet only); empty = public signet
+	SignetChallenge string `json:"signet_challenge,omitempty"` // hex
+	SignetHRP       string `json:"signet_hrp,omitempty"`
+	SignetMagic     string `json:"signet_magic,omitempty"` // hex message-start bytes
+
+	// Chain backend selection: electrum (default), bitcoind or esplora
+	Backend          string `json:"backend,omitempty"`
+	BitcoindURL      string `json:"bitcoind_url,omitempty"`
+	BitcoindUser     string `json:"bitcoind_user,omitempty"`
+	BitcoindPassword string `json:"bitcoind_password,omitempty"`
+	BitcoindWallet   string `json:"bitcoind_wallet,omitempty"` // empty = scantxoutset
+	EsploraURL       string `json:"esplora_url,omitempty"`     // empty = network default
+
+	// PersistCache keeps wallet cache snapshots in storage across restarts
+	PersistCache bool `json:"persist_cache,omitempty"`
+
+	// DeletedWalletRetention is how long deleted wallets can be undeleted, in
+	// seconds; nil = defaultDeletedWalletRetention, 0 = delete immediately
+	DeletedWalletRetention *int `json:"deleted_wallet_retention,omitempty"`
+
+	// AntiFeeSniping sets the locktime of wallet-built transactions to the
+	// chain tip; nil = enabled
+	AntiFeeSniping *bool `json:"anti_fee_sniping,omitempty"`
+}
+
+// defaultDeletedWalletRetention is how long deleted wallets are kept by default
+const defaultDeletedWalletRetention = 30 * 24 * time.Hour
+
+// deletedWalletRetention returns how long a deleted wallet can be undeleted
+func (c *btcConfig) deletedWalletRetention() time.Duration {
+	if c == nil || c.DeletedWalletRetention == nil {
+		return defaultDeletedWalletRetention
+	}
+	return time.Duration(*c.DeletedWalletRetention) * time.Second
+}
+
+// antiFeeSniping reports whether wallet-built transactions are locked to the
+// chain tip
+func (c *btcConfig) antiFeeSniping() bool {
+	return c == nil || c.AntiFeeSniping == nil || *c.AntiFeeSniping
+}
+
+// networkID returns the network name used to encode and decode addresses.
+// A custom signet is registered with the wallet package under a name derived
+// from its parameters; every other network uses its configured name.
+func (c *btcConfig) networkID() (string, error) {
+	if c == nil || c.Network == "" {
+		return "mainnet", nil
+	}
+	if c.Network != "signet" || c.SignetChallenge == "" {
+		return c.Network, nil
+	}
+
+	challenge, err := hex.DecodeString(c.SignetChallenge)
+	if err != nil {
+		return "", fmt.Errorf("signet_challenge must be hex: %w", err)
+	}
+	opts := wallet.SignetOptions{
+		Challenge: challenge,
+		HRP:       c.SignetHRP,
+	}
+	if c.SignetMagic != "" {
+		if opts.Magic, err = wallet.ParseMagic(c.SignetMagic); err != nil {
+			return "", err
+		}
+	}
+	return wallet.RegisterCustomSignet(opts)
+}
+
+// electrumURLFor returns the Electrum server configured for a network other
+// than the mount network, or "" to use the network's default pool
+func (c *btcConfig) electrumURLFor(network string) string {
+	if c == nil {
+		return ""
+	}
+	return c.ElectrumURLs[network]
+}
+
+// backendType returns the configured chain backend, defaulting to electrum
+func (c *btcConfig) backendType() string {
+	if c == nil || c.Backend == "" {
+		return backendElectrum
+	}
+	return c.Backend
+}
+
+// bitcoindWatchTarget identifies the bitcoind watch-only wallet that tracks
+// wallet addresses, or "" when none is used
+func (c *btcConfig) bitcoindWatchTarget() string {
+	if c == nil || c.backendType() != backendBitcoind || c.BitcoindWallet == "" {
+		return ""
+	}
+	return c.BitcoindURL + "#" + c.BitcoindWallet
+}
+
+// bitcoindOptions returns the Bitcoin Core RPC client options for this config
+func (c *btcConfig) bitcoindOptions() bitcoind.Options {
+	if c == nil {
+		return bitcoind.Options{}
+	}
+	return bitcoind.Options{
+		URL:            c.BitcoindURL,
+		User:           c.BitcoindUser,
+		Password:       c.BitcoindPassword,
+		Wallet:         c.BitcoindWallet,
+		RequestTimeout: time.Duration(c.RequestTimeout) * time.Second,
+	}
+}
+
+// esploraURL returns the configured Esplora API URL or the network default
+func (c *btcConfig) esploraURL(network string) string {
+	if c != nil && c.EsploraURL != "" {
+		return c.EsploraURL
+	}
+	return DefaultEsploraURLs[network]
+}
+
+// esploraOptions returns the Esplora client options for this config
+func (c *btcConfig) esploraOptions() esplora.Options {
+	if c == nil {
+		return esplora.Options{}
+	}
+	return esplora.Options{
+		RequestTimeout: time.Duration(c.RequestTimeout) * time.Second,
+		SOCKS5Proxy:    c.SOCKS5Proxy,
+	}
+}
+
+// electrumOptions returns the Electrum client options for this config
+func (c *btcConfig) electrumOptions() electrum.Options {
+	if c == nil {
+		return electrum.Options{}
+	}
+	return electrum.Options{
+		ConnectTimeout:     time.Duration(c.ConnectTimeout) * time.Second,
+		RequestTimeout:     time.Duration(c.RequestTimeout) * time.Second,
+		TLSCAPEM:           c.TLSCAPEM,
+		TLSCertFingerprint: c.TLSCertFingerprintSHA256,
+		TLSSkipVerify:      c.TLSSkipVerify,
+		SOCKS5Proxy:        c.SOCKS5Proxy,
+	}
 }
 
 func pathConfig(b *btcBackend) []*framework.Path {
@@ -104,16 +289,99 @@ func pathConfig(b *btcBackend) []*framework.Path {
 					Type:        framework.TypeString,
 					Description: "Electrum server URL. If not set, a random server from the default pool is used per connection.",
 				},
+				"electrum_urls": {
+					Type:        framework.TypeKVPairs,
+					Description: "Electrum server URL per network for wallets created on a network other than the mount network, e.g. testnet4=ssl://host:50002. Networks without an entry use their default pool.",
+				},
 				"network": {
 					Type:        framework.TypeString,
-					Description: "Bitcoin network: mainnet, testnet4, or signet (signet requires custom electrum_url)",
+					Description: "Bitcoin network: mainnet, testnet4, signet, or regtest (signet and regtest require custom electrum_url)",
 					Default:     "mainnet",
 				},
+				"signet_challenge": {
+					Type:        framework.TypeString,
+					Description: "Block signing challenge script (hex) of a custom signet. Only valid with network=signet.",
+				},
+				"signet_hrp": {
+					Type:        framework.TypeString,
+					Description: "Bech32 address prefix of a custom signet (default: tb)",
+				},
+				"signet_magic": {
+					Type:        framework.TypeString,
+					Description: "Network magic of a custom signet as 4 hex bytes, e.g. 0a03cf40 (default: derived from signet_challenge)",
+				},
 				"min_confirmations": {
 					Type:        framework.TypeInt,
 					Description: "Minimum confirmations required to spend UTXOs (default: 1)",
 					Default:     1,
 				},
+				"connect_timeout": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Timeout for connecting to the Electrum server (default: 10s)",
+				},
+				"request_timeout": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Timeout for a single Electrum request when the Vault request has no earlier deadline (default: 15s)",
+				},
+				"tls_ca_pem": {
+					Type:        framework.TypeString,
+					Description: "PEM-encoded CA certificate(s) to trust for ssl:// Electrum servers instead of the system roots",
+				},
+				"tls_cert_fingerprint_sha256": {
+					Type:        framework.TypeString,
+					Description: "Pin the Electrum server certificate by its SHA-256 fingerprint (hex). Replaces chain verification, allowing self-signed certificates, unless tls_ca_pem is also set, in which case both are checked.",
+				},
+				"tls_skip_verify": {
+					Type:        framework.TypeBool,
+					Description: "Disable TLS certificate verification (test networks only)",
+				},
+				"socks5_proxy": {
+					Type:        framework.TypeString,
+					Description: "SOCKS5 proxy for Electrum connections, e.g. 127.0.0.1:9050 for Tor. Accepts host:port or socks5://[user:pass@]host:port.",
+				},
+				"backend": {
+					Type:        framework.TypeString,
+					Description: "Chain backend: electrum (default), bitcoind, or esplora",
+				},
+				"bitcoind_url": {
+					Type:        framework.TypeString,
+					Description: "Bitcoin Core RPC URL, e.g. http://127.0.0.1:8332 (required when backend=bitcoind)",
+				},
+				"bitcoind_user": {
+					Type:        framework.TypeString,
+					Description: "Bitcoin Core RPC username",
+				},
+				"bitcoind_password": {
+					Type:        framework.TypeString,
+					Description: "Bitcoin Core RPC password",
+					DisplayAttrs: &framework.DisplayAttributes{
+						Sensitive: true,
+					},
+				},
+				"bitcoind_wallet": {
+					Type:        framework.TypeString,
+					Description: "Descriptor watch-only wallet used to track addresses. If not set, scantxoutset is used (confirmed outputs only, no mempool).",
+				},
+				"bitcoind_rescan": {
+					Type:        framework.TypeBool,
+					Description: "Import every stored address into bitcoind_wallet again, rescanning from each wallet's creation. Done automatically when the bitcoind wallet changes. Not stored.",
+				},
+				"persist_cache": {
+					Type:        framework.TypeBool,
+					Description: "Persist the wallet cache (status hashes, UTXOs, history) to storage so it survives plugin restarts and standby promotion",
+				},
+				"esplora_url": {
+					Type:        framework.TypeString,
+					Description: "Esplora REST API base URL, e.g. https://mempool.space/api. If not set, a default for the network is used.",
+				},
+				"deleted_wallet_retention": {
+					Type:        framework.TypeDurationSecond,
+					Description: "How long a deleted wallet can be undeleted before it is purged (default: 720h). 0 deletes wallets immediately.",
+				},
+				"anti_fee_sniping": {
+					Type:        framework.TypeBool,
+					Description: "Set the locktime of wallet-built transactions to the current block height, occasionally backdated, like Bitcoin Core (default: true)",
+				},
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ReadOperation: &framework.PathOperation{
@@ -168,14 +436,55 @@ func (b *btcBackend) pathConfigRead(ctx context.Context, req *logical.Request, d
 		return nil, nil
 	}
 
-	b.Logger().Debug("config read", "network", config.Network, "electrum_url", config.ElectrumURL, "min_confirmations", config.MinConfirmations)
+	b.Logger().Debug("config read", "network", config.Network, "backend", config.backendType(), "electrum_url", config.ElectrumURL, "min_confirmations", config.MinConfirmations)
 
 	respData := map[string]interface{}{
 		"network":           config.Network,
+		"backend":           config.backendType(),
 		"min_confirmations": config.MinConfirmations,
+		"connect_timeout":   config.ConnectTimeout,
+		"request_timeout":   config.RequestTimeout,
 	}
 
-	if config.ElectrumURL != "" {
+	if config.TLSCAPEM != "" {
+		respData["tls_ca_pem"] = config.TLSCAPEM
+	}
+	if config.TLSCertFingerprintSHA256 != "" {
+		respData["tls_cert_fingerprint_sha256"] = config.TLSCertFingerprintSHA256
+	}
+	if config.SignetChallenge != "" {
+		respData["signet_challenge"] = config.SignetChallenge
+		respData["signet_hrp"] = wallet.DefaultSignetHRP
+		if config.SignetHRP != "" {
+			respData["signet_hrp"] = config.SignetHRP
+		}
+		respData["signet_magic"] = config.SignetMagic
+		if challenge, err := hex.DecodeString(config.SignetChallenge); err == nil && config.SignetMagic == "" {
+			respData["signet_magic"] = wallet.FormatMagic(wallet.SignetMagic(challenge))
+		}
+		if networkID, err := config.networkID(); err == nil {
+			respData["network_id"] = networkID
+		}
+	}
+	if len(config.ElectrumURLs) > 0 {
+		respData["electrum_urls"] = config.ElectrumURLs
+	}
+	respData["tls_skip_verify"] = config.TLSSkipVerify
+	respData["persist_cache"] = config.PersistCache
+	respData["deleted_wallet_retention"] = int64(config.deletedWalletRetention().Seconds())
+	respData["anti_fee_sniping"] = config.antiFeeSniping()
+	if config.SOCKS5Proxy != "" {
+		respData["socks5_proxy"] = redactProxyURL(config.SOCKS5Proxy)
+	}
+
+	if config.backendType() == backendBitcoind {
+		// The RPC password is never returned
+		respData["bitcoind_url"] = config.BitcoindURL
+		respData["bitcoind_user"] = config.BitcoindUser
+		respData["bitcoind_wallet"] = config.BitcoindWallet
+	} else if config.backendType() == backendEsplora {
+		respData["esplora_url"] = config.esploraURL(config.Network)
+	} else if config.ElectrumURL != "" {
 		respData["electrum_url"] = config.ElectrumURL
 	} else {
 		// Show the server pool for this network
@@ -187,6 +496,8 @@ func (b *btcBackend) pathConfigRead(ctx context.Context, req *logical.Request, d
 			servers = Testnet4ElectrumServers
 		case "signet":
 			servers = SignetElectrumServers
+		case "regtest":
+			servers = RegtestElectrumServers
 		}
 		respData["electrum_url"] = "(random from pool)"
 		respData["electrum_pool"] = servers
@@ -204,6 +515,13 @@ func (b *btcBackend) pathConfigWrite(ctx context.Context, req *logical.Request,
 
 	createOperation := req.Operation == logical.CreateOperation
 
+	// Existing wallets without a recorded network live on the current one
+	previousNetwork, err := config.networkID()
+	if err != nil {
+		previousNetwork = ""
+	}
+	previousWatch := config.bitcoindWatchTarget()
+
 	if config == nil {
 		if !createOperation {
 			return nil, fmt.Errorf("config not found during update operation")
@@ -215,6 +533,10 @@ func (b *btcBackend) pathConfigWrite(ctx context.Context, req *logical.Request,
 	if electrumURL, ok := data.GetOk("electrum_url"); ok {
 		config.ElectrumURL = electrumURL.(string)
 	}
+
+	if electrumURLs, ok := data.GetOk("electrum_urls"); ok {
+		config.ElectrumURLs = electrumURLs.(map[string]string)
+	}
 	// If not provided, leave empty to use random server selection
 
 	if network, ok := data.GetOk("network"); ok {
@@ -223,15 +545,113 @@ func (b *btcBackend) pathConfigWrite(ctx context.Context, req *logical.Request,
 		config.Network = data.Get("network").(string)
 	}
 
+	if challenge, ok := data.GetOk("signet_challenge"); ok {
+		config.SignetChallenge = strings.ToLower(strings.TrimSpace(challenge.(string)))
+	}
+
+	if hrp, ok := data.GetOk("signet_hrp"); ok {
+		config.SignetHRP = hrp.(string)
+	}
+
+	if magic, ok := data.GetOk("signet_magic"); ok {
+		config.SignetMagic = strings.ToLower(magic.(string))
+	}
+
 	if minConf, ok := data.GetOk("min_confirmations"); ok {
 		config.MinConfirmations = minConf.(int)
 	} else if createOperation {
 		config.MinConfirmations = data.Get("min_confirmations").(int)
 	}
 
+	if connectTimeout, ok := data.GetOk("connect_timeout"); ok {
+		config.ConnectTimeout = connectTimeout.(int)
+	}
+
+	if requestTimeout, ok := data.GetOk("request_timeout"); ok {
+		config.RequestTimeout = requestTimeout.(int)
+	}
+
+	if caPEM, ok := data.GetOk("tls_ca_pem"); ok {
+		config.TLSCAPEM = caPEM.(string)
+	}
+
+	if fingerprint, ok := data.GetOk("tls_cert_fingerprint_sha256"); ok {
+		config.TLSCertFingerprintSHA256 = fingerprint.(string)
+	}
+
+	if skipVerify, ok := data.GetOk("tls_skip_verify"); ok {
+		config.TLSSkipVerify = skipVerify.(bool)
+	}
+
+	if socksProxy, ok := data.GetOk("socks5_proxy"); ok {
+		config.SOCKS5Proxy = socksProxy.(string)
+	}
+
+	if backend, ok := data.GetOk("backend"); ok {
+		config.Backend = backend.(string)
+	}
+
+	if bitcoindURL, ok := data.GetOk("bitcoind_url"); ok {
+		config.BitcoindURL = bitcoindURL.(string)
+	}
+
+	if bitcoindUser, ok := data.GetOk("bitcoind_user"); ok {
+		config.BitcoindUser = bitcoindUser.(string)
+	}
+
+	if bitcoindPassword, ok := data.GetOk("bitcoind_password"); ok {
+		config.BitcoindPassword = bitcoindPassword.(string)
+	}
+
+	if bitcoindWallet, ok := data.GetOk("bitcoind_wallet"); ok {
+		config.BitcoindWallet = bitcoindWallet.(string)
+	}
+
+	if esploraURL, ok := data.GetOk("esplora_url"); ok {
+		config.EsploraURL = esploraURL.(string)
+	}
+
+	if retention, ok := data.GetOk("deleted_wallet_retention"); ok {
+		seconds := retention.(int)
+		config.DeletedWalletRetention = &seconds
+	}
+
+	if antiFeeSniping, ok := data.GetOk("anti_fee_sniping"); ok {
+		enabled := antiFeeSniping.(bool)
+		config.AntiFeeSniping = &enabled
+	}
+
+	wasPersistingCache := config.PersistCache
+	if persistCache, ok := data.GetOk("persist_cache"); ok {
+		config.PersistCache = persistCache.(bool)
+	}
+
 	// Validate network
-	if config.Network != "mainnet" && config.Network != "testnet4" && config.Network != "signet" {
-		return logical.ErrorResponse("network must be 'mainnet', 'testnet4', or 'signet'"), nil
+	if !validNetwork(config.Network) {
+		return logical.ErrorResponse("network must be 'mainnet', 'testnet4', 'signet', or 'regtest'"), nil
+	}
+
+	// Validate per-network Electrum servers
+	for network, serverURL := range config.ElectrumURLs {
+		if !validNetwork(network) {
+			return logical.ErrorResponse("electrum_urls: invalid network %q", network), nil
+		}
+		if serverURL == "" {
+			return logical.ErrorResponse("electrum_urls: empty server URL for network %q", network), nil
+		}
+	}
+
+	// Validate custom signet parameters
+	if config.SignetChallenge != "" || config.SignetHRP != "" || config.SignetMagic != "" {
+		if config.Network != "signet" {
+			return logical.ErrorResponse("signet_challenge, signet_hrp and signet_magic are only valid with network=signet"), nil
+		}
+		if config.SignetChallenge == "" {
+			return logical.ErrorResponse("signet_hrp and signet_magic require signet_challenge"), nil
+		}
+		if _, err := config.networkID(); err != nil {
+			return logical.ErrorResponse("invalid signet parameters: %s", err.Error()), nil
+		}
 	}
 
 	// Validate min_confirmations
@@ -239,6 +659,74 @@ func (b *btcBackend) pathConfigWrite(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse("min_confirmations must be >= 0"), nil
 	}
 
+	// Validate timeouts (0 means use the client default)
+	if config.ConnectTimeout < 0 || config.RequestTimeout < 0 {
+		return logical.ErrorResponse("connect_timeout and request_timeout must be >= 0"), nil
+	}
+	if config.DeletedWalletRetention != nil && *config.DeletedWalletRetention < 0 {
+		return logical.ErrorResponse("deleted_wallet_retention must be >= 0"), nil
+	}
+
+	// Validate TLS and proxy settings
+	if config.TLSCAPEM != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(config.TLSCAPEM)) {
+		return logical.ErrorResponse("tls_ca_pem contains no valid PEM certificates"), nil
+	}
+	if config.TLSCertFingerprintSHA256 != "" {
+		if _, err := electrum.ParseFingerprint(config.TLSCertFingerprintSHA256); err != nil {
+			return logical.ErrorResponse("tls_cert_fingerprint_sha256: %s", err.Error()), nil
+		}
+	}
+	if config.TLSSkipVerify && config.Network == "mainnet" {
+		return logical.ErrorResponse("tls_skip_verify is not allowed on mainnet - use tls_cert_fingerprint_sha256 or tls_ca_pem instead"), nil
+	}
+	if config.SOCKS5Proxy != "" {
+		if err := electrum.ValidateProxyURL(config.SOCKS5Proxy); err != nil {
+			return logical.ErrorResponse("socks5_proxy: %s", err.Error()), nil
+		}
+	}
+
+	// Validate chain backend
+	switch config.backendType() {
+	case backendElectrum:
+	case backendBitcoind:
+		if config.BitcoindURL == "" {
+			return logical.ErrorResponse("bitcoind_url is required when backend is 'bitcoind'"), nil
+		}
+		u, err := url.Parse(config.BitcoindURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return logical.ErrorResponse("bitcoind_url must be an http:// or https:// URL"), nil
+		}
+	case backendEsplora:
+		esploraURL := config.esploraURL(config.Network)
+		if esploraURL == "" {
+			return logical.ErrorResponse("esplora_url is required for network %q", config.Network), nil
+		}
+		u, err := url.Parse(esploraURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return logical.ErrorResponse("esplora_url must be an http:// or https:// URL"), nil
+		}
+	default:
+		return logical.ErrorResponse("backend must be 'electrum', 'bitcoind', or 'esplora'"), nil
+	}
+
+	// Keep existing wallets on the network they were created on
+	var resp *logical.Response
+	if network, _ := config.networkID(); previousNetwork != "" && network != previousNetwork {
+		pinned, stranded, err := pinWalletNetworks(ctx, req.Storage, previousNetwork)
+		if err != nil {
+			return nil, err
+		}
+		if len(stranded) > 0 {
+			return logical.ErrorResponse("cannot change the network: wallets %s use the custom signet %s, which is only defined by this config",
+				strings.Join(stranded, ", "), previousNetwork), nil
+		}
+		if pinned > 0 {
+			b.Logger().Info("pinned existing wallets to their network", "network", previousNetwork, "wallets", pinned)
+			resp = &logical.Response{}
+			resp.AddWarning(fmt.Sprintf("%d existing wallet(s) stay on %s; new wallets default to %s", pinned, previousNetwork, network))
+		}
+	}
+
 	entry, err := logical.StorageEntryJSON(configStoragePath, config)
 	if err != nil {
 		return nil, err
@@ -248,11 +736,44 @@ func (b *btcBackend) pathConfigWrite(ctx context.Context, req *logical.Request,
 		return nil, err
 	}
 
+	// Drop persisted snapshots when persistence is turned off so stale
+	// entries are not restored if it is re-enabled later
+	if wasPersistingCache && !config.PersistCache {
+		if err := purgePersistedCaches(ctx, req.Storage); err != nil {
+			return nil, err
+		}
+	}
+
 	// Reset the client so the new config takes effect
 	b.reset()
 
-	b.Logger().Info("config saved", "network", config.Network, "electrum_url", config.ElectrumURL, "min_confirmations", config.MinConfirmations)
-	return nil, nil
+	// Addresses stored before the node tracked them have history it has not
+	// seen: import them all, rescanning from each wallet's creation
+	rescan := data.Get("bitcoind_rescan").(bool)
+	if watch := config.bitcoindWatchTarget(); watch != "" && (watch != previousWatch || rescan) {
+		network, err := config.networkID()
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			resp = &logical.Response{}
+		}
+		client, err := b.getClient(ctx, req.Storage, network)
+		var watched int
+		if err == nil {
+			watched, err = watchAllWallets(ctx, req.Storage, client, network)
+		}
+		if err != nil {
+			b.Logger().Warn("failed to import wallet addresses into bitcoind", "error", err)
+			resp.AddWarning(fmt.Sprintf("config saved, but importing wallet addresses into bitcoind failed (%s); retry with bitcoind_rescan=true", err))
+		} else {
+			b.Logger().Info("imported wallet addresses into bitcoind", "addresses", watched)
+			resp.Data = map[string]interface{}{"bitcoind_addresses_imported": watched}
+		}
+	}
+
+	b.Logger().Info("config saved", "network", config.Network, "backend", config.backendType(), "electrum_url", config.ElectrumURL, "min_confirmations", config.MinConfirmations)
+	return resp, nil
 }
 
 func (b *btcBackend) pathConfigDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -268,6 +789,15 @@ func (b *btcBackend) pathConfigDelete(ctx context.Context, req *logical.Request,
 	return nil, nil
 }
 
+// redactProxyURL hides the password in a socks5:// proxy URL
+func redactProxyURL(proxyURL string) string {
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.User == nil {
+		return proxyURL
+	}
+	return u.Redacted()
+}
+
 // getConfig retrieves the configuration from storage
 func getConfig(ctx context.Context, s logical.Storage) (*btcConfig, error) {
 	entry, err := s.Get(ctx, configStoragePath)
@@ -287,18 +817,15 @@ func getConfig(ctx context.Context, s logical.Storage) (*btcConfig, error) {
 	return config, nil
 }
 
-// getNetwork retrieves the network from config, defaulting to mainnet
+// getNetwork retrieves the network from config, defaulting to mainnet.
+// For a custom signet this is the name registered for its parameters.
 func getNetwork(ctx context.Context, s logical.Storage) (string, error) {
 	config, err := getConfig(ctx, s)
 	if err != nil {
 		return "", err
 	}
 
-	if config == nil || config.Network == "" {
-		return "mainnet", nil
-	}
-
-	return config.Network, nil
+	return config.networkID()
 }
 
 // getMinConfirmations retrieves the min_confirmations from config, defaulting to 1
@@ -325,13 +852,89 @@ Configure the Bitcoin secrets engine.
 `
 
 const pathConfigHelpDescription = `
-This endpoint configures the Bitcoin secrets engine with network, Electrum
-server, and confirmation requirements.
+This endpoint configures the Bitcoin secrets engine with network, chain
+backend, and confirmation requirements.
 
 Parameters:
-  - network: mainnet, testnet4, or signet (default: mainnet)
+  - network: mainnet, testnet4, signet, or regtest (default: mainnet)
+  - signet_challenge: Challenge script (hex) of a custom signet
+  - signet_hrp: Bech32 address prefix of a custom signet (default: tb)
+  - signet_magic: Network magic of a custom signet (default: from challenge)
   - electrum_url: Electrum server URL (optional - uses random server from pool if not set)
+  - electrum_urls: Electrum server per network for wallets on other networks
   - min_confirmations: Minimum confirmations to spend UTXOs (default: 1)
+  - connect_timeout: Electrum connection timeout (default: 10s)
+  - request_timeout: Per-request Electrum timeout (default: 15s)
+  - tls_ca_pem: PEM CA bundle to trust for ssl:// servers (private CA)
+  - tls_cert_fingerprint_sha256: Pin the server certificate by SHA-256
+    fingerprint (also checked against tls_ca_pem when both are set)
+  - tls_skip_verify: Disable certificate checks (test networks only)
+  - socks5_proxy: Route Electrum traffic through a SOCKS5 proxy such as Tor
+  - backend: electrum (default), bitcoind, or esplora
+  - bitcoind_url, bitcoind_user, bitcoind_password: Bitcoin Core RPC access
+  - bitcoind_wallet: Descriptor watch-only wallet for address tracking
+  - esplora_url: Esplora REST API base URL (default: mempool.space for
+    mainnet and testnet4)
+  - persist_cache: Keep wallet cache snapshots in storage (default: false)
+  - deleted_wallet_retention: How long deleted wallets can be undeleted
+    (default: 720h, 0 = delete immediately)
+  - anti_fee_sniping: Lock wallet-built transactions to the current block
+    height, like Bitcoin Core (default: true)
+
+Timeouts:
+  Every Electrum call also honors the deadline of the Vault request that made
+  it. A cancelled Vault request abandons its pending calls without dropping
+  the shared connection. Only request_timeout expiring marks the connection
+  dead and forces a reconnect.
+
+Chain Backends:
+  electrum talks to an Electrum server (the default). bitcoind talks to a
+  Bitcoin Core node over JSON-RPC instead. With bitcoind_wallet set, new
+  addresses are imported into that descriptor watch-only wallet on first use
+  without a rescan, as they have no history yet. Addresses that may have
+  history are imported with a rescan from their wallet's creation: all
+  stored addresses when the bitcoind wallet is configured or changed (or
+  bitcoind_rescan=true is given), restored wallets, and the gap addresses of
+  a wallet scan. A rescan blocks the request until bitcoind finishes it; if
+  the request times out, bitcoind completes the rescan in the background.
+  Without a wallet, scantxoutset is used: no setup is needed but only
+  confirmed outputs are visible, so mempool payments are missing and outputs
+  spent by unconfirmed transactions still look unspent. Every lookup scans
+  the whole UTXO set, so it suits small wallets and test networks. getrawtransaction needs -txindex for
+  transactions outside the watch-only wallet. esplora uses the HTTPS REST
+  API served by mempool.space and blockstream.info, for environments that
+  cannot reach Electrum TCP ports. Public instances rate-limit, so large
+  wallets are better served by a self-hosted instance. socks5_proxy also
+  applies to esplora.
+
+Persistent Cache:
+  Balances, UTXOs and history are cached in memory per address and
+  revalidated against the chain backend's status hash on every read. With
+  persist_cache=true the cache is also written to storage (under cache/,
+  which is not seal-wrapped and not replicated), so the first read after a
+  plugin restart or standby promotion only needs one status check per
+  address instead of a full history fetch. Restored entries are used only
+  while their status hash still matches and for at most 24 hours. Turning
+  persist_cache off deletes the stored snapshots.
+
+Wallet Networks:
+  network is the default for new wallets. Each wallet records the network it
+  was created on (vault write btc/wallets/:name network=...), and keeps using
+  it when the mount network changes: wallets created before wallets recorded
+  their network are pinned to the previous network on such a change. Wallets
+  on the mount network use the configured backend. Wallets on any other
+  network use Electrum, through the server given in electrum_urls or the
+  network's default pool. A custom signet is only defined by this config, so
+  the network cannot be changed away from it while wallets use it.
+
+Custom Signet:
+  Without signet_challenge, network=signet is the public signet. With it, the
+  challenge script defines a private signet (BIP325) whose network magic is
+  derived from the challenge unless signet_magic overrides it. signet_hrp
+  changes the bech32 prefix of generated and accepted addresses. All signets
+  share the same genesis block, so it is not configurable. The signet is
+  reported as network_id (signet-<magic>[-<hrp>]). Set these before creating
+  wallets: changing them later does not re-encode stored addresses.
 
 Server Selection:
   If electrum_url is not specified, a random server from the default pool is
@@ -351,10 +954,52 @@ Example (custom signet - requires explicit server):
       network=signet \
       electrum_url="ssl://your-signet-electrum:50002"
 
+Example (private signet with its own challenge and address prefix):
+  $ vault write btc/config \
+      network=signet \
+      signet_challenge="5121...51ae" \
+      signet_hrp=sb \
+      electrum_url="tcp://signet.internal:60601"
+
+Example (local regtest node with electrs):
+  $ vault write btc/config \
+      network=regtest \
+      electrum_url="tcp://127.0.0.1:60401"
+
+Example (mainnet default with testnet4 wallets on a private server):
+  $ vault write btc/config \
+      network=mainnet \
+      electrum_urls="testnet4=ssl://electrum.internal:50002"
+  $ vault write btc/wallets/qa network=testnet4
+
+Example (Tor onion server with a pinned self-signed certificate):
+  $ vault write btc/config \
+      network=mainnet \
+      electrum_url="ssl://abcdef...xyz.onion:50002" \
+      tls_cert_fingerprint_sha256="9f86d081884c7d65..." \
+      socks5_proxy="127.0.0.1:9050"
+
+Example (own Bitcoin Core node with a watch-only wallet):
+  $ bitcoin-cli createwallet vault true true "" false true
+  $ vault write btc/config \
+      network=mainnet \
+      backend=bitcoind \
+      bitcoind_url="http://127.0.0.1:8332" \
+      bitcoind_user=vault \
+      bitcoind_password=... \
+      bitcoind_wallet=vault
+
+Example (Esplora REST API):
+  $ vault write btc/config \
+      network=mainnet \
+      backend=esplora \
+      esplora_url="https://blockstream.info/api"
+
 Default server pools:
   - mainnet:  electrum.blockstream.info, electrum.bitaroo.net, electrum.emzy.de
   - testnet4: mempool.space, electrum.blockstream.info
   - signet:   (no default pool - requires explicit electrum_url)
+  - regtest:  (no default pool - requires explicit electrum_url)
 
 To see which servers are in the pool:
   $ vault read btc/config
@@ -0,0 +1,361 @@
+package btc
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathConfigSeedEncryption(b *btcBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "config/seed-encryption",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"enabled": {
+					Type:        framework.TypeBool,
+					Description: "Encrypt wallet seeds with a per-mount data key. Enabling seals every existing wallet; disabling stores them in plaintext again.",
+				},
+				"transit_address": {
+					Type:        framework.TypeString,
+					Description: "Address of the Vault server holding the Transit key, e.g. https://vault.internal:8200",
+				},
+				"transit_token": {
+					Type:        framework.TypeString,
+					Description: "Token allowed to encrypt and decrypt with the Transit key. Use a periodic token.",
+					DisplayAttrs: &framework.DisplayAttributes{
+						Sensitive: true,
+					},
+				},
+				"transit_namespace": {
+					Type:        framework.TypeString,
+					Description: "Vault namespace of the Transit mount (Vault Enterprise)",
+				},
+				"transit_mount": {
+					Type:        framework.TypeString,
+					Description: "Path of the Transit secrets engine (default: transit)",
+				},
+				"transit_key": {
+					Type:        framework.TypeString,
+					Description: "Transit key that wraps the data key. If not set, the data key is kept only in the plugin's seal-wrapped storage.",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathSeedEncryptionRead,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "seed-encryption-config",
+					},
+				},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathSeedEncryptionWrite,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "seed-encryption-config",
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathSeedEncryptionWrite,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "seed-encryption-config",
+					},
+				},
+			},
+			ExistenceCheck:  b.pathSeedEncryptionExistenceCheck,
+			HelpSynopsis:    pathSeedEncryptionHelpSynopsis,
+			HelpDescription: pathSeedEncryptionHelpDescription,
+		},
+		{
+			Pattern: "config/seed-encryption/rotate",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathSeedEncryptionRotate,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "rotate-seed-key",
+					},
+				},
+			},
+			HelpSynopsis:    pathSeedEncryptionRotateHelpSynopsis,
+			HelpDescription: pathSeedEncryptionRotateHelpDescription,
+		},
+	}
+}
+
+func (b *btcBackend) pathSeedEncryptionExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
+	config, err := getSeedEncryptionConfig(ctx, req.Storage)
+	if err != nil {
+		return false, err
+	}
+	return config != nil, nil
+}
+
+func (b *btcBackend) pathSeedEncryptionRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getSeedEncryptionConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	keyring, err := getSeedKeyring(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Transit token is never returned
+	respData := map[string]interface{}{
+		"enabled": config.Enabled,
+	}
+	if config.TransitKey != "" {
+		respData["transit_address"] = config.TransitAddress
+		respData["transit_mount"] = config.TransitMount
+		respData["transit_key"] = config.TransitKey
+		if config.TransitNamespace != "" {
+			respData["transit_namespace"] = config.TransitNamespace
+		}
+	}
+	if current := keyring.current(); current != nil {
+		respData["key_version"] = current.Version
+		respData["key_created_at"] = current.CreatedAt.Format(time.RFC3339)
+	}
+
+	return &logical.Response{Data: respData}, nil
+}
+
+func (b *btcBackend) pathSeedEncryptionWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	previous, err := getSeedEncryptionConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &seedEncryptionConfig{TransitMount: defaultTransitMount}
+	if previous != nil {
+		*config = *previous
+	}
+
+	if enabled, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabled.(bool)
+	}
+	if address, ok := data.GetOk("transit_address"); ok {
+		config.TransitAddress = address.(string)
+	}
+	if token, ok := data.GetOk("transit_token"); ok {
+		config.TransitToken = token.(string)
+	}
+	if namespace, ok := data.GetOk("transit_namespace"); ok {
+		config.TransitNamespace = namespace.(string)
+	}
+	if mount, ok := data.GetOk("transit_mount"); ok {
+		config.TransitMount = strings.Trim(mount.(string), "/")
+		if config.TransitMount == "" {
+			config.TransitMount = defaultTransitMount
+		}
+	}
+	if key, ok := data.GetOk("transit_key"); ok {
+		config.TransitKey = key.(string)
+	}
+
+	// Validate Transit settings
+	if config.TransitKey != "" {
+		u, err := url.Parse(config.TransitAddress)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return logical.ErrorResponse("transit_address must be an http:// or https:// URL when transit_key is set"), nil
+		}
+		if config.TransitToken == "" {
+			return logical.ErrorResponse("transit_token is required when transit_key is set"), nil
+		}
+		if strings.Contains(config.TransitKey, "/") {
+			return logical.ErrorResponse("transit_key must be a key name, not a path"), nil
+		}
+	}
+
+	keyring, err := getSeedKeyring(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated int
+	if config.Enabled {
+		switch {
+		case keyring.current() == nil:
+			b.Logger().Info("creating seed data key", "transit_key", config.TransitKey)
+			dataKey, _, err := newSeedDataKey(ctx, config, 1)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create seed data key: %w", err)
+			}
+			keyring = &seedKeyring{}
+			keyring.add(dataKey)
+		case previous.kekID() != config.kekID():
+			b.Logger().Info("rewrapping seed data keys", "from", previous.TransitKey, "to", config.TransitKey)
+			if err := keyring.rewrap(ctx, previous, config); err != nil {
+				return nil, fmt.Errorf("failed to rewrap seed data keys: %w", err)
+			}
+		}
+		if err := saveSeedKeyring(ctx, req.Storage, keyring); err != nil {
+			return nil, err
+		}
+
+		// Save the config before sealing so wallets created meanwhile are sealed too
+		if err := saveSeedEncryptionConfig(ctx, req.Storage, config); err != nil {
+			return nil, err
+		}
+
+		if updated, err = b.resealWallets(ctx, req.Storage, config, keyring); err != nil {
+			return nil, fmt.Errorf("failed to seal wallet seeds after %d wallet(s): %w", updated, err)
+		}
+	} else {
+		if keyring != nil {
+			from := previous
+			if from == nil {
+				from = config
+			}
+			if updated, err = b.unsealWallets(ctx, req.Storage, from, keyring); err != nil {
+				return nil, fmt.Errorf("failed to unseal wallet seeds after %d wallet(s): %w", updated, err)
+			}
+			if err := req.Storage.Delete(ctx, seedKeyringStoragePath); err != nil {
+				return nil, fmt.Errorf("error deleting seed keyring: %w", err)
+			}
+		}
+		if err := saveSeedEncryptionConfig(ctx, req.Storage, config); err != nil {
+			return nil, err
+		}
+	}
+
+	b.Logger().Info("seed encryption config saved", "enabled", config.Enabled, "transit_key", config.TransitKey, "wallets_updated", updated)
+
+	respData := map[string]interface{}{
+		"enabled":         config.Enabled,
+		"wallets_updated": updated,
+	}
+	if current := keyring.current(); config.Enabled && current != nil {
+		respData["key_version"] = current.Version
+	}
+	return &logical.Response{Data: respData}, nil
+}
+
+func (b *btcBackend) pathSeedEncryptionRotate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getSeedEncryptionConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || !config.Enabled {
+		return logical.ErrorResponse("seed encryption is not enabled"), nil
+	}
+
+	keyring, err := getSeedKeyring(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	current := keyring.current()
+	if current == nil {
+		return nil, fmt.Errorf("seed encryption is enabled but no data key exists")
+	}
+
+	// Older versions are rewrapped with the latest Transit key version too,
+	// so the Transit key's min_decryption_version can be raised afterwards
+	if err := keyring.rewrap(ctx, config, config); err != nil {
+		return nil, fmt.Errorf("failed to rewrap seed data keys: %w", err)
+	}
+
+	dataKey, _, err := newSeedDataKey(ctx, config, current.Version+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create seed data key: %w", err)
+	}
+	keyring.add(dataKey)
+	if err := saveSeedKeyring(ctx, req.Storage, keyring); err != nil {
+		return nil, err
+	}
+
+	updated, err := b.resealWallets(ctx, req.Storage, config, keyring)
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-encrypt wallet seeds after %d wallet(s): %w", updated, err)
+	}
+
+	b.Logger().Info("seed data key rotated", "version", dataKey.Version, "wallets_reencrypted", updated)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"key_version":         dataKey.Version,
+			"wallets_reencrypted": updated,
+		},
+	}, nil
+}
+
+// saveSeedEncryptionConfig saves the seed encryption config
+func saveSeedEncryptionConfig(ctx context.Context, s logical.Storage, config *seedEncryptionConfig) error {
+	entry, err := logical.StorageEntryJSON(seedEncryptionStoragePath, config)
+	if err != nil {
+		return fmt.Errorf("error creating storage entry: %w", err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return fmt.Errorf("error saving seed encryption config: %w", err)
+	}
+	return nil
+}
+
+const pathSeedEncryptionHelpSynopsis = `
+Configure envelope encryption of wallet seeds.
+`
+
+const pathSeedEncryptionHelpDescription = `
+With seed encryption enabled, every wallet seed is encrypted (AES-256-GCM)
+with a per-mount data key before it is written to storage. With transit_key
+set, the data key itself is encrypted by a Vault Transit key and only its
+ciphertext is stored, so reading the plugin's storage is not enough to
+recover a seed: the Transit key has to be reachable as well.
+
+Addresses are derived from account public keys cached on each wallet, so
+the seed is only decrypted to sign (send, consolidate, scan sweeps, PSBT
+signing) and when a new account is created.
+
+Enabling seals every existing wallet in place, and disabling stores every
+seed in plaintext again. Changing transit_key (or its mount or namespace)
+rewraps the data keys with the new key; the old key must still be usable
+during that write.
+
+Parameters:
+  - enabled: Encrypt wallet seeds (default: false)
+  - transit_address: Vault server holding the Transit key
+  - transit_token: Token with update on <transit_mount>/encrypt/<key> and
+    <transit_mount>/decrypt/<key>; use a periodic token
+  - transit_namespace: Namespace of the Transit mount
+  - transit_mount: Transit mount path (default: transit)
+  - transit_key: Transit key name (optional)
+
+Example (data key kept in the plugin's seal-wrapped storage):
+  $ vault write btc/config/seed-encryption enabled=true
+
+Example (data key wrapped by a Transit key):
+  $ vault secrets enable transit
+  $ vault write -f transit/keys/btc-seeds
+  $ vault write btc/config/seed-encryption \
+      enabled=true \
+      transit_address="https://vault.internal:8200" \
+      transit_token="hvs...." \
+      transit_key=btc-seeds
+`
+
+const pathSeedEncryptionRotateHelpSynopsis = `
+Rotate the seed data key and re-encrypt every wallet.
+`
+
+const pathSeedEncryptionRotateHelpDescription = `
+Generates a new data key, wraps it with the latest version of the Transit
+key (if configured), and re-encrypts every wallet seed with it in place.
+Older data key versions are rewrapped as well and kept, so wallets written
+concurrently with the rotation stay readable. Rotate the Transit key first
+to move the data keys to a new Transit key version:
+
+  $ vault write -f transit/keys/btc-seeds/rotate
+  $ vault write -f btc/config/seed-encryption/rotate
+`
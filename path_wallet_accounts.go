@@ -0,0 +1,308 @@
+package btc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/djschnei21/vault-plugin-btc/wallet"
+)
+
+// accountPathRegex optionally scopes a wallet path to a BIP44 account, e.g.
+// wallets/treasury/accounts/2/send. Without it, requests act on account 0.
+const accountPathRegex = `(/accounts/(?P<account>\d+))?`
+
+// accountField is the schema of the account path parameter
+func accountField() *framework.FieldSchema {
+	return &framework.FieldSchema{
+		Type:        framework.TypeInt,
+		Description: "BIP44 account index within the wallet (default: 0)",
+	}
+}
+
+// requestAccount returns the account index addressed by the request
+func requestAccount(data *framework.FieldData) (uint32, error) {
+	raw, ok := data.GetOk("account")
+	if !ok {
+		return 0, nil
+	}
+
+	account := raw.(int)
+	if account < 0 || account > wallet.MaxAccount {
+		return 0, fmt.Errorf("account must be between 0 and %d", wallet.MaxAccount)
+	}
+	return uint32(account), nil
+}
+
+// walletAccountPath returns the API path of a wallet account for use in messages
+func walletAccountPath(name string, account uint32) string {
+	if account == 0 {
+		return "btc/wallets/" + name
+	}
+	return fmt.Sprintf("btc/wallets/%s/accounts/%d", name, account)
+}
+
+// getWalletAccount resolves the account addressed by the request. A non-nil
+// response is a user-facing error that should be returned as-is.
+func getWalletAccount(w *btcWallet, data *framework.FieldData) (uint32, *btcAccount, *logical.Response) {
+	account, err := requestAccount(data)
+	if err != nil {
+		return 0, nil, logical.ErrorResponse(err.Error())
+	}
+
+	acct := w.account(account)
+	if acct == nil {
+		return 0, nil, logical.ErrorResponse("account %d not found in wallet %q - create it with: vault write %s", account, w.Name, walletAccountPath(w.Name, account))
+	}
+	return account, acct, nil
+}
+
+func pathWalletAccounts(b *btcBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + "/accounts/?$",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+				OperationSuffix: "accounts",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the wallet",
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathWalletAccountsList,
+				},
+			},
+			HelpSynopsis:    pathWalletAccountsListHelpSynopsis,
+			HelpDescription: pathWalletAccountsListHelpDescription,
+		},
+		{
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + `/accounts/(?P<account>\d+)`,
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the wallet",
+					Required:    true,
+				},
+				"account": {
+					Type:        framework.TypeInt,
+					Description: "BIP44 account index within the wallet",
+					Required:    true,
+				},
+				"description": {
+					Type:        framework.TypeString,
+					Description: "Optional description for this account",
+				},
+				"address_type": {
+					Type:        framework.TypeString,
+					Description: "On read, the type of the returned receive address: p2tr, p2wpkh, p2sh-p2wpkh or p2pkh (default: wallet address_type)",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathWalletsRead,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "account",
+					},
+				},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathWalletAccountWrite,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "account",
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathWalletAccountWrite,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "account",
+					},
+				},
+			},
+			ExistenceCheck:  b.pathWalletAccountExistenceCheck,
+			HelpSynopsis:    pathWalletAccountHelpSynopsis,
+			HelpDescription: pathWalletAccountHelpDescription,
+		},
+	}
+}
+
+func (b *btcBackend) pathWalletAccountsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	w, err := getWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return logical.ErrorResponse("wallet %q not found", name), nil
+	}
+
+	indices := w.accountIndices()
+	keys := make([]string, 0, len(indices))
+	keyInfo := make(map[string]interface{}, len(indices))
+	for _, index := range indices {
+		acct := w.account(index)
+		key := fmt.Sprintf("%d", index)
+		keys = append(keys, key)
+
+		info := map[string]interface{}{
+			"next_address_index": acct.NextAddressIndex,
+			"created_at":         acct.CreatedAt.Format(time.RFC3339),
+		}
+		if acct.Description != "" {
+			info["description"] = acct.Description
+		}
+		keyInfo[key] = info
+	}
+
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
+}
+
+func (b *btcBackend) pathWalletAccountExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
+	name := data.Get("name").(string)
+	w, err := getWallet(ctx, req.Storage, name)
+	if err != nil {
+		return false, err
+	}
+	if w == nil {
+		return false, nil
+	}
+
+	account, err := requestAccount(data)
+	if err != nil {
+		return false, nil
+	}
+	return w.account(account) != nil, nil
+}
+
+func (b *btcBackend) pathWalletAccountWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	w, err := getWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return logical.ErrorResponse("wallet %q not found", name), nil
+	}
+
+	account, err := requestAccount(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
+	acct := w.account(account)
+	created := acct == nil
+	var initialAddresses []string
+	if created {
+		b.Logger().Info("creating wallet account", "wallet", name, "account", account)
+		acct = &btcAccount{CreatedAt: time.Now().UTC()}
+		w.Accounts[account] = acct
+
+		if err := addWalletAccountKeys(ctx, req.Storage, w, network, account); err != nil {
+			return nil, err
+		}
+		if err := setSilentPaymentKeys(ctx, req.Storage, w, network); err != nil {
+			return nil, err
+		}
+		if initialAddresses, err = generateInitialAddresses(ctx, req.Storage, w, network, account); err != nil {
+			return nil, err
+		}
+	}
+
+	if description, ok := data.GetOk("description"); ok {
+		acct.Description = description.(string)
+	}
+
+	if err := saveWallet(ctx, req.Storage, w); err != nil {
+		return nil, err
+	}
+	b.registerAddresses(ctx, req.Storage, w, network, initialAddresses...)
+
+	xpub, derivationPath, err := walletAccountXpub(ctx, req.Storage, w, network, account, w.AddressType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive xpub: %w", err)
+	}
+
+	addresses, err := getStoredAddresses(ctx, req.Storage, name, account)
+	if err != nil {
+		return nil, err
+	}
+
+	respData := map[string]interface{}{
+		"name":            w.Name,
+		"account":         account,
+		"network":         network,
+		"address_type":    w.AddressType,
+		"derivation_path": derivationPath,
+		"xpub":            xpub,
+		"address_count":   len(addresses),
+		"created_at":      acct.CreatedAt.Format(time.RFC3339),
+	}
+	if created && len(addresses) > 0 {
+		respData["receive_address"] = addresses[0].Address
+		respData["receive_index"] = addresses[0].Index
+	}
+	if acct.Description != "" {
+		respData["description"] = acct.Description
+	}
+
+	return &logical.Response{Data: respData}, nil
+}
+
+const pathWalletAccountsListHelpSynopsis = `
+List the accounts of a wallet.
+`
+
+const pathWalletAccountsListHelpDescription = `
+Lists the BIP44 accounts that have been created in a wallet. Account 0 always
+exists and is the account used by the top-level wallet endpoints.
+
+Example:
+  $ vault list btc/wallets/my-wallet/accounts
+`
+
+const pathWalletAccountHelpSynopsis = `
+Manage a BIP44 account within a wallet.
+`
+
+const pathWalletAccountHelpDescription = `
+Each wallet can hold multiple BIP44 accounts derived from the same seed
+(m/purpose'/coin'/account'). Accounts have their own address counters,
+balances, xpub and spending scope, so funds can be segregated without
+creating additional wallets.
+
+To create an account (generates its first 5 receive addresses):
+  $ vault write btc/wallets/my-wallet/accounts/1 description="Payroll"
+
+To view the account balance and receive address:
+  $ vault read btc/wallets/my-wallet/accounts/1
+
+Account-scoped endpoints:
+  btc/wallets/my-wallet/accounts/1/addresses
+  btc/wallets/my-wallet/accounts/1/utxos
+  btc/wallets/my-wallet/accounts/1/qr
+  btc/wallets/my-wallet/accounts/1/xpub
+  btc/wallets/my-wallet/accounts/1/send
+  btc/wallets/my-wallet/accounts/1/consolidate
+  btc/wallets/my-wallet/accounts/1/compact
+  btc/wallets/my-wallet/accounts/1/scan
+
+Sends and consolidations only spend UTXOs of the addressed account, and
+change returns to that account. The un-prefixed wallet endpoints operate on
+account 0.
+`
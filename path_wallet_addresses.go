@@ -7,14 +7,12 @@ import (
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
-
-	"github.com/djschnei21/vault-plugin-btc/wallet"
 )
 
 func pathWalletAddresses(b *btcBackend) []*framework.Path {
 	return []*framework.Path{
 		{
-			Pattern: "wallets/" + framework.GenericNameRegex("name") + "/addresses",
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + accountPathRegex + "/addresses",
 			DisplayAttrs: &framework.DisplayAttributes{
 				OperationPrefix: "btc",
 			},
@@ -24,11 +22,16 @@ func pathWalletAddresses(b *btcBackend) []*framework.Path {
 					Description: "Name of the wallet",
 					Required:    true,
 				},
+				"account": accountField(),
 				"count": {
 					Type:        framework.TypeInt,
 					Description: "Number of unused addresses to generate (default: 1)",
 					Default:     1,
 				},
+				"address_type": {
+					Type:        framework.TypeString,
+					Description: "Type of addresses to generate: p2tr, p2wpkh, p2sh-p2wpkh or p2pkh (default: wallet address_type)",
+				},
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ReadOperation: &framework.PathOperation{
@@ -62,6 +65,7 @@ type AddressInfo struct {
 	Address        string `json:"address"`
 	Index          uint32 `json:"index"`
 	DerivationPath string `json:"derivation_path"`
+	AddressType    string `json:"address_type"`
 	Confirmed      int64  `json:"confirmed"`
 	Unconfirmed    int64  `json:"unconfirmed"`
 	Total          int64  `json:"total"`
@@ -83,27 +87,42 @@ func (b *btcBackend) pathWalletAddressesRead(ctx context.Context, req *logical.R
 		return logical.ErrorResponse("wallet %q not found", name), nil
 	}
 
-	client, err := b.getClient(ctx, req.Storage)
+	account, _, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Electrum server: %w", err)
+		return nil, err
+	}
+
+	client, err := b.getClient(ctx, req.Storage, network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to chain backend: %w", err)
 	}
 
 	// Get stored addresses
-	addresses, err := getStoredAddresses(ctx, req.Storage, name)
+	addresses, err := getStoredAddresses(ctx, req.Storage, name, account)
 	if err != nil {
 		return nil, err
 	}
 
-	walletCache := b.cache.GetWalletCache(name)
+	walletCache := b.getWalletCache(ctx, req.Storage, name)
 	var addressInfos []AddressInfo
 
 	for _, addr := range addresses {
+		// Stop early if the Vault request was cancelled
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		var balance BalanceInfo
 		var history []TxHistoryItem
 		var utxos []CachedUTXO
 
-		// Get current status hash from Electrum (lightweight call)
-		currentStatus, subscribeErr := client.Subscribe(addr.ScriptHash)
+		// Get current status hash from the chain backend (lightweight call)
+		currentStatus, subscribeErr := client.AddressStatus(ctx, addr.Address)
 		subscribeSucceeded := subscribeErr == nil
 		if subscribeErr != nil {
 			b.Logger().Warn("failed to get status", "address", addr.Address, "error", subscribeErr)
@@ -121,11 +140,11 @@ func (b *btcBackend) pathWalletAddressesRead(ctx context.Context, req *logical.R
 			balance = cached.Balance
 			history = cached.History
 		} else {
-			// Cache miss or stale - fetch from Electrum
-			b.Logger().Debug("cache miss, fetching from Electrum", "address", addr.Address)
+			// Cache miss or stale - fetch from the chain backend
+			b.Logger().Debug("cache miss, fetching from chain backend", "address", addr.Address)
 
 			// Get balance
-			balanceResp, err := client.GetBalance(addr.ScriptHash)
+			balanceResp, err := client.GetBalance(ctx, addr.Address)
 			if err != nil {
 				b.Logger().Warn("failed to get balance", "address", addr.Address, "error", err)
 				balance = BalanceInfo{}
@@ -137,7 +156,7 @@ func (b *btcBackend) pathWalletAddressesRead(ctx context.Context, req *logical.R
 			}
 
 			// Get history
-			historyResp, err := client.GetHistory(addr.ScriptHash)
+			historyResp, err := client.GetHistory(ctx, addr.Address)
 			if err != nil {
 				b.Logger().Warn("failed to get history", "address", addr.Address, "error", err)
 				history = []TxHistoryItem{}
@@ -152,7 +171,7 @@ func (b *btcBackend) pathWalletAddressesRead(ctx context.Context, req *logical.R
 			}
 
 			// Get UTXOs for cache
-			utxoResp, err := client.ListUnspent(addr.ScriptHash)
+			utxoResp, err := client.ListUnspent(ctx, addr.Address)
 			if err != nil {
 				b.Logger().Warn("failed to get UTXOs", "address", addr.Address, "error", err)
 				utxos = []CachedUTXO{}
@@ -178,6 +197,7 @@ func (b *btcBackend) pathWalletAddressesRead(ctx context.Context, req *logical.R
 			Address:        addr.Address,
 			Index:          addr.Index,
 			DerivationPath: addr.DerivationPath,
+			AddressType:    addr.AddressType,
 			Confirmed:      balance.Confirmed,
 			Unconfirmed:    balance.Unconfirmed,
 			Total:          balance.Confirmed + balance.Unconfirmed,
@@ -188,6 +208,8 @@ func (b *btcBackend) pathWalletAddressesRead(ctx context.Context, req *logical.R
 		addressInfos = append(addressInfos, info)
 	}
 
+	b.saveWalletCache(ctx, req.Storage, name, walletCache)
+
 	// Sort by index
 	sort.Slice(addressInfos, func(i, j int) bool {
 		return addressInfos[i].Index < addressInfos[j].Index
@@ -213,6 +235,7 @@ func (b *btcBackend) pathWalletAddressesRead(ctx context.Context, req *logical.R
 			"address":         info.Address,
 			"index":           info.Index,
 			"derivation_path": info.DerivationPath,
+			"address_type":    info.AddressType,
 			"confirmed":       info.Confirmed,
 			"unconfirmed":     info.Unconfirmed,
 			"total":           info.Total,
@@ -226,6 +249,7 @@ func (b *btcBackend) pathWalletAddressesRead(ctx context.Context, req *logical.R
 
 	return &logical.Response{
 		Data: map[string]interface{}{
+			"account":           account,
 			"addresses":         addressList,
 			"address_count":     len(addressInfos),
 			"used_count":        usedCount,
@@ -264,24 +288,34 @@ func (b *btcBackend) pathWalletAddressesWrite(ctx context.Context, req *logical.
 		return logical.ErrorResponse("wallet %q not found", name), nil
 	}
 
-	network, err := getNetwork(ctx, req.Storage)
+	account, acct, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	addressType, err := requestAddressType(w, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get Electrum client for checking address usage
-	client, err := b.getClient(ctx, req.Storage)
+	// Get chain backend for checking address usage
+	client, err := b.getClient(ctx, req.Storage, network)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Electrum server: %w", err)
+		return nil, fmt.Errorf("failed to connect to chain backend: %w", err)
 	}
 
 	// Get existing addresses
-	addresses, err := getStoredAddresses(ctx, req.Storage, name)
+	addresses, err := getStoredAddresses(ctx, req.Storage, name, account)
 	if err != nil {
 		return nil, err
 	}
 
-	walletCache := b.cache.GetWalletCache(name)
+	walletCache := b.getWalletCache(ctx, req.Storage, name)
 	var unusedAddresses []map[string]interface{}
 
 	// First, find unused addresses among existing ones
@@ -290,14 +324,14 @@ func (b *btcBackend) pathWalletAddressesWrite(ctx context.Context, req *logical.
 			break
 		}
 
-		// Skip spent addresses
-		if addr.Spent {
+		// Skip spent addresses, change addresses, and addresses of another type
+		if addr.Spent || addr.Change || addr.AddressType != addressType {
 			continue
 		}
 
 		// Check if address has history
 		var historyCount int
-		currentStatus, err := client.Subscribe(addr.ScriptHash)
+		currentStatus, err := client.AddressStatus(ctx, addr.Address)
 		if err != nil {
 			b.Logger().Warn("failed to get status", "address", addr.Address, "error", err)
 		}
@@ -306,7 +340,7 @@ func (b *btcBackend) pathWalletAddressesWrite(ctx context.Context, req *logical.
 		if cached != nil {
 			historyCount = len(cached.History)
 		} else {
-			historyResp, err := client.GetHistory(addr.ScriptHash)
+			historyResp, err := client.GetHistory(ctx, addr.Address)
 			if err != nil {
 				b.Logger().Warn("failed to get history", "address", addr.Address, "error", err)
 			} else {
@@ -320,13 +354,15 @@ func (b *btcBackend) pathWalletAddressesWrite(ctx context.Context, req *logical.
 				"address":         addr.Address,
 				"index":           addr.Index,
 				"derivation_path": addr.DerivationPath,
+				"address_type":    addr.AddressType,
 			})
 		}
 	}
 
 	// Generate new addresses if we need more
+	var generated []string
 	for len(unusedAddresses) < count {
-		addrInfo, err := wallet.GenerateAddressInfoForType(w.Seed, network, w.NextAddressIndex, w.AddressType)
+		addrInfo, err := walletAddressInfo(ctx, req.Storage, w, network, account, 0, acct.NextAddressIndex, addressType)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate address: %w", err)
 		}
@@ -335,38 +371,38 @@ func (b *btcBackend) pathWalletAddressesWrite(ctx context.Context, req *logical.
 		stored := &storedAddress{
 			Address:        addrInfo.Address,
 			Index:          addrInfo.Index,
+			Account:        account,
 			DerivationPath: addrInfo.DerivationPath,
 			ScriptHash:     addrInfo.ScriptHash,
+			AddressType:    addrInfo.AddressType,
 		}
 
-		storageKey := fmt.Sprintf("%s%s/%d", addressStoragePrefix, name, w.NextAddressIndex)
-		entry, err := logical.StorageEntryJSON(storageKey, stored)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create storage entry: %w", err)
-		}
-
-		if err := req.Storage.Put(ctx, entry); err != nil {
-			return nil, fmt.Errorf("failed to store address: %w", err)
+		if err := storeAddress(ctx, req.Storage, name, stored); err != nil {
+			return nil, err
 		}
+		generated = append(generated, addrInfo.Address)
 
 		unusedAddresses = append(unusedAddresses, map[string]interface{}{
 			"address":         addrInfo.Address,
 			"index":           addrInfo.Index,
 			"derivation_path": addrInfo.DerivationPath,
+			"address_type":    addrInfo.AddressType,
 		})
 
-		w.NextAddressIndex++
+		acct.NextAddressIndex++
 	}
 
 	// Save wallet with updated index
 	if err := saveWallet(ctx, req.Storage, w); err != nil {
 		return nil, fmt.Errorf("failed to update wallet: %w", err)
 	}
+	b.registerAddresses(ctx, req.Storage, w, network, generated...)
 
 	b.Logger().Debug("addresses generated", "wallet", name, "count", len(unusedAddresses))
 
 	return &logical.Response{
 		Data: map[string]interface{}{
+			"account":   account,
 			"addresses": unusedAddresses,
 			"count":     len(unusedAddresses),
 		},
@@ -385,7 +421,8 @@ wallet's Addresses tab. Each address includes:
 
   - address: The Bitcoin address
   - index: The derivation index
-  - derivation_path: Full BIP84 derivation path
+  - derivation_path: Full BIP84/86 derivation path
+  - address_type: p2tr, p2wpkh, p2sh-p2wpkh or p2pkh
   - confirmed: Confirmed balance in satoshis
   - unconfirmed: Unconfirmed balance in satoshis
   - total: Total balance (confirmed + unconfirmed)
@@ -417,6 +454,15 @@ or have any transaction history are excluded.
 Example - Get 5 unused addresses:
   $ vault write btc/wallets/my-wallet/addresses count=5
 
+Example - Get a SegWit address from a Taproot wallet:
+  $ vault write btc/wallets/my-wallet/addresses address_type=p2wpkh
+
+Indices are shared by both address types, so an index is used by at most one
+type. External wallets tracking a single branch will see gaps.
+
+Example - Get an address for account 1:
+  $ vault write btc/wallets/my-wallet/accounts/1/addresses
+
 Response:
   - addresses: List of unused addresses with their derivation info
   - count: Number of addresses returned
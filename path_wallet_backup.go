@@ -0,0 +1,524 @@
+package btc
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/armor"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/djschnei21/vault-plugin-btc/wallet"
+)
+
+// walletBackupVersion is the format version of the backup plaintext
+const walletBackupVersion = 1
+
+// restoreWalletName is reserved: btc/wallets/restore is the restore endpoint
+const restoreWalletName = "restore"
+
+// walletNameRe matches the names accepted by framework.GenericNameRegex
+var walletNameRe = regexp.MustCompile(`^\w(([\w-.]+)?\w)?$`)
+
+// walletBackup is the plaintext of an encrypted wallet backup. The wallet
+// carries its seed in plaintext, its network, and every account counter
+// and setting; the address records keep spent flags for reuse prevention.
+// Silent payment outputs have no address record and cannot be rediscovered
+// without rescanning, so their records are carried as well. FirstAddress is
+// derived from the seed when the backup is made, so a restore can check the
+// seed even for a wallet without address records.
+type walletBackup struct {
+	Version        int                   `json:"version"`
+	Network        string                `json:"network"`
+	Wallet         *btcWallet            `json:"wallet"`
+	FirstAddress   string                `json:"first_address"`
+	Addresses      []storedAddress       `json:"addresses"`
+	SilentPayments []storedSilentPayment `json:"silent_payments,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+}
+
+func pathWalletBackup(b *btcBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			// Listed before the wallet paths, which would match "restore" as a name
+			Pattern: "wallets/" + restoreWalletName,
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"backup": {
+					Type:        framework.TypeString,
+					Description: "ASCII-armored encrypted backup returned by btc/wallets/:name/backup",
+					Required:    true,
+				},
+				"identity": {
+					Type:        framework.TypeString,
+					Description: "age identity (AGE-SECRET-KEY-1...) or unencrypted OpenSSH private key able to decrypt the backup",
+					Required:    true,
+					DisplayAttrs: &framework.DisplayAttributes{
+						Sensitive: true,
+					},
+				},
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the restored wallet (default: the name in the backup)",
+				},
+				"network": {
+					Type:        framework.TypeString,
+					Description: "Expected network of the backup; the restore fails if the backup is for another network",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathWalletRestore,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "restore-wallet",
+					},
+				},
+			},
+			HelpSynopsis:    pathWalletRestoreHelpSynopsis,
+			HelpDescription: pathWalletRestoreHelpDescription,
+		},
+		{
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + "/backup",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the wallet",
+					Required:    true,
+				},
+				"recipients": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Public keys to encrypt the backup to: age recipients (age1...) or SSH public keys (ssh-ed25519, ssh-rsa). Any one of them can decrypt it.",
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathWalletBackup,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "backup-wallet",
+					},
+				},
+			},
+			HelpSynopsis:    pathWalletBackupHelpSynopsis,
+			HelpDescription: pathWalletBackupHelpDescription,
+		},
+	}
+}
+
+func (b *btcBackend) pathWalletBackup(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	recipients, err := parseBackupRecipients(data.Get("recipients").([]string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	w, err := getWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return logical.ErrorResponse("wallet %q not found", name), nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := walletSeed(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
+	// The backup carries the plaintext seed and no mount-specific sealing
+	backupWallet := *w
+	backupWallet.Seed = seed
+	backupWallet.SealedSeed = ""
+	backupWallet.AccountKeys = nil
+	backupWallet.Network = network
+
+	firstAddress, err := backupFirstAddress(seed, network, w)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &walletBackup{
+		Version:      walletBackupVersion,
+		Network:      network,
+		Wallet:       &backupWallet,
+		FirstAddress: firstAddress,
+		CreatedAt:    time.Now().UTC(),
+	}
+	for _, account := range w.accountIndices() {
+		addresses, err := getStoredAddresses(ctx, req.Storage, name, account)
+		if err != nil {
+			return nil, err
+		}
+		backup.Addresses = append(backup.Addresses, addresses...)
+
+		payments, err := getSilentPayments(ctx, req.Storage, name, account)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range payments {
+			backup.SilentPayments = append(backup.SilentPayments, *p)
+		}
+	}
+
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+	encrypted, err := age.Encrypt(armored, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+	if err := json.NewEncoder(encrypted).Encode(backup); err != nil {
+		return nil, fmt.Errorf("failed to encode backup: %w", err)
+	}
+	if err := encrypted.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+	if err := armored.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode backup: %w", err)
+	}
+
+	b.Logger().Info("wallet backup created", "wallet", name, "recipients", len(recipients), "addresses", len(backup.Addresses), "silent_payments", len(backup.SilentPayments))
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":                 name,
+			"network":              network,
+			"backup":               buf.String(),
+			"first_address":        firstAddress,
+			"accounts":             len(w.Accounts),
+			"address_count":        len(backup.Addresses),
+			"silent_payment_count": len(backup.SilentPayments),
+			"created_at":           backup.CreatedAt.Format(time.RFC3339),
+		},
+	}, nil
+}
+
+func (b *btcBackend) pathWalletRestore(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	identities, err := parseBackupIdentities(data.Get("identity").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	plaintext, err := age.Decrypt(armor.NewReader(strings.NewReader(strings.TrimSpace(data.Get("backup").(string)))), identities...)
+	if err != nil {
+		return logical.ErrorResponse("failed to decrypt backup: %s", err.Error()), nil
+	}
+	var backup walletBackup
+	if err := json.NewDecoder(io.LimitReader(plaintext, 64<<20)).Decode(&backup); err != nil {
+		return logical.ErrorResponse("failed to decode backup: %s", err.Error()), nil
+	}
+	if backup.Version != walletBackupVersion {
+		return logical.ErrorResponse("unsupported backup version %d", backup.Version), nil
+	}
+	if backup.Wallet == nil || len(backup.Wallet.Seed) != wallet.SeedLength {
+		return logical.ErrorResponse("backup does not contain a wallet seed"), nil
+	}
+
+	name := backup.Wallet.Name
+	if requested, ok := data.GetOk("name"); ok && requested.(string) != "" {
+		name = requested.(string)
+	}
+	if !walletNameRe.MatchString(name) || name == restoreWalletName {
+		return logical.ErrorResponse("invalid wallet name %q", name), nil
+	}
+
+	existing, err := getWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return logical.ErrorResponse("wallet %q already exists", name), nil
+	}
+	msg, err := deletedWalletNameError(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if msg != "" {
+		return logical.ErrorResponse(msg), nil
+	}
+
+	// Reading the mount network registers a configured custom signet
+	if _, err := getNetwork(ctx, req.Storage); err != nil {
+		return nil, err
+	}
+	network := backup.Network
+	if expected, ok := data.GetOk("network"); ok && expected.(string) != "" && expected.(string) != network {
+		return logical.ErrorResponse("backup is for network %q, not %q", network, expected.(string)), nil
+	}
+	if !validNetwork(network) && !wallet.IsCustomNetwork(network) {
+		return logical.ErrorResponse("backup is for network %q, which is not configured on this mount", network), nil
+	}
+
+	// The seed must derive the address recorded when the backup was made,
+	// and every address record must derive from it
+	w := backup.Wallet
+	if backup.FirstAddress == "" {
+		return logical.ErrorResponse("backup has no first_address to verify the seed against"), nil
+	}
+	firstAddress, err := backupFirstAddress(w.Seed, network, w)
+	if err != nil {
+		return logical.ErrorResponse("failed to derive an address from the backup seed: %s", err.Error()), nil
+	}
+	if firstAddress != backup.FirstAddress {
+		return logical.ErrorResponse("seed mismatch: the backup seed derives %s as its first address, the backup records %s", firstAddress, backup.FirstAddress), nil
+	}
+	for _, addr := range backup.Addresses {
+		if err := verifyBackupAddress(w.Seed, network, addr); err != nil {
+			return logical.ErrorResponse("address derivation mismatch: %s", err.Error()), nil
+		}
+	}
+	for _, p := range backup.SilentPayments {
+		if err := verifyBackupSilentPayment(w.Seed, network, p); err != nil {
+			return logical.ErrorResponse("silent payment derivation mismatch: %s", err.Error()), nil
+		}
+	}
+
+	b.Logger().Info("restoring wallet", "name", name, "network", network, "addresses", len(backup.Addresses))
+
+	w.Name = name
+	w.Network = network
+	w.SealedSeed = ""
+	w.AccountKeys = nil
+	if err := sealNewWallet(ctx, req.Storage, w, network); err != nil {
+		return nil, fmt.Errorf("failed to seal wallet seed: %w", err)
+	}
+
+	// Stale cache entries of a deleted wallet with the same name must not resurface
+	b.invalidateWalletCache(ctx, req.Storage, name)
+
+	for i := range backup.Addresses {
+		if err := storeAddress(ctx, req.Storage, name, &backup.Addresses[i]); err != nil {
+			return nil, err
+		}
+	}
+	for i := range backup.SilentPayments {
+		if err := storeSilentPayment(ctx, req.Storage, name, &backup.SilentPayments[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// The wallet entry is written last so a partial restore is not visible
+	if err := saveWallet(ctx, req.Storage, w); err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"name":                 name,
+			"network":              network,
+			"address_type":         w.AddressType,
+			"accounts":             len(w.Accounts),
+			"first_address":        firstAddress,
+			"address_count":        len(backup.Addresses),
+			"verified_addresses":   len(backup.Addresses),
+			"silent_payment_count": len(backup.SilentPayments),
+			"backup_created_at":    backup.CreatedAt.Format(time.RFC3339),
+		},
+	}
+
+	// The restored addresses have history that a backend tracking registered
+	// addresses only finds by looking back to the wallet's creation
+	addresses := make([]string, 0, len(backup.Addresses)+len(backup.SilentPayments))
+	for _, addr := range backup.Addresses {
+		addresses = append(addresses, addr.Address)
+	}
+	for _, p := range backup.SilentPayments {
+		addresses = append(addresses, p.Address)
+	}
+	config, err := getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config.backendType() != backendBitcoind {
+		return resp, nil
+	}
+	client, err := b.getClient(ctx, req.Storage, network)
+	if err == nil {
+		err = watchWalletAddresses(ctx, client, w, addresses)
+	}
+	if err != nil {
+		b.Logger().Warn("failed to register restored addresses with the chain backend", "wallet", name, "error", err)
+		resp.AddWarning(fmt.Sprintf("the restored addresses could not be registered with the chain backend (%s); write btc/config with bitcoind_rescan=true to retry", err))
+	}
+	return resp, nil
+}
+
+// verifyBackupAddress checks that a stored address derives from seed
+// backupFirstAddress derives the first receive address of account 0 in the
+// wallet's default address type
+func backupFirstAddress(seed []byte, network string, w *btcWallet) (string, error) {
+	address, err := wallet.GenerateAddressForAccount(seed, network, 0, 0, 0, w.AddressType)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive first address: %w", err)
+	}
+	return address, nil
+}
+
+func verifyBackupAddress(seed []byte, network string, addr storedAddress) error {
+	addressType := addr.AddressType
+	if addressType == "" {
+		addressType = wallet.AddressTypeForDerivationPath(addr.DerivationPath)
+	}
+
+	info, err := wallet.GenerateAddressInfoForAccount(seed, network, addr.Account, addr.chain(), addr.Index, addressType)
+	if err != nil {
+		return fmt.Errorf("%s: %w", addr.Address, err)
+	}
+	if info.Address != addr.Address {
+		return fmt.Errorf("backup lists %s at %s, the seed derives %s", addr.Address, addr.DerivationPath, info.Address)
+	}
+	return nil
+}
+
+// verifyBackupSilentPayment checks that a silent payment output is spendable
+// with the seed: the account's spend key plus the stored tweak must give the
+// output's Taproot key
+func verifyBackupSilentPayment(seed []byte, network string, p storedSilentPayment) error {
+	tweak, err := hex.DecodeString(p.Tweak)
+	if err != nil {
+		return fmt.Errorf("%s: invalid tweak", p.outpoint())
+	}
+	key, err := wallet.SilentPaymentSpendKey(seed, network, p.Account, tweak)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.outpoint(), err)
+	}
+	params, err := wallet.NetworkParams(network)
+	if err != nil {
+		return err
+	}
+	address, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(key.PubKey()), params)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.outpoint(), err)
+	}
+	if address.EncodeAddress() != p.Address {
+		return fmt.Errorf("backup lists %s for %s, the seed derives %s", p.Address, p.outpoint(), address.EncodeAddress())
+	}
+	return nil
+}
+
+// parseBackupRecipients parses age (age1...) and SSH public key recipients
+func parseBackupRecipients(values []string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		var recipient age.Recipient
+		var err error
+		if strings.HasPrefix(value, "ssh-") {
+			recipient, err = agessh.ParseRecipient(value)
+		} else {
+			var parsed []age.Recipient
+			parsed, err = age.ParseRecipients(strings.NewReader(value))
+			if err == nil {
+				recipient = parsed[0]
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %s", value, err.Error())
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("at least one recipient is required")
+	}
+	return recipients, nil
+}
+
+// parseBackupIdentities parses age identities or an OpenSSH private key
+func parseBackupIdentities(value string) ([]age.Identity, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "-----BEGIN") {
+		identity, err := agessh.ParseIdentity([]byte(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH identity: %s", err.Error())
+		}
+		return []age.Identity{identity}, nil
+	}
+
+	identities, err := age.ParseIdentities(strings.NewReader(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %s", err.Error())
+	}
+	return identities, nil
+}
+
+const pathWalletBackupHelpSynopsis = `
+Export an encrypted backup of a wallet.
+`
+
+const pathWalletBackupHelpDescription = `
+Produces an age-encrypted, ASCII-armored bundle holding the wallet seed, its
+settings (description, address type, change policy, network), the counters
+and descriptions of every account, and all stored address records and
+received silent payment outputs including their spent flags. The bundle is encrypted to the given public keys; any one
+of the matching private keys can decrypt it. Vault never sees those private
+keys unless the bundle is restored with btc/wallets/restore.
+
+Recipients are age X25519 (age1...) or post-quantum (age1pq1...) public keys,
+or SSH public keys (ssh-ed25519, ssh-rsa).
+
+A sealed seed is decrypted for the backup; the bundle does not depend on this
+mount's seed encryption, so it can be restored on another Vault cluster.
+
+Example:
+  $ age-keygen -o backup.key
+  $ vault write -field=backup btc/wallets/treasury/backup \
+      recipients="age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p" \
+      > treasury.age
+  $ age -d -i backup.key treasury.age | jq .wallet.name
+`
+
+const pathWalletRestoreHelpSynopsis = `
+Import a wallet from an encrypted backup.
+`
+
+const pathWalletRestoreHelpDescription = `
+Decrypts a bundle created by btc/wallets/:name/backup with the given age
+identity or OpenSSH private key and recreates the wallet, its accounts, its
+address records and its silent payment outputs. The identity is only used
+for this request and is not stored.
+
+Before anything is written the restore checks that:
+  - no wallet with the target name exists
+  - the backup's network is known to this mount (a custom signet must be
+    configured identically in btc/config), and matches network if given
+  - the seed in the backup derives first_address, the first receive address
+    of account 0 recorded when the backup was made (also returned by the
+    backup and restore requests, to compare against a known address)
+  - every address record derives from the seed in the backup
+  - every silent payment output is spendable with the seed in the backup
+
+If seed encryption is enabled, the restored seed is sealed with this mount's
+data key.
+
+Example:
+  $ vault write btc/wallets/restore \
+      backup=@treasury.age \
+      identity=@backup.key \
+      network=mainnet
+`
@@ -0,0 +1,677 @@
+package btc
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/djschnei21/vault-plugin-btc/wallet"
+)
+
+const channelFundingStoragePrefix = "channel_funding/"
+
+// storedChannelFunding stores a Lightning channel funding transaction that
+// is signed but withheld until the peer has signed the commitment
+// transaction. Its inputs are locked until it is finalized or cancelled.
+type storedChannelFunding struct {
+	TxID           string        `json:"txid"`
+	Account        uint32        `json:"account,omitempty"`
+	FundingScript  string        `json:"funding_script"`
+	FundingAddress string        `json:"funding_address"`
+	OutputIndex    int           `json:"output_index"`
+	Amount         int64         `json:"amount"`
+	Fee            int64         `json:"fee"`
+	ChangeAddress  string        `json:"change_address,omitempty"`
+	ChangeAmount   int64         `json:"change_amount,omitempty"`
+	Inputs         []wallet.UTXO `json:"inputs"`
+	PSBT           string        `json:"psbt"`
+	Hex            string        `json:"hex"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+// outpoints returns the txid:vout of every input
+func (f *storedChannelFunding) outpoints() []string {
+	outpoints := make([]string, len(f.Inputs))
+	for i, utxo := range f.Inputs {
+		outpoints[i] = fmt.Sprintf("%s:%d", utxo.TxID, utxo.Vout)
+	}
+	return outpoints
+}
+
+// signedTx decodes the withheld signed transaction
+func (f *storedChannelFunding) signedTx() (*wire.MsgTx, error) {
+	raw, err := hex.DecodeString(f.Hex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel funding transaction: %w", err)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("invalid channel funding transaction: %w", err)
+	}
+	return tx, nil
+}
+
+func pathWalletChannelFunding(b *btcBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + accountPathRegex + "/channel-funding/?$",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the wallet",
+					Required:    true,
+				},
+				"account": accountField(),
+				"funding_script": {
+					Type:        framework.TypeString,
+					Description: "Hex P2WSH or P2TR output script of the channel, from the Lightning node",
+				},
+				"amount": {
+					Type:        framework.TypeInt,
+					Description: "Channel capacity in satoshis",
+				},
+				"fee_rate": feeRateField(),
+				"fee":      feeField(),
+				"min_confirmations": {
+					Type:        framework.TypeInt,
+					Description: "Minimum confirmations for UTXOs (default: from config)",
+					Default:     -1,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathWalletChannelFundingList,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "channel-fundings",
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathWalletChannelFundingCreate,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "channel-funding",
+					},
+				},
+			},
+			HelpSynopsis:    pathWalletChannelFundingHelpSynopsis,
+			HelpDescription: pathWalletChannelFundingHelpDescription,
+		},
+		{
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + accountPathRegex + `/channel-funding/(?P<txid>[0-9a-f]{64})`,
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the wallet",
+					Required:    true,
+				},
+				"account": accountField(),
+				"txid": {
+					Type:        framework.TypeString,
+					Description: "Transaction ID of the channel funding",
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathWalletChannelFundingRead,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "channel-funding",
+					},
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathWalletChannelFundingCancel,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb:   "cancel",
+						OperationSuffix: "channel-funding",
+					},
+				},
+			},
+			HelpSynopsis:    pathWalletChannelFundingTxHelpSynopsis,
+			HelpDescription: pathWalletChannelFundingTxHelpDescription,
+		},
+	}
+}
+
+func (b *btcBackend) pathWalletChannelFundingCreate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	scriptHex := data.Get("funding_script").(string)
+	amount := int64(data.Get("amount").(int))
+	minConfirmations := data.Get("min_confirmations").(int)
+
+	b.Logger().Debug("channel funding request", "wallet", name, "amount", amount, "fee_rate", data.Get("fee_rate"), "fee", data.Get("fee"))
+
+	fundingScript, err := hex.DecodeString(scriptHex)
+	if err != nil || len(fundingScript) == 0 {
+		return logical.ErrorResponse("funding_script must be a hex output script"), nil
+	}
+	switch txscript.GetScriptClass(fundingScript) {
+	case txscript.WitnessV0ScriptHashTy, txscript.WitnessV1TaprootTy:
+	default:
+		return logical.ErrorResponse("funding_script must be a P2WSH or P2TR output script"), nil
+	}
+
+	if amount < wallet.DustLimit {
+		return logical.ErrorResponse("amount must be at least the dust limit of %d sats", wallet.DustLimit), nil
+	}
+
+	fee, err := requestFee(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// Held until the funding record locks the selected inputs, so a send
+	// or another funding cannot select them in between
+	defer b.lockWallet(name)()
+
+	w, err := getWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return logical.ErrorResponse("wallet %q not found", name), nil
+	}
+
+	account, acct, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := wallet.NetworkParams(network)
+	if err != nil {
+		return nil, err
+	}
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(fundingScript, params)
+	if err != nil || len(addrs) != 1 {
+		return logical.ErrorResponse("funding_script must be a P2WSH or P2TR output script"), nil
+	}
+	fundingAddress := addrs[0].EncodeAddress()
+	fundingType, _ := wallet.GetAddressType(fundingAddress, network)
+
+	if minConfirmations < 0 {
+		minConfirmations, err = getMinConfirmations(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	utxoInfos, err := b.getUTXOsForWallet(ctx, req.Storage, name, account, minConfirmations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UTXOs: %w", err)
+	}
+
+	// The Lightning node holds on to the txid before the transaction is
+	// signed, so only inputs whose signatures are all in the witness qualify
+	var utxos []wallet.UTXO
+	for _, info := range utxoInfos {
+		if info.AddressType != wallet.AddressTypeP2WPKH && info.AddressType != wallet.AddressTypeP2TR {
+			continue
+		}
+		scriptPubKey, err := wallet.GetScriptPubKey(info.Address, network)
+		if err != nil {
+			continue
+		}
+		utxos = append(utxos, wallet.UTXO{
+			TxID:         info.TxID,
+			Vout:         info.Vout,
+			Value:        info.Value,
+			Address:      info.Address,
+			AddressIndex: info.AddressIndex,
+			Account:      account,
+			Change:       info.chain(),
+			ScriptPubKey: scriptPubKey,
+			AddressType:  info.AddressType,
+
+			SilentPaymentTweak: info.silentPaymentTweak(),
+		})
+	}
+	if len(utxos) == 0 {
+		return logical.ErrorResponse("no native SegWit (p2wpkh or p2tr) UTXOs available for channel funding"), nil
+	}
+
+	// Selection plans the fee exactly as the builder will, so a fee below
+	// the relay minimum is rejected before any state changes
+	var changeType, changeAddr string
+	outputs := sendOutputs(fundingAddress, amount, nil)
+	selectedUTXOs, _, err := wallet.SelectUTXOsForOutputs(utxos, outputs, network, fee, func(selected []wallet.UTXO) (string, error) {
+		changeType = w.changeAddressType("", fundingType, selected)
+		changeInfo, err := walletAddressInfo(ctx, req.Storage, w, network, account, 1, acct.NextAddressIndex, changeType)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate change address: %w", err)
+		}
+		changeAddr = changeInfo.Address
+		return changeAddr, nil
+	})
+	if err != nil {
+		return logical.ErrorResponse("UTXO selection failed: %s", err.Error()), nil
+	}
+
+	changeScriptHash, err := wallet.AddressToScriptHash(changeAddr, network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute change address scripthash: %w", err)
+	}
+	stored := &storedAddress{
+		Address:        changeAddr,
+		Index:          acct.NextAddressIndex,
+		Account:        account,
+		Change:         true,
+		DerivationPath: wallet.DerivationPathForAccount(network, account, 1, acct.NextAddressIndex, changeType),
+		ScriptHash:     changeScriptHash,
+		AddressType:    changeType,
+	}
+	if err := storeAddress(ctx, req.Storage, name, stored); err != nil {
+		return nil, fmt.Errorf("failed to store change address: %w", err)
+	}
+	acct.NextAddressIndex++
+	if err := saveWallet(ctx, req.Storage, w); err != nil {
+		return nil, fmt.Errorf("failed to update wallet: %w", err)
+	}
+	b.registerAddresses(ctx, req.Storage, w, network, changeAddr)
+
+	seed, err := walletSeed(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
+	lockTime, err := b.antiFeeSnipingLockTime(ctx, req.Storage, name, network, selectedUTXOs)
+	if err != nil {
+		return nil, err
+	}
+
+	txResult, err := wallet.BuildTransactionWithFee(seed, network, selectedUTXOs, outputs, changeAddr, fee, lockTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build transaction: %w", err)
+	}
+
+	funding := &storedChannelFunding{
+		TxID:           txResult.TxID,
+		Account:        account,
+		FundingScript:  hex.EncodeToString(fundingScript),
+		FundingAddress: fundingAddress,
+		Amount:         amount,
+		Fee:            txResult.Fee,
+		ChangeAmount:   txResult.ChangeAmount,
+		Inputs:         selectedUTXOs,
+		Hex:            txResult.Hex,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if txResult.ChangeAmount > 0 {
+		funding.ChangeAddress = changeAddr
+	}
+
+	tx, err := funding.signedTx()
+	if err != nil {
+		return nil, err
+	}
+	funding.OutputIndex = -1
+	for i, out := range tx.TxOut {
+		if bytes.Equal(out.PkScript, fundingScript) {
+			funding.OutputIndex = i
+			break
+		}
+	}
+	if funding.OutputIndex < 0 {
+		return nil, fmt.Errorf("channel funding transaction %s has no funding output", funding.TxID)
+	}
+
+	funding.PSBT, err = channelFundingPSBT(tx, selectedUTXOs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storeChannelFunding(ctx, req.Storage, name, funding); err != nil {
+		return nil, err
+	}
+
+	b.Logger().Info("channel funding created", "wallet", name, "account", account, "txid", funding.TxID, "amount", amount, "fee", funding.Fee)
+
+	return addFeeWarning(&logical.Response{Data: funding.responseData()}, fee, funding.Fee), nil
+}
+
+func (b *btcBackend) pathWalletChannelFundingList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	w, err := getWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return logical.ErrorResponse("wallet %q not found", name), nil
+	}
+
+	account, _, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	fundings, err := getChannelFundings(ctx, req.Storage, name, account)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(fundings))
+	keyInfo := make(map[string]interface{}, len(fundings))
+	for _, f := range fundings {
+		keys = append(keys, f.TxID)
+		keyInfo[f.TxID] = map[string]interface{}{
+			"funding_address": f.FundingAddress,
+			"amount":          f.Amount,
+			"fee":             f.Fee,
+			"created_at":      f.CreatedAt.Format(time.RFC3339),
+		}
+	}
+
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
+}
+
+func (b *btcBackend) pathWalletChannelFundingRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	funding, errResp, err := requestedChannelFunding(ctx, req.Storage, data)
+	if err != nil || errResp != nil {
+		return errResp, err
+	}
+	return &logical.Response{Data: funding.responseData()}, nil
+}
+
+func (b *btcBackend) pathWalletChannelFundingCancel(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	// Finalizing settles the funding too, so only one of them may see it
+	defer b.lockWallet(name)()
+
+	funding, errResp, err := requestedChannelFunding(ctx, req.Storage, data)
+	if err != nil || errResp != nil {
+		return errResp, err
+	}
+
+	if err := deleteChannelFunding(ctx, req.Storage, name, funding); err != nil {
+		return nil, err
+	}
+
+	b.Logger().Info("channel funding cancelled", "wallet", name, "account", funding.Account, "txid", funding.TxID)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"txid":            funding.TxID,
+			"cancelled":       true,
+			"inputs_unlocked": funding.outpoints(),
+		},
+	}, nil
+}
+
+// requestedChannelFunding loads the channel funding named by the request
+// path. A non-nil response is a user-facing error.
+func requestedChannelFunding(ctx context.Context, s logical.Storage, data *framework.FieldData) (*storedChannelFunding, *logical.Response, error) {
+	name := data.Get("name").(string)
+	txid := data.Get("txid").(string)
+
+	w, err := getWallet(ctx, s, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if w == nil {
+		return nil, logical.ErrorResponse("wallet %q not found", name), nil
+	}
+
+	account, _, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return nil, errResp, nil
+	}
+
+	funding, err := getChannelFunding(ctx, s, name, account, txid)
+	if err != nil {
+		return nil, nil, err
+	}
+	if funding == nil {
+		return nil, logical.ErrorResponse("no pending channel funding %s in account %d", txid, account), nil
+	}
+	return funding, nil, nil
+}
+
+// responseData returns the fields shown for a pending channel funding. The
+// signed transaction is withheld until psbt/finalize.
+func (f *storedChannelFunding) responseData() map[string]interface{} {
+	respData := map[string]interface{}{
+		"txid":            f.TxID,
+		"account":         f.Account,
+		"psbt":            f.PSBT,
+		"funding_script":  f.FundingScript,
+		"funding_address": f.FundingAddress,
+		"output_index":    f.OutputIndex,
+		"amount":          f.Amount,
+		"fee":             f.Fee,
+		"inputs":          f.outpoints(),
+		"created_at":      f.CreatedAt.Format(time.RFC3339),
+	}
+	if f.ChangeAddress != "" {
+		respData["change_address"] = f.ChangeAddress
+		respData["change_amount"] = f.ChangeAmount
+	}
+	return respData
+}
+
+// channelFundingPSBT returns the unsigned PSBT of a channel funding
+// transaction, for the Lightning node to verify the funding output
+func channelFundingPSBT(tx *wire.MsgTx, utxos []wallet.UTXO) (string, error) {
+	unsigned := tx.Copy()
+	for _, in := range unsigned.TxIn {
+		in.SignatureScript = nil
+		in.Witness = nil
+	}
+
+	p, err := psbt.NewFromUnsignedTx(unsigned)
+	if err != nil {
+		return "", fmt.Errorf("failed to create PSBT: %w", err)
+	}
+	for i, utxo := range utxos {
+		p.Inputs[i].WitnessUtxo = wire.NewTxOut(utxo.Value, utxo.ScriptPubKey)
+	}
+	return p.B64Encode()
+}
+
+// channelFundingStoragePath returns the storage prefix holding the pending
+// channel fundings of a wallet account
+func channelFundingStoragePath(walletName string, account uint32) string {
+	return fmt.Sprintf("%s%s/%d/", channelFundingStoragePrefix, walletName, account)
+}
+
+// getChannelFunding returns a pending channel funding, or nil if there is none
+func getChannelFunding(ctx context.Context, s logical.Storage, walletName string, account uint32, txid string) (*storedChannelFunding, error) {
+	entry, err := s.Get(ctx, channelFundingStoragePath(walletName, account)+txid)
+	if err != nil {
+		return nil, fmt.Errorf("error reading channel funding: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var f storedChannelFunding
+	if err := entry.DecodeJSON(&f); err != nil {
+		return nil, fmt.Errorf("error decoding channel funding: %w", err)
+	}
+	return &f, nil
+}
+
+// findChannelFunding returns the pending channel funding of any account of a
+// wallet with the given txid, or nil if there is none
+func findChannelFunding(ctx context.Context, s logical.Storage, w *btcWallet, txid string) (*storedChannelFunding, error) {
+	for _, account := range w.accountIndices() {
+		f, err := getChannelFunding(ctx, s, w.Name, account, txid)
+		if err != nil || f != nil {
+			return f, err
+		}
+	}
+	return nil, nil
+}
+
+// getChannelFundings returns the pending channel fundings of a wallet
+// account, oldest first
+func getChannelFundings(ctx context.Context, s logical.Storage, walletName string, account uint32) ([]*storedChannelFunding, error) {
+	entries, err := s.List(ctx, channelFundingStoragePath(walletName, account))
+	if err != nil {
+		return nil, fmt.Errorf("error listing channel fundings: %w", err)
+	}
+
+	fundings := make([]*storedChannelFunding, 0, len(entries))
+	for _, txid := range entries {
+		f, err := getChannelFunding(ctx, s, walletName, account, txid)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			fundings = append(fundings, f)
+		}
+	}
+
+	sort.Slice(fundings, func(i, j int) bool {
+		return fundings[i].CreatedAt.Before(fundings[j].CreatedAt)
+	})
+	return fundings, nil
+}
+
+// channelFundingLocks returns the outpoints locked by the pending channel
+// fundings of a wallet account
+func channelFundingLocks(ctx context.Context, s logical.Storage, walletName string, account uint32) (map[string]bool, error) {
+	fundings, err := getChannelFundings(ctx, s, walletName, account)
+	if err != nil {
+		return nil, err
+	}
+
+	locked := make(map[string]bool)
+	for _, f := range fundings {
+		for _, outpoint := range f.outpoints() {
+			locked[outpoint] = true
+		}
+	}
+	return locked, nil
+}
+
+func storeChannelFunding(ctx context.Context, s logical.Storage, walletName string, f *storedChannelFunding) error {
+	entry, err := logical.StorageEntryJSON(channelFundingStoragePath(walletName, f.Account)+f.TxID, f)
+	if err != nil {
+		return fmt.Errorf("failed to create storage entry: %w", err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return fmt.Errorf("failed to store channel funding %s: %w", f.TxID, err)
+	}
+	return nil
+}
+
+// deleteChannelFunding removes a pending channel funding, unlocking its inputs
+func deleteChannelFunding(ctx context.Context, s logical.Storage, walletName string, f *storedChannelFunding) error {
+	if err := s.Delete(ctx, channelFundingStoragePath(walletName, f.Account)+f.TxID); err != nil {
+		return fmt.Errorf("error deleting channel funding %s: %w", f.TxID, err)
+	}
+	return nil
+}
+
+// completeChannelFunding removes a finalized channel funding and marks its
+// inputs spent
+func completeChannelFunding(ctx context.Context, s logical.Storage, walletName string, f *storedChannelFunding) error {
+	if err := markUTXOsSpent(ctx, s, walletName, f.Account, f.Inputs); err != nil {
+		return err
+	}
+	return deleteChannelFunding(ctx, s, walletName, f)
+}
+
+// deleteChannelFundings removes every pending channel funding of a wallet
+// and returns how many were deleted
+func deleteChannelFundings(ctx context.Context, s logical.Storage, walletName string) (int, error) {
+	prefix := channelFundingStoragePrefix + walletName + "/"
+	accounts, err := s.List(ctx, prefix)
+	if err != nil {
+		return 0, fmt.Errorf("error listing channel fundings: %w", err)
+	}
+
+	deleted := 0
+	for _, account := range accounts {
+		entries, err := s.List(ctx, prefix+account)
+		if err != nil {
+			return deleted, fmt.Errorf("error listing channel fundings: %w", err)
+		}
+		for _, entry := range entries {
+			if err := s.Delete(ctx, prefix+account+entry); err != nil {
+				return deleted, fmt.Errorf("error deleting channel funding: %w", err)
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+const pathWalletChannelFundingHelpSynopsis = `
+Fund a Lightning channel with a withheld transaction.
+`
+
+const pathWalletChannelFundingHelpDescription = `
+Builds and signs a transaction paying a Lightning channel's P2WSH or P2TR
+funding script, for a coordinator such as LND or CLN opening a channel from
+Vault. The signed transaction is not returned: Vault keeps it until the peer
+has signed the commitment transaction and the coordinator asks for it through
+psbt/finalize. Until then, the inputs are locked and not spent by send,
+consolidate or another channel funding. Concurrent send, consolidate and
+channel funding requests on one wallet run one at a time, so they never
+select the same inputs.
+
+Only native SegWit (p2wpkh and p2tr) UTXOs fund channels, so the txid the
+Lightning node verifies cannot change when the transaction is signed.
+
+Parameters:
+  - funding_script: Hex P2WSH or P2TR output script of the channel (required)
+  - amount: Channel capacity in satoshis (required)
+  - fee_rate: Fee rate in satoshis per vbyte, with up to three decimals
+    (default: 10, minimum: 1)
+  - fee: Absolute fee in satoshis, instead of fee_rate
+  - min_confirmations: Minimum UTXO confirmations (default: from config)
+
+Response:
+  - txid: Transaction ID of the funding transaction
+  - psbt: Unsigned PSBT (base64) for the Lightning node to verify
+  - output_index: Index of the funding output
+  - inputs: Locked outpoints
+
+Workflow:
+  # 1. Start the channel open on the node, e.g. lncli openchannel --psbt,
+  #    and fund the script it returns
+  $ vault write btc/wallets/treasury/channel-funding \
+      funding_script="0020..." amount=1000000 fee_rate=5
+
+  # 2. Hand the psbt to the node to verify. Once the peer has signed the
+  #    commitment, finalize and broadcast the funding transaction
+  $ vault write btc/wallets/treasury/psbt/finalize psbt="cHNidP8BAH..."
+
+  # Abandoned channel opens are cancelled to unlock the inputs
+  $ vault delete btc/wallets/treasury/channel-funding/<txid>
+
+A LIST returns the pending channel fundings of the account.
+`
+
+const pathWalletChannelFundingTxHelpSynopsis = `
+Read or cancel a pending channel funding.
+`
+
+const pathWalletChannelFundingTxHelpDescription = `
+A read returns the unsigned PSBT and details of a pending channel funding. A
+delete cancels it and unlocks its inputs; the withheld signed transaction is
+discarded.
+
+Example:
+  $ vault delete btc/wallets/treasury/channel-funding/<txid>
+`
@@ -6,9 +6,6 @@ import (
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
-
-	"github.com/djschnei21/vault-plugin-btc/electrum"
-	"github.com/djschnei21/vault-plugin-btc/wallet"
 )
 
 // CompactionResult holds the results of a compaction operation
@@ -22,7 +19,7 @@ type CompactionResult struct {
 func pathWalletCompact(b *btcBackend) []*framework.Path {
 	return []*framework.Path{
 		{
-			Pattern: "wallets/" + framework.GenericNameRegex("name") + "/compact",
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + accountPathRegex + "/compact",
 			DisplayAttrs: &framework.DisplayAttributes{
 				OperationPrefix: "btc",
 			},
@@ -32,6 +29,7 @@ func pathWalletCompact(b *btcBackend) []*framework.Path {
 					Description: "Name of the wallet",
 					Required:    true,
 				},
+				"account": accountField(),
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.UpdateOperation: &framework.PathOperation{
@@ -72,23 +70,29 @@ func (b *btcBackend) pathWalletCompact(ctx context.Context, req *logical.Request
 		return logical.ErrorResponse("wallet %q not found", name), nil
 	}
 
-	network, err := getNetwork(ctx, req.Storage)
+	account, _, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := b.getClient(ctx, req.Storage)
+	client, err := b.getClient(ctx, req.Storage, network)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Electrum server: %w", err)
+		return nil, fmt.Errorf("failed to connect to chain backend: %w", err)
 	}
 
-	result, err := b.runCompaction(ctx, req.Storage, name, network, client)
+	result, err := b.runCompaction(ctx, req.Storage, name, account, network, client)
 	if err != nil {
 		return nil, err
 	}
 
 	return &logical.Response{
 		Data: map[string]interface{}{
+			"account":               account,
 			"previous_first_active": result.PreviousFirstActive,
 			"new_first_active":      result.NewFirstActive,
 			"addresses_deleted":     result.AddressesDeleted,
@@ -98,7 +102,7 @@ func (b *btcBackend) pathWalletCompact(ctx context.Context, req *logical.Request
 }
 
 // runCompaction performs the actual compaction work and can be called from multiple places
-func (b *btcBackend) runCompaction(ctx context.Context, s logical.Storage, walletName string, network string, client *electrum.Client) (*CompactionResult, error) {
+func (b *btcBackend) runCompaction(ctx context.Context, s logical.Storage, walletName string, account uint32, network string, client ChainBackend) (*CompactionResult, error) {
 	w, err := getWallet(ctx, s, walletName)
 	if err != nil {
 		return nil, err
@@ -108,19 +112,24 @@ func (b *btcBackend) runCompaction(ctx context.Context, s logical.Storage, walle
 		return nil, fmt.Errorf("wallet %q not found", walletName)
 	}
 
+	acct := w.account(account)
+	if acct == nil {
+		return nil, fmt.Errorf("account %d not found in wallet %q", account, walletName)
+	}
+
 	// Get all stored addresses
-	addresses, err := getStoredAddresses(ctx, s, walletName)
+	addresses, err := getStoredAddresses(ctx, s, walletName, account)
 	if err != nil {
 		return nil, err
 	}
 
-	originalFirstActive := w.FirstActiveIndex
+	originalFirstActive := acct.FirstActiveIndex
 	deletedCount := 0
-	newFirstActive := w.FirstActiveIndex
+	newFirstActive := acct.FirstActiveIndex
 
 	// Find the new first active index by checking each address from the current first active
 	// An address can be compacted if: spent=true AND balance=0
-	for idx := w.FirstActiveIndex; idx < w.NextAddressIndex; idx++ {
+	for idx := acct.FirstActiveIndex; idx < acct.NextAddressIndex; idx++ {
 		// Find stored address for this index
 		var addr *storedAddress
 		for i := range addresses {
@@ -132,7 +141,7 @@ func (b *btcBackend) runCompaction(ctx context.Context, s logical.Storage, walle
 
 		// If no stored address, regenerate to check
 		if addr == nil {
-			addrInfo, err := wallet.GenerateAddressInfoForType(w.Seed, network, idx, w.AddressType)
+			addrInfo, err := walletAddressInfo(ctx, s, w, network, account, 0, idx, w.AddressType)
 			if err != nil {
 				b.Logger().Warn("failed to regenerate address", "index", idx, "error", err)
 				break
@@ -150,8 +159,8 @@ func (b *btcBackend) runCompaction(ctx context.Context, s logical.Storage, walle
 			break
 		}
 
-		// Check balance via Electrum
-		balanceResp, err := client.GetBalance(addr.ScriptHash)
+		// Check balance via the chain backend
+		balanceResp, err := client.GetBalance(ctx, addr.Address)
 		if err != nil {
 			b.Logger().Warn("failed to get balance", "address", addr.Address, "error", err)
 			break
@@ -170,8 +179,7 @@ func (b *btcBackend) runCompaction(ctx context.Context, s logical.Storage, walle
 	// Delete address records below the new first active index
 	for _, addr := range addresses {
 		if addr.Index < newFirstActive {
-			storageKey := fmt.Sprintf("%s%s/%d", addressStoragePrefix, walletName, addr.Index)
-			if err := s.Delete(ctx, storageKey); err != nil {
+			if err := s.Delete(ctx, addressStorageKey(walletName, account, addr.Index)); err != nil {
 				b.Logger().Warn("failed to delete address", "index", addr.Index, "error", err)
 			} else {
 				deletedCount++
@@ -180,18 +188,19 @@ func (b *btcBackend) runCompaction(ctx context.Context, s logical.Storage, walle
 	}
 
 	// Update wallet with new first active index
-	if newFirstActive != w.FirstActiveIndex {
-		w.FirstActiveIndex = newFirstActive
+	if newFirstActive != acct.FirstActiveIndex {
+		acct.FirstActiveIndex = newFirstActive
 		if err := saveWallet(ctx, s, w); err != nil {
 			return nil, fmt.Errorf("failed to update wallet: %w", err)
 		}
 	}
 
 	// Invalidate cache since we've been checking addresses
-	b.cache.InvalidateWallet(walletName)
+	b.invalidateWalletCache(ctx, s, walletName)
 
 	b.Logger().Info("wallet compacted",
 		"wallet", walletName,
+		"account", account,
 		"previous_first_active", originalFirstActive,
 		"new_first_active", newFirstActive,
 		"addresses_deleted", deletedCount)
@@ -200,7 +209,7 @@ func (b *btcBackend) runCompaction(ctx context.Context, s logical.Storage, walle
 		PreviousFirstActive: originalFirstActive,
 		NewFirstActive:      newFirstActive,
 		AddressesDeleted:    deletedCount,
-		AddressesRemaining:  int(w.NextAddressIndex - newFirstActive),
+		AddressesRemaining:  int(acct.NextAddressIndex - newFirstActive),
 	}, nil
 }
 
@@ -220,6 +229,9 @@ and speeds up wallet operations.
 Example:
   $ vault write btc/wallets/my-wallet/compact
 
+Each account is compacted separately:
+  $ vault write btc/wallets/my-wallet/accounts/1/compact
+
 Response:
   - previous_first_active: Previous lowest tracked address index
   - new_first_active: New lowest tracked address index after compaction
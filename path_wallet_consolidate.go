@@ -13,7 +13,7 @@ import (
 func pathWalletConsolidate(b *btcBackend) []*framework.Path {
 	return []*framework.Path{
 		{
-			Pattern: "wallets/" + framework.GenericNameRegex("name") + "/consolidate",
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + accountPathRegex + "/consolidate",
 			DisplayAttrs: &framework.DisplayAttributes{
 				OperationPrefix: "btc",
 			},
@@ -23,11 +23,9 @@ func pathWalletConsolidate(b *btcBackend) []*framework.Path {
 					Description: "Name of the wallet",
 					Required:    true,
 				},
-				"fee_rate": {
-					Type:        framework.TypeInt,
-					Description: "Fee rate in satoshis per vbyte (default: 10)",
-					Default:     10,
-				},
+				"account":  accountField(),
+				"fee_rate": feeRateField(),
+				"fee":      feeField(),
 				"min_confirmations": {
 					Type:        framework.TypeInt,
 					Description: "Minimum confirmations for UTXOs (default: from config)",
@@ -48,6 +46,10 @@ func pathWalletConsolidate(b *btcBackend) []*framework.Path {
 					Description: "Run compaction after consolidation to clean up spent empty addresses (default: false)",
 					Default:     false,
 				},
+				"address_type": {
+					Type:        framework.TypeString,
+					Description: "Type of the consolidated output address: p2tr, p2wpkh, p2sh-p2wpkh or p2pkh (default: wallet address_type)",
+				},
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.UpdateOperation: &framework.PathOperation{
@@ -76,22 +78,19 @@ func (b *btcBackend) pathWalletConsolidateExistenceCheck(ctx context.Context, re
 
 func (b *btcBackend) pathWalletConsolidate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	name := data.Get("name").(string)
-	feeRate := int64(data.Get("fee_rate").(int))
 	minConfOverride := data.Get("min_confirmations").(int)
 	belowValue := int64(data.Get("below_value").(int))
 	dryRun := data.Get("dry_run").(bool)
 	compact := data.Get("compact").(bool)
 
-	b.Logger().Debug("consolidate request", "wallet", name, "fee_rate", feeRate, "below_value", belowValue, "dry_run", dryRun, "compact", compact)
+	b.Logger().Debug("consolidate request", "wallet", name, "fee_rate", data.Get("fee_rate"), "fee", data.Get("fee"), "below_value", belowValue, "dry_run", dryRun, "compact", compact)
 
-	if feeRate <= 0 {
-		return logical.ErrorResponse("fee_rate must be positive"), nil
+	fee, err := requestFee(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	// Safety check for unreasonably high fee rates
-	if errMsg := wallet.ValidateFeeRate(feeRate); errMsg != "" {
-		return logical.ErrorResponse(errMsg), nil
-	}
+	defer b.lockWallet(name)()
 
 	w, err := getWallet(ctx, req.Storage, name)
 	if err != nil {
@@ -102,7 +101,17 @@ func (b *btcBackend) pathWalletConsolidate(ctx context.Context, req *logical.Req
 		return logical.ErrorResponse("wallet %q not found", name), nil
 	}
 
-	network, err := getNetwork(ctx, req.Storage)
+	account, acct, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	outputType, err := requestAddressType(w, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
 	if err != nil {
 		return nil, err
 	}
@@ -117,7 +126,7 @@ func (b *btcBackend) pathWalletConsolidate(ctx context.Context, req *logical.Req
 	}
 
 	// Get all UTXOs
-	utxoInfos, err := b.getUTXOsForWallet(ctx, req.Storage, name, minConfirmations)
+	utxoInfos, err := b.getUTXOsForWallet(ctx, req.Storage, name, account, minConfirmations)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get UTXOs: %w", err)
 	}
@@ -174,27 +183,27 @@ func (b *btcBackend) pathWalletConsolidate(ctx context.Context, req *logical.Req
 			Value:        info.Value,
 			Address:      info.Address,
 			AddressIndex: info.AddressIndex,
+			Account:      account,
+			Change:       info.chain(),
 			ScriptPubKey: scriptPubKey,
-			AddressType:  w.AddressType,
+			AddressType:  info.AddressType,
+
+			SilentPaymentTweak: info.silentPaymentTweak(),
 		})
 	}
 
-	// Estimate fee using address-type-aware calculation (matches BuildConsolidationTransaction)
-	estimatedFee := wallet.EstimateFeeForUTXOs(walletUTXOs, 1, feeRate, w.AddressType)
-	// Calculate vsize for display
-	inputVSize := 0
-	for _, utxo := range walletUTXOs {
-		if utxo.AddressType == wallet.AddressTypeP2TR {
-			inputVSize += wallet.P2TRInputSize
-		} else {
-			inputVSize += wallet.P2WPKHInputSize
-		}
+	// Generate destination address (fresh address for consolidation output)
+	destInfo, err := walletAddressInfo(ctx, req.Storage, w, network, account, 0, acct.NextAddressIndex, outputType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate destination address: %w", err)
 	}
-	outputSize := wallet.P2WPKHOutputSize
-	if w.AddressType == wallet.AddressTypeP2TR {
-		outputSize = wallet.P2TROutputSize
+	destAddr := destInfo.Address
+
+	// Size the fee on the transaction BuildConsolidationTransaction will sign
+	estimatedFee, estimatedVSize, err := wallet.EstimateFee(walletUTXOs, []string{destAddr}, network, fee)
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate fee: %w", err)
 	}
-	estimatedVSize := wallet.TxOverhead + inputVSize + outputSize
 
 	// Calculate output value
 	outputValue := totalInput - estimatedFee
@@ -208,12 +217,6 @@ func (b *btcBackend) pathWalletConsolidate(ctx context.Context, req *logical.Req
 			wallet.DustLimit, totalInput, estimatedFee, outputValue), nil
 	}
 
-	// Generate destination address (fresh address for consolidation output)
-	destAddr, err := wallet.GenerateAddressFromSeedForType(w.Seed, network, w.NextAddressIndex, w.AddressType)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate destination address: %w", err)
-	}
-
 	// If dry run, return estimate without broadcasting
 	if dryRun {
 		b.Logger().Debug("consolidate dry run complete", "wallet", name, "inputs", len(walletUTXOs), "output_value", outputValue)
@@ -226,14 +229,15 @@ func (b *btcBackend) pathWalletConsolidate(ctx context.Context, req *logical.Req
 				"estimated_vsize":       estimatedVSize,
 				"output_value":          outputValue,
 				"output_address":        destAddr,
-				"fee_rate":              feeRate,
+				"output_address_type":   outputType,
+				"fee_rate":              feeRateOf(fee, estimatedFee, estimatedVSize),
 				"privacy_warning":       "Consolidation links all input addresses together, revealing common ownership",
 			},
 		}, nil
 	}
 
 	// Store destination address
-	addrInfo, err := wallet.GenerateAddressInfoForType(w.Seed, network, w.NextAddressIndex, w.AddressType)
+	addrInfo, err := walletAddressInfo(ctx, req.Storage, w, network, account, 0, acct.NextAddressIndex, outputType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate address info: %w", err)
 	}
@@ -241,24 +245,21 @@ func (b *btcBackend) pathWalletConsolidate(ctx context.Context, req *logical.Req
 	stored := &storedAddress{
 		Address:        addrInfo.Address,
 		Index:          addrInfo.Index,
+		Account:        account,
 		DerivationPath: addrInfo.DerivationPath,
 		ScriptHash:     addrInfo.ScriptHash,
+		AddressType:    addrInfo.AddressType,
 	}
 
-	storageKey := fmt.Sprintf("%s%s/%d", addressStoragePrefix, name, w.NextAddressIndex)
-	entry, err := logical.StorageEntryJSON(storageKey, stored)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create storage entry: %w", err)
-	}
-
-	if err := req.Storage.Put(ctx, entry); err != nil {
-		return nil, fmt.Errorf("failed to store address: %w", err)
+	if err := storeAddress(ctx, req.Storage, name, stored); err != nil {
+		return nil, err
 	}
 
-	w.NextAddressIndex++
+	acct.NextAddressIndex++
 	if err := saveWallet(ctx, req.Storage, w); err != nil {
 		return nil, fmt.Errorf("failed to update wallet: %w", err)
 	}
+	b.registerAddresses(ctx, req.Storage, w, network, addrInfo.Address)
 
 	// Build consolidation transaction (single output to ourselves)
 	outputs := []wallet.TxOutput{
@@ -268,25 +269,36 @@ func (b *btcBackend) pathWalletConsolidate(ctx context.Context, req *logical.Req
 		},
 	}
 
+	seed, err := walletSeed(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
+	lockTime, err := b.antiFeeSnipingLockTime(ctx, req.Storage, name, network, walletUTXOs)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build transaction with no change (all value goes to single output)
-	txResult, err := wallet.BuildConsolidationTransaction(
-		w.Seed,
+	txResult, err := wallet.BuildConsolidationTransactionWithFee(
+		seed,
 		network,
 		walletUTXOs,
 		outputs[0].Address,
-		feeRate,
+		fee,
+		lockTime,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build consolidation transaction: %w", err)
 	}
 
 	// Broadcast
-	client, err := b.getClient(ctx, req.Storage)
+	client, err := b.getClient(ctx, req.Storage, network)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Electrum: %w", err)
+		return nil, fmt.Errorf("failed to connect to chain backend: %w", err)
 	}
 
-	txid, err := client.BroadcastTransaction(txResult.Hex)
+	txid, err := client.BroadcastTransaction(ctx, txResult.Hex)
 	if err != nil {
 		b.Logger().Warn("consolidation broadcast failed", "wallet", name, "error", err)
 		return &logical.Response{
@@ -305,14 +317,10 @@ func (b *btcBackend) pathWalletConsolidate(ctx context.Context, req *logical.Req
 	}
 
 	// Invalidate cache after successful broadcast
-	b.cache.InvalidateWallet(name)
+	b.invalidateWalletCache(ctx, req.Storage, name)
 
 	// Mark input addresses as spent (never receive to them again)
-	spentIndices := make([]uint32, 0, len(walletUTXOs))
-	for _, utxo := range walletUTXOs {
-		spentIndices = append(spentIndices, utxo.AddressIndex)
-	}
-	if err := markAddressesSpent(ctx, req.Storage, name, spentIndices); err != nil {
+	if err := markUTXOsSpent(ctx, req.Storage, name, account, walletUTXOs); err != nil {
 		b.Logger().Warn("failed to mark addresses as spent", "wallet", name, "error", err)
 		// Non-fatal: transaction was broadcast successfully
 	}
@@ -332,13 +340,14 @@ func (b *btcBackend) pathWalletConsolidate(ctx context.Context, req *logical.Req
 		"fee":                 txResult.Fee,
 		"output_value":        outputValue,
 		"output_address":      destAddr,
+		"output_address_type": outputType,
 		"broadcast":           true,
 		"privacy_warning":     "Consolidation links all input addresses together, revealing common ownership",
 	}
 
 	// Run compaction if requested
 	if compact {
-		compactResult, err := b.runCompaction(ctx, req.Storage, name, network, client)
+		compactResult, err := b.runCompaction(ctx, req.Storage, name, account, network, client)
 		if err != nil {
 			b.Logger().Warn("compaction after consolidation failed", "wallet", name, "error", err)
 			respData["compact_error"] = err.Error()
@@ -380,13 +389,18 @@ Example - Consolidate and compact in one operation:
   $ vault write btc/wallets/treasury/consolidate compact=true
 
 Parameters:
-  - fee_rate: Fee rate in satoshis per vbyte (default: 10)
+  - fee_rate: Fee rate in satoshis per vbyte, with up to three decimals
+              (default: 10, minimum: 1)
+  - fee: Absolute fee in satoshis, instead of fee_rate
   - min_confirmations: Minimum UTXO confirmations (default: from config)
   - below_value: Only consolidate UTXOs below this value in satoshis
                  (default: 0, meaning consolidate all UTXOs)
   - dry_run: Preview without broadcasting (default: false)
   - compact: Run compaction after consolidation to clean up spent empty
              address records (default: false)
+  - address_type: Type of the consolidated output address
+                  (default: wallet address_type). Inputs of every type
+                  are consolidated together.
 
 Response:
   - txid: Transaction ID (if broadcast)
@@ -0,0 +1,281 @@
+package btc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/djschnei21/vault-plugin-btc/wallet"
+)
+
+func pathWalletMessage(b *btcBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + accountPathRegex + "/sign-message",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the wallet",
+					Required:    true,
+				},
+				"account": accountField(),
+				"message": {
+					Type:        framework.TypeString,
+					Description: "Message to sign",
+					Required:    true,
+				},
+				"address": {
+					Type:        framework.TypeString,
+					Description: "Stored address of the wallet to sign with",
+				},
+				"index": {
+					Type:        framework.TypeInt,
+					Description: "Receive address index to sign with, instead of address",
+				},
+				"address_type": {
+					Type:        framework.TypeString,
+					Description: "Address type of index: p2tr, p2wpkh, p2sh-p2wpkh or p2pkh (default: wallet address_type)",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathWalletSignMessage,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "sign-message",
+					},
+				},
+			},
+			HelpSynopsis:    pathWalletSignMessageHelpSynopsis,
+			HelpDescription: pathWalletSignMessageHelpDescription,
+		},
+		{
+			Pattern: "verify-message",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"address": {
+					Type:        framework.TypeString,
+					Description: "Address the message was signed with",
+					Required:    true,
+				},
+				"message": {
+					Type:        framework.TypeString,
+					Description: "Signed message",
+					Required:    true,
+				},
+				"signature": {
+					Type:        framework.TypeString,
+					Description: "Base64 BIP322 simple or legacy signature",
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathVerifyMessage,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "verify-message",
+					},
+				},
+			},
+			HelpSynopsis:    pathVerifyMessageHelpSynopsis,
+			HelpDescription: pathVerifyMessageHelpDescription,
+		},
+	}
+}
+
+func (b *btcBackend) pathWalletSignMessage(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	message := data.Get("message").(string)
+
+	w, err := getWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return logical.ErrorResponse("wallet %q not found", name), nil
+	}
+
+	account, _, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
+	address := data.Get("address").(string)
+	rawIndex, hasIndex := data.GetOk("index")
+	if (address == "") == !hasIndex {
+		return logical.ErrorResponse("exactly one of address or index is required"), nil
+	}
+
+	// Only the wallet's own keys sign, so an address must be on record and
+	// an index is derived on the receive chain
+	var signer storedAddress
+	if address != "" {
+		addresses, err := getStoredAddresses(ctx, req.Storage, name, account)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, stored := range addresses {
+			if stored.Address == address {
+				signer = stored
+				found = true
+				break
+			}
+		}
+		if !found {
+			return logical.ErrorResponse("address %s does not belong to account %d of wallet %q", address, account, name), nil
+		}
+	} else {
+		index := rawIndex.(int)
+		if index < 0 || index >= 1<<31 {
+			return logical.ErrorResponse("index must be between 0 and 2147483647"), nil
+		}
+		addressType, err := requestAddressType(w, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		info, err := walletAddressInfo(ctx, req.Storage, w, network, account, 0, uint32(index), addressType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive address: %w", err)
+		}
+		signer = storedAddress{
+			Address:        info.Address,
+			Index:          info.Index,
+			Account:        account,
+			AddressType:    addressType,
+			DerivationPath: info.DerivationPath,
+		}
+	}
+
+	seed, err := walletSeed(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+	key, err := wallet.DeriveKeyForAccount(seed, network, account, signer.chain(), signer.Index, signer.AddressType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive signing key: %w", err)
+	}
+	privKey, err := wallet.GetPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	respData := map[string]interface{}{
+		"address":         signer.Address,
+		"address_type":    signer.AddressType,
+		"derivation_path": signer.DerivationPath,
+		"message":         message,
+	}
+
+	if signer.AddressType == AddressTypeP2WPKH || signer.AddressType == AddressTypeP2TR {
+		sig, err := wallet.SignMessageBIP322(privKey, signer.Address, network, message)
+		if err != nil {
+			return nil, err
+		}
+		respData["bip322_signature"] = sig
+	}
+	if signer.AddressType != AddressTypeP2TR {
+		sig, err := wallet.SignMessageLegacy(privKey, signer.AddressType, message)
+		if err != nil {
+			return nil, err
+		}
+		respData["legacy_signature"] = sig
+	}
+
+	b.Logger().Info("message signed", "wallet", name, "account", account, "address", signer.Address)
+
+	return &logical.Response{Data: respData}, nil
+}
+
+func (b *btcBackend) pathVerifyMessage(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	address := data.Get("address").(string)
+	message := data.Get("message").(string)
+	signature := data.Get("signature").(string)
+
+	if address == "" || signature == "" {
+		return logical.ErrorResponse("address and signature are required"), nil
+	}
+
+	network, err := getNetwork(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if err := wallet.ValidateAddress(address, network); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if wallet.IsSilentPaymentAddress(address) {
+		return logical.ErrorResponse("silent payment addresses have no key to sign messages with"), nil
+	}
+
+	respData := map[string]interface{}{
+		"address": address,
+		"network": network,
+	}
+
+	// A signature that does not verify is an answer, not a request error
+	format, err := wallet.VerifyMessage(address, network, message, signature)
+	if err != nil {
+		respData["valid"] = false
+		respData["error"] = err.Error()
+		return &logical.Response{Data: respData}, nil
+	}
+
+	respData["valid"] = true
+	respData["format"] = format
+	return &logical.Response{Data: respData}, nil
+}
+
+const pathWalletSignMessageHelpSynopsis = `
+Sign a message with a wallet address key.
+`
+
+const pathWalletSignMessageHelpDescription = `
+Signs a message to prove control of an address, for example for exchange
+withdrawal whitelisting or proof of ownership. The key is chosen by a stored
+address of the account, or by a receive address index and address_type.
+
+Signatures returned depend on the address type:
+  p2wpkh       bip322_signature and legacy_signature
+  p2tr         bip322_signature
+  p2sh-p2wpkh  legacy_signature
+  p2pkh        legacy_signature
+
+bip322_signature is a BIP322 simple signature. legacy_signature is a Bitcoin
+Core style signmessage signature with a BIP137 header, accepted by most
+wallets that predate BIP322.
+
+Examples:
+  $ vault write btc/wallets/treasury/sign-message \
+      address=bc1q... message="I control this address"
+
+  $ vault write btc/wallets/treasury/accounts/1/sign-message \
+      index=0 address_type=p2tr message="I control this address"
+`
+
+const pathVerifyMessageHelpSynopsis = `
+Verify a signed message for any address.
+`
+
+const pathVerifyMessageHelpDescription = `
+Checks a BIP322 simple signature or a legacy signmessage signature against an
+address of the mount's configured network. The address does not need to
+belong to a wallet of this engine.
+
+The response reports valid=true with the signature format, or valid=false with
+the reason verification failed.
+
+Example:
+  $ vault write btc/verify-message \
+      address=bc1q... message="I control this address" signature=...
+`
@@ -118,7 +118,7 @@ func (b *btcBackend) pathWalletPSBTSign(ctx context.Context, req *logical.Reques
 		return logical.ErrorResponse("wallet %q not found", name), nil
 	}
 
-	network, err := getNetwork(ctx, req.Storage)
+	network, err := walletNetwork(ctx, req.Storage, w)
 	if err != nil {
 		return nil, err
 	}
@@ -139,16 +139,21 @@ func (b *btcBackend) pathWalletPSBTSign(ctx context.Context, req *logical.Reques
 		return logical.ErrorResponse("invalid PSBT: %s", err.Error()), nil
 	}
 
-	// Get stored addresses to find which inputs we can sign (for single-sig)
-	addresses, err := getStoredAddresses(ctx, req.Storage, name)
+	seed, err := walletSeed(ctx, req.Storage, w)
 	if err != nil {
 		return nil, err
 	}
 
-	// Build address to index map for single-sig lookup
-	addrToIndex := make(map[string]uint32)
-	for _, addr := range addresses {
-		addrToIndex[addr.Address] = addr.Index
+	// Get stored addresses of every account to find which inputs we can sign (for single-sig)
+	addrToStored := make(map[string]storedAddress)
+	for _, account := range w.accountIndices() {
+		addresses, err := getStoredAddresses(ctx, req.Storage, name, account)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addresses {
+			addrToStored[addr.Address] = addr
+		}
 	}
 
 	// Sign each input we have keys for
@@ -172,9 +177,9 @@ func (b *btcBackend) pathWalletPSBTSign(ctx context.Context, req *logical.Reques
 		// Try multiple signing strategies
 		signed := false
 
-		// Strategy 1: Direct address match (single-sig P2WPKH/P2TR)
+		// Strategy 1: Direct address match (single-sig P2WPKH/P2SH-P2WPKH/P2TR)
 		if !signed {
-			signed = b.trySignSingleSig(p, i, input, params, network, w, addrToIndex, sigHashes)
+			signed = b.trySignSingleSig(p, i, input, params, network, w, seed, addrToStored, sigHashes)
 			if signed {
 				signedCount++
 				continue
@@ -183,7 +188,7 @@ func (b *btcBackend) pathWalletPSBTSign(ctx context.Context, req *logical.Reques
 
 		// Strategy 2: BIP32 derivation matching (multi-sig and external PSBTs)
 		if !signed {
-			signed = b.trySignByBip32Derivation(p, i, input, network, w, sigHashes)
+			signed = b.trySignByBip32Derivation(p, i, input, network, w, seed, sigHashes)
 			if signed {
 				signedCount++
 				continue
@@ -192,7 +197,7 @@ func (b *btcBackend) pathWalletPSBTSign(ctx context.Context, req *logical.Reques
 
 		// Strategy 3: Scan our keys against witness script (multi-sig P2WSH)
 		if !signed && input.WitnessScript != nil {
-			signed = b.trySignMultiSig(p, i, input, network, w, sigHashes)
+			signed = b.trySignMultiSig(p, i, input, network, w, seed, sigHashes)
 			if signed {
 				signedCount++
 			}
@@ -216,8 +221,8 @@ func (b *btcBackend) pathWalletPSBTSign(ctx context.Context, req *logical.Reques
 
 // trySignSingleSig attempts to sign a single-sig input by matching the address
 func (b *btcBackend) trySignSingleSig(p *psbt.Packet, inputIndex int, input psbt.PInput,
-	params *chaincfg.Params, network string, w *btcWallet,
-	addrToIndex map[string]uint32, sigHashes *txscript.TxSigHashes) bool {
+	params *chaincfg.Params, network string, w *btcWallet, seed []byte,
+	addrToStored map[string]storedAddress, sigHashes *txscript.TxSigHashes) bool {
 
 	// Extract address from scriptPubKey
 	_, addrs, _, err := txscript.ExtractPkScriptAddrs(input.WitnessUtxo.PkScript, params)
@@ -226,20 +231,26 @@ func (b *btcBackend) trySignSingleSig(p *psbt.Packet, inputIndex int, input psbt
 	}
 
 	addr := addrs[0].EncodeAddress()
-	index, ok := addrToIndex[addr]
+	stored, ok := addrToStored[addr]
 	if !ok {
 		return false // Not our address
 	}
 
-	// Detect address type from scriptPubKey
-	addrType := wallet.AddressTypeP2WPKH
-	detectedType, err := wallet.GetAddressType(addr, network)
-	if err == nil && detectedType == "p2tr" {
-		addrType = wallet.AddressTypeP2TR
+	// Use the type recorded with the address, falling back to the scriptPubKey
+	addrType := stored.AddressType
+	if addrType == "" {
+		addrType = wallet.AddressTypeP2WPKH
+		detectedType, err := wallet.GetAddressType(addr, network)
+		if err == nil && detectedType == "p2tr" {
+			addrType = wallet.AddressTypeP2TR
+		}
+	}
+	if addrType == wallet.AddressTypeP2PKH {
+		return false // Legacy inputs carry no witness UTXO and are not signed here
 	}
 
-	// Derive the key using correct path for address type
-	key, err := wallet.DeriveReceivingKeyForType(w.Seed, network, index, addrType)
+	// Derive the key using the stored account and chain, and the path for the address type
+	key, err := wallet.DeriveKeyForAccount(seed, network, stored.Account, stored.chain(), stored.Index, addrType)
 	if err != nil {
 		return false
 	}
@@ -249,7 +260,7 @@ func (b *btcBackend) trySignSingleSig(p *psbt.Packet, inputIndex int, input psbt
 
 // trySignByBip32Derivation attempts to sign by matching BIP32 derivation paths in the PSBT
 func (b *btcBackend) trySignByBip32Derivation(p *psbt.Packet, inputIndex int, input psbt.PInput,
-	network string, w *btcWallet, sigHashes *txscript.TxSigHashes) bool {
+	network string, w *btcWallet, seed []byte, sigHashes *txscript.TxSigHashes) bool {
 
 	// Check BIP32 derivation entries
 	for _, deriv := range input.Bip32Derivation {
@@ -262,22 +273,14 @@ func (b *btcBackend) trySignByBip32Derivation(p *psbt.Packet, inputIndex int, in
 		path := deriv.Bip32Path
 
 		// Check if this matches our wallet's derivation pattern
-		addrType, index, isOurs := b.matchDerivationPath(path, network, w.AddressType)
+		addrType, account, index, isOurs := b.matchDerivationPath(path, network, w)
 		if !isOurs {
 			continue
 		}
 
-		// Derive our key for this path
-		var key *hdkeychain.ExtendedKey
-		var err error
-
-		// Determine if this is receiving (change=0) or change (change=1) address
+		// Derive our key for this path (change=0 receiving, change=1 change)
 		change := path[3]
-		if change == 0 {
-			key, err = wallet.DeriveReceivingKeyForType(w.Seed, network, index, addrType)
-		} else {
-			key, err = wallet.DeriveChangeKeyForType(w.Seed, network, index, addrType)
-		}
+		key, err := wallet.DeriveKeyForAccount(seed, network, account, change, index, addrType)
 		if err != nil {
 			continue
 		}
@@ -292,7 +295,7 @@ func (b *btcBackend) trySignByBip32Derivation(p *psbt.Packet, inputIndex int, in
 			continue // Pubkey doesn't match - not our key
 		}
 
-		b.Logger().Debug("matched BIP32 derivation", "input", inputIndex, "index", index, "type", addrType)
+		b.Logger().Debug("matched BIP32 derivation", "input", inputIndex, "account", account, "index", index, "type", addrType)
 
 		// Check if this is a multi-sig (has witness script)
 		if input.WitnessScript != nil {
@@ -307,7 +310,7 @@ func (b *btcBackend) trySignByBip32Derivation(p *psbt.Packet, inputIndex int, in
 
 // trySignMultiSig scans our wallet's keys to find any that are in the witness script
 func (b *btcBackend) trySignMultiSig(p *psbt.Packet, inputIndex int, input psbt.PInput,
-	network string, w *btcWallet, sigHashes *txscript.TxSigHashes) bool {
+	network string, w *btcWallet, seed []byte, sigHashes *txscript.TxSigHashes) bool {
 
 	// Extract pubkeys from the witness script
 	scriptPubKeys := extractPubKeysFromScript(input.WitnessScript)
@@ -315,41 +318,47 @@ func (b *btcBackend) trySignMultiSig(p *psbt.Packet, inputIndex int, input psbt.
 		return false
 	}
 
-	// Try to find a matching key from our wallet
-	// We'll scan a reasonable range of indices (0 to NextAddressIndex + gap)
-	maxIndex := w.NextAddressIndex + 20 // Include some gap limit
-	if maxIndex < 100 {
-		maxIndex = 100 // Minimum scan range
+	// Wallets hold keys on both the BIP84 and BIP86 branches; try the
+	// wallet's default branch first
+	addrTypes := []string{w.AddressType}
+	for _, t := range []string{wallet.AddressTypeP2WPKH, wallet.AddressTypeP2TR} {
+		if t != w.AddressType {
+			addrTypes = append(addrTypes, t)
+		}
 	}
 
-	for idx := uint32(0); idx < maxIndex; idx++ {
-		// Try both receiving and change paths
-		for _, change := range []uint32{0, 1} {
-			var key *hdkeychain.ExtendedKey
-			var err error
-
-			if change == 0 {
-				key, err = wallet.DeriveReceivingKeyForType(w.Seed, network, idx, w.AddressType)
-			} else {
-				key, err = wallet.DeriveChangeKeyForType(w.Seed, network, idx, w.AddressType)
-			}
-			if err != nil {
-				continue
+	// Try to find a matching key from each account of our wallet
+	for _, addrType := range addrTypes {
+		for _, account := range w.accountIndices() {
+			// We'll scan a reasonable range of indices (0 to NextAddressIndex + gap)
+			maxIndex := w.account(account).NextAddressIndex + 20 // Include some gap limit
+			if maxIndex < 100 {
+				maxIndex = 100 // Minimum scan range
 			}
 
-			pubKey, err := wallet.GetPublicKey(key)
-			if err != nil {
-				continue
-			}
-
-			pubKeyBytes := pubKey.SerializeCompressed()
-
-			// Check if this pubkey is in the witness script
-			for _, scriptPubKey := range scriptPubKeys {
-				if bytes.Equal(pubKeyBytes, scriptPubKey) {
-					b.Logger().Debug("found matching key in witness script",
-						"input", inputIndex, "index", idx, "change", change)
-					return b.signMultiSigInput(p, inputIndex, input, key, sigHashes)
+			for idx := uint32(0); idx < maxIndex; idx++ {
+				// Try both receiving and change paths
+				for _, change := range []uint32{0, 1} {
+					key, err := wallet.DeriveKeyForAccount(seed, network, account, change, idx, addrType)
+					if err != nil {
+						continue
+					}
+
+					pubKey, err := wallet.GetPublicKey(key)
+					if err != nil {
+						continue
+					}
+
+					pubKeyBytes := pubKey.SerializeCompressed()
+
+					// Check if this pubkey is in the witness script
+					for _, scriptPubKey := range scriptPubKeys {
+						if bytes.Equal(pubKeyBytes, scriptPubKey) {
+							b.Logger().Debug("found matching key in witness script",
+								"input", inputIndex, "address_type", addrType, "account", account, "index", idx, "change", change)
+							return b.signMultiSigInput(p, inputIndex, input, key, sigHashes)
+						}
+					}
 				}
 			}
 		}
@@ -358,10 +367,11 @@ func (b *btcBackend) trySignMultiSig(p *psbt.Packet, inputIndex int, input psbt.
 	return false
 }
 
-// matchDerivationPath checks if a BIP32 path matches our wallet's derivation pattern
-func (b *btcBackend) matchDerivationPath(path []uint32, network string, walletAddrType string) (string, uint32, bool) {
+// matchDerivationPath checks if a BIP32 path matches one of our wallet's accounts
+// and returns the address type, account and index it derives
+func (b *btcBackend) matchDerivationPath(path []uint32, network string, w *btcWallet) (string, uint32, uint32, bool) {
 	if len(path) < 5 {
-		return "", 0, false
+		return "", 0, 0, false
 	}
 
 	// Expected path: purpose'/coin'/account'/change/index
@@ -371,7 +381,7 @@ func (b *btcBackend) matchDerivationPath(path []uint32, network string, walletAd
 	purpose := path[0]
 	coin := path[1]
 	account := path[2]
-	// change := path[3] // 0 = receiving, 1 = change
+	change := path[3] // 0 = receiving, 1 = change
 	index := path[4]
 
 	// Determine address type from purpose
@@ -381,28 +391,32 @@ func (b *btcBackend) matchDerivationPath(path []uint32, network string, walletAd
 		addrType = wallet.AddressTypeP2WPKH
 	case hardenedOffset + 86: // m/86'
 		addrType = wallet.AddressTypeP2TR
+	case hardenedOffset + 49: // m/49'
+		addrType = wallet.AddressTypeP2SHP2WPKH
 	default:
-		return "", 0, false // Unknown purpose
+		return "", 0, 0, false // Unknown purpose
 	}
 
 	// Check coin type matches network
-	expectedCoin := uint32(hardenedOffset + 0) // mainnet
-	if network == "testnet4" || network == "signet" {
-		expectedCoin = hardenedOffset + 1 // testnet
-	}
+	expectedCoin := hardenedOffset + wallet.CoinTypeForNetwork(network)
 	if coin != expectedCoin {
-		return "", 0, false
+		return "", 0, 0, false
 	}
 
-	// We only support account 0
-	if account != hardenedOffset+0 {
-		return "", 0, false
+	// The account must be hardened and exist in the wallet
+	if account < hardenedOffset || w.account(account-hardenedOffset) == nil {
+		return "", 0, 0, false
 	}
 
-	return addrType, index, true
+	// Only the external and internal chains are used
+	if change > 1 {
+		return "", 0, 0, false
+	}
+
+	return addrType, account - hardenedOffset, index, true
 }
 
-// signInput signs a single-sig input (P2WPKH or P2TR key-path)
+// signInput signs a single-sig input (P2WPKH, P2SH-P2WPKH or P2TR key-path)
 func (b *btcBackend) signInput(p *psbt.Packet, inputIndex int, input psbt.PInput,
 	key *hdkeychain.ExtendedKey, addrType string, sigHashes *txscript.TxSigHashes) bool {
 
@@ -430,11 +444,22 @@ func (b *btcBackend) signInput(p *psbt.Packet, inputIndex int, input psbt.PInput
 		}
 		p.Inputs[inputIndex].TaprootKeySpendSig = sig
 	} else {
-		// P2WPKH: Use ECDSA signature with SigHashAll
+		// P2WPKH: Use ECDSA signature with SigHashAll. Nested P2SH-P2WPKH
+		// signs the same witness program, carried as the redeem script.
+		witnessProgram := input.WitnessUtxo.PkScript
+		if addrType == wallet.AddressTypeP2SHP2WPKH {
+			redeemScript, err := wallet.NestedP2WPKHRedeemScript(pubKey)
+			if err != nil {
+				return false
+			}
+			witnessProgram = redeemScript
+			p.Inputs[inputIndex].RedeemScript = redeemScript
+		}
+
 		witness, err := txscript.WitnessSignature(
 			p.UnsignedTx, sigHashes, inputIndex,
 			input.WitnessUtxo.Value,
-			input.WitnessUtxo.PkScript,
+			witnessProgram,
 			txscript.SigHashAll,
 			privKey, true,
 		)
@@ -524,6 +549,9 @@ func (b *btcBackend) pathWalletPSBTFinalize(ctx context.Context, req *logical.Re
 
 	b.Logger().Debug("PSBT finalize request", "wallet", name, "broadcast", broadcast)
 
+	// A channel funding is settled here, so it must not race a cancel
+	defer b.lockWallet(name)()
+
 	w, err := getWallet(ctx, req.Storage, name)
 	if err != nil {
 		return nil, err
@@ -533,6 +561,11 @@ func (b *btcBackend) pathWalletPSBTFinalize(ctx context.Context, req *logical.Re
 		return logical.ErrorResponse("wallet %q not found", name), nil
 	}
 
+	network, err := walletNetwork(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
 	// Decode PSBT
 	psbtBytes, err := base64.StdEncoding.DecodeString(psbtBase64)
 	if err != nil {
@@ -544,17 +577,32 @@ func (b *btcBackend) pathWalletPSBTFinalize(ctx context.Context, req *logical.Re
 		return logical.ErrorResponse("invalid PSBT: %s", err.Error()), nil
 	}
 
-	// Finalize all inputs
-	for i := range p.Inputs {
-		if err := psbt.Finalize(p, i); err != nil {
-			return logical.ErrorResponse("failed to finalize input %d: %s", i, err.Error()), nil
-		}
+	// A channel funding PSBT is finalized with the transaction signed when
+	// the funding was created
+	funding, err := findChannelFunding(ctx, req.Storage, w, p.UnsignedTx.TxHash().String())
+	if err != nil {
+		return nil, err
 	}
 
-	// Extract final transaction
-	finalTx, err := psbt.Extract(p)
-	if err != nil {
-		return logical.ErrorResponse("failed to extract transaction: %s", err.Error()), nil
+	var finalTx *wire.MsgTx
+	if funding != nil {
+		finalTx, err = funding.signedTx()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Finalize all inputs
+		for i := range p.Inputs {
+			if err := psbt.Finalize(p, i); err != nil {
+				return logical.ErrorResponse("failed to finalize input %d: %s", i, err.Error()), nil
+			}
+		}
+
+		// Extract final transaction
+		finalTx, err = psbt.Extract(p)
+		if err != nil {
+			return logical.ErrorResponse("failed to extract transaction: %s", err.Error()), nil
+		}
 	}
 
 	// Serialize transaction
@@ -570,26 +618,39 @@ func (b *btcBackend) pathWalletPSBTFinalize(ctx context.Context, req *logical.Re
 		"txid": txid,
 		"hex":  txHex,
 	}
+	if funding != nil {
+		respData["channel_funding"] = true
+		respData["output_index"] = funding.OutputIndex
+	}
+
+	// A channel funding whose broadcast failed stays pending with its inputs
+	// locked, so its signed transaction is withheld until it goes out
+	broadcastFailed := func(message string) *logical.Response {
+		respData["broadcast"] = false
+		respData["error"] = message
+		resp := &logical.Response{Data: respData}
+		if funding != nil {
+			delete(respData, "hex")
+			resp.AddWarning("The channel funding is still pending and its inputs stay locked. Finalize it again to retry the broadcast, or cancel it.")
+		}
+		return resp
+	}
 
 	if broadcast {
-		client, err := b.getClient(ctx, req.Storage)
+		client, err := b.getClient(ctx, req.Storage, network)
 		if err != nil {
 			b.Logger().Warn("PSBT finalize: failed to connect for broadcast", "wallet", name, "error", err)
-			respData["broadcast"] = false
-			respData["error"] = fmt.Sprintf("failed to connect: %s", err.Error())
-			return &logical.Response{Data: respData}, nil
+			return broadcastFailed(fmt.Sprintf("failed to connect: %s", err.Error())), nil
 		}
 
-		broadcastTxid, err := client.BroadcastTransaction(txHex)
+		broadcastTxid, err := client.BroadcastTransaction(ctx, txHex)
 		if err != nil {
 			b.Logger().Warn("PSBT finalize: broadcast failed", "wallet", name, "txid", txid, "error", err)
-			respData["broadcast"] = false
-			respData["error"] = err.Error()
-			return &logical.Response{Data: respData}, nil
+			return broadcastFailed(err.Error()), nil
 		}
 
 		// Invalidate cache after successful broadcast - UTXOs have changed
-		b.cache.InvalidateWallet(name)
+		b.invalidateWalletCache(ctx, req.Storage, name)
 
 		b.Logger().Info("PSBT finalize: transaction broadcast", "wallet", name, "txid", broadcastTxid)
 		respData["broadcast"] = true
@@ -599,6 +660,14 @@ func (b *btcBackend) pathWalletPSBTFinalize(ctx context.Context, req *logical.Re
 		respData["broadcast"] = false
 	}
 
+	// The signed funding transaction is out, so its inputs count as spent
+	if funding != nil {
+		if err := completeChannelFunding(ctx, req.Storage, name, funding); err != nil {
+			return nil, err
+		}
+		b.Logger().Info("channel funding finalized", "wallet", name, "account", funding.Account, "txid", txid)
+	}
+
 	return &logical.Response{Data: respData}, nil
 }
 
@@ -619,7 +688,7 @@ single-sig and multi-sig (P2WSH) inputs, making it suitable for:
   - Multi-sig setups where Vault holds one of the signing keys
 
 Signing Strategies (tried in order):
-  1. Direct address match - for single-sig P2WPKH/P2TR inputs
+  1. Direct address match - for single-sig P2WPKH, P2SH-P2WPKH and P2TR inputs
   2. BIP32 derivation matching - uses derivation paths in PSBT to find our key
   3. Witness script scanning - for multi-sig, scans the script for our pubkeys
 
@@ -649,6 +718,8 @@ Response:
 
 Only inputs where this wallet can provide a signature are signed. Other inputs
 are left unchanged, allowing the PSBT to be passed to additional signers.
+Inputs must carry a witness UTXO, so legacy P2PKH inputs are not signed; use
+the send endpoint to sweep p2pkh wallets.
 `
 
 const pathPSBTFinalizeHelpSynopsis = `
@@ -669,4 +740,10 @@ Parameters:
 
 Returns the final transaction hex and txid. If broadcast=true, also broadcasts
 the transaction to the network.
+
+A PSBT of a pending channel funding (see channel-funding) is finalized with
+the signatures Vault withheld when the funding was created. Its inputs are
+unlocked and marked spent once the transaction is returned or broadcast; a
+failed broadcast keeps them locked and withholds the transaction hex, so the
+request can be retried or the funding cancelled.
 `
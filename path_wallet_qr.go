@@ -13,7 +13,7 @@ import (
 func pathWalletQR(b *btcBackend) []*framework.Path {
 	return []*framework.Path{
 		{
-			Pattern: "wallets/" + framework.GenericNameRegex("name") + "/qr",
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + accountPathRegex + "/qr",
 			DisplayAttrs: &framework.DisplayAttributes{
 				OperationPrefix: "btc",
 			},
@@ -23,6 +23,11 @@ func pathWalletQR(b *btcBackend) []*framework.Path {
 					Description: "Name of the wallet",
 					Required:    true,
 				},
+				"account": accountField(),
+				"address_type": {
+					Type:        framework.TypeString,
+					Description: "Type of the receive address: p2tr, p2wpkh, p2sh-p2wpkh or p2pkh (default: wallet address_type)",
+				},
 				"size": {
 					Type:        framework.TypeInt,
 					Description: "QR code size in pixels (default: 256)",
@@ -68,14 +73,29 @@ func (b *btcBackend) pathWalletQRRead(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse("wallet %q not found", name), nil
 	}
 
-	// Get Electrum client to find unused address
-	client, err := b.getClient(ctx, req.Storage)
+	account, _, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	addressType, err := requestAddressType(w, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get chain backend to find unused address
+	client, err := b.getClient(ctx, req.Storage, network)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Electrum server: %w", err)
+		return nil, fmt.Errorf("failed to connect to chain backend: %w", err)
 	}
 
 	// Get stored addresses
-	addresses, err := getStoredAddresses(ctx, req.Storage, name)
+	addresses, err := getStoredAddresses(ctx, req.Storage, name, account)
 	if err != nil {
 		return nil, err
 	}
@@ -86,17 +106,17 @@ func (b *btcBackend) pathWalletQRRead(ctx context.Context, req *logical.Request,
 	// Find unused address (must already exist - reads don't generate new addresses)
 	var receiveAddress string
 	for _, addr := range addresses {
-		if addr.Spent {
+		if addr.Spent || addr.Change || addr.AddressType != addressType {
 			continue
 		}
-		history, err := client.GetHistory(addr.ScriptHash)
+		history, err := client.GetHistory(ctx, addr.Address)
 		if err != nil {
 			// Try reconnect if needed
 			if !reconnectAttempted && b.handleClientError(err) {
 				reconnectAttempted = true
-				if newClient, reconErr := b.getClient(ctx, req.Storage); reconErr == nil {
+				if newClient, reconErr := b.getClient(ctx, req.Storage, network); reconErr == nil {
 					client = newClient
-					history, err = client.GetHistory(addr.ScriptHash)
+					history, err = client.GetHistory(ctx, addr.Address)
 				}
 			}
 		}
@@ -108,7 +128,7 @@ func (b *btcBackend) pathWalletQRRead(ctx context.Context, req *logical.Request,
 
 	// Return error if no unused address available
 	if receiveAddress == "" {
-		return logical.ErrorResponse("no unused address available - generate one with: vault write btc/wallets/%s/addresses", name), nil
+		return logical.ErrorResponse("no unused %s address available - generate one with: vault write %s/addresses address_type=%s", addressType, walletAccountPath(name, account), addressType), nil
 	}
 
 	// Generate BIP21 URI
@@ -126,7 +146,7 @@ func (b *btcBackend) pathWalletQRRead(ctx context.Context, req *logical.Request,
 			return nil, fmt.Errorf("failed to generate QR code: %w", err)
 		}
 		respData["qr"] = qr.ToSmallString(false)
-		respData["display_hint"] = "vault read -field=qr btc/wallets/" + name + "/qr format=ascii"
+		respData["display_hint"] = "vault read -field=qr " + walletAccountPath(name, account) + "/qr format=ascii"
 	} else {
 		// Generate PNG as base64
 		png, err := qrcode.Encode(uri, qrcode.Medium, size)
@@ -0,0 +1,357 @@
+package btc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/djschnei21/vault-plugin-btc/wallet"
+)
+
+func pathWalletReserves(b *btcBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + accountPathRegex + "/proof-of-reserves",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the wallet",
+					Required:    true,
+				},
+				"account": accountField(),
+				"message": {
+					Type:        framework.TypeString,
+					Description: "Challenge message supplied by the auditor",
+					Required:    true,
+				},
+				"min_confirmations": {
+					Type:        framework.TypeInt,
+					Description: "Minimum confirmations for UTXOs (default: from config)",
+					Default:     -1,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathWalletProofOfReserves,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "proof-of-reserves",
+					},
+				},
+			},
+			HelpSynopsis:    pathWalletProofOfReservesHelpSynopsis,
+			HelpDescription: pathWalletProofOfReservesHelpDescription,
+		},
+		{
+			Pattern: "proof-of-reserves/verify",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"psbt": {
+					Type:        framework.TypeString,
+					Description: "Base64-encoded proof of reserves PSBT",
+					Required:    true,
+				},
+				"message": {
+					Type:        framework.TypeString,
+					Description: "Challenge message the proof must commit to",
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathVerifyProofOfReserves,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "proof-of-reserves-verify",
+					},
+				},
+			},
+			HelpSynopsis:    pathVerifyProofOfReservesHelpSynopsis,
+			HelpDescription: pathVerifyProofOfReservesHelpDescription,
+		},
+	}
+}
+
+func (b *btcBackend) pathWalletProofOfReserves(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	message := data.Get("message").(string)
+	minConfirmations := data.Get("min_confirmations").(int)
+
+	if message == "" {
+		return logical.ErrorResponse("message is required"), nil
+	}
+
+	w, err := getWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return logical.ErrorResponse("wallet %q not found", name), nil
+	}
+
+	account, _, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
+	if minConfirmations < 0 {
+		minConfirmations, err = getMinConfirmations(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	utxoInfos, err := b.getUTXOsForWallet(ctx, req.Storage, name, account, minConfirmations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UTXOs: %w", err)
+	}
+	if len(utxoInfos) == 0 {
+		return logical.ErrorResponse("no UTXOs to prove"), nil
+	}
+
+	utxos := make([]wallet.UTXO, 0, len(utxoInfos))
+	utxoList := make([]map[string]interface{}, 0, len(utxoInfos))
+	for _, info := range utxoInfos {
+		scriptPubKey, err := wallet.GetScriptPubKey(info.Address, network)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get scriptPubKey of %s: %w", info.Address, err)
+		}
+		utxos = append(utxos, wallet.UTXO{
+			TxID:         info.TxID,
+			Vout:         info.Vout,
+			Value:        info.Value,
+			Address:      info.Address,
+			AddressIndex: info.AddressIndex,
+			Account:      account,
+			Change:       info.chain(),
+			ScriptPubKey: scriptPubKey,
+			AddressType:  info.AddressType,
+
+			SilentPaymentTweak: info.silentPaymentTweak(),
+		})
+		utxoList = append(utxoList, map[string]interface{}{
+			"txid":          info.TxID,
+			"vout":          info.Vout,
+			"value":         info.Value,
+			"address":       info.Address,
+			"confirmations": info.Confirmations,
+		})
+	}
+
+	seed, err := walletSeed(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := wallet.BuildProofOfReserves(seed, network, utxos, message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build proof of reserves: %w", err)
+	}
+
+	proof, err := proofOfReservesPSBT(tx, utxos)
+	if err != nil {
+		return nil, err
+	}
+
+	total := tx.TxOut[0].Value
+	commitment := wallet.ProofOfReservesCommitment(message)
+
+	b.Logger().Info("proof of reserves created", "wallet", name, "account", account, "utxos", len(utxos), "total", total)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"psbt":              proof,
+			"message":           message,
+			"commitment":        commitment.String(),
+			"network":           network,
+			"account":           account,
+			"total":             total,
+			"utxo_count":        len(utxos),
+			"utxos":             utxoList,
+			"min_confirmations": minConfirmations,
+		},
+	}, nil
+}
+
+// proofOfReservesPSBT packages a signed proof as a finalized BIP127 PSBT.
+// Every input carries the output it spends so the proof can be checked
+// without the previous transactions.
+func proofOfReservesPSBT(tx *wire.MsgTx, utxos []wallet.UTXO) (string, error) {
+	unsigned := tx.Copy()
+	for _, in := range unsigned.TxIn {
+		in.SignatureScript = nil
+		in.Witness = nil
+	}
+
+	p, err := psbt.NewFromUnsignedTx(unsigned)
+	if err != nil {
+		return "", fmt.Errorf("failed to create PSBT: %w", err)
+	}
+
+	p.Inputs[0].WitnessUtxo = wallet.ProofOfReservesCommitmentOutput()
+	for i, utxo := range utxos {
+		in := &p.Inputs[i+1]
+		in.WitnessUtxo = wire.NewTxOut(utxo.Value, utxo.ScriptPubKey)
+		if len(tx.TxIn[i+1].SignatureScript) > 0 {
+			in.FinalScriptSig = tx.TxIn[i+1].SignatureScript
+		}
+		if len(tx.TxIn[i+1].Witness) > 0 {
+			var buf bytes.Buffer
+			if err := psbt.WriteTxWitness(&buf, tx.TxIn[i+1].Witness); err != nil {
+				return "", fmt.Errorf("failed to serialize witness: %w", err)
+			}
+			in.FinalScriptWitness = buf.Bytes()
+		}
+	}
+
+	return p.B64Encode()
+}
+
+func (b *btcBackend) pathVerifyProofOfReserves(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	psbtBase64 := data.Get("psbt").(string)
+	message := data.Get("message").(string)
+
+	psbtBytes, err := base64.StdEncoding.DecodeString(psbtBase64)
+	if err != nil {
+		return logical.ErrorResponse("invalid base64 PSBT: %s", err.Error()), nil
+	}
+	p, err := psbt.NewFromRawBytes(bytes.NewReader(psbtBytes), false)
+	if err != nil {
+		return logical.ErrorResponse("invalid PSBT: %s", err.Error()), nil
+	}
+
+	network, err := getNetwork(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	params, err := wallet.NetworkParams(network)
+	if err != nil {
+		return nil, err
+	}
+
+	respData := map[string]interface{}{
+		"message": message,
+		"network": network,
+	}
+	invalid := func(reason string) (*logical.Response, error) {
+		respData["valid"] = false
+		respData["error"] = reason
+		return &logical.Response{Data: respData}, nil
+	}
+
+	// The commitment input is never signed; an empty final scriptSig lets
+	// the transaction be extracted
+	if len(p.Inputs) > 0 && p.Inputs[0].FinalScriptSig == nil && p.Inputs[0].FinalScriptWitness == nil {
+		p.Inputs[0].FinalScriptSig = []byte{}
+	}
+	tx, err := psbt.Extract(p)
+	if err != nil {
+		return invalid(fmt.Sprintf("proof is not fully signed: %s", err.Error()))
+	}
+
+	prevOuts := make([]*wire.TxOut, len(p.Inputs))
+	for i, in := range p.Inputs {
+		prevOuts[i] = in.WitnessUtxo
+	}
+
+	total, err := wallet.VerifyProofOfReserves(tx, prevOuts, message)
+	if err != nil {
+		return invalid(err.Error())
+	}
+
+	// A valid signature only proves the outputs existed; each must also be
+	// unspent on chain now
+	client, err := b.getClient(ctx, req.Storage, network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to chain backend: %w", err)
+	}
+
+	var unspentTotal int64
+	var spent []string
+	for i := 1; i < len(tx.TxIn); i++ {
+		outPoint := tx.TxIn[i].PreviousOutPoint
+		_, addrs, _, err := txscript.ExtractPkScriptAddrs(prevOuts[i].PkScript, params)
+		if err != nil || len(addrs) != 1 {
+			return invalid(fmt.Sprintf("input %d spends a script without a %s address", i, network))
+		}
+
+		unspent, err := client.ListUnspent(ctx, addrs[0].EncodeAddress())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list unspent outputs of %s: %w", addrs[0].EncodeAddress(), err)
+		}
+		found := false
+		for _, u := range unspent {
+			if u.TxHash == outPoint.Hash.String() && uint32(u.TxPos) == outPoint.Index && u.Value == prevOuts[i].Value {
+				found = true
+				break
+			}
+		}
+		if found {
+			unspentTotal += prevOuts[i].Value
+		} else {
+			spent = append(spent, outPoint.String())
+		}
+	}
+
+	respData["total"] = total
+	respData["unspent_total"] = unspentTotal
+	respData["utxo_count"] = len(tx.TxIn) - 1
+	if len(spent) > 0 {
+		respData["spent"] = spent
+		return invalid(fmt.Sprintf("%d of %d outputs are spent or unknown", len(spent), len(tx.TxIn)-1))
+	}
+
+	respData["valid"] = true
+	return &logical.Response{Data: respData}, nil
+}
+
+const pathWalletProofOfReservesHelpSynopsis = `
+Prove the holdings of a wallet account to an auditor.
+`
+
+const pathWalletProofOfReservesHelpDescription = `
+Builds a BIP127 proof of reserves: a PSBT spending every current UTXO of the
+account, plus a first input committing to the auditor's challenge message.
+That input spends an output that does not exist, so the proof is signed but
+can never be broadcast, and no funds move.
+
+The response contains the finalized PSBT, the total proven, and the UTXOs
+included. Auditors can check the proof with btc/proof-of-reserves/verify or
+any BIP127 verifier.
+
+Example:
+  $ vault write btc/wallets/treasury/proof-of-reserves \
+      message="Audit 2026-Q3, nonce 8f1c..."
+`
+
+const pathVerifyProofOfReservesHelpSynopsis = `
+Verify a proof of reserves.
+`
+
+const pathVerifyProofOfReservesHelpDescription = `
+Checks a BIP127 proof of reserves PSBT against a challenge message: the proof
+must commit to the message, every input must be validly signed, and every
+spent output must still be unspent on the mount's configured network.
+
+The response reports valid=true with the total proven, or valid=false with
+the reason, including the outputs that have since been spent.
+
+Example:
+  $ vault write btc/proof-of-reserves/verify \
+      psbt=cHNidP8B... message="Audit 2026-Q3, nonce 8f1c..."
+`
@@ -13,7 +13,7 @@ import (
 func pathWalletScan(b *btcBackend) []*framework.Path {
 	return []*framework.Path{
 		{
-			Pattern: "wallets/" + framework.GenericNameRegex("name") + "/scan",
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + accountPathRegex + "/scan",
 			DisplayAttrs: &framework.DisplayAttributes{
 				OperationPrefix: "btc",
 			},
@@ -23,6 +23,7 @@ func pathWalletScan(b *btcBackend) []*framework.Path {
 					Description: "Name of the wallet",
 					Required:    true,
 				},
+				"account": accountField(),
 				"retired": {
 					Type:        framework.TypeBool,
 					Description: "Scan retired addresses below FirstActiveIndex (default: true)",
@@ -43,6 +44,10 @@ func pathWalletScan(b *btcBackend) []*framework.Path {
 					Description: "Fee rate in satoshis per vbyte for sweep transaction (default: 10)",
 					Default:     10,
 				},
+				"address_type": {
+					Type:        framework.TypeString,
+					Description: "Address type to scan and sweep to: p2tr, p2wpkh, p2sh-p2wpkh or p2pkh (default: wallet address_type)",
+				},
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ReadOperation: &framework.PathOperation{
@@ -104,14 +109,24 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 		return logical.ErrorResponse("wallet %q not found", name), nil
 	}
 
-	network, err := getNetwork(ctx, req.Storage)
+	account, acct, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	scanType, err := requestAddressType(w, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := b.getClient(ctx, req.Storage)
+	client, err := b.getClient(ctx, req.Storage, network)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Electrum server: %w", err)
+		return nil, fmt.Errorf("failed to connect to chain backend: %w", err)
 	}
 
 	respData := map[string]interface{}{}
@@ -124,25 +139,30 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 	var retiredTotal int64
 	var utxosForSweep []wallet.UTXO
 
-	if scanRetired && w.FirstActiveIndex > 0 {
-		b.Logger().Debug("scanning retired addresses", "count", w.FirstActiveIndex)
+	if scanRetired && acct.FirstActiveIndex > 0 {
+		b.Logger().Debug("scanning retired addresses", "count", acct.FirstActiveIndex)
 
-		for idx := uint32(0); idx < w.FirstActiveIndex; idx++ {
-			addrInfo, err := wallet.GenerateAddressInfoForType(w.Seed, network, idx, w.AddressType)
+		for idx := uint32(0); idx < acct.FirstActiveIndex; idx++ {
+			// Stop early if the Vault request was cancelled
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			addrInfo, err := walletAddressInfo(ctx, req.Storage, w, network, account, 0, idx, scanType)
 			if err != nil {
 				b.Logger().Warn("failed to regenerate address", "index", idx, "error", err)
 				continue
 			}
 
-			balanceResp, err := client.GetBalance(addrInfo.ScriptHash)
+			balanceResp, err := client.GetBalance(ctx, addrInfo.Address)
 			if err != nil {
 				b.Logger().Warn("failed to get balance", "address", addrInfo.Address, "error", err)
 				// Try reconnect if needed
 				if !reconnectAttempted && b.handleClientError(err) {
 					reconnectAttempted = true
-					if newClient, reconErr := b.getClient(ctx, req.Storage); reconErr == nil {
+					if newClient, reconErr := b.getClient(ctx, req.Storage, network); reconErr == nil {
 						client = newClient
-						balanceResp, err = client.GetBalance(addrInfo.ScriptHash)
+						balanceResp, err = client.GetBalance(ctx, addrInfo.Address)
 					}
 				}
 				if err != nil {
@@ -166,7 +186,7 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 				retiredTotal += total
 
 				if sweep {
-					utxoResp, err := client.ListUnspent(addrInfo.ScriptHash)
+					utxoResp, err := client.ListUnspent(ctx, addrInfo.Address)
 					if err != nil {
 						b.Logger().Warn("failed to list unspent", "address", addrInfo.Address, "error", err)
 						continue
@@ -185,15 +205,16 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 							Value:        u.Value,
 							Address:      addrInfo.Address,
 							AddressIndex: idx,
+							Account:      account,
 							ScriptPubKey: scriptPubKey,
-							AddressType:  w.AddressType,
+							AddressType:  scanType,
 						})
 					}
 				}
 			}
 		}
 
-		respData["retired_scanned"] = w.FirstActiveIndex
+		respData["retired_scanned"] = acct.FirstActiveIndex
 		respData["retired_found"] = retiredFound
 		respData["retired_total"] = retiredTotal
 	}
@@ -205,26 +226,48 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 	var highestFoundIndex uint32
 
 	if gapDepth > 0 {
-		startIdx := w.NextAddressIndex
+		startIdx := acct.NextAddressIndex
 		endIdx := startIdx + uint32(gapDepth)
 		b.Logger().Debug("scanning gap addresses", "start", startIdx, "end", endIdx)
 
+		gapInfos := make(map[uint32]*wallet.AddressInfo, gapDepth)
+		gapAddresses := make([]string, 0, gapDepth)
 		for idx := startIdx; idx < endIdx; idx++ {
-			addrInfo, err := wallet.GenerateAddressInfoForType(w.Seed, network, idx, w.AddressType)
+			addrInfo, err := walletAddressInfo(ctx, req.Storage, w, network, account, 0, idx, scanType)
 			if err != nil {
 				b.Logger().Warn("failed to generate address", "index", idx, "error", err)
 				continue
 			}
+			gapInfos[idx] = addrInfo
+			gapAddresses = append(gapAddresses, addrInfo.Address)
+		}
 
-			balanceResp, err := client.GetBalance(addrInfo.ScriptHash)
+		// Gap addresses were never looked up, so a backend that tracks
+		// registered addresses must look back for their history first
+		if err := watchWalletAddresses(ctx, client, w, gapAddresses); err != nil {
+			return logical.ErrorResponse("failed to register gap addresses with the chain backend: %s", err.Error()), nil
+		}
+
+		for idx := startIdx; idx < endIdx; idx++ {
+			// Stop early if the Vault request was cancelled
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			addrInfo := gapInfos[idx]
+			if addrInfo == nil {
+				continue
+			}
+
+			balanceResp, err := client.GetBalance(ctx, addrInfo.Address)
 			if err != nil {
 				b.Logger().Warn("failed to get balance", "address", addrInfo.Address, "error", err)
 				// Try reconnect if needed
 				if !reconnectAttempted && b.handleClientError(err) {
 					reconnectAttempted = true
-					if newClient, reconErr := b.getClient(ctx, req.Storage); reconErr == nil {
+					if newClient, reconErr := b.getClient(ctx, req.Storage, network); reconErr == nil {
 						client = newClient
-						balanceResp, err = client.GetBalance(addrInfo.ScriptHash)
+						balanceResp, err = client.GetBalance(ctx, addrInfo.Address)
 					}
 				}
 				if err != nil {
@@ -256,18 +299,13 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 				stored := &storedAddress{
 					Address:        addrInfo.Address,
 					Index:          addrInfo.Index,
+					Account:        account,
 					DerivationPath: addrInfo.DerivationPath,
 					ScriptHash:     addrInfo.ScriptHash,
+					AddressType:    addrInfo.AddressType,
 				}
 
-				storageKey := fmt.Sprintf("%s%s/%d", addressStoragePrefix, name, idx)
-				entry, err := logical.StorageEntryJSON(storageKey, stored)
-				if err != nil {
-					b.Logger().Warn("failed to create storage entry", "index", idx, "error", err)
-					continue
-				}
-
-				if err := req.Storage.Put(ctx, entry); err != nil {
+				if err := storeAddress(ctx, req.Storage, name, stored); err != nil {
 					b.Logger().Warn("failed to store address", "index", idx, "error", err)
 					continue
 				}
@@ -281,13 +319,13 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 
 		// Update NextAddressIndex if we found addresses beyond current
 		// Also fill in any gaps to maintain contiguous address storage
-		if len(gapFound) > 0 && highestFoundIndex >= w.NextAddressIndex {
+		if len(gapFound) > 0 && highestFoundIndex >= acct.NextAddressIndex {
 			newNextIndex := highestFoundIndex + 1
-			b.Logger().Info("updating NextAddressIndex", "old", w.NextAddressIndex, "new", newNextIndex)
+			b.Logger().Info("updating NextAddressIndex", "old", acct.NextAddressIndex, "new", newNextIndex)
 
 			// Fill in ALL addresses from old NextAddressIndex to new one (not just those with funds)
 			// This maintains contiguous address storage and ensures proper address tracking
-			for fillIdx := w.NextAddressIndex; fillIdx < newNextIndex; fillIdx++ {
+			for fillIdx := acct.NextAddressIndex; fillIdx < newNextIndex; fillIdx++ {
 				// Check if this address was already registered (has funds)
 				alreadyRegistered := false
 				for _, reg := range gapRegistered {
@@ -301,7 +339,7 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 				}
 
 				// Generate and store this address to fill the gap
-				addrInfo, err := wallet.GenerateAddressInfoForType(w.Seed, network, fillIdx, w.AddressType)
+				addrInfo, err := walletAddressInfo(ctx, req.Storage, w, network, account, 0, fillIdx, scanType)
 				if err != nil {
 					b.Logger().Warn("failed to generate gap-fill address", "index", fillIdx, "error", err)
 					continue
@@ -310,18 +348,13 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 				stored := &storedAddress{
 					Address:        addrInfo.Address,
 					Index:          addrInfo.Index,
+					Account:        account,
 					DerivationPath: addrInfo.DerivationPath,
 					ScriptHash:     addrInfo.ScriptHash,
+					AddressType:    addrInfo.AddressType,
 				}
 
-				storageKey := fmt.Sprintf("%s%s/%d", addressStoragePrefix, name, fillIdx)
-				entry, err := logical.StorageEntryJSON(storageKey, stored)
-				if err != nil {
-					b.Logger().Warn("failed to create gap-fill storage entry", "index", fillIdx, "error", err)
-					continue
-				}
-
-				if err := req.Storage.Put(ctx, entry); err != nil {
+				if err := storeAddress(ctx, req.Storage, name, stored); err != nil {
 					b.Logger().Warn("failed to store gap-fill address", "index", fillIdx, "error", err)
 					continue
 				}
@@ -329,7 +362,7 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 				b.Logger().Debug("filled gap address", "index", fillIdx, "address", addrInfo.Address)
 			}
 
-			w.NextAddressIndex = newNextIndex
+			acct.NextAddressIndex = newNextIndex
 			if err := saveWallet(ctx, req.Storage, w); err != nil {
 				return nil, fmt.Errorf("failed to update wallet: %w", err)
 			}
@@ -340,7 +373,7 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 		respData["gap_total"] = gapTotal
 		if len(gapRegistered) > 0 {
 			respData["gap_registered"] = gapRegistered
-			respData["new_next_index"] = w.NextAddressIndex
+			respData["new_next_index"] = acct.NextAddressIndex
 		}
 	}
 
@@ -352,7 +385,17 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 		for _, utxo := range utxosForSweep {
 			sweepTotal += utxo.Value
 		}
-		estimatedSweepFee := wallet.EstimateFeeForUTXOs(utxosForSweep, 1, feeRate, w.AddressType)
+		// Generate destination address
+		destInfo, err := walletAddressInfo(ctx, req.Storage, w, network, account, 0, acct.NextAddressIndex, scanType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate destination address: %w", err)
+		}
+		destAddr := destInfo.Address
+
+		estimatedSweepFee, _, err := wallet.EstimateFee(utxosForSweep, []string{destAddr}, network, wallet.Fee{Rate: wallet.SatPerVByte(feeRate)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate sweep fee: %w", err)
+		}
 		sweepOutput := sweepTotal - estimatedSweepFee
 
 		if sweepOutput <= 0 {
@@ -364,14 +407,8 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 				sweepOutput, wallet.DustLimit, estimatedSweepFee), nil
 		}
 
-		// Generate destination address
-		destAddr, err := wallet.GenerateAddressFromSeedForType(w.Seed, network, w.NextAddressIndex, w.AddressType)
-		if err != nil {
-			return nil, fmt.Errorf("failed to generate destination address: %w", err)
-		}
-
 		// Store destination address
-		addrInfo, err := wallet.GenerateAddressInfoForType(w.Seed, network, w.NextAddressIndex, w.AddressType)
+		addrInfo, err := walletAddressInfo(ctx, req.Storage, w, network, account, 0, acct.NextAddressIndex, scanType)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate address info: %w", err)
 		}
@@ -379,46 +416,53 @@ func (b *btcBackend) pathWalletScan(ctx context.Context, req *logical.Request, d
 		stored := &storedAddress{
 			Address:        addrInfo.Address,
 			Index:          addrInfo.Index,
+			Account:        account,
 			DerivationPath: addrInfo.DerivationPath,
 			ScriptHash:     addrInfo.ScriptHash,
+			AddressType:    addrInfo.AddressType,
 		}
 
-		storageKey := fmt.Sprintf("%s%s/%d", addressStoragePrefix, name, w.NextAddressIndex)
-		entry, err := logical.StorageEntryJSON(storageKey, stored)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create storage entry: %w", err)
-		}
-
-		if err := req.Storage.Put(ctx, entry); err != nil {
-			return nil, fmt.Errorf("failed to store address: %w", err)
+		if err := storeAddress(ctx, req.Storage, name, stored); err != nil {
+			return nil, err
 		}
 
-		w.NextAddressIndex++
+		acct.NextAddressIndex++
 		if err := saveWallet(ctx, req.Storage, w); err != nil {
 			return nil, fmt.Errorf("failed to update wallet: %w", err)
 		}
 
+		seed, err := walletSeed(ctx, req.Storage, w)
+		if err != nil {
+			return nil, err
+		}
+
+		lockTime, err := b.antiFeeSnipingLockTime(ctx, req.Storage, name, network, utxosForSweep)
+		if err != nil {
+			return nil, err
+		}
+
 		// Build sweep transaction
-		txResult, err := wallet.BuildConsolidationTransaction(
-			w.Seed,
+		txResult, err := wallet.BuildConsolidationTransactionWithLockTime(
+			seed,
 			network,
 			utxosForSweep,
 			destAddr,
 			feeRate,
+			lockTime,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to build sweep transaction: %w", err)
 		}
 
 		// Broadcast
-		txid, err := client.BroadcastTransaction(txResult.Hex)
+		txid, err := client.BroadcastTransaction(ctx, txResult.Hex)
 		if err != nil {
 			b.Logger().Warn("sweep broadcast failed", "wallet", name, "error", err)
 			respData["sweep_error"] = err.Error()
 			respData["sweep_hex"] = txResult.Hex
 			respData["sweep_broadcast"] = false
 		} else {
-			b.cache.InvalidateWallet(name)
+			b.invalidateWalletCache(ctx, req.Storage, name)
 			b.Logger().Info("sweep broadcast successful",
 				"wallet", name, "txid", txid,
 				"swept_addresses", len(retiredFound),
@@ -513,6 +557,9 @@ Parameters:
   - gap: Scan N addresses beyond NextAddressIndex (default: 0)
   - sweep: Consolidate found retired funds to a fresh address (default: false)
   - fee_rate: Fee rate for sweep transaction in sat/vbyte (default: 10)
+  - address_type: Address type to derive when scanning, and of the sweep
+                  output (default: wallet address_type). Wallets that hold
+                  both p2wpkh and p2tr addresses should scan each type.
 
 Response:
   - retired_scanned: Number of retired addresses scanned
@@ -2,7 +2,12 @@ package btc
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -13,7 +18,7 @@ import (
 func pathWalletSend(b *btcBackend) []*framework.Path {
 	return []*framework.Path{
 		{
-			Pattern: "wallets/" + framework.GenericNameRegex("name") + "/send",
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + accountPathRegex + "/send",
 			DisplayAttrs: &framework.DisplayAttributes{
 				OperationPrefix: "btc",
 			},
@@ -23,20 +28,18 @@ func pathWalletSend(b *btcBackend) []*framework.Path {
 					Description: "Name of the wallet",
 					Required:    true,
 				},
+				"account": accountField(),
 				"to": {
 					Type:        framework.TypeString,
-					Description: "Destination Bitcoin address",
+					Description: "Destination Bitcoin address, or a silent payment (sp1...) address",
 					Required:    true,
 				},
 				"amount": {
 					Type:        framework.TypeInt,
 					Description: "Amount to send in satoshis (ignored if max_send=true)",
 				},
-				"fee_rate": {
-					Type:        framework.TypeInt,
-					Description: "Fee rate in satoshis per vbyte (default: 10)",
-					Default:     10,
-				},
+				"fee_rate": feeRateField(),
+				"fee":      feeField(),
 				"min_confirmations": {
 					Type:        framework.TypeInt,
 					Description: "Minimum confirmations for UTXOs (default: from config)",
@@ -52,6 +55,22 @@ func pathWalletSend(b *btcBackend) []*framework.Path {
 					Description: "Send all available funds minus fee (default: false)",
 					Default:     false,
 				},
+				"change_policy": {
+					Type:        framework.TypeString,
+					Description: "Override the wallet's change_policy: default, match_destination, or match_inputs",
+				},
+				"locktime": {
+					Type:        framework.TypeInt,
+					Description: "Block height, or Unix timestamp from 500000000 on, before which the transaction cannot be mined (default: current height with anti_fee_sniping, else 0)",
+				},
+				"op_return": {
+					Type:        framework.TypeString,
+					Description: "Hex-encoded data of up to 80 bytes to embed in a zero-value OP_RETURN output",
+				},
+				"sequences": {
+					Type:        framework.TypeKVPairs,
+					Description: "Input sequences as txid:vout=nSequence, e.g. BIP68 relative timelocks; listed UTXOs are always spent",
+				},
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.UpdateOperation: &framework.PathOperation{
@@ -82,12 +101,28 @@ func (b *btcBackend) pathWalletSend(ctx context.Context, req *logical.Request, d
 	name := data.Get("name").(string)
 	toAddress := data.Get("to").(string)
 	amount := int64(data.Get("amount").(int))
-	feeRate := int64(data.Get("fee_rate").(int))
 	minConfOverride := data.Get("min_confirmations").(int)
 	dryRun := data.Get("dry_run").(bool)
 	maxSend := data.Get("max_send").(bool)
+	changePolicy := data.Get("change_policy").(string)
+	rawLockTime := data.Get("locktime").(int)
+
+	b.Logger().Debug("send request", "wallet", name, "to", toAddress, "amount", amount, "fee_rate", data.Get("fee_rate"), "fee", data.Get("fee"), "dry_run", dryRun, "max_send", maxSend, "locktime", rawLockTime)
+
+	if rawLockTime < 0 || rawLockTime > math.MaxUint32 {
+		return logical.ErrorResponse("locktime must be between 0 and %d", uint32(math.MaxUint32)), nil
+	}
+	lockTime := uint32(rawLockTime)
+
+	sequences, err := parseInputSequences(data.Get("sequences").(map[string]string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
 
-	b.Logger().Debug("send request", "wallet", name, "to", toAddress, "amount", amount, "fee_rate", feeRate, "dry_run", dryRun, "max_send", maxSend)
+	opReturn, err := parseOpReturn(data.Get("op_return").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
 
 	// Validate inputs
 	if !maxSend {
@@ -99,15 +134,19 @@ func (b *btcBackend) pathWalletSend(ctx context.Context, req *logical.Request, d
 		}
 	}
 
-	if feeRate <= 0 {
-		return logical.ErrorResponse("fee_rate must be positive"), nil
+	fee, err := requestFee(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	// Safety check for unreasonably high fee rates
-	if errMsg := wallet.ValidateFeeRate(feeRate); errMsg != "" {
-		return logical.ErrorResponse(errMsg), nil
+	if changePolicy != "" && !validChangePolicy(changePolicy) {
+		return logical.ErrorResponse("invalid change_policy %q: must be %q, %q, or %q", changePolicy,
+			ChangePolicyDefault, ChangePolicyMatchDestination, ChangePolicyMatchInputs), nil
 	}
 
+	// The wallet is read under the lock so its change counter is current
+	defer b.lockWallet(name)()
+
 	w, err := getWallet(ctx, req.Storage, name)
 	if err != nil {
 		return nil, err
@@ -117,7 +156,12 @@ func (b *btcBackend) pathWalletSend(ctx context.Context, req *logical.Request, d
 		return logical.ErrorResponse("wallet %q not found", name), nil
 	}
 
-	network, err := getNetwork(ctx, req.Storage)
+	account, acct, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
 	if err != nil {
 		return nil, err
 	}
@@ -136,8 +180,22 @@ func (b *btcBackend) pathWalletSend(ctx context.Context, req *logical.Request, d
 		return logical.ErrorResponse("invalid destination address: %s", err.Error()), nil
 	}
 
+	// A silent payment goes to a Taproot output computed from the selected
+	// inputs. Until they are signed for, an output of the same size stands in.
+	payTo := toAddress
+	silentPayment := wallet.IsSilentPaymentAddress(toAddress)
+	if silentPayment {
+		payTo, err = wallet.SilentPaymentPlaceholder(toAddress, network)
+		if err != nil {
+			return logical.ErrorResponse("invalid destination address: %s", err.Error()), nil
+		}
+	}
+
+	// Detect destination address type (for fee estimation and the change policy)
+	destType, _ := wallet.GetAddressType(payTo, network)
+
 	// Get UTXOs
-	utxoInfos, err := b.getUTXOsForWallet(ctx, req.Storage, name, minConfirmations)
+	utxoInfos, err := b.getUTXOsForWallet(ctx, req.Storage, name, account, minConfirmations)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get UTXOs: %w", err)
 	}
@@ -148,6 +206,8 @@ func (b *btcBackend) pathWalletSend(ctx context.Context, req *logical.Request, d
 
 	// Convert to wallet.UTXO and calculate total available
 	utxos := make([]wallet.UTXO, 0, len(utxoInfos))
+	utxoHeights := make(map[string]int64, len(utxoInfos))
+	var requiredUTXOs []wallet.UTXO
 	var totalAvailable int64
 	for _, info := range utxoInfos {
 		scriptPubKey, err := wallet.GetScriptPubKey(info.Address, network)
@@ -155,21 +215,37 @@ func (b *btcBackend) pathWalletSend(ctx context.Context, req *logical.Request, d
 			continue
 		}
 
-		utxos = append(utxos, wallet.UTXO{
+		utxo := wallet.UTXO{
 			TxID:         info.TxID,
 			Vout:         info.Vout,
 			Value:        info.Value,
 			Address:      info.Address,
 			AddressIndex: info.AddressIndex,
+			Account:      account,
+			Change:       info.chain(),
 			ScriptPubKey: scriptPubKey,
-			AddressType:  w.AddressType,
-		})
+			AddressType:  info.AddressType,
+
+			SilentPaymentTweak: info.silentPaymentTweak(),
+		}
+		outpoint := fmt.Sprintf("%s:%d", info.TxID, info.Vout)
+		if sequence, ok := sequences[outpoint]; ok {
+			utxo.Sequence = sequence
+			requiredUTXOs = append(requiredUTXOs, utxo)
+			delete(sequences, outpoint)
+		}
+		utxoHeights[outpoint] = info.Height
+		utxos = append(utxos, utxo)
 		totalAvailable += info.Value
 	}
+	for outpoint := range sequences {
+		return logical.ErrorResponse("sequence given for %s, which is not a spendable UTXO of account %d", outpoint, account), nil
+	}
 
 	// Handle max_send: use all UTXOs, single output (no change)
 	var selectedUTXOs []wallet.UTXO
 	var changeAddr string
+	var changeType string
 	var changeAmount int64
 
 	if maxSend {
@@ -177,7 +253,10 @@ func (b *btcBackend) pathWalletSend(ctx context.Context, req *logical.Request, d
 		selectedUTXOs = utxos
 
 		// Calculate fee for single output (no change)
-		estimatedFee := wallet.EstimateFeeForUTXOs(selectedUTXOs, 1, feeRate, w.AddressType)
+		estimatedFee, _, err := wallet.EstimateFeeForOutputs(selectedUTXOs, sendOutputs(payTo, 0, opReturn), network, fee)
+		if err != nil {
+			return logical.ErrorResponse("fee estimation failed: %s", err.Error()), nil
+		}
 		amount = totalAvailable - estimatedFee
 
 		if amount <= 0 {
@@ -190,151 +269,213 @@ func (b *btcBackend) pathWalletSend(ctx context.Context, req *logical.Request, d
 		// No change output for max_send
 		changeAmount = 0
 	} else {
-		// Normal send: select UTXOs for the amount
+		// Normal send: select UTXOs for the outputs, sized with their change
+		// address of the type chosen by the change policy
+		changeAddress := func(selected []wallet.UTXO) (string, error) {
+			changeType = w.changeAddressType(changePolicy, destType, selected)
+			changeInfo, err := walletAddressInfo(ctx, req.Storage, w, network, account, 1, acct.NextAddressIndex, changeType)
+			if err != nil {
+				return "", fmt.Errorf("failed to generate change address: %w", err)
+			}
+			changeAddr = changeInfo.Address
+			return changeAddr, nil
+		}
 		var err error
-		selectedUTXOs, _, err = wallet.SelectUTXOs(utxos, amount, feeRate)
+		selectedUTXOs, _, err = wallet.SelectUTXOsForOutputs(utxos, sendOutputs(payTo, amount, opReturn), network, fee, changeAddress)
 		if err != nil {
 			return logical.ErrorResponse("UTXO selection failed: %s", err.Error()), nil
 		}
 
-		// Generate change address
-		changeAddr, err = wallet.GenerateChangeAddressFromSeedForType(w.Seed, network, w.NextAddressIndex, w.AddressType)
-		if err != nil {
-			return nil, fmt.Errorf("failed to generate change address: %w", err)
+		// Inputs given a sequence are spent even if selection skipped them
+		if len(requiredUTXOs) > 0 {
+			selectedUTXOs = includeUTXOs(selectedUTXOs, requiredUTXOs)
+			if _, err := changeAddress(selectedUTXOs); err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	// Detect destination address type
-	destOutputSize := wallet.P2WPKHOutputSize
-	if detectedType, err := wallet.GetAddressType(toAddress, network); err == nil && detectedType == "p2tr" {
-		destOutputSize = wallet.P2TROutputSize
+	if err := wallet.ValidateTimelocks(lockTime, selectedUTXOs); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	// Calculate input vsize
-	inputVSize := 0
-	for _, utxo := range selectedUTXOs {
-		if utxo.AddressType == wallet.AddressTypeP2TR {
-			inputVSize += wallet.P2TRInputSize
-		} else {
-			inputVSize += wallet.P2WPKHInputSize
+	// Work out when a timelocked transaction can be mined
+	var timelock map[string]interface{}
+	timelocked := false
+	if lockTime != 0 || hasRelativeLock(selectedUTXOs) {
+		// The cached height may be a few blocks old, which matters here
+		var currentHeight int64
+		if client, err := b.getClient(ctx, req.Storage, network); err == nil {
+			currentHeight, _ = client.GetBlockHeight(ctx)
 		}
+		if currentHeight == 0 {
+			currentHeight = b.getWalletCache(ctx, req.Storage, name).GetBlockHeight()
+		}
+		timelock, timelocked = timelockStatus(lockTime, selectedUTXOs, utxoHeights, currentHeight, time.Now())
 	}
 
-	// Calculate total vsize
-	outputVSize := destOutputSize
-	if !maxSend {
-		changeOutputSize := wallet.P2WPKHOutputSize
-		if w.AddressType == wallet.AddressTypeP2TR {
-			changeOutputSize = wallet.P2TROutputSize
+	// Work out the fee exactly as the transaction builders will, so a fee
+	// below the relay minimum is rejected before any state changes
+	outputs := sendOutputs(payTo, amount, opReturn)
+	var estimatedFee int64
+	var estimatedVSize int
+	if maxSend {
+		estimatedFee, estimatedVSize, err = wallet.EstimateFeeForOutputs(selectedUTXOs, outputs, network, fee)
+		if err != nil {
+			return logical.ErrorResponse("fee estimation failed: %s", err.Error()), nil
 		}
-		outputVSize += changeOutputSize
+	} else {
+		plan, err := wallet.PlanTransaction(selectedUTXOs, outputs, changeAddr, network, fee)
+		if err != nil {
+			return logical.ErrorResponse("fee estimation failed: %s", err.Error()), nil
+		}
+		estimatedFee, estimatedVSize, changeAmount = plan.Fee, plan.VSize, plan.ChangeAmount
 	}
-	estimatedVSize := wallet.TxOverhead + inputVSize + outputVSize
-	estimatedFee := int64(estimatedVSize) * feeRate
 
 	// For dry_run, return estimate without modifying state
 	if dryRun {
-		if !maxSend {
-			// Calculate change for non-max_send
-			var totalSelected int64
-			for _, utxo := range selectedUTXOs {
-				totalSelected += utxo.Value
-			}
-			changeAmount = totalSelected - amount - estimatedFee
-		}
-
 		b.Logger().Debug("send dry run", "wallet", name, "amount", amount, "fee", estimatedFee)
-		return &logical.Response{
-			Data: map[string]interface{}{
-				"dry_run":         true,
-				"amount":          amount,
-				"to":              toAddress,
-				"fee_rate":        feeRate,
-				"estimated_fee":   estimatedFee,
-				"estimated_vsize": estimatedVSize,
-				"change_amount":   changeAmount,
-				"inputs_used":     len(selectedUTXOs),
-				"total_available": totalAvailable,
-				"max_send":        maxSend,
-			},
-		}, nil
+		respData := map[string]interface{}{
+			"dry_run":         true,
+			"amount":          amount,
+			"to":              toAddress,
+			"fee_rate":        feeRateOf(fee, estimatedFee, estimatedVSize),
+			"estimated_fee":   estimatedFee,
+			"estimated_vsize": estimatedVSize,
+			"change_amount":   changeAmount,
+			"inputs_used":     len(selectedUTXOs),
+			"total_available": totalAvailable,
+			"max_send":        maxSend,
+		}
+		if changeAmount > 0 {
+			respData["change_address_type"] = changeType
+		}
+		if opReturn != nil {
+			respData["op_return"] = hex.EncodeToString(opReturn)
+		}
+		for k, v := range timelock {
+			respData[k] = v
+		}
+		return addFeeWarning(&logical.Response{Data: respData}, fee, estimatedFee), nil
 	}
 
 	// Not a dry run - proceed with transaction
 
 	// For non-max_send, store change address
 	if !maxSend {
-		changeKey, err := wallet.DeriveChangeKeyForType(w.Seed, network, w.NextAddressIndex, w.AddressType)
-		if err != nil {
-			return nil, fmt.Errorf("failed to derive change key: %w", err)
-		}
 		changeScriptHash, err := wallet.AddressToScriptHash(changeAddr, network)
 		if err != nil {
 			return nil, fmt.Errorf("failed to compute change address scripthash: %w", err)
 		}
-		_ = changeKey
 
 		stored := &storedAddress{
 			Address:        changeAddr,
-			Index:          w.NextAddressIndex,
-			DerivationPath: wallet.DerivationPathForType(network, 1, w.NextAddressIndex, w.AddressType),
+			Index:          acct.NextAddressIndex,
+			Account:        account,
+			Change:         true,
+			DerivationPath: wallet.DerivationPathForAccount(network, account, 1, acct.NextAddressIndex, changeType),
 			ScriptHash:     changeScriptHash,
+			AddressType:    changeType,
 		}
 
-		storageKey := fmt.Sprintf("%s%s/%d", addressStoragePrefix, name, w.NextAddressIndex)
-		entry, err := logical.StorageEntryJSON(storageKey, stored)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create storage entry: %w", err)
-		}
-
-		if err := req.Storage.Put(ctx, entry); err != nil {
+		if err := storeAddress(ctx, req.Storage, name, stored); err != nil {
 			return nil, fmt.Errorf("failed to store change address: %w", err)
 		}
 
-		w.NextAddressIndex++
+		acct.NextAddressIndex++
 		if err := saveWallet(ctx, req.Storage, w); err != nil {
 			return nil, fmt.Errorf("failed to update wallet: %w", err)
 		}
+		b.registerAddresses(ctx, req.Storage, w, network, changeAddr)
+	}
+
+	// The seed is only decrypted for signing
+	seed, err := walletSeed(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
+	if silentPayment {
+		payTo, err = wallet.SilentPaymentDestination(seed, network, selectedUTXOs, toAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute silent payment output: %w", err)
+		}
+		outputs = sendOutputs(payTo, amount, opReturn)
+	}
+
+	if lockTime == 0 {
+		lockTime, err = b.antiFeeSnipingLockTime(ctx, req.Storage, name, network, selectedUTXOs)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Build transaction
 	var txResult *wallet.TransactionResult
-	if maxSend {
+	if maxSend && opReturn == nil {
 		// Use consolidation builder for max_send (single output, no change)
-		txResult, err = wallet.BuildConsolidationTransaction(
-			w.Seed,
+		txResult, err = wallet.BuildConsolidationTransactionWithFee(
+			seed,
 			network,
 			selectedUTXOs,
-			toAddress,
-			feeRate,
+			payTo,
+			fee,
+			lockTime,
 		)
 	} else {
-		outputs := []wallet.TxOutput{
-			{
-				Address: toAddress,
-				Value:   amount,
-			},
-		}
-		txResult, err = wallet.BuildTransaction(
-			w.Seed,
+		// A max_send amount leaves nothing for change, so changeAddr is unused
+		txResult, err = wallet.BuildTransactionWithFee(
+			seed,
 			network,
 			selectedUTXOs,
 			outputs,
 			changeAddr,
-			feeRate,
+			fee,
+			lockTime,
 		)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to build transaction: %w", err)
 	}
 
+	// A transaction that is not final yet would be rejected; hand it back
+	// signed so it can be broadcast once its timelocks have passed
+	if timelocked {
+		b.Logger().Info("timelocked transaction signed", "wallet", name, "account", account, "txid", txResult.TxID, "locktime", lockTime)
+		respData := map[string]interface{}{
+			"txid":      txResult.TxID,
+			"hex":       txResult.Hex,
+			"fee":       txResult.Fee,
+			"amount":    amount,
+			"to":        toAddress,
+			"broadcast": false,
+		}
+		if !maxSend {
+			respData["change_amount"] = txResult.ChangeAmount
+			respData["change_address"] = changeAddr
+			respData["change_address_type"] = changeType
+		}
+		if opReturn != nil {
+			respData["op_return"] = hex.EncodeToString(opReturn)
+		}
+		if silentPayment {
+			respData["silent_payment_output"] = payTo
+		}
+		for k, v := range timelock {
+			respData[k] = v
+		}
+		resp := addFeeWarning(&logical.Response{Data: respData}, fee, txResult.Fee)
+		resp.AddWarning("The transaction is timelocked and was not broadcast. Broadcast the hex once it is valid; spending any of its inputs before then invalidates it.")
+		return resp, nil
+	}
+
 	// Broadcast
-	client, err := b.getClient(ctx, req.Storage)
+	client, err := b.getClient(ctx, req.Storage, network)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Electrum: %w", err)
+		return nil, fmt.Errorf("failed to connect to chain backend: %w", err)
 	}
 
-	txid, err := client.BroadcastTransaction(txResult.Hex)
+	txid, err := client.BroadcastTransaction(ctx, txResult.Hex)
 	if err != nil {
 		b.Logger().Warn("broadcast failed", "wallet", name, "error", err, "txid", txResult.TxID)
 		respData := map[string]interface{}{
@@ -349,23 +490,26 @@ func (b *btcBackend) pathWalletSend(ctx context.Context, req *logical.Request, d
 		if !maxSend {
 			respData["change_amount"] = txResult.ChangeAmount
 			respData["change_address"] = changeAddr
+			respData["change_address_type"] = changeType
+		}
+		if opReturn != nil {
+			respData["op_return"] = hex.EncodeToString(opReturn)
 		}
-		return &logical.Response{Data: respData}, nil
+		if silentPayment {
+			respData["silent_payment_output"] = payTo
+		}
+		return addFeeWarning(&logical.Response{Data: respData}, fee, txResult.Fee), nil
 	}
 
 	// Invalidate cache after successful broadcast
-	b.cache.InvalidateWallet(name)
+	b.invalidateWalletCache(ctx, req.Storage, name)
 
 	// Mark input addresses as spent
-	spentIndices := make([]uint32, 0, len(selectedUTXOs))
-	for _, utxo := range selectedUTXOs {
-		spentIndices = append(spentIndices, utxo.AddressIndex)
-	}
-	if err := markAddressesSpent(ctx, req.Storage, name, spentIndices); err != nil {
+	if err := markUTXOsSpent(ctx, req.Storage, name, account, selectedUTXOs); err != nil {
 		b.Logger().Warn("failed to mark addresses as spent", "wallet", name, "error", err)
 	}
 
-	b.Logger().Info("transaction broadcast", "wallet", name, "txid", txid, "amount", amount, "to", toAddress, "fee", txResult.Fee, "max_send", maxSend)
+	b.Logger().Info("transaction broadcast", "wallet", name, "account", account, "txid", txid, "amount", amount, "to", toAddress, "fee", txResult.Fee, "max_send", maxSend)
 
 	respData := map[string]interface{}{
 		"txid":      txid,
@@ -377,14 +521,267 @@ func (b *btcBackend) pathWalletSend(ctx context.Context, req *logical.Request, d
 	if !maxSend {
 		respData["change_amount"] = txResult.ChangeAmount
 		respData["change_address"] = changeAddr
+		respData["change_address_type"] = changeType
+	}
+	if opReturn != nil {
+		respData["op_return"] = hex.EncodeToString(opReturn)
+	}
+	if silentPayment {
+		respData["silent_payment_output"] = payTo
+	}
+	return addFeeWarning(&logical.Response{Data: respData}, fee, txResult.Fee), nil
+}
+
+// feeRateField is the decimal fee rate field of the endpoints building
+// transactions
+func feeRateField() *framework.FieldSchema {
+	return &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Fee rate in satoshis per vbyte, with up to three decimals, e.g. 1.5 (default: 10)",
+		Default:     defaultFeeRate,
+	}
+}
+
+// feeField is the absolute fee field of the endpoints building transactions
+func feeField() *framework.FieldSchema {
+	return &framework.FieldSchema{
+		Type:        framework.TypeInt,
+		Description: "Absolute fee in satoshis, instead of fee_rate",
+	}
+}
+
+// defaultFeeRate is the fee rate in sat/vB when a request sets neither
+// fee_rate nor fee
+const defaultFeeRate = "10"
+
+// requestFee returns the fee a request pays: an absolute fee, or a decimal
+// fee_rate
+func requestFee(data *framework.FieldData) (wallet.Fee, error) {
+	rawRate, rateSet := data.GetOk("fee_rate")
+	rawFee, feeSet := data.GetOk("fee")
+	if rateSet && feeSet {
+		return wallet.Fee{}, fmt.Errorf("fee and fee_rate are mutually exclusive")
+	}
+
+	var fee wallet.Fee
+	if feeSet {
+		fee.Amount = int64(rawFee.(int))
+		if fee.Amount <= 0 {
+			return wallet.Fee{}, fmt.Errorf("fee must be positive")
+		}
+	} else {
+		rate := defaultFeeRate
+		if rateSet {
+			rate = rawRate.(string)
+		}
+		var err error
+		fee.Rate, err = wallet.ParseFeeRate(rate)
+		if err != nil {
+			return wallet.Fee{}, err
+		}
+		if fee.Rate <= 0 {
+			return wallet.Fee{}, fmt.Errorf("fee_rate must be positive")
+		}
+	}
+
+	if err := fee.Validate(); err != nil {
+		return wallet.Fee{}, err
+	}
+	return fee, nil
+}
+
+// feeRateOf returns the fee rate in sat/vB reported for a transaction of
+// vsize vbytes paying amount: the rate requested, or the rate a fixed fee
+// works out to
+func feeRateOf(fee wallet.Fee, amount int64, vsize int) float64 {
+	if fee.Amount > 0 {
+		return wallet.EffectiveFeeRate(amount, vsize).SatPerVByte()
+	}
+	return fee.Rate.SatPerVByte()
+}
+
+// addFeeWarning warns when a fixed fee was raised to paid because the change
+// was too small for an output
+func addFeeWarning(resp *logical.Response, fee wallet.Fee, paid int64) *logical.Response {
+	if fee.Amount > 0 && paid != fee.Amount {
+		resp.AddWarning(fmt.Sprintf("The fee is %d sats instead of the requested %d: the %d sats left over are below the dust limit, too little for a change output, and were added to the fee.", paid, fee.Amount, paid-fee.Amount))
 	}
-	return &logical.Response{Data: respData}, nil
+	return resp
 }
 
+// parseOpReturn decodes the hex data of an OP_RETURN output; empty means
+// no data output
+func parseOpReturn(raw string) ([]byte, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	data, err := hex.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid op_return: must be hex")
+	}
+	if len(data) > wallet.MaxOpReturnSize {
+		return nil, fmt.Errorf("op_return data of %d bytes exceeds the limit of %d bytes", len(data), wallet.MaxOpReturnSize)
+	}
+	return data, nil
+}
+
+// sendOutputs returns the outputs of a send: the payment, followed by the
+// OP_RETURN data output if any
+func sendOutputs(to string, amount int64, opReturn []byte) []wallet.TxOutput {
+	outputs := []wallet.TxOutput{{Address: to, Value: amount}}
+	if opReturn != nil {
+		outputs = append(outputs, wallet.TxOutput{OpReturn: opReturn})
+	}
+	return outputs
+}
 
-// getUTXOsForWallet returns UTXOs for a wallet filtered by minimum confirmations
-func (b *btcBackend) getUTXOsForWallet(ctx context.Context, s logical.Storage, walletName string, minConfirmations int) ([]UTXOInfo, error) {
-	b.Logger().Debug("fetching UTXOs", "wallet", walletName, "min_confirmations", minConfirmations)
+// parseInputSequences parses txid:vout=nSequence pairs
+func parseInputSequences(raw map[string]string) (map[string]uint32, error) {
+	sequences := make(map[string]uint32, len(raw))
+	for outpoint, value := range raw {
+		txid, vout, found := strings.Cut(outpoint, ":")
+		if !found || len(txid) != 64 {
+			return nil, fmt.Errorf("invalid sequences key %q: must be txid:vout", outpoint)
+		}
+		if _, err := strconv.ParseUint(vout, 10, 32); err != nil {
+			return nil, fmt.Errorf("invalid sequences key %q: must be txid:vout", outpoint)
+		}
+		sequence, err := strconv.ParseUint(value, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sequence %q for %s: must be a 32-bit number", value, outpoint)
+		}
+		sequences[strings.ToLower(outpoint)] = uint32(sequence)
+	}
+	return sequences, nil
+}
+
+// includeUTXOs adds the required UTXOs missing from selected
+func includeUTXOs(selected, required []wallet.UTXO) []wallet.UTXO {
+	for _, utxo := range required {
+		found := false
+		for i := range selected {
+			if selected[i].TxID == utxo.TxID && selected[i].Vout == utxo.Vout {
+				found = true
+				break
+			}
+		}
+		if !found {
+			selected = append(selected, utxo)
+		}
+	}
+	return selected
+}
+
+// hasRelativeLock reports whether any input has a BIP68 relative timelock
+func hasRelativeLock(utxos []wallet.UTXO) bool {
+	for _, utxo := range utxos {
+		if _, _, ok := wallet.RelativeLock(utxo.Sequence); ok && utxo.Sequence != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// timelockStatus describes when a transaction with lockTime spending utxos
+// can be mined, and reports whether it is known not to be valid yet.
+// Time-based locks are checked against now, which runs ahead of the median
+// time past consensus uses; relative time locks depend on block times and
+// are only reported.
+func timelockStatus(lockTime uint32, utxos []wallet.UTXO, heights map[string]int64, currentHeight int64, now time.Time) (map[string]interface{}, bool) {
+	status := map[string]interface{}{
+		"locktime":       lockTime,
+		"current_height": currentHeight,
+	}
+	timelocked := false
+
+	var validFromHeight int64
+	switch {
+	case lockTime == 0:
+	case lockTime < wallet.LockTimeThreshold:
+		status["locktime_type"] = "height"
+		validFromHeight = int64(lockTime) + 1
+	default:
+		status["locktime_type"] = "time"
+		validAfter := time.Unix(int64(lockTime), 0).UTC()
+		status["valid_after"] = validAfter.Format(time.RFC3339)
+		if !now.After(validAfter) {
+			timelocked = true
+		}
+	}
+
+	var relativeLocks []map[string]interface{}
+	heightKnown := true
+	for _, utxo := range utxos {
+		value, seconds, ok := wallet.RelativeLock(utxo.Sequence)
+		if !ok || utxo.Sequence == 0 {
+			continue
+		}
+		outpoint := fmt.Sprintf("%s:%d", utxo.TxID, utxo.Vout)
+		lock := map[string]interface{}{"outpoint": outpoint, "sequence": utxo.Sequence}
+		if seconds {
+			lock["seconds"] = value
+		} else {
+			lock["blocks"] = value
+			if height := heights[outpoint]; height > 0 {
+				validFromHeight = max(validFromHeight, height+int64(value))
+			} else {
+				// The lock only starts counting once the input confirms
+				heightKnown = false
+				timelocked = true
+			}
+		}
+		relativeLocks = append(relativeLocks, lock)
+	}
+	if len(relativeLocks) > 0 {
+		status["relative_locks"] = relativeLocks
+	}
+
+	if validFromHeight > 0 && heightKnown {
+		status["valid_from_height"] = validFromHeight
+		if currentHeight > 0 && validFromHeight > currentHeight+1 {
+			timelocked = true
+			status["blocks_remaining"] = validFromHeight - currentHeight - 1
+		}
+	}
+	status["timelocked"] = timelocked
+	return status, timelocked
+}
+
+// antiFeeSnipingLockTime returns the locktime of a wallet-built transaction
+// spending utxos: the chain tip, occasionally backdated, or 0 when
+// anti_fee_sniping is disabled, the tip is unknown, or an input is final
+func (b *btcBackend) antiFeeSnipingLockTime(ctx context.Context, s logical.Storage, walletName, network string, utxos []wallet.UTXO) (uint32, error) {
+	config, err := getConfig(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+	if !config.antiFeeSniping() {
+		return 0, nil
+	}
+	for _, utxo := range utxos {
+		if utxo.Sequence == wallet.SequenceFinal {
+			return 0, nil
+		}
+	}
+
+	height := b.getWalletCache(ctx, s, walletName).GetBlockHeight()
+	if height == 0 {
+		client, err := b.getClient(ctx, s, network)
+		if err != nil {
+			return 0, fmt.Errorf("failed to connect to chain backend: %w", err)
+		}
+		height, err = client.GetBlockHeight(ctx)
+		if err != nil {
+			b.Logger().Warn("failed to get block height, using locktime 0", "wallet", walletName, "error", err)
+			return 0, nil
+		}
+	}
+	return wallet.AntiFeeSnipingLockTime(height), nil
+}
+
+// getUTXOsForWallet returns UTXOs for a wallet account filtered by minimum confirmations
+func (b *btcBackend) getUTXOsForWallet(ctx context.Context, s logical.Storage, walletName string, account uint32, minConfirmations int) ([]UTXOInfo, error) {
+	b.Logger().Debug("fetching UTXOs", "wallet", walletName, "account", account, "min_confirmations", minConfirmations)
 
 	w, err := getWallet(ctx, s, walletName)
 	if err != nil {
@@ -395,17 +792,22 @@ func (b *btcBackend) getUTXOsForWallet(ctx context.Context, s logical.Storage, w
 		return nil, fmt.Errorf("wallet %q not found", walletName)
 	}
 
-	client, err := b.getClient(ctx, s)
+	network, err := walletNetwork(ctx, s, w)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Electrum server: %w", err)
+		return nil, err
 	}
 
-	addresses, err := getStoredAddresses(ctx, s, walletName)
+	client, err := b.getClient(ctx, s, network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to chain backend: %w", err)
+	}
+
+	addresses, err := getStoredAddresses(ctx, s, walletName, account)
 	if err != nil {
 		return nil, err
 	}
 
-	walletCache := b.cache.GetWalletCache(walletName)
+	walletCache := b.getWalletCache(ctx, s, walletName)
 	var allUTXOs []UTXOInfo
 
 	// Track if we need to reconnect (stale connection detected)
@@ -417,15 +819,15 @@ func (b *btcBackend) getUTXOsForWallet(ctx context.Context, s logical.Storage, w
 	if cachedHeight > 0 {
 		currentBlockHeight = cachedHeight
 	} else {
-		currentBlockHeight, err = client.GetBlockHeight()
+		currentBlockHeight, err = client.GetBlockHeight(ctx)
 		if err != nil {
 			b.Logger().Warn("failed to get block height", "error", err)
 			// Try reconnect
 			if b.handleClientError(err) {
 				reconnectAttempted = true
-				if newClient, reconErr := b.getClient(ctx, s); reconErr == nil {
+				if newClient, reconErr := b.getClient(ctx, s, network); reconErr == nil {
 					client = newClient
-					currentBlockHeight, _ = client.GetBlockHeight()
+					currentBlockHeight, _ = client.GetBlockHeight(ctx)
 				}
 			}
 		}
@@ -435,21 +837,26 @@ func (b *btcBackend) getUTXOsForWallet(ctx context.Context, s logical.Storage, w
 	}
 
 	for _, addr := range addresses {
+		// Stop early if the Vault request was cancelled
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		var utxos []CachedUTXO
 
-		// Get current status hash from Electrum (lightweight call)
-		currentStatus, err := client.Subscribe(addr.ScriptHash)
+		// Get current status hash from the chain backend (lightweight call)
+		currentStatus, err := client.AddressStatus(ctx, addr.Address)
 		if err != nil {
 			b.Logger().Warn("failed to get status", "address", addr.Address, "error", err)
 
 			// Check for connection errors and try to reconnect once
 			if !reconnectAttempted && b.handleClientError(err) {
 				reconnectAttempted = true
-				newClient, reconErr := b.getClient(ctx, s)
+				newClient, reconErr := b.getClient(ctx, s, network)
 				if reconErr == nil {
 					client = newClient
 					// Retry with fresh connection
-					currentStatus, err = client.Subscribe(addr.ScriptHash)
+					currentStatus, err = client.AddressStatus(ctx, addr.Address)
 					if err != nil {
 						b.Logger().Warn("failed to get status after reconnect", "address", addr.Address, "error", err)
 					}
@@ -467,19 +874,19 @@ func (b *btcBackend) getUTXOsForWallet(ctx context.Context, s logical.Storage, w
 			b.Logger().Debug("cache hit (status match)", "address", addr.Address)
 			utxos = cached.UTXOs
 		} else {
-			// Cache miss or stale - fetch from Electrum
-			b.Logger().Debug("cache miss, fetching from Electrum", "address", addr.Address)
+			// Cache miss or stale - fetch from the chain backend
+			b.Logger().Debug("cache miss, fetching from chain backend", "address", addr.Address)
 
 			// Get balance for cache
 			var balance BalanceInfo
-			balanceResp, balErr := client.GetBalance(addr.ScriptHash)
+			balanceResp, balErr := client.GetBalance(ctx, addr.Address)
 			if balErr != nil {
 				// Try reconnect if needed
 				if !reconnectAttempted && b.handleClientError(balErr) {
 					reconnectAttempted = true
-					if newClient, reconErr := b.getClient(ctx, s); reconErr == nil {
+					if newClient, reconErr := b.getClient(ctx, s, network); reconErr == nil {
 						client = newClient
-						balanceResp, balErr = client.GetBalance(addr.ScriptHash)
+						balanceResp, balErr = client.GetBalance(ctx, addr.Address)
 					}
 				}
 			}
@@ -489,7 +896,7 @@ func (b *btcBackend) getUTXOsForWallet(ctx context.Context, s logical.Storage, w
 
 			// Get history for cache
 			var history []TxHistoryItem
-			historyResp, histErr := client.GetHistory(addr.ScriptHash)
+			historyResp, histErr := client.GetHistory(ctx, addr.Address)
 			if histErr == nil {
 				history = make([]TxHistoryItem, len(historyResp))
 				for i, h := range historyResp {
@@ -498,15 +905,15 @@ func (b *btcBackend) getUTXOsForWallet(ctx context.Context, s logical.Storage, w
 			}
 
 			// Get UTXOs
-			utxoResp, utxoErr := client.ListUnspent(addr.ScriptHash)
+			utxoResp, utxoErr := client.ListUnspent(ctx, addr.Address)
 			if utxoErr != nil {
 				b.Logger().Warn("failed to list unspent", "address", addr.Address, "error", utxoErr)
 				// Try reconnect if needed
 				if !reconnectAttempted && b.handleClientError(utxoErr) {
 					reconnectAttempted = true
-					if newClient, reconErr := b.getClient(ctx, s); reconErr == nil {
+					if newClient, reconErr := b.getClient(ctx, s, network); reconErr == nil {
 						client = newClient
-						utxoResp, utxoErr = client.ListUnspent(addr.ScriptHash)
+						utxoResp, utxoErr = client.ListUnspent(ctx, addr.Address)
 					}
 				}
 				if utxoErr != nil {
@@ -526,21 +933,7 @@ func (b *btcBackend) getUTXOsForWallet(ctx context.Context, s logical.Storage, w
 		}
 
 		for _, utxo := range utxos {
-			// Calculate actual confirmations from block height
-			var confirmations int64 = 0
-			if utxo.Height > 0 {
-				if currentBlockHeight > 0 {
-					confirmations = currentBlockHeight - utxo.Height + 1
-					if confirmations < 0 {
-						confirmations = 0 // Sanity check for reorgs
-					}
-				} else {
-					// Block height unknown but UTXO is in a block - treat as 1 confirmation minimum
-					confirmations = 1
-				}
-			}
-			// Height == 0 means unconfirmed (mempool)
-
+			confirmations := confirmationsAt(utxo.Height, currentBlockHeight)
 			if int(confirmations) < minConfirmations {
 				continue
 			}
@@ -551,6 +944,8 @@ func (b *btcBackend) getUTXOsForWallet(ctx context.Context, s logical.Storage, w
 				Value:         utxo.Value,
 				Address:       addr.Address,
 				AddressIndex:  addr.Index,
+				Change:        addr.Change,
+				AddressType:   addr.AddressType,
 				ScriptHash:    addr.ScriptHash,
 				Height:        utxo.Height,
 				Confirmations: confirmations,
@@ -560,6 +955,33 @@ func (b *btcBackend) getUTXOsForWallet(ctx context.Context, s logical.Storage, w
 		}
 	}
 
+	b.saveWalletCache(ctx, s, walletName, walletCache)
+
+	// Outputs received at the silent payment address have no stored address
+	if w.SilentPayments {
+		silentUTXOs, err := b.silentPaymentUTXOs(ctx, s, client, walletName, account, currentBlockHeight, minConfirmations)
+		if err != nil {
+			return nil, err
+		}
+		allUTXOs = append(allUTXOs, silentUTXOs...)
+	}
+
+	// Inputs of a pending channel funding are locked until it is finalized
+	// or cancelled
+	locked, err := channelFundingLocks(ctx, s, walletName, account)
+	if err != nil {
+		return nil, err
+	}
+	if len(locked) > 0 {
+		unlocked := allUTXOs[:0]
+		for _, utxo := range allUTXOs {
+			if !locked[fmt.Sprintf("%s:%d", utxo.TxID, utxo.Vout)] {
+				unlocked = append(unlocked, utxo)
+			}
+		}
+		allUTXOs = unlocked
+	}
+
 	b.Logger().Debug("UTXOs fetched", "wallet", walletName, "utxo_count", len(allUTXOs))
 	return allUTXOs, nil
 }
@@ -584,6 +1006,22 @@ Examples:
       amount=50000 \
       dry_run=true
 
+  # Pay a decimal fee rate, or an exact fee
+  $ vault write btc/wallets/my-wallet/send \
+      to="bc1q..." \
+      amount=50000 \
+      fee_rate=1.5
+  $ vault write btc/wallets/my-wallet/send \
+      to="bc1q..." \
+      amount=50000 \
+      fee=2000
+
+  # Anchor a document hash next to the payment
+  $ vault write btc/wallets/my-wallet/send \
+      to="bc1q..." \
+      amount=50000 \
+      op_return=9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+
   # Send all funds (empty wallet)
   $ vault write btc/wallets/my-wallet/send \
       to="bc1q..." \
@@ -596,16 +1034,53 @@ Examples:
       max_send=true \
       dry_run=true
 
+  # Send from account 1 (only spends account 1 UTXOs)
+  $ vault write btc/wallets/my-wallet/accounts/1/send \
+      to="bc1q..." \
+      amount=50000
+
 Parameters:
   - to: Destination Bitcoin address (required)
   - amount: Amount in satoshis (required unless max_send=true)
-  - fee_rate: Fee rate in satoshis per vbyte (default: 10)
+  - fee_rate: Fee rate in satoshis per vbyte, with up to three decimals
+    (default: 10, minimum: 1)
+  - fee: Absolute fee in satoshis, instead of fee_rate. It must pay at
+    least 1 sat/vB; change too small for an output is added to it.
   - min_confirmations: Minimum UTXO confirmations (default: from config)
   - dry_run: Estimate fee without broadcasting (default: false)
   - max_send: Send all available funds minus fee (default: false)
+  - locktime: Block height, or Unix timestamp from 500000000 on, before
+    which the transaction cannot be mined (default: the current height
+    when anti_fee_sniping is enabled in config, else 0)
+  - sequences: Input sequences as txid:vout=nSequence (default: RBF)
+  - op_return: Hex data of up to 80 bytes to anchor on chain in a
+    zero-value OP_RETURN output, which the fee estimate includes
+
+Timelocks:
+  A locktime or a BIP68 relative timelock in sequences pre-signs a
+  time-delayed transaction, e.g. for inheritance or escrow. UTXOs listed in
+  sequences are always spent, and a sequence of 0xffffffff is rejected with a
+  locktime because it disables it. If the transaction cannot be mined in the
+  next block it is returned signed but not broadcast; the response shows
+  valid_from_height (or valid_after for a timestamp locktime). Spending any
+  of its inputs before then invalidates it.
+
+  # Sweep to a cold wallet no earlier than block 900000
+  $ vault write btc/wallets/my-wallet/send \
+      to="bc1q..." max_send=true locktime=900000
+
+  # Spend a UTXO only 144 blocks after it confirmed
+  $ vault write btc/wallets/my-wallet/send \
+      to="bc1q..." amount=50000 sequences="<txid>:0=144"
+
+Silent payments:
+  A BIP352 silent payment address (sp1... or tsp1...) in "to" pays a fresh
+  taproot output derived from the recipient's keys and the spent inputs. The
+  derived address is returned as silent_payment_output.
 
 When max_send=true, the amount parameter is ignored and all UTXOs are spent
-to a single output. No change address is created.
+to a single output, besides any op_return data output. No change address is
+created.
 
 When dry_run=true, the response includes estimated_fee, estimated_vsize,
 and other details without modifying wallet state or broadcasting.
@@ -0,0 +1,312 @@
+package btc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/djschnei21/vault-plugin-btc/wallet"
+)
+
+func pathWalletShares(b *btcBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + "/shares",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the wallet",
+					Required:    true,
+				},
+				"groups": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Share groups as M-of-N member thresholds, e.g. 2-of-3,3-of-5",
+					Default:     []string{"2-of-3"},
+				},
+				"group_threshold": {
+					Type:        framework.TypeInt,
+					Description: "Number of groups required to recover the seed",
+					Default:     1,
+				},
+				"passphrase": {
+					Type:        framework.TypeString,
+					Description: "Optional SLIP-39 passphrase that must also be supplied on import",
+					DisplayAttrs: &framework.DisplayAttributes{
+						Sensitive: true,
+					},
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathWalletSharesWrite,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "wallet-shares",
+					},
+				},
+			},
+			HelpSynopsis:    pathWalletSharesHelpSynopsis,
+			HelpDescription: pathWalletSharesHelpDescription,
+		},
+		{
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + "/shares/import",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the wallet",
+					Required:    true,
+				},
+				"shares": {
+					Type:        framework.TypeStringSlice,
+					Description: "SLIP-39 mnemonics, enough to meet the group and member thresholds",
+					Required:    true,
+					DisplayAttrs: &framework.DisplayAttributes{
+						Sensitive: true,
+					},
+				},
+				"passphrase": {
+					Type:        framework.TypeString,
+					Description: "SLIP-39 passphrase the shares were created with",
+					DisplayAttrs: &framework.DisplayAttributes{
+						Sensitive: true,
+					},
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathWalletSharesImport,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "wallet-shares-import",
+					},
+				},
+			},
+			HelpSynopsis:    pathWalletSharesImportHelpSynopsis,
+			HelpDescription: pathWalletSharesImportHelpDescription,
+		},
+	}
+}
+
+func (b *btcBackend) pathWalletSharesWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	groups, err := parseShareGroups(data.Get("groups").([]string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	groupThreshold := data.Get("group_threshold").(int)
+	if groupThreshold < 1 || groupThreshold > len(groups) {
+		return logical.ErrorResponse("group_threshold must be between 1 and the number of groups (%d)", len(groups)), nil
+	}
+
+	w, err := getWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return logical.ErrorResponse("wallet %q not found", name), nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+	first, err := walletAddressInfo(ctx, req.Storage, w, network, 0, 0, 0, w.AddressType)
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := walletSeed(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
+	mnemonics, err := wallet.GenerateSlip39Shares(groupThreshold, groups, seed, data.Get("passphrase").(string), wallet.Slip39DefaultIterationExponent)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	shareGroups := make([]map[string]interface{}, len(groups))
+	shareCount := 0
+	for i, group := range groups {
+		shareGroups[i] = map[string]interface{}{
+			"group":     i + 1,
+			"threshold": group.Threshold,
+			"count":     group.Count,
+			"shares":    mnemonics[i],
+		}
+		shareCount += group.Count
+	}
+
+	b.Logger().Info("wallet seed split into shares", "wallet", name, "groups", len(groups), "group_threshold", groupThreshold, "shares", shareCount)
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"name":            name,
+			"network":         network,
+			"group_threshold": groupThreshold,
+			"groups":          shareGroups,
+			"first_address":   first.Address,
+		},
+	}
+	resp.AddWarning("Shares are not stored and cannot be read again. Hand each share to its holder now.")
+	return resp, nil
+}
+
+func (b *btcBackend) pathWalletSharesImport(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	w, err := getWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return logical.ErrorResponse("wallet %q not found", name), nil
+	}
+
+	seed, err := wallet.CombineSlip39Shares(data.Get("shares").([]string), data.Get("passphrase").(string))
+	if err != nil {
+		return logical.ErrorResponse("failed to combine shares: %s", err.Error()), nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify against the earliest receive address still on record; compact
+	// may have removed index 0
+	addresses, err := getStoredAddresses(ctx, req.Storage, name, 0)
+	if err != nil {
+		return nil, err
+	}
+	var first *storedAddress
+	for i := range addresses {
+		if !addresses[i].Change {
+			first = &addresses[i]
+			break
+		}
+	}
+	if first == nil {
+		return logical.ErrorResponse("wallet %q has no stored receive address to verify the shares against", name), nil
+	}
+
+	derived, err := wallet.GenerateAddressInfoForAccount(seed, network, 0, 0, first.Index, first.AddressType)
+	if err != nil {
+		return nil, err
+	}
+	if derived.Address != first.Address {
+		return logical.ErrorResponse("the shares do not recover this wallet's seed: %s derives %s, the wallet has %s (check the passphrase)",
+			first.DerivationPath, derived.Address, first.Address), nil
+	}
+
+	// The seed is replaced rather than compared, so a wallet whose sealed
+	// seed can no longer be decrypted is usable again
+	w.Seed = seed
+	w.SealedSeed = ""
+	w.AccountKeys = nil
+	if err := sealNewWallet(ctx, req.Storage, w, network); err != nil {
+		return nil, fmt.Errorf("failed to seal wallet seed: %w", err)
+	}
+	if err := saveWallet(ctx, req.Storage, w); err != nil {
+		return nil, err
+	}
+
+	b.Logger().Info("wallet seed recovered from shares", "wallet", name, "verified_address", first.Address)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":             name,
+			"network":          network,
+			"verified_address": first.Address,
+			"derivation_path":  first.DerivationPath,
+			"sealed":           w.SealedSeed != "",
+		},
+	}, nil
+}
+
+// parseShareGroups parses M-of-N group specifications
+func parseShareGroups(specs []string) ([]wallet.Slip39Group, error) {
+	var groups []wallet.Slip39Group
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		parts := strings.Split(spec, "-of-")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid group %q: must be M-of-N, e.g. 2-of-3", spec)
+		}
+		threshold, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid group %q: must be M-of-N, e.g. 2-of-3", spec)
+		}
+		count, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid group %q: must be M-of-N, e.g. 2-of-3", spec)
+		}
+		groups = append(groups, wallet.Slip39Group{Threshold: threshold, Count: count})
+	}
+
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("at least one group is required")
+	}
+	return groups, nil
+}
+
+const pathWalletSharesHelpSynopsis = `
+Split a wallet seed into SLIP-39 shares.
+`
+
+const pathWalletSharesHelpDescription = `
+Splits the wallet seed into SLIP-39 Shamir mnemonics so that no single
+custodian can reconstruct it. Shares are organized in groups, each with its
+own M-of-N member threshold; group_threshold groups are needed to recover the
+seed. The shares are returned once and are not stored.
+
+The response includes the wallet's first receive address; share holders can
+record it to check a recovered seed.
+
+A 1-of-N group would hand out N copies of the same share and is rejected; use
+1-of-1 for a single trusted holder.
+
+Examples:
+  # Any 2 of 3 custodians
+  $ vault write btc/wallets/treasury/shares groups=2-of-3
+
+  # 2 of 3 executives and 3 of 5 board members, or either group plus the
+  # offsite vault share
+  $ vault write btc/wallets/treasury/shares \
+      groups="2-of-3,3-of-5,1-of-1" group_threshold=2
+
+Shares are compatible with other SLIP-39 implementations, such as Trezor
+devices and python-shamir-mnemonic.
+`
+
+const pathWalletSharesImportHelpSynopsis = `
+Recover a wallet seed from SLIP-39 shares.
+`
+
+const pathWalletSharesImportHelpDescription = `
+Combines SLIP-39 shares into a seed and checks that it derives the wallet's
+earliest stored receive address. On success the wallet's seed is replaced with
+the recovered one, sealed with the mount's data key if seed encryption is
+enabled. This recovers a wallet whose sealed seed can no longer be decrypted,
+and doubles as a recovery drill for share holders.
+
+A wrong passphrase recovers a different seed, which fails the address check.
+
+Example:
+  $ vault write btc/wallets/treasury/shares/import \
+      shares="academic acid ..." shares="academic agency ..." \
+      passphrase=...
+`
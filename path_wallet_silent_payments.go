@@ -0,0 +1,682 @@
+package btc
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/djschnei21/vault-plugin-btc/wallet"
+)
+
+const silentPaymentStoragePrefix = "silent_payments/"
+
+// maxSilentPaymentScanBlocks bounds the blocks scanned per request. Every
+// transaction with a Taproot output costs a fetch of each transaction it
+// spends from, so a day of blocks is already thousands of lookups.
+const maxSilentPaymentScanBlocks = 144
+
+// storedSilentPayment stores an output received at a silent payment address.
+// Each output has its own Taproot address, which only the tweak links to the
+// wallet.
+type storedSilentPayment struct {
+	TxID    string `json:"txid"`
+	Vout    int    `json:"vout"`
+	Value   int64  `json:"value"`
+	Address string `json:"address"`
+	Account uint32 `json:"account,omitempty"`
+	Tweak   string `json:"tweak"`
+	Spent   bool   `json:"spent,omitempty"`
+}
+
+// outpoint returns the txid:vout of the output
+func (p *storedSilentPayment) outpoint() string {
+	return fmt.Sprintf("%s:%d", p.TxID, p.Vout)
+}
+
+func pathWalletSilentPayments(b *btcBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + accountPathRegex + "/silent-payments",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the wallet",
+					Required:    true,
+				},
+				"account": accountField(),
+				"txids": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Transactions to scan for outputs paid to the silent payment address. Cannot be combined with start_height/end_height.",
+				},
+				"start_height": {
+					Type:        framework.TypeInt,
+					Description: "First block to scan when txids is not set (default: the block after the last one scanned)",
+				},
+				"end_height": {
+					Type:        framework.TypeInt,
+					Description: "Last block to scan when txids is not set (default: the chain tip, at most 144 blocks after start_height)",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathWalletSilentPaymentsRead,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "silent-payments",
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathWalletSilentPaymentsScan,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb:   "scan",
+						OperationSuffix: "silent-payments",
+					},
+				},
+			},
+			HelpSynopsis:    pathWalletSilentPaymentsHelpSynopsis,
+			HelpDescription: pathWalletSilentPaymentsHelpDescription,
+		},
+	}
+}
+
+// silentPaymentWallet loads a wallet with silent payments enabled and the
+// scan keys of the requested account. The keys are read from the account, so
+// the seed is only decrypted for accounts enabled before they were stored. A
+// non-nil response is a user-facing error.
+func silentPaymentWallet(ctx context.Context, s logical.Storage, data *framework.FieldData) (*btcWallet, uint32, string, *wallet.SilentPaymentScanKeys, *logical.Response, error) {
+	name := data.Get("name").(string)
+
+	w, err := getWallet(ctx, s, name)
+	if err != nil {
+		return nil, 0, "", nil, nil, err
+	}
+	if w == nil {
+		return nil, 0, "", nil, logical.ErrorResponse("wallet %q not found", name), nil
+	}
+	if !w.SilentPayments {
+		return nil, 0, "", nil, logical.ErrorResponse("silent payments are not enabled on wallet %q - enable them with: vault write btc/wallets/%s silent_payments=true", name, name), nil
+	}
+
+	account, acct, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return nil, 0, "", nil, errResp, nil
+	}
+
+	network, err := walletNetwork(ctx, s, w)
+	if err != nil {
+		return nil, 0, "", nil, nil, err
+	}
+
+	if acct.SilentPaymentScanKey == "" {
+		if err := setSilentPaymentKeys(ctx, s, w, network); err != nil {
+			return nil, 0, "", nil, nil, err
+		}
+		if err := saveWallet(ctx, s, w); err != nil {
+			return nil, 0, "", nil, nil, err
+		}
+	}
+
+	keys, err := silentPaymentScanKeys(acct)
+	if err != nil {
+		return nil, 0, "", nil, nil, err
+	}
+	return w, account, network, keys, nil, nil
+}
+
+// setSilentPaymentKeys stores the scan private key and spend public key of
+// every account that lacks them while silent payments are enabled, decrypting
+// the seed only if there is one to derive. Disabling silent payments clears
+// them. The wallet is not saved.
+func setSilentPaymentKeys(ctx context.Context, s logical.Storage, w *btcWallet, network string) error {
+	var seed []byte
+	for _, index := range w.accountIndices() {
+		acct := w.Accounts[index]
+		if !w.SilentPayments {
+			acct.SilentPaymentScanKey = ""
+			acct.SilentPaymentSpendKey = ""
+			continue
+		}
+		if acct.SilentPaymentScanKey != "" {
+			continue
+		}
+
+		if seed == nil {
+			var err error
+			seed, err = walletSeed(ctx, s, w)
+			if err != nil {
+				return err
+			}
+		}
+		keys, err := wallet.DeriveSilentPaymentKeys(seed, network, index)
+		if err != nil {
+			return fmt.Errorf("failed to derive silent payment keys: %w", err)
+		}
+		acct.SilentPaymentScanKey = hex.EncodeToString(keys.Scan.Serialize())
+		acct.SilentPaymentSpendKey = hex.EncodeToString(keys.Spend.PubKey().SerializeCompressed())
+	}
+	return nil
+}
+
+// silentPaymentScanKeys decodes the silent payment keys stored on an account
+func silentPaymentScanKeys(acct *btcAccount) (*wallet.SilentPaymentScanKeys, error) {
+	scan, err := hex.DecodeString(acct.SilentPaymentScanKey)
+	if err != nil || len(scan) != 32 {
+		return nil, fmt.Errorf("invalid stored silent payment scan key")
+	}
+	spendBytes, err := hex.DecodeString(acct.SilentPaymentSpendKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored silent payment spend key: %w", err)
+	}
+	spend, err := btcec.ParsePubKey(spendBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored silent payment spend key: %w", err)
+	}
+	scanKey, _ := btcec.PrivKeyFromBytes(scan)
+	return &wallet.SilentPaymentScanKeys{Scan: scanKey, Spend: spend}, nil
+}
+
+func (b *btcBackend) pathWalletSilentPaymentsRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	w, account, network, keys, errResp, err := silentPaymentWallet(ctx, req.Storage, data)
+	if err != nil || errResp != nil {
+		return errResp, err
+	}
+
+	address, err := keys.Address(network)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := getSilentPayments(ctx, req.Storage, w.Name, account)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	outputs := make([]map[string]interface{}, 0, len(payments))
+	for _, p := range payments {
+		outputs = append(outputs, silentPaymentData(p))
+		if !p.Spent {
+			total += p.Value
+		}
+	}
+
+	respData := map[string]interface{}{
+		"name":    w.Name,
+		"network": network,
+		"address": address,
+		"outputs": outputs,
+		"total":   total,
+	}
+	if account != 0 {
+		respData["account"] = account
+	}
+	if height := w.account(account).SilentPaymentHeight; height > 0 {
+		respData["scanned_height"] = height
+	}
+	return &logical.Response{Data: respData}, nil
+}
+
+func (b *btcBackend) pathWalletSilentPaymentsScan(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	txids := data.Get("txids").([]string)
+	_, hasStart := data.GetOk("start_height")
+	_, hasEnd := data.GetOk("end_height")
+	if len(txids) > 0 && (hasStart || hasEnd) {
+		return logical.ErrorResponse("txids cannot be combined with start_height or end_height"), nil
+	}
+
+	w, account, network, keys, errResp, err := silentPaymentWallet(ctx, req.Storage, data)
+	if err != nil || errResp != nil {
+		return errResp, err
+	}
+
+	client, err := b.getClient(ctx, req.Storage, network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to chain backend: %w", err)
+	}
+
+	scanner := &silentPaymentScanner{
+		storage:    req.Storage,
+		client:     client,
+		walletName: w.Name,
+		account:    account,
+		network:    network,
+		keys:       keys,
+		found:      make([]map[string]interface{}, 0),
+	}
+
+	respData := map[string]interface{}{
+		"name":    w.Name,
+		"network": network,
+	}
+	if account != 0 {
+		respData["account"] = account
+	}
+
+	if len(txids) > 0 {
+		for _, txid := range txids {
+			txid = strings.TrimSpace(txid)
+			tx, err := fetchTransaction(ctx, client, txid)
+			if err != nil {
+				return logical.ErrorResponse("failed to fetch transaction %s: %s", txid, err.Error()), nil
+			}
+			if errResp, err := scanner.scan(ctx, tx); err != nil || errResp != nil {
+				return errResp, err
+			}
+		}
+		b.Logger().Info("silent payments scanned", "wallet", w.Name, "account", account, "transactions", len(txids), "found", len(scanner.found))
+
+		respData["scanned"] = len(txids)
+		respData["found"] = scanner.found
+		return &logical.Response{Data: respData}, nil
+	}
+
+	blocks, ok := client.(blockSource)
+	if !ok {
+		return logical.ErrorResponse("the chain backend cannot list block transactions (Electrum servers only index addresses) - scan specific transactions with txids, or configure a bitcoind or esplora backend"), nil
+	}
+
+	tip, err := client.GetBlockHeight(ctx)
+	if err != nil {
+		return logical.ErrorResponse("failed to get block height: %s", err.Error()), nil
+	}
+
+	// Continue after the last block scanned unless a start is given
+	acct := w.account(account)
+	startHeight := acct.SilentPaymentHeight + 1
+	if hasStart {
+		startHeight = int64(data.Get("start_height").(int))
+	} else if acct.SilentPaymentHeight == 0 {
+		return logical.ErrorResponse("start_height is required for the first block scan of %s", walletAccountPath(w.Name, account)), nil
+	}
+	if startHeight < 1 {
+		return logical.ErrorResponse("start_height must be at least 1"), nil
+	}
+
+	endHeight := tip
+	if hasEnd {
+		endHeight = int64(data.Get("end_height").(int))
+		if endHeight > tip {
+			return logical.ErrorResponse("end_height %d is above the chain tip %d", endHeight, tip), nil
+		}
+		if endHeight < startHeight {
+			return logical.ErrorResponse("end_height %d is below start_height %d", endHeight, startHeight), nil
+		}
+		if endHeight-startHeight+1 > maxSilentPaymentScanBlocks {
+			return logical.ErrorResponse("cannot scan more than %d blocks per request", maxSilentPaymentScanBlocks), nil
+		}
+	} else if endHeight-startHeight+1 > maxSilentPaymentScanBlocks {
+		// Scan the next batch; the caller repeats the request to catch up
+		endHeight = startHeight + maxSilentPaymentScanBlocks - 1
+	}
+
+	scanned := 0
+	for height := startHeight; height <= endHeight; height++ {
+		blockTxIDs, err := blocks.BlockTransactions(ctx, height)
+		if err != nil {
+			return logical.ErrorResponse("failed to list the transactions of block %d: %s", height, err.Error()), nil
+		}
+		for _, txid := range blockTxIDs {
+			tx, err := fetchTransaction(ctx, client, txid)
+			if err != nil {
+				return logical.ErrorResponse("failed to fetch transaction %s: %s", txid, err.Error()), nil
+			}
+			if errResp, err := scanner.scan(ctx, tx); err != nil || errResp != nil {
+				return errResp, err
+			}
+			scanned++
+		}
+	}
+
+	if endHeight >= startHeight && endHeight > acct.SilentPaymentHeight {
+		acct.SilentPaymentHeight = endHeight
+		if err := saveWallet(ctx, req.Storage, w); err != nil {
+			return nil, err
+		}
+	}
+
+	b.Logger().Info("silent payments scanned", "wallet", w.Name, "account", account, "start_height", startHeight, "end_height", endHeight, "transactions", scanned, "found", len(scanner.found))
+
+	respData["start_height"] = startHeight
+	respData["end_height"] = endHeight
+	respData["tip_height"] = tip
+	respData["scanned"] = scanned
+	respData["found"] = scanner.found
+	return &logical.Response{Data: respData}, nil
+}
+
+// silentPaymentScanner scans transactions for outputs paid to a wallet
+// account's silent payment address and stores the ones it finds
+type silentPaymentScanner struct {
+	storage    logical.Storage
+	client     ChainBackend
+	walletName string
+	account    uint32
+	network    string
+	keys       *wallet.SilentPaymentScanKeys
+	found      []map[string]interface{}
+}
+
+// scan checks one transaction. Transactions without Taproot outputs cannot
+// carry a silent payment and are skipped before their inputs are fetched.
+// A non-nil response is a user-facing error.
+func (sc *silentPaymentScanner) scan(ctx context.Context, tx *wire.MsgTx) (*logical.Response, error) {
+	txid := tx.TxHash().String()
+	if !hasTaprootOutput(tx) {
+		return nil, nil
+	}
+
+	prevOuts, err := fetchPrevOuts(ctx, sc.client, tx)
+	if err != nil {
+		return logical.ErrorResponse("failed to fetch the inputs of %s: %s", txid, err.Error()), nil
+	}
+	if prevOuts == nil {
+		return nil, nil
+	}
+
+	outputs, err := wallet.ScanSilentPayments(tx, prevOuts, sc.keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", txid, err)
+	}
+
+	params, err := wallet.NetworkParams(sc.network)
+	if err != nil {
+		return nil, err
+	}
+	for _, output := range outputs {
+		address, err := btcutil.NewAddressTaproot(tx.TxOut[output.Vout].PkScript[2:], params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode output address: %w", err)
+		}
+		p := &storedSilentPayment{
+			TxID:    txid,
+			Vout:    int(output.Vout),
+			Value:   output.Value,
+			Address: address.EncodeAddress(),
+			Account: sc.account,
+			Tweak:   hex.EncodeToString(output.Tweak),
+		}
+		if err := storeSilentPayment(ctx, sc.storage, sc.walletName, p); err != nil {
+			return nil, err
+		}
+		sc.found = append(sc.found, silentPaymentData(p))
+	}
+	return nil, nil
+}
+
+// hasTaprootOutput reports whether tx has a P2TR output
+func hasTaprootOutput(tx *wire.MsgTx) bool {
+	for _, out := range tx.TxOut {
+		if txscript.IsPayToTaproot(out.PkScript) {
+			return true
+		}
+	}
+	return false
+}
+
+// silentPaymentData returns the response fields of a received output
+func silentPaymentData(p *storedSilentPayment) map[string]interface{} {
+	return map[string]interface{}{
+		"txid":    p.TxID,
+		"vout":    p.Vout,
+		"value":   p.Value,
+		"address": p.Address,
+		"spent":   p.Spent,
+	}
+}
+
+// fetchTransaction returns a transaction from the chain backend
+func fetchTransaction(ctx context.Context, client ChainBackend, txid string) (*wire.MsgTx, error) {
+	rawHex, err := client.GetTransaction(ctx, txid)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction hex: %w", err)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// fetchPrevOuts returns the outputs spent by the inputs of tx, fetching each
+// previous transaction once. Coinbase transactions have none and return nil.
+func fetchPrevOuts(ctx context.Context, client ChainBackend, tx *wire.MsgTx) ([]*wire.TxOut, error) {
+	prevTxs := make(map[string]*wire.MsgTx)
+	prevOuts := make([]*wire.TxOut, 0, len(tx.TxIn))
+	for _, txIn := range tx.TxIn {
+		if txIn.PreviousOutPoint.Index == wire.MaxPrevOutIndex {
+			return nil, nil
+		}
+
+		prevTxID := txIn.PreviousOutPoint.Hash.String()
+		prevTx, ok := prevTxs[prevTxID]
+		if !ok {
+			var err error
+			prevTx, err = fetchTransaction(ctx, client, prevTxID)
+			if err != nil {
+				return nil, err
+			}
+			prevTxs[prevTxID] = prevTx
+		}
+
+		if int(txIn.PreviousOutPoint.Index) >= len(prevTx.TxOut) {
+			return nil, fmt.Errorf("%s has no output %d", prevTxID, txIn.PreviousOutPoint.Index)
+		}
+		prevOuts = append(prevOuts, prevTx.TxOut[txIn.PreviousOutPoint.Index])
+	}
+	return prevOuts, nil
+}
+
+// silentPaymentStoragePath returns the storage prefix holding the silent
+// payments received by a wallet account
+func silentPaymentStoragePath(walletName string, account uint32) string {
+	return fmt.Sprintf("%s%s/%d/", silentPaymentStoragePrefix, walletName, account)
+}
+
+// getSilentPayments returns the outputs received at an account's silent
+// payment address, sorted by outpoint
+func getSilentPayments(ctx context.Context, s logical.Storage, walletName string, account uint32) ([]*storedSilentPayment, error) {
+	prefix := silentPaymentStoragePath(walletName, account)
+	entries, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("error listing silent payments: %w", err)
+	}
+
+	payments := make([]*storedSilentPayment, 0, len(entries))
+	for _, entry := range entries {
+		stored, err := s.Get(ctx, prefix+entry)
+		if err != nil {
+			return nil, fmt.Errorf("error reading silent payment: %w", err)
+		}
+		if stored == nil {
+			continue
+		}
+		var p storedSilentPayment
+		if err := stored.DecodeJSON(&p); err != nil {
+			return nil, fmt.Errorf("error decoding silent payment: %w", err)
+		}
+		payments = append(payments, &p)
+	}
+
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].outpoint() < payments[j].outpoint()
+	})
+	return payments, nil
+}
+
+// storeSilentPayment writes a received output. Scanning a transaction again
+// keeps the spent flag of outputs already recorded.
+func storeSilentPayment(ctx context.Context, s logical.Storage, walletName string, p *storedSilentPayment) error {
+	key := silentPaymentStoragePath(walletName, p.Account) + p.outpoint()
+
+	existing, err := s.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("error reading silent payment: %w", err)
+	}
+	if existing != nil {
+		var old storedSilentPayment
+		if err := existing.DecodeJSON(&old); err == nil {
+			p.Spent = p.Spent || old.Spent
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(key, p)
+	if err != nil {
+		return fmt.Errorf("failed to create storage entry: %w", err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return fmt.Errorf("failed to store silent payment %s: %w", p.outpoint(), err)
+	}
+	return nil
+}
+
+// markUTXOsSpent marks the addresses and silent payment outputs spent by a
+// transaction, so they are never received to or selected again
+func markUTXOsSpent(ctx context.Context, s logical.Storage, walletName string, account uint32, utxos []wallet.UTXO) error {
+	indices := make([]uint32, 0, len(utxos))
+	for _, utxo := range utxos {
+		if len(utxo.SilentPaymentTweak) == 0 {
+			indices = append(indices, utxo.AddressIndex)
+			continue
+		}
+
+		key := fmt.Sprintf("%s%s:%d", silentPaymentStoragePath(walletName, account), utxo.TxID, utxo.Vout)
+		entry, err := s.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("error reading silent payment: %w", err)
+		}
+		if entry == nil {
+			continue
+		}
+		var p storedSilentPayment
+		if err := entry.DecodeJSON(&p); err != nil {
+			return fmt.Errorf("error decoding silent payment: %w", err)
+		}
+		p.Spent = true
+		if err := storeSilentPayment(ctx, s, walletName, &p); err != nil {
+			return err
+		}
+	}
+	return markAddressesSpent(ctx, s, walletName, account, indices)
+}
+
+// deleteSilentPayments removes every silent payment record of a wallet and
+// returns how many were deleted
+func deleteSilentPayments(ctx context.Context, s logical.Storage, walletName string) (int, error) {
+	prefix := silentPaymentStoragePrefix + walletName + "/"
+	accounts, err := s.List(ctx, prefix)
+	if err != nil {
+		return 0, fmt.Errorf("error listing silent payments: %w", err)
+	}
+
+	deleted := 0
+	for _, account := range accounts {
+		entries, err := s.List(ctx, prefix+account)
+		if err != nil {
+			return deleted, fmt.Errorf("error listing silent payments: %w", err)
+		}
+		for _, entry := range entries {
+			if err := s.Delete(ctx, prefix+account+entry); err != nil {
+				return deleted, fmt.Errorf("error deleting silent payment: %w", err)
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// silentPaymentUTXOs returns the unspent silent payment outputs of a wallet
+// account with at least minConfirmations, checking each against the chain
+// backend
+func (b *btcBackend) silentPaymentUTXOs(ctx context.Context, s logical.Storage, client ChainBackend, walletName string, account uint32, currentBlockHeight int64, minConfirmations int) ([]UTXOInfo, error) {
+	payments, err := getSilentPayments(ctx, s, walletName, account)
+	if err != nil {
+		return nil, err
+	}
+
+	var utxos []UTXOInfo
+	for _, p := range payments {
+		if p.Spent {
+			continue
+		}
+
+		unspent, err := client.ListUnspent(ctx, p.Address)
+		if err != nil {
+			b.Logger().Warn("failed to list unspent", "address", p.Address, "error", err)
+			continue
+		}
+		for _, u := range unspent {
+			if u.TxHash != p.TxID || u.TxPos != p.Vout {
+				continue
+			}
+			confirmations := confirmationsAt(u.Height, currentBlockHeight)
+			if int(confirmations) < minConfirmations {
+				continue
+			}
+			utxos = append(utxos, UTXOInfo{
+				TxID:               p.TxID,
+				Vout:               p.Vout,
+				Value:              u.Value,
+				Address:            p.Address,
+				AddressType:        AddressTypeP2TR,
+				Height:             u.Height,
+				Confirmations:      confirmations,
+				SilentPaymentTweak: p.Tweak,
+			})
+		}
+	}
+	return utxos, nil
+}
+
+const pathWalletSilentPaymentsHelpSynopsis = `
+Receive silent payments (BIP352) to a wallet.
+`
+
+const pathWalletSilentPaymentsHelpDescription = `
+This endpoint returns the silent payment address of a wallet account and
+scans transactions for outputs paid to it. Silent payments must first be
+enabled on the wallet:
+  $ vault write btc/wallets/my-wallet silent_payments=true
+
+A silent payment address (sp1...) can be published and reused: every payment
+to it lands on a fresh Taproot output that only the wallet can link to it.
+The scan and spend keys are derived from the seed at m/352'/coin'/account'.
+The scan private key and spend public key are stored with the account while
+silent payments are enabled, so reading the address and scanning never
+decrypt the seed; only spending a received output does.
+
+To read the address and the outputs received so far:
+  $ vault read btc/wallets/my-wallet/silent-payments
+
+Payments are not discovered through address lookups. Scan the transactions
+that may pay the wallet, fetching them and the outputs they spend through the
+chain backend:
+  $ vault write btc/wallets/my-wallet/silent-payments txids="<txid>,<txid>"
+
+With the bitcoind or esplora backend, blocks can be scanned instead. The first
+block scan needs a start height; later ones continue after the last block
+scanned, up to 144 blocks per request:
+  $ vault write btc/wallets/my-wallet/silent-payments start_height=870000
+  $ vault write -f btc/wallets/my-wallet/silent-payments
+
+Electrum servers cannot list the transactions of a block, so with the electrum
+backend only txids can be scanned.
+
+Detected outputs are spent by send, consolidate, and proof-of-reserves like
+any other UTXO of the account. Labels are not supported.
+`
@@ -12,7 +12,7 @@ import (
 func pathWalletUTXOs(b *btcBackend) []*framework.Path {
 	return []*framework.Path{
 		{
-			Pattern: "wallets/" + framework.GenericNameRegex("name") + "/utxos",
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + accountPathRegex + "/utxos",
 			DisplayAttrs: &framework.DisplayAttributes{
 				OperationPrefix: "btc",
 			},
@@ -22,6 +22,7 @@ func pathWalletUTXOs(b *btcBackend) []*framework.Path {
 					Description: "Name of the wallet",
 					Required:    true,
 				},
+				"account": accountField(),
 				"min_confirmations": {
 					Type:        framework.TypeInt,
 					Description: "Filter UTXOs by minimum confirmations (default: 0, show all)",
@@ -48,6 +49,7 @@ type UTXODetail struct {
 	Vout          uint32 `json:"vout"`
 	Address       string `json:"address"`
 	AddressIndex  uint32 `json:"address_index"`
+	AddressType   string `json:"address_type"`
 	Value         int64  `json:"value"`
 	Height        int64  `json:"height"`
 	Confirmations int64  `json:"confirmations"`
@@ -68,9 +70,19 @@ func (b *btcBackend) pathWalletUTXOsRead(ctx context.Context, req *logical.Reque
 		return logical.ErrorResponse("wallet %q not found", name), nil
 	}
 
-	client, err := b.getClient(ctx, req.Storage)
+	account, _, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Electrum server: %w", err)
+		return nil, err
+	}
+
+	client, err := b.getClient(ctx, req.Storage, network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to chain backend: %w", err)
 	}
 
 	// Get current block height for confirmations calculation
@@ -78,12 +90,12 @@ func (b *btcBackend) pathWalletUTXOsRead(ctx context.Context, req *logical.Reque
 	// For more accurate confirmations, we'd need to query the current block height
 
 	// Get stored addresses
-	addresses, err := getStoredAddresses(ctx, req.Storage, name)
+	addresses, err := getStoredAddresses(ctx, req.Storage, name, account)
 	if err != nil {
 		return nil, err
 	}
 
-	walletCache := b.cache.GetWalletCache(name)
+	walletCache := b.getWalletCache(ctx, req.Storage, name)
 	var utxoDetails []UTXODetail
 	var totalValue int64
 
@@ -96,15 +108,15 @@ func (b *btcBackend) pathWalletUTXOsRead(ctx context.Context, req *logical.Reque
 	if cachedHeight > 0 {
 		currentBlockHeight = cachedHeight
 	} else {
-		currentBlockHeight, err = client.GetBlockHeight()
+		currentBlockHeight, err = client.GetBlockHeight(ctx)
 		if err != nil {
 			b.Logger().Warn("failed to get block height", "error", err)
 			// Try reconnect
 			if b.handleClientError(err) {
 				reconnectAttempted = true
-				if newClient, reconErr := b.getClient(ctx, req.Storage); reconErr == nil {
+				if newClient, reconErr := b.getClient(ctx, req.Storage, network); reconErr == nil {
 					client = newClient
-					currentBlockHeight, _ = client.GetBlockHeight()
+					currentBlockHeight, _ = client.GetBlockHeight(ctx)
 				}
 			}
 		}
@@ -114,21 +126,26 @@ func (b *btcBackend) pathWalletUTXOsRead(ctx context.Context, req *logical.Reque
 	}
 
 	for _, addr := range addresses {
+		// Stop early if the Vault request was cancelled
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		var utxos []CachedUTXO
 
-		// Get current status hash from Electrum (lightweight call)
-		currentStatus, err := client.Subscribe(addr.ScriptHash)
+		// Get current status hash from the chain backend (lightweight call)
+		currentStatus, err := client.AddressStatus(ctx, addr.Address)
 		if err != nil {
 			b.Logger().Warn("failed to get status", "address", addr.Address, "error", err)
 
 			// Check for connection errors and try to reconnect once
 			if !reconnectAttempted && b.handleClientError(err) {
 				reconnectAttempted = true
-				newClient, reconErr := b.getClient(ctx, req.Storage)
+				newClient, reconErr := b.getClient(ctx, req.Storage, network)
 				if reconErr == nil {
 					client = newClient
 					// Retry with fresh connection
-					currentStatus, err = client.Subscribe(addr.ScriptHash)
+					currentStatus, err = client.AddressStatus(ctx, addr.Address)
 					if err != nil {
 						b.Logger().Warn("failed to get status after reconnect", "address", addr.Address, "error", err)
 					}
@@ -146,20 +163,20 @@ func (b *btcBackend) pathWalletUTXOsRead(ctx context.Context, req *logical.Reque
 			b.Logger().Debug("cache hit (status match)", "address", addr.Address)
 			utxos = cached.UTXOs
 		} else {
-			// Cache miss or stale - fetch from Electrum
-			b.Logger().Debug("cache miss, fetching from Electrum", "address", addr.Address)
+			// Cache miss or stale - fetch from the chain backend
+			b.Logger().Debug("cache miss, fetching from chain backend", "address", addr.Address)
 
 			// Get balance for cache
-			balanceResp, err := client.GetBalance(addr.ScriptHash)
+			balanceResp, err := client.GetBalance(ctx, addr.Address)
 			var balance BalanceInfo
 			if err != nil {
 				b.Logger().Warn("failed to get balance", "address", addr.Address, "error", err)
 				// Try reconnect if needed
 				if !reconnectAttempted && b.handleClientError(err) {
 					reconnectAttempted = true
-					if newClient, reconErr := b.getClient(ctx, req.Storage); reconErr == nil {
+					if newClient, reconErr := b.getClient(ctx, req.Storage, network); reconErr == nil {
 						client = newClient
-						balanceResp, err = client.GetBalance(addr.ScriptHash)
+						balanceResp, err = client.GetBalance(ctx, addr.Address)
 					}
 				}
 			}
@@ -171,7 +188,7 @@ func (b *btcBackend) pathWalletUTXOsRead(ctx context.Context, req *logical.Reque
 			}
 
 			// Get history for cache
-			historyResp, err := client.GetHistory(addr.ScriptHash)
+			historyResp, err := client.GetHistory(ctx, addr.Address)
 			var history []TxHistoryItem
 			if err != nil {
 				b.Logger().Warn("failed to get history", "address", addr.Address, "error", err)
@@ -187,15 +204,15 @@ func (b *btcBackend) pathWalletUTXOsRead(ctx context.Context, req *logical.Reque
 			}
 
 			// Get UTXOs
-			utxoResp, err := client.ListUnspent(addr.ScriptHash)
+			utxoResp, err := client.ListUnspent(ctx, addr.Address)
 			if err != nil {
 				b.Logger().Warn("failed to get UTXOs", "address", addr.Address, "error", err)
 				// Try reconnect if needed
 				if !reconnectAttempted && b.handleClientError(err) {
 					reconnectAttempted = true
-					if newClient, reconErr := b.getClient(ctx, req.Storage); reconErr == nil {
+					if newClient, reconErr := b.getClient(ctx, req.Storage, network); reconErr == nil {
 						client = newClient
-						utxoResp, err = client.ListUnspent(addr.ScriptHash)
+						utxoResp, err = client.ListUnspent(ctx, addr.Address)
 					}
 				}
 			}
@@ -245,6 +262,7 @@ func (b *btcBackend) pathWalletUTXOsRead(ctx context.Context, req *logical.Reque
 				Vout:          utxo.Vout,
 				Address:       addr.Address,
 				AddressIndex:  addr.Index,
+				AddressType:   addr.AddressType,
 				Value:         utxo.Value,
 				Height:        utxo.Height,
 				Confirmations: confirmations,
@@ -254,6 +272,8 @@ func (b *btcBackend) pathWalletUTXOsRead(ctx context.Context, req *logical.Reque
 		}
 	}
 
+	b.saveWalletCache(ctx, req.Storage, name, walletCache)
+
 	// Sort by value (largest first, like Sparrow's default)
 	sort.Slice(utxoDetails, func(i, j int) bool {
 		return utxoDetails[i].Value > utxoDetails[j].Value
@@ -267,6 +287,7 @@ func (b *btcBackend) pathWalletUTXOsRead(ctx context.Context, req *logical.Reque
 			"vout":          detail.Vout,
 			"address":       detail.Address,
 			"address_index": detail.AddressIndex,
+			"address_type":  detail.AddressType,
 			"value":         detail.Value,
 			"height":        detail.Height,
 			"confirmations": detail.Confirmations,
@@ -6,14 +6,12 @@ import (
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
-
-	"github.com/djschnei21/vault-plugin-btc/wallet"
 )
 
 func pathWalletXpub(b *btcBackend) []*framework.Path {
 	return []*framework.Path{
 		{
-			Pattern: "wallets/" + framework.GenericNameRegex("name") + "/xpub",
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + accountPathRegex + "/xpub",
 			DisplayAttrs: &framework.DisplayAttributes{
 				OperationPrefix: "btc",
 			},
@@ -23,6 +21,11 @@ func pathWalletXpub(b *btcBackend) []*framework.Path {
 					Description: "Name of the wallet",
 					Required:    true,
 				},
+				"account": accountField(),
+				"address_type": {
+					Type:        framework.TypeString,
+					Description: "Branch to export: p2tr (BIP86), p2wpkh (BIP84), p2sh-p2wpkh (BIP49) or p2pkh (BIP44) (default: wallet address_type)",
+				},
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ReadOperation: &framework.PathOperation{
@@ -52,55 +55,74 @@ func (b *btcBackend) pathWalletXpubRead(ctx context.Context, req *logical.Reques
 		return logical.ErrorResponse("wallet %q not found", name), nil
 	}
 
-	network, err := getNetwork(ctx, req.Storage)
+	account, _, errResp := getWalletAccount(w, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	addressType, err := requestAddressType(w, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get the extended public key
-	xpub, derivationPath, err := wallet.GetAccountXpub(w.Seed, network, w.AddressType)
+	xpub, derivationPath, err := walletAccountXpub(ctx, req.Storage, w, network, account, addressType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive xpub: %w", err)
 	}
 
 	// Determine the key format name based on address type and network
 	var keyFormat string
-	switch w.AddressType {
+	switch addressType {
 	case AddressTypeP2WPKH:
 		if network == "mainnet" {
 			keyFormat = "zpub"
 		} else {
 			keyFormat = "vpub"
 		}
-	case AddressTypeP2TR:
+	case AddressTypeP2SHP2WPKH:
+		if network == "mainnet" {
+			keyFormat = "ypub"
+		} else {
+			keyFormat = "upub"
+		}
+	default:
 		if network == "mainnet" {
 			keyFormat = "xpub"
 		} else {
 			keyFormat = "tpub"
 		}
-	default:
-		keyFormat = "xpub"
 	}
 
 	// Build output descriptor for Sparrow/other wallets
 	var descriptor string
-	switch w.AddressType {
+	switch addressType {
 	case AddressTypeP2WPKH:
 		descriptor = fmt.Sprintf("wpkh([fingerprint%s]%s/<0;1>/*)", derivationPath[1:], xpub)
 	case AddressTypeP2TR:
 		descriptor = fmt.Sprintf("tr([fingerprint%s]%s/<0;1>/*)", derivationPath[1:], xpub)
+	case AddressTypeP2SHP2WPKH:
+		descriptor = fmt.Sprintf("sh(wpkh([fingerprint%s]%s/<0;1>/*))", derivationPath[1:], xpub)
+	case AddressTypeP2PKH:
+		descriptor = fmt.Sprintf("pkh([fingerprint%s]%s/<0;1>/*)", derivationPath[1:], xpub)
 	}
 
-	b.Logger().Debug("xpub read complete", "wallet", name, "format", keyFormat)
+	b.Logger().Debug("xpub read complete", "wallet", name, "account", account, "format", keyFormat)
 
 	return &logical.Response{
 		Data: map[string]interface{}{
 			"xpub":            xpub,
-			"format":         keyFormat,
+			"account":         account,
+			"format":          keyFormat,
 			"derivation_path": derivationPath,
-			"address_type":   w.AddressType,
-			"network":        network,
-			"descriptor":     descriptor,
+			"address_type":    addressType,
+			"network":         network,
+			"descriptor":      descriptor,
 		},
 	}, nil
 }
@@ -121,18 +143,27 @@ wallet software like Sparrow. This enables a watch-only wallet workflow:
 Key Formats:
   - p2wpkh wallets: zpub (mainnet) or vpub (testnet) per SLIP-0132
   - p2tr wallets: xpub (mainnet) or tpub (testnet) - no SLIP-0132 standard
+  - p2sh-p2wpkh wallets: ypub (mainnet) or upub (testnet) per SLIP-0132
+  - p2pkh wallets: xpub (mainnet) or tpub (testnet)
 
 Response fields:
   - xpub: The extended public key string
-  - format: Key format name (zpub, vpub, xpub, tpub)
-  - derivation_path: BIP84/86 derivation path (e.g., m/84'/0'/0')
-  - address_type: Wallet address type (p2wpkh or p2tr)
-  - network: Bitcoin network (mainnet, testnet4, signet)
+  - format: Key format name (zpub, vpub, ypub, upub, xpub, tpub)
+  - derivation_path: BIP44/49/84/86 derivation path (e.g., m/84'/0'/0')
+  - address_type: Exported branch. Wallets hold every branch of their seed;
+    pass address_type to export a branch other than the wallet default
+  - network: Bitcoin network (mainnet, testnet4, signet, regtest)
   - descriptor: Output descriptor template for wallet import
 
 Example:
   $ vault read btc/wallets/my-wallet/xpub
 
+Export the BIP84 branch of a Taproot wallet:
+  $ vault read btc/wallets/my-wallet/xpub address_type=p2wpkh
+
+Each account has its own xpub (e.g., m/84'/0'/1' for account 1):
+  $ vault read btc/wallets/my-wallet/accounts/1/xpub
+
 Importing into Sparrow:
   1. File > New Wallet > "Watch Only"
   2. Paste the xpub value
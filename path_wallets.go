@@ -3,6 +3,8 @@ package btc
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
@@ -15,19 +17,141 @@ const walletsStoragePrefix = "wallets/"
 
 // AddressType constants
 const (
-	AddressTypeP2WPKH = "p2wpkh" // Native SegWit (BIP84)
-	AddressTypeP2TR   = "p2tr"   // Taproot (BIP86)
+	AddressTypeP2WPKH     = "p2wpkh"      // Native SegWit (BIP84)
+	AddressTypeP2TR       = "p2tr"        // Taproot (BIP86)
+	AddressTypeP2SHP2WPKH = "p2sh-p2wpkh" // Nested SegWit (BIP49), for recovering older wallets
+	AddressTypeP2PKH      = "p2pkh"       // Legacy (BIP44), for recovering older wallets
+)
+
+// Change policies select the address type of change outputs
+const (
+	ChangePolicyDefault          = "default"           // The wallet's default address_type
+	ChangePolicyMatchDestination = "match_destination" // Same type as the payment output
+	ChangePolicyMatchInputs      = "match_inputs"      // Same type as the spent inputs, if they agree
 )
 
 // btcWallet stores the wallet configuration
 type btcWallet struct {
 	Name             string    `json:"name"`
 	Description      string    `json:"description,omitempty"`
-	Seed             []byte    `json:"seed"`
-	AddressType      string    `json:"address_type"` // p2wpkh or p2tr (default: p2tr)
+	Seed             []byte    `json:"seed,omitempty"`        // Empty when the seed is sealed
+	SealedSeed       string    `json:"sealed_seed,omitempty"` // Seed encrypted under the mount's seed data key
+	Network          string    `json:"network,omitempty"`     // Network the wallet was created on; empty = mount network
+	AddressType      string    `json:"address_type"`          // Default receive type: p2tr, p2wpkh, p2sh-p2wpkh or p2pkh (default: p2tr)
+	ChangePolicy     string    `json:"change_policy,omitempty"`
+	SilentPayments   bool      `json:"silent_payments,omitempty"` // Receive BIP352 silent payments (see silent-payments)
 	NextAddressIndex uint32    `json:"next_address_index"`
 	FirstActiveIndex uint32    `json:"first_active_index"` // Addresses below this are spent+empty
 	CreatedAt        time.Time `json:"created_at"`
+
+	// Accounts holds the address counters of each BIP44 account. Account 0
+	// mirrors NextAddressIndex/FirstActiveIndex above so wallets written
+	// before accounts existed keep working.
+	Accounts map[uint32]*btcAccount `json:"accounts,omitempty"`
+
+	// AccountKeys caches the account public keys of a sealed wallet by
+	// address type and account (e.g. "p2tr/0"), so addresses can be derived
+	// without decrypting the seed
+	AccountKeys map[string]string `json:"account_keys,omitempty"`
+}
+
+// btcAccount stores the per-account state of a wallet (m/purpose'/coin'/account')
+type btcAccount struct {
+	Description      string    `json:"description,omitempty"`
+	NextAddressIndex uint32    `json:"next_address_index"`
+	FirstActiveIndex uint32    `json:"first_active_index"`
+	CreatedAt        time.Time `json:"created_at"`
+
+	// The scan private key and spend public key of the silent payment
+	// address, stored while silent payments are enabled so the address can
+	// be shown and payments scanned without decrypting the seed
+	SilentPaymentScanKey  string `json:"silent_payment_scan_key,omitempty"`
+	SilentPaymentSpendKey string `json:"silent_payment_spend_key,omitempty"`
+
+	// SilentPaymentHeight is the last block scanned for silent payments
+	SilentPaymentHeight int64 `json:"silent_payment_height,omitempty"`
+}
+
+// validAddressType reports whether t is a supported address type
+func validAddressType(t string) bool {
+	switch t {
+	case AddressTypeP2TR, AddressTypeP2WPKH, AddressTypeP2SHP2WPKH, AddressTypeP2PKH:
+		return true
+	default:
+		return false
+	}
+}
+
+// invalidAddressTypeError describes an unsupported address_type value
+func invalidAddressTypeError(t string) string {
+	return fmt.Sprintf("invalid address_type %q: must be %q, %q, %q, or %q", t,
+		AddressTypeP2TR, AddressTypeP2WPKH, AddressTypeP2SHP2WPKH, AddressTypeP2PKH)
+}
+
+// validChangePolicy reports whether p is a supported change policy
+func validChangePolicy(p string) bool {
+	return p == ChangePolicyDefault || p == ChangePolicyMatchDestination || p == ChangePolicyMatchInputs
+}
+
+// requestAddressType returns the address type requested in the address_type
+// field, falling back to the wallet's default type when it is not set
+func requestAddressType(w *btcWallet, data *framework.FieldData) (string, error) {
+	raw, ok := data.GetOk("address_type")
+	if !ok || raw.(string) == "" {
+		return w.AddressType, nil
+	}
+
+	addressType := raw.(string)
+	if !validAddressType(addressType) {
+		return "", fmt.Errorf("%s", invalidAddressTypeError(addressType))
+	}
+	return addressType, nil
+}
+
+// changeAddressType returns the address type for a change output under the
+// given policy (the wallet's policy if empty)
+func (w *btcWallet) changeAddressType(policy, destinationType string, inputs []wallet.UTXO) string {
+	if policy == "" {
+		policy = w.ChangePolicy
+	}
+
+	switch policy {
+	case ChangePolicyMatchDestination:
+		if validAddressType(destinationType) {
+			return destinationType
+		}
+	case ChangePolicyMatchInputs:
+		if len(inputs) > 0 {
+			inputType := inputs[0].AddressType
+			agree := validAddressType(inputType)
+			for _, utxo := range inputs[1:] {
+				if utxo.AddressType != inputType {
+					agree = false
+					break
+				}
+			}
+			if agree {
+				return inputType
+			}
+		}
+	}
+
+	return w.AddressType
+}
+
+// account returns the state of the given account, or nil if it has not been created
+func (w *btcWallet) account(index uint32) *btcAccount {
+	return w.Accounts[index]
+}
+
+// accountIndices returns the wallet's account indices in ascending order
+func (w *btcWallet) accountIndices() []uint32 {
+	indices := make([]uint32, 0, len(w.Accounts))
+	for index := range w.Accounts {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	return indices
 }
 
 func pathWallets(b *btcBackend) []*framework.Path {
@@ -63,9 +187,25 @@ func pathWallets(b *btcBackend) []*framework.Path {
 				},
 				"address_type": {
 					Type:        framework.TypeString,
-					Description: "Address type: p2tr (Taproot, default) or p2wpkh (SegWit)",
+					Description: "Default address type: p2tr (Taproot, default), p2wpkh (SegWit), p2sh-p2wpkh (nested SegWit) or p2pkh (legacy). On read, the type of the returned receive address",
 					Default:     "p2tr",
 				},
+				"change_policy": {
+					Type:        framework.TypeString,
+					Description: "Address type of change outputs: default (wallet address_type), match_destination, or match_inputs",
+				},
+				"silent_payments": {
+					Type:        framework.TypeBool,
+					Description: "Receive BIP352 silent payments: derive scan and spend keys from the seed and return an sp1 address",
+				},
+				"network": {
+					Type:        framework.TypeString,
+					Description: "Network of the wallet: mainnet, testnet4, signet, or regtest (default: the mount network). Fixed at creation.",
+				},
+				"force": {
+					Type:        framework.TypeBool,
+					Description: "On delete, delete the wallet even if its balance is not zero or cannot be checked",
+				},
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ReadOperation: &framework.PathOperation{
@@ -134,19 +274,33 @@ func (b *btcBackend) pathWalletsRead(ctx context.Context, req *logical.Request,
 		return nil, nil
 	}
 
-	network, err := getNetwork(ctx, req.Storage)
+	account, err := requestAccount(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	acct := w.account(account)
+	if acct == nil {
+		return nil, nil
+	}
+
+	receiveType, err := requestAddressType(w, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get Electrum client for balance and address checks
-	client, err := b.getClient(ctx, req.Storage)
+	// Get chain backend for balance and address checks
+	client, err := b.getClient(ctx, req.Storage, network)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Electrum server: %w", err)
+		return nil, fmt.Errorf("failed to connect to chain backend: %w", err)
 	}
 
 	// Get all stored addresses and calculate balance
-	addresses, err := getStoredAddresses(ctx, req.Storage, name)
+	addresses, err := getStoredAddresses(ctx, req.Storage, name, account)
 	if err != nil {
 		return nil, err
 	}
@@ -156,7 +310,7 @@ func (b *btcBackend) pathWalletsRead(ctx context.Context, req *logical.Request,
 	var receiveIndex uint32
 
 	// Use cache for efficient data fetching
-	walletCache := b.cache.GetWalletCache(name)
+	walletCache := b.getWalletCache(ctx, req.Storage, name)
 
 	// Track if we need to reconnect (stale connection detected)
 	reconnectAttempted := false
@@ -164,22 +318,27 @@ func (b *btcBackend) pathWalletsRead(ctx context.Context, req *logical.Request,
 	// First pass: find an unused address and aggregate balances
 	b.Logger().Debug("checking addresses for wallet", "wallet", name, "address_count", len(addresses))
 	for _, addr := range addresses {
+		// Stop early if the Vault request was cancelled
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		var balance BalanceInfo
 		var historyCount int
 
-		// Get current status hash from Electrum (lightweight call)
-		currentStatus, err := client.Subscribe(addr.ScriptHash)
+		// Get current status hash from the chain backend (lightweight call)
+		currentStatus, err := client.AddressStatus(ctx, addr.Address)
 		if err != nil {
 			b.Logger().Warn("failed to get status", "address", addr.Address, "error", err)
 
 			// Check for connection errors and try to reconnect once
 			if !reconnectAttempted && b.handleClientError(err) {
 				reconnectAttempted = true
-				newClient, reconErr := b.getClient(ctx, req.Storage)
+				newClient, reconErr := b.getClient(ctx, req.Storage, network)
 				if reconErr == nil {
 					client = newClient
 					// Retry this address with fresh connection
-					currentStatus, err = client.Subscribe(addr.ScriptHash)
+					currentStatus, err = client.AddressStatus(ctx, addr.Address)
 					if err != nil {
 						b.Logger().Warn("failed to get status after reconnect", "address", addr.Address, "error", err)
 					}
@@ -200,19 +359,19 @@ func (b *btcBackend) pathWalletsRead(ctx context.Context, req *logical.Request,
 			balance = cached.Balance
 			historyCount = len(cached.History)
 		} else {
-			// Cache miss, stale, or Subscribe failed - fetch from Electrum
-			b.Logger().Debug("fetching from Electrum", "address", addr.Address, "subscribe_failed", err != nil)
+			// Cache miss, stale, or Subscribe failed - fetch from the chain backend
+			b.Logger().Debug("fetching from chain backend", "address", addr.Address, "subscribe_failed", err != nil)
 
 			// Get balance
-			balanceResp, balErr := client.GetBalance(addr.ScriptHash)
+			balanceResp, balErr := client.GetBalance(ctx, addr.Address)
 			if balErr != nil {
 				b.Logger().Warn("failed to get balance", "address", addr.Address, "error", balErr)
 				// Try reconnect if needed
 				if !reconnectAttempted && b.handleClientError(balErr) {
 					reconnectAttempted = true
-					if newClient, reconErr := b.getClient(ctx, req.Storage); reconErr == nil {
+					if newClient, reconErr := b.getClient(ctx, req.Storage, network); reconErr == nil {
 						client = newClient
-						balanceResp, balErr = client.GetBalance(addr.ScriptHash)
+						balanceResp, balErr = client.GetBalance(ctx, addr.Address)
 					}
 				}
 			}
@@ -225,7 +384,7 @@ func (b *btcBackend) pathWalletsRead(ctx context.Context, req *logical.Request,
 
 			// Get history
 			var history []TxHistoryItem
-			historyResp, histErr := client.GetHistory(addr.ScriptHash)
+			historyResp, histErr := client.GetHistory(ctx, addr.Address)
 			if histErr != nil {
 				b.Logger().Warn("failed to get history", "address", addr.Address, "error", histErr)
 			} else {
@@ -238,7 +397,7 @@ func (b *btcBackend) pathWalletsRead(ctx context.Context, req *logical.Request,
 
 			// Get UTXOs for cache completeness
 			var utxos []CachedUTXO
-			utxoResp, utxoErr := client.ListUnspent(addr.ScriptHash)
+			utxoResp, utxoErr := client.ListUnspent(ctx, addr.Address)
 			if utxoErr == nil {
 				utxos = make([]CachedUTXO, len(utxoResp))
 				for i, u := range utxoResp {
@@ -257,9 +416,9 @@ func (b *btcBackend) pathWalletsRead(ctx context.Context, req *logical.Request,
 
 		// Check if this address can be used for receiving
 		// Skip if: 1) already marked spent, OR 2) has any transaction history
-		if receiveAddress == "" {
+		if receiveAddress == "" && addr.AddressType == receiveType && !addr.Change {
 			if addr.Spent {
-				// Fast path: address already marked as spent, skip without Electrum check
+				// Fast path: address already marked as spent, skip without a chain backend check
 				b.Logger().Debug("address marked as spent, skipping", "address", addr.Address, "index", addr.Index)
 			} else if historyCount > 0 {
 				// Address has transaction history - should not be reused
@@ -273,6 +432,8 @@ func (b *btcBackend) pathWalletsRead(ctx context.Context, req *logical.Request,
 		}
 	}
 
+	b.saveWalletCache(ctx, req.Storage, name, walletCache)
+
 	// Log if no unused address is available (user must generate via POST /addresses)
 	if receiveAddress == "" {
 		b.Logger().Debug("no unused address available", "wallet", name, "address_count", len(addresses))
@@ -294,13 +455,32 @@ func (b *btcBackend) pathWalletsRead(ctx context.Context, req *logical.Request,
 		respData["receive_index"] = receiveIndex
 	} else {
 		respData["receive_address"] = nil
-		respData["warning"] = "no unused address available - generate one with: vault write btc/wallets/" + name + "/addresses"
+		respData["warning"] = "no unused " + receiveType + " address available - generate one with: vault write " + walletAccountPath(name, account) + "/addresses address_type=" + receiveType
+	}
+	respData["receive_address_type"] = receiveType
+
+	if w.ChangePolicy != "" {
+		respData["change_policy"] = w.ChangePolicy
+	}
+	if w.SilentPayments {
+		respData["silent_payments"] = true
 	}
 
 	if w.Description != "" {
 		respData["description"] = w.Description
 	}
 
+	if account != 0 {
+		respData["account"] = account
+		respData["created_at"] = acct.CreatedAt.Format(time.RFC3339)
+		delete(respData, "description")
+		if acct.Description != "" {
+			respData["description"] = acct.Description
+		}
+	} else if len(w.Accounts) > 1 {
+		respData["accounts"] = w.accountIndices()
+	}
+
 	return &logical.Response{Data: respData}, nil
 }
 
@@ -319,26 +499,52 @@ func (b *btcBackend) pathWalletsWrite(ctx context.Context, req *logical.Request,
 		if !createOperation {
 			return nil, fmt.Errorf("wallet %q not found during update operation", name)
 		}
+		if name == restoreWalletName {
+			return logical.ErrorResponse("%q is reserved for btc/wallets/%s and cannot be used as a wallet name", name, restoreWalletName), nil
+		}
+
+		// The addresses of a deleted wallet are kept until it is purged
+		msg, err := deletedWalletNameError(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if msg != "" {
+			return logical.ErrorResponse(msg), nil
+		}
 
 		// Get and validate address type
 		addressType := data.Get("address_type").(string)
-		if addressType != AddressTypeP2TR && addressType != AddressTypeP2WPKH {
-			return logical.ErrorResponse("invalid address_type %q: must be %q or %q", addressType, AddressTypeP2TR, AddressTypeP2WPKH), nil
+		if !validAddressType(addressType) {
+			return logical.ErrorResponse(invalidAddressTypeError(addressType)), nil
+		}
+
+		config, err := getConfig(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		network, err := resolveWalletNetwork(config, data.Get("network").(string))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
 		}
 
-		b.Logger().Info("creating new wallet", "name", name, "address_type", addressType)
+		b.Logger().Info("creating new wallet", "name", name, "address_type", addressType, "network", network)
 		// Generate new seed for new wallet
 		seed, err := wallet.GenerateSeed()
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate seed: %w", err)
 		}
 
+		now := time.Now().UTC()
 		w = &btcWallet{
 			Name:             name,
 			Seed:             seed,
+			Network:          network,
 			AddressType:      addressType,
 			NextAddressIndex: 0,
-			CreatedAt:        time.Now().UTC(),
+			CreatedAt:        now,
+			Accounts: map[uint32]*btcAccount{
+				0: {CreatedAt: now},
+			},
 		}
 	}
 
@@ -347,49 +553,69 @@ func (b *btcBackend) pathWalletsWrite(ctx context.Context, req *logical.Request,
 		w.Description = description.(string)
 	}
 
+	// The default address type can be changed later; existing addresses keep their own type
+	if !createOperation {
+		if addressType, ok := data.GetOk("address_type"); ok {
+			if !validAddressType(addressType.(string)) {
+				return logical.ErrorResponse(invalidAddressTypeError(addressType.(string))), nil
+			}
+			w.AddressType = addressType.(string)
+		}
+	}
+
+	if changePolicy, ok := data.GetOk("change_policy"); ok {
+		if !validChangePolicy(changePolicy.(string)) {
+			return logical.ErrorResponse("invalid change_policy %q: must be %q, %q, or %q", changePolicy,
+				ChangePolicyDefault, ChangePolicyMatchDestination, ChangePolicyMatchInputs), nil
+		}
+		w.ChangePolicy = changePolicy.(string)
+	}
+
+	if silentPayments, ok := data.GetOk("silent_payments"); ok {
+		w.SilentPayments = silentPayments.(bool)
+	}
+
 	// Get network for address generation
-	network, err := getNetwork(ctx, req.Storage)
+	network, err := walletNetwork(ctx, req.Storage, w)
 	if err != nil {
 		return nil, err
 	}
 
-	// For create operations, generate and store the first 5 addresses
-	const initialAddressCount = 5
-	if createOperation {
-		for i := uint32(0); i < initialAddressCount; i++ {
-			addrInfo, err := wallet.GenerateAddressInfoForType(w.Seed, network, i, w.AddressType)
-			if err != nil {
-				return nil, fmt.Errorf("failed to generate address %d: %w", i, err)
-			}
-
-			stored := &storedAddress{
-				Address:        addrInfo.Address,
-				Index:          addrInfo.Index,
-				DerivationPath: addrInfo.DerivationPath,
-				ScriptHash:     addrInfo.ScriptHash,
-			}
-
-			storageKey := fmt.Sprintf("%s%s/%d", addressStoragePrefix, w.Name, i)
-			entry, err := logical.StorageEntryJSON(storageKey, stored)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create storage entry: %w", err)
-			}
+	// The network is part of every stored address and cannot change
+	if requested, ok := data.GetOk("network"); ok && !createOperation {
+		config, err := getConfig(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		if resolved, err := resolveWalletNetwork(config, requested.(string)); err != nil || resolved != network {
+			return logical.ErrorResponse("network cannot be changed after wallet creation (wallet is on %s)", network), nil
+		}
+	}
 
-			if err := req.Storage.Put(ctx, entry); err != nil {
-				return nil, fmt.Errorf("failed to store address %d: %w", i, err)
-			}
+	// For create operations, seal the seed if seed encryption is enabled and
+	// generate and store the first 5 addresses
+	var initialAddresses []string
+	if createOperation {
+		if err := sealNewWallet(ctx, req.Storage, w, network); err != nil {
+			return nil, fmt.Errorf("failed to seal wallet seed: %w", err)
+		}
+		if initialAddresses, err = generateInitialAddresses(ctx, req.Storage, w, network, 0); err != nil {
+			return nil, err
 		}
+	}
 
-		w.NextAddressIndex = initialAddressCount
+	if err := setSilentPaymentKeys(ctx, req.Storage, w, network); err != nil {
+		return nil, err
 	}
 
 	// Save wallet
 	if err := saveWallet(ctx, req.Storage, w); err != nil {
 		return nil, err
 	}
+	b.registerAddresses(ctx, req.Storage, w, network, initialAddresses...)
 
 	// Get stored addresses for response
-	addresses, err := getStoredAddresses(ctx, req.Storage, name)
+	addresses, err := getStoredAddresses(ctx, req.Storage, name, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -418,37 +644,224 @@ func (b *btcBackend) pathWalletsWrite(ctx context.Context, req *logical.Request,
 	if w.Description != "" {
 		respData["description"] = w.Description
 	}
+	if w.ChangePolicy != "" {
+		respData["change_policy"] = w.ChangePolicy
+	}
+	if w.SilentPayments {
+		keys, err := silentPaymentScanKeys(w.account(0))
+		if err != nil {
+			return nil, err
+		}
+		address, err := keys.Address(network)
+		if err != nil {
+			return nil, err
+		}
+		respData["silent_payments"] = true
+		respData["silent_payment_address"] = address
+	}
 
 	return &logical.Response{Data: respData}, nil
 }
 
 func (b *btcBackend) pathWalletsDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	name := data.Get("name").(string)
-	b.Logger().Debug("deleting wallet", "name", name)
+	force := data.Get("force").(bool)
+	b.Logger().Debug("deleting wallet", "name", name, "force", force)
+
+	w, err := getWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return nil, nil
+	}
+
+	network, err := walletNetwork(ctx, req.Storage, w)
+	if err != nil {
+		return nil, err
+	}
 
-	// Invalidate cache
-	b.cache.InvalidateWallet(name)
+	// A balance that can't be checked is not taken to be zero
+	if !force {
+		total, err := b.walletChainBalance(ctx, req.Storage, w, network)
+		if err != nil {
+			return logical.ErrorResponse("failed to check the balance of wallet %q: %s; delete with force=true to skip the check", name, err.Error()), nil
+		}
+		if total != 0 {
+			return logical.ErrorResponse("wallet %q holds %d sats; move the funds first or delete with force=true", name, total), nil
+		}
+	}
 
-	// Delete the wallet
-	if err := req.Storage.Delete(ctx, walletsStoragePrefix+name); err != nil {
-		return nil, fmt.Errorf("error deleting wallet: %w", err)
+	config, err := getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
 	}
 
-	// Delete associated addresses
-	addressPrefix := addressStoragePrefix + name + "/"
-	addresses, err := req.Storage.List(ctx, addressPrefix)
+	deleted, err := b.deleteWallet(ctx, req.Storage, w, network, config.deletedWalletRetention())
 	if err != nil {
-		return nil, fmt.Errorf("error listing addresses: %w", err)
+		return nil, err
+	}
+	if deleted == nil {
+		return nil, nil
 	}
 
-	for _, addr := range addresses {
-		if err := req.Storage.Delete(ctx, addressPrefix+addr); err != nil {
-			return nil, fmt.Errorf("error deleting address: %w", err)
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":        name,
+			"deleted_at":  deleted.DeletedAt.Format(time.RFC3339),
+			"purge_after": deleted.PurgeAfter.Format(time.RFC3339),
+		},
+	}, nil
+}
+
+// walletChainBalance returns the confirmed and unconfirmed balance of every
+// account of a wallet, including unspent silent payment outputs, as the
+// chain backend reports it now
+func (b *btcBackend) walletChainBalance(ctx context.Context, s logical.Storage, w *btcWallet, network string) (int64, error) {
+	client, err := b.getClient(ctx, s, network)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to chain backend: %w", err)
+	}
+
+	reconnectAttempted := false
+	var total int64
+	for _, account := range w.accountIndices() {
+		addresses, err := getStoredAddresses(ctx, s, w.Name, account)
+		if err != nil {
+			return 0, err
+		}
+		for _, addr := range addresses {
+			balance, err := client.GetBalance(ctx, addr.Address)
+			if err != nil && !reconnectAttempted && b.handleClientError(err) {
+				reconnectAttempted = true
+				if client, err = b.getClient(ctx, s, network); err == nil {
+					balance, err = client.GetBalance(ctx, addr.Address)
+				}
+			}
+			if err != nil {
+				return 0, fmt.Errorf("failed to get balance of %s: %w", addr.Address, err)
+			}
+			total += balance.Confirmed + balance.Unconfirmed
+		}
+
+		payments, err := getSilentPayments(ctx, s, w.Name, account)
+		if err != nil {
+			return 0, err
+		}
+		for _, p := range payments {
+			if p.Spent {
+				continue
+			}
+			unspent, err := client.ListUnspent(ctx, p.Address)
+			if err != nil {
+				return 0, fmt.Errorf("failed to list unspent outputs of %s: %w", p.Address, err)
+			}
+			for _, u := range unspent {
+				if u.TxHash == p.TxID && u.TxPos == p.Vout {
+					total += u.Value
+				}
+			}
+		}
+	}
+	return total, nil
+}
+
+// initialAddressCount is the number of receive addresses generated for a new wallet or account
+const initialAddressCount = 5
+
+// generateInitialAddresses stores the first receive addresses of a freshly
+// created account and returns them
+func generateInitialAddresses(ctx context.Context, s logical.Storage, w *btcWallet, network string, account uint32) ([]string, error) {
+	acct := w.account(account)
+	addresses := make([]string, 0, initialAddressCount)
+	for i := uint32(0); i < initialAddressCount; i++ {
+		addrInfo, err := walletAddressInfo(ctx, s, w, network, account, 0, i, w.AddressType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate address %d: %w", i, err)
 		}
+
+		stored := &storedAddress{
+			Address:        addrInfo.Address,
+			Index:          addrInfo.Index,
+			Account:        account,
+			DerivationPath: addrInfo.DerivationPath,
+			ScriptHash:     addrInfo.ScriptHash,
+			AddressType:    addrInfo.AddressType,
+		}
+		if err := storeAddress(ctx, s, w.Name, stored); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, addrInfo.Address)
+	}
+
+	acct.NextAddressIndex = initialAddressCount
+	return addresses, nil
+}
+
+// resolveWalletNetwork maps the network requested for a new wallet to the
+// network recorded on it. The mount network, including a custom signet, is
+// the default.
+func resolveWalletNetwork(config *btcConfig, requested string) (string, error) {
+	mountNetwork, err := config.networkID()
+	if err != nil {
+		return "", err
+	}
+	if requested == "" || requested == mountNetwork || (config != nil && requested == config.Network) {
+		return mountNetwork, nil
+	}
+	if !validNetwork(requested) {
+		return "", fmt.Errorf("invalid network %q: must be 'mainnet', 'testnet4', 'signet', or 'regtest'", requested)
+	}
+	return requested, nil
+}
+
+// walletNetwork returns the network a wallet was created on. Wallets created
+// before wallets recorded their network use the mount network.
+func walletNetwork(ctx context.Context, s logical.Storage, w *btcWallet) (string, error) {
+	// Reading the mount network also registers a configured custom signet
+	network, err := getNetwork(ctx, s)
+	if err != nil {
+		return "", err
+	}
+	if w != nil && w.Network != "" {
+		return w.Network, nil
 	}
+	return network, nil
+}
 
-	b.Logger().Info("wallet deleted", "name", name, "addresses_deleted", len(addresses))
-	return nil, nil
+// pinWalletNetworks records network on every wallet that does not carry its
+// own network yet, so that changing the mount network leaves them in place.
+// Wallets on a custom signet cannot outlive its config, so when any wallet
+// is on network and network is a custom signet, nothing is pinned and their
+// names are returned instead.
+func pinWalletNetworks(ctx context.Context, s logical.Storage, network string) (int, []string, error) {
+	wallets, err := listWallets(ctx, s)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var legacy []*btcWallet
+	var onNetwork []string
+	for _, w := range wallets {
+		if w.Network == "" {
+			legacy = append(legacy, w)
+		}
+		if w.Network == "" || w.Network == network {
+			onNetwork = append(onNetwork, w.Name)
+		}
+	}
+
+	if wallet.IsCustomNetwork(network) && len(onNetwork) > 0 {
+		return 0, onNetwork, nil
+	}
+
+	for _, w := range legacy {
+		w.Network = network
+		if err := saveWallet(ctx, s, w); err != nil {
+			return 0, nil, err
+		}
+	}
+	return len(legacy), nil, nil
 }
 
 // getWallet retrieves a wallet from storage
@@ -467,11 +880,52 @@ func getWallet(ctx context.Context, s logical.Storage, name string) (*btcWallet,
 		return nil, fmt.Errorf("error decoding wallet: %w", err)
 	}
 
+	// Wallets created before accounts existed only have the top-level counters
+	if w.Accounts[0] == nil {
+		if w.Accounts == nil {
+			w.Accounts = make(map[uint32]*btcAccount)
+		}
+		w.Accounts[0] = &btcAccount{
+			NextAddressIndex: w.NextAddressIndex,
+			FirstActiveIndex: w.FirstActiveIndex,
+			CreatedAt:        w.CreatedAt,
+		}
+	}
+
 	return w, nil
 }
 
+// listWallets retrieves every wallet from storage
+func listWallets(ctx context.Context, s logical.Storage) ([]*btcWallet, error) {
+	names, err := s.List(ctx, walletsStoragePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("error listing wallets: %w", err)
+	}
+
+	var wallets []*btcWallet
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		w, err := getWallet(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		if w != nil {
+			wallets = append(wallets, w)
+		}
+	}
+	return wallets, nil
+}
+
 // saveWallet saves a wallet to storage
 func saveWallet(ctx context.Context, s logical.Storage, w *btcWallet) error {
+	// Keep the top-level counters in sync with account 0
+	if acct := w.account(0); acct != nil {
+		w.NextAddressIndex = acct.NextAddressIndex
+		w.FirstActiveIndex = acct.FirstActiveIndex
+	}
+
 	entry, err := logical.StorageEntryJSON(walletsStoragePrefix+w.Name, w)
 	if err != nil {
 		return fmt.Errorf("error creating storage entry: %w", err)
@@ -498,18 +952,53 @@ Manage Bitcoin wallets.
 
 const pathWalletsHelpDescription = `
 This endpoint manages Bitcoin wallets. Each wallet is an HD wallet with its own
-seed and address derivation. All wallets use the network configured at the mount
-level (btc/config).
+seed and address derivation. A wallet is created on the network configured at
+the mount level (btc/config) unless network is given, and stays on that
+network for its lifetime.
 
 To create a new wallet:
   $ vault write btc/wallets/my-wallet description="Treasury"
 
+To create a wallet on another network than the mount default:
+  $ vault write btc/wallets/qa-wallet network=testnet4
+
+A wallet holds both BIP84 (p2wpkh) and BIP86 (p2tr) branches of its seed.
+address_type is the default for new receive addresses; other endpoints accept
+address_type to request the other type. change_policy selects the type of
+change outputs: default, match_destination, or match_inputs.
+
+To receive BIP352 silent payments at a reusable sp1 address:
+  $ vault write btc/wallets/my-wallet silent_payments=true
+
+The address is returned on write and by btc/wallets/my-wallet/silent-payments,
+which also scans transactions for payments to it.
+
+To get a SegWit receive address from a Taproot wallet:
+  $ vault read btc/wallets/my-wallet address_type=p2wpkh
+
+The BIP49 (p2sh-p2wpkh, 3... addresses) and BIP44 (p2pkh, 1... addresses)
+types are supported for recovering funds held by older wallets. A wallet with
+one of these default types tracks that branch and can sweep it to a modern
+address:
+  $ vault write btc/wallets/old-funds address_type=p2sh-p2wpkh
+  $ vault write btc/wallets/old-funds/send to="bc1p..." max_send=true
+
 To view wallet info and balance:
   $ vault read btc/wallets/my-wallet
 
+The wallet itself is BIP44 account 0. Additional accounts derived from the
+same seed are managed under btc/wallets/my-wallet/accounts.
+
 To delete a wallet:
   $ vault delete btc/wallets/my-wallet
 
-WARNING: Deleting a wallet permanently destroys the seed. Ensure all funds have
-been transferred before deletion.
+A wallet whose balance, checked with the chain backend, is not zero or cannot
+be checked is only deleted with force=true.
+Deleted wallets are kept for deleted_wallet_retention (see btc/config) and can
+be undeleted with btc/wallets/my-wallet/undelete until they are purged. Their
+names cannot be reused until then.
+
+WARNING: Purging a wallet permanently destroys the seed. Ensure all funds have
+been transferred, or export a backup with btc/wallets/my-wallet/backup, before
+deletion.
 `
@@ -0,0 +1,379 @@
+package btc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// deletedWalletsStoragePrefix holds soft-deleted wallets until they are purged
+const deletedWalletsStoragePrefix = "deleted_wallets/"
+
+// deletedWallet is a soft-deleted wallet. Its address records stay in place
+// until it is purged, so an undeleted wallet keeps its reuse prevention.
+type deletedWallet struct {
+	Wallet     *btcWallet `json:"wallet"`
+	DeletedAt  time.Time  `json:"deleted_at"`
+	PurgeAfter time.Time  `json:"purge_after"`
+}
+
+func pathDeletedWallets(b *btcBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "deleted-wallets/?$",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+				OperationSuffix: "deleted-wallets",
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathDeletedWalletsList,
+				},
+			},
+			HelpSynopsis:    pathDeletedWalletsHelpSynopsis,
+			HelpDescription: pathDeletedWalletsHelpDescription,
+		},
+		{
+			Pattern: "deleted-wallets/" + framework.GenericNameRegex("name"),
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the deleted wallet",
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathDeletedWalletsRead,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "deleted-wallet",
+					},
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathDeletedWalletsPurge,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "deleted-wallet",
+					},
+				},
+			},
+			HelpSynopsis:    pathDeletedWalletsHelpSynopsis,
+			HelpDescription: pathDeletedWalletsHelpDescription,
+		},
+		{
+			Pattern: "wallets/" + framework.GenericNameRegex("name") + "/undelete",
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "btc",
+			},
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the deleted wallet",
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathWalletUndelete,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "undelete-wallet",
+					},
+				},
+			},
+			HelpSynopsis:    pathWalletUndeleteHelpSynopsis,
+			HelpDescription: pathWalletUndeleteHelpDescription,
+		},
+	}
+}
+
+func (b *btcBackend) pathDeletedWalletsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, deletedWalletsStoragePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("error listing deleted wallets: %w", err)
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *btcBackend) pathDeletedWalletsRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	deleted, err := getDeletedWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		return nil, nil
+	}
+
+	respData := map[string]interface{}{
+		"name":         name,
+		"network":      deleted.Wallet.Network,
+		"address_type": deleted.Wallet.AddressType,
+		"accounts":     len(deleted.Wallet.Accounts),
+		"created_at":   deleted.Wallet.CreatedAt.Format(time.RFC3339),
+		"deleted_at":   deleted.DeletedAt.Format(time.RFC3339),
+		"purge_after":  deleted.PurgeAfter.Format(time.RFC3339),
+	}
+	if deleted.Wallet.Description != "" {
+		respData["description"] = deleted.Wallet.Description
+	}
+	return &logical.Response{Data: respData}, nil
+}
+
+func (b *btcBackend) pathDeletedWalletsPurge(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	deleted, err := getDeletedWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		return nil, nil
+	}
+
+	if err := b.purgeDeletedWallet(ctx, req.Storage, name); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *btcBackend) pathWalletUndelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	deleted, err := getDeletedWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		return logical.ErrorResponse("no deleted wallet %q found; it may have been purged", name), nil
+	}
+
+	existing, err := getWallet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return logical.ErrorResponse("wallet %q already exists", name), nil
+	}
+
+	// The wallet entry is written before the tombstone is removed, so a
+	// failure in between leaves both rather than neither
+	if err := saveWallet(ctx, req.Storage, deleted.Wallet); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, deletedWalletsStoragePrefix+name); err != nil {
+		return nil, fmt.Errorf("error deleting tombstone: %w", err)
+	}
+
+	b.Logger().Info("wallet undeleted", "name", name, "deleted_at", deleted.DeletedAt)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":       name,
+			"network":    deleted.Wallet.Network,
+			"deleted_at": deleted.DeletedAt.Format(time.RFC3339),
+		},
+	}, nil
+}
+
+// deleteWallet moves a wallet to a tombstone kept for the retention period,
+// or deletes it right away when retention is 0. It returns the tombstone, or
+// nil if the wallet was deleted immediately.
+func (b *btcBackend) deleteWallet(ctx context.Context, s logical.Storage, w *btcWallet, network string, retention time.Duration) (*deletedWallet, error) {
+	b.invalidateWalletCache(ctx, s, w.Name)
+
+	if retention == 0 {
+		if err := s.Delete(ctx, walletsStoragePrefix+w.Name); err != nil {
+			return nil, fmt.Errorf("error deleting wallet: %w", err)
+		}
+		deleted, err := deleteStoredAddresses(ctx, s, w.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := deleteSilentPayments(ctx, s, w.Name); err != nil {
+			return nil, err
+		}
+		if _, err := deleteChannelFundings(ctx, s, w.Name); err != nil {
+			return nil, err
+		}
+		b.Logger().Info("wallet deleted", "name", w.Name, "addresses_deleted", deleted)
+		return nil, nil
+	}
+
+	// A deleted wallet must come back on its own network even if the mount
+	// network changes in the meantime
+	w.Network = network
+
+	now := time.Now().UTC()
+	deleted := &deletedWallet{
+		Wallet:     w,
+		DeletedAt:  now,
+		PurgeAfter: now.Add(retention),
+	}
+	if err := saveDeletedWallet(ctx, s, deleted); err != nil {
+		return nil, err
+	}
+	if err := s.Delete(ctx, walletsStoragePrefix+w.Name); err != nil {
+		return nil, fmt.Errorf("error deleting wallet: %w", err)
+	}
+
+	b.Logger().Info("wallet moved to deleted wallets", "name", w.Name, "purge_after", deleted.PurgeAfter)
+	return deleted, nil
+}
+
+// purgeDeletedWallet permanently removes a deleted wallet and its addresses
+func (b *btcBackend) purgeDeletedWallet(ctx context.Context, s logical.Storage, name string) error {
+	b.invalidateWalletCache(ctx, s, name)
+
+	addresses, err := deleteStoredAddresses(ctx, s, name)
+	if err != nil {
+		return err
+	}
+	if _, err := deleteSilentPayments(ctx, s, name); err != nil {
+		return err
+	}
+	if _, err := deleteChannelFundings(ctx, s, name); err != nil {
+		return err
+	}
+	if err := s.Delete(ctx, deletedWalletsStoragePrefix+name); err != nil {
+		return fmt.Errorf("error purging wallet: %w", err)
+	}
+
+	b.Logger().Info("deleted wallet purged", "name", name, "addresses_deleted", addresses)
+	return nil
+}
+
+// purgeExpiredWallets purges deleted wallets whose retention ended before now
+func (b *btcBackend) purgeExpiredWallets(ctx context.Context, s logical.Storage, now time.Time) (int, error) {
+	deleted, err := listDeletedWallets(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int
+	for _, d := range deleted {
+		if now.Before(d.PurgeAfter) {
+			continue
+		}
+		if err := b.purgeDeletedWallet(ctx, s, d.Wallet.Name); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// periodicFunc runs on the active node. Performance secondaries and standbys
+// cannot write the replicated tombstones and leave purging to the primary.
+func (b *btcBackend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary | consts.ReplicationPerformanceStandby) {
+		return nil
+	}
+
+	if _, err := b.purgeExpiredWallets(ctx, req.Storage, time.Now()); err != nil {
+		b.Logger().Warn("failed to purge deleted wallets", "error", err)
+		return err
+	}
+	return nil
+}
+
+// getDeletedWallet retrieves a deleted wallet, or nil if none exists
+func getDeletedWallet(ctx context.Context, s logical.Storage, name string) (*deletedWallet, error) {
+	entry, err := s.Get(ctx, deletedWalletsStoragePrefix+name)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving deleted wallet: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	deleted := new(deletedWallet)
+	if err := entry.DecodeJSON(deleted); err != nil {
+		return nil, fmt.Errorf("error decoding deleted wallet: %w", err)
+	}
+	if deleted.Wallet == nil {
+		return nil, fmt.Errorf("deleted wallet %q has no wallet data", name)
+	}
+	return deleted, nil
+}
+
+// listDeletedWallets retrieves every deleted wallet from storage
+func listDeletedWallets(ctx context.Context, s logical.Storage) ([]*deletedWallet, error) {
+	names, err := s.List(ctx, deletedWalletsStoragePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("error listing deleted wallets: %w", err)
+	}
+
+	deleted := make([]*deletedWallet, 0, len(names))
+	for _, name := range names {
+		d, err := getDeletedWallet(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			deleted = append(deleted, d)
+		}
+	}
+	return deleted, nil
+}
+
+// saveDeletedWallet writes a deleted wallet to storage
+func saveDeletedWallet(ctx context.Context, s logical.Storage, deleted *deletedWallet) error {
+	entry, err := logical.StorageEntryJSON(deletedWalletsStoragePrefix+deleted.Wallet.Name, deleted)
+	if err != nil {
+		return fmt.Errorf("error creating storage entry: %w", err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return fmt.Errorf("error saving deleted wallet: %w", err)
+	}
+	return nil
+}
+
+// deletedWalletNameError describes a wallet name still held by a deleted
+// wallet, or returns "" if the name is free
+func deletedWalletNameError(ctx context.Context, s logical.Storage, name string) (string, error) {
+	deleted, err := getDeletedWallet(ctx, s, name)
+	if err != nil || deleted == nil {
+		return "", err
+	}
+	return fmt.Sprintf("wallet %q was deleted and can be undeleted until %s; undelete it with btc/wallets/%s/undelete or purge it with a delete on btc/deleted-wallets/%s",
+		name, deleted.PurgeAfter.Format(time.RFC3339), name, name), nil
+}
+
+const pathDeletedWalletsHelpSynopsis = `
+List, inspect, or purge deleted wallets.
+`
+
+const pathDeletedWalletsHelpDescription = `
+Deleting a wallet moves it here for the deleted_wallet_retention period set in
+btc/config (default: 720h). The seed and address records are kept, and the
+wallet can be brought back with btc/wallets/:name/undelete. Once the retention
+period is over, the wallet and its addresses are purged in the background.
+Its name cannot be reused until then.
+
+Deleting an entry here purges it immediately. This permanently destroys the
+seed.
+
+Examples:
+  $ vault list btc/deleted-wallets
+  $ vault read btc/deleted-wallets/old-wallet
+  $ vault delete btc/deleted-wallets/old-wallet
+`
+
+const pathWalletUndeleteHelpSynopsis = `
+Restore a deleted wallet.
+`
+
+const pathWalletUndeleteHelpDescription = `
+Brings back a wallet deleted within the deleted_wallet_retention period, with
+its seed, accounts, and address records.
+
+Example:
+  $ vault write -f btc/wallets/old-wallet/undelete
+`
@@ -0,0 +1,651 @@
+package btc
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/djschnei21/vault-plugin-btc/wallet"
+)
+
+const (
+	seedEncryptionStoragePath = "seed_encryption"
+	seedKeyringStoragePath    = "seed_keyring"
+
+	// seedDataKeyLength is the size of the AES-256 key that encrypts seeds
+	seedDataKeyLength = 32
+
+	defaultTransitMount = "transit"
+)
+
+// seedEncryptionConfig stores the optional envelope encryption of wallet
+// seeds. When enabled, seeds are encrypted with a per-mount data key, which
+// is itself encrypted by a Vault Transit key when transit_key is set.
+type seedEncryptionConfig struct {
+	Enabled          bool   `json:"enabled"`
+	TransitAddress   string `json:"transit_address,omitempty"`
+	TransitToken     string `json:"transit_token,omitempty"`
+	TransitNamespace string `json:"transit_namespace,omitempty"`
+	TransitMount     string `json:"transit_mount,omitempty"`
+	TransitKey       string `json:"transit_key,omitempty"` // empty = data key kept in plugin storage only
+}
+
+// seedDataKey is one version of the per-mount key that encrypts wallet seeds
+type seedDataKey struct {
+	Version    int       `json:"version"`
+	Key        []byte    `json:"key,omitempty"`         // plaintext, when no Transit key is configured
+	WrappedKey string    `json:"wrapped_key,omitempty"` // Transit ciphertext of the key
+	TransitKey string    `json:"transit_key,omitempty"` // Transit key that wrapped it
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// seedKeyring holds every data key version. Wallets are re-encrypted with
+// the current version on rotation; older versions are kept so that wallet
+// records written concurrently with a rotation stay readable.
+type seedKeyring struct {
+	CurrentVersion int                  `json:"current_version"`
+	Keys           map[int]*seedDataKey `json:"keys"`
+}
+
+// current returns the data key new seeds are encrypted with
+func (k *seedKeyring) current() *seedDataKey {
+	if k == nil {
+		return nil
+	}
+	return k.key(k.CurrentVersion)
+}
+
+// key returns the data key of a version, or nil if the keyring does not have it
+func (k *seedKeyring) key(version int) *seedDataKey {
+	if k == nil {
+		return nil
+	}
+	return k.Keys[version]
+}
+
+// add stores a data key and makes it the current version
+func (k *seedKeyring) add(dataKey *seedDataKey) {
+	if k.Keys == nil {
+		k.Keys = make(map[int]*seedDataKey)
+	}
+	k.Keys[dataKey.Version] = dataKey
+	k.CurrentVersion = dataKey.Version
+}
+
+// transitKEK wraps data keys with a named Vault Transit key
+type transitKEK struct {
+	client *api.Client
+	mount  string
+	key    string
+}
+
+// kek returns the Transit client of the config, or nil when data keys are
+// kept in plugin storage
+func (c *seedEncryptionConfig) kek() (*transitKEK, error) {
+	if c == nil || c.TransitKey == "" {
+		return nil, nil
+	}
+
+	apiConfig := api.DefaultConfig()
+	if apiConfig.Error != nil {
+		return nil, fmt.Errorf("failed to configure Vault client: %w", apiConfig.Error)
+	}
+	apiConfig.Address = c.TransitAddress
+
+	client, err := api.NewClient(apiConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vault client: %w", err)
+	}
+	client.SetToken(c.TransitToken)
+	if c.TransitNamespace != "" {
+		client.SetNamespace(c.TransitNamespace)
+	}
+
+	mount := c.TransitMount
+	if mount == "" {
+		mount = defaultTransitMount
+	}
+
+	return &transitKEK{client: client, mount: strings.Trim(mount, "/"), key: c.TransitKey}, nil
+}
+
+// wrap encrypts a data key with the latest version of the Transit key
+func (t *transitKEK) wrap(ctx context.Context, key []byte) (string, error) {
+	secret, err := t.client.Logical().WriteWithContext(ctx, t.mount+"/encrypt/"+t.key, map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("transit encrypt failed: %w", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return "", fmt.Errorf("transit encrypt returned no data")
+	}
+
+	ciphertext, ok := secret.Data["ciphertext"].(string)
+	if !ok || ciphertext == "" {
+		return "", fmt.Errorf("transit encrypt returned no ciphertext")
+	}
+	return ciphertext, nil
+}
+
+// unwrap decrypts a data key wrapped by the Transit key
+func (t *transitKEK) unwrap(ctx context.Context, ciphertext string) ([]byte, error) {
+	secret, err := t.client.Logical().WriteWithContext(ctx, t.mount+"/decrypt/"+t.key, map[string]interface{}{
+		"ciphertext": ciphertext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("transit decrypt failed: %w", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("transit decrypt returned no data")
+	}
+
+	plaintext, _ := secret.Data["plaintext"].(string)
+	key, err := base64.StdEncoding.DecodeString(plaintext)
+	if err != nil || len(key) != seedDataKeyLength {
+		return nil, fmt.Errorf("transit decrypt returned an invalid data key")
+	}
+	return key, nil
+}
+
+// newSeedDataKey generates a data key and wraps it with the configured KEK
+func newSeedDataKey(ctx context.Context, config *seedEncryptionConfig, version int) (*seedDataKey, []byte, error) {
+	key := make([]byte, seedDataKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	dataKey := &seedDataKey{
+		Version:   version,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := dataKey.wrap(ctx, config, key); err != nil {
+		return nil, nil, err
+	}
+	return dataKey, key, nil
+}
+
+// wrap stores key in the data key entry, encrypted by the KEK of config if any
+func (k *seedDataKey) wrap(ctx context.Context, config *seedEncryptionConfig, key []byte) error {
+	kek, err := config.kek()
+	if err != nil {
+		return err
+	}
+	if kek == nil {
+		k.Key, k.WrappedKey, k.TransitKey = key, "", ""
+		return nil
+	}
+
+	wrapped, err := kek.wrap(ctx, key)
+	if err != nil {
+		return err
+	}
+	k.Key, k.WrappedKey, k.TransitKey = nil, wrapped, kek.key
+	return nil
+}
+
+// unwrap returns the plaintext data key, decrypting it with the KEK of
+// config when it was wrapped
+func (k *seedDataKey) unwrap(ctx context.Context, config *seedEncryptionConfig) ([]byte, error) {
+	if k.WrappedKey == "" {
+		if len(k.Key) != seedDataKeyLength {
+			return nil, fmt.Errorf("seed data key version %d is invalid", k.Version)
+		}
+		return k.Key, nil
+	}
+
+	kek, err := config.kek()
+	if err != nil {
+		return nil, err
+	}
+	if kek == nil || kek.key != k.TransitKey {
+		return nil, fmt.Errorf("seed data key version %d is wrapped by transit key %q, which is not configured", k.Version, k.TransitKey)
+	}
+	return kek.unwrap(ctx, k.WrappedKey)
+}
+
+// sealSeed encrypts a seed with a data key. The wallet name is bound as
+// additional data so a sealed seed cannot be moved to another wallet.
+// The result is "v<version>:<base64 nonce||ciphertext>".
+func sealSeed(key []byte, version int, walletName string, seed []byte) (string, error) {
+	aead, err := newSeedCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, seed, []byte(walletName))
+	return fmt.Sprintf("v%d:%s", version, base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// openSeed decrypts a seed sealed by sealSeed
+func openSeed(key []byte, walletName, sealed string) ([]byte, error) {
+	_, payload, err := parseSealedSeed(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("malformed sealed seed: %w", err)
+	}
+
+	aead, err := newSeedCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < aead.NonceSize() {
+		return nil, fmt.Errorf("malformed sealed seed")
+	}
+
+	seed, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(walletName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt seed of wallet %q", walletName)
+	}
+	return seed, nil
+}
+
+// parseSealedSeed splits a sealed seed into its data key version and payload
+func parseSealedSeed(sealed string) (int, string, error) {
+	prefix, payload, ok := strings.Cut(sealed, ":")
+	if !ok || !strings.HasPrefix(prefix, "v") {
+		return 0, "", fmt.Errorf("malformed sealed seed")
+	}
+	version, err := strconv.Atoi(prefix[1:])
+	if err != nil || version < 1 {
+		return 0, "", fmt.Errorf("malformed sealed seed version %q", prefix)
+	}
+	return version, payload, nil
+}
+
+func newSeedCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed data key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// walletSeed returns the seed of a wallet, decrypting it when the wallet is
+// sealed. Only signing and key export should need it: addresses of sealed
+// wallets are derived from the cached account public keys.
+func walletSeed(ctx context.Context, s logical.Storage, w *btcWallet) ([]byte, error) {
+	if len(w.Seed) > 0 {
+		return w.Seed, nil
+	}
+	if w.SealedSeed == "" {
+		return nil, fmt.Errorf("wallet %q has no seed", w.Name)
+	}
+
+	version, _, err := parseSealedSeed(w.SealedSeed)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := getSeedEncryptionConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	keyring, err := getSeedKeyring(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	dataKey := keyring.key(version)
+	if dataKey == nil {
+		return nil, fmt.Errorf("seed data key version %d of wallet %q not found", version, w.Name)
+	}
+
+	key, err := dataKey.unwrap(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return openSeed(key, w.Name, w.SealedSeed)
+}
+
+// accountKeyID identifies a cached account public key, e.g. "p2tr/0"
+func accountKeyID(account uint32, addressType string) string {
+	return fmt.Sprintf("%s/%d", addressType, account)
+}
+
+// sealedAddressTypes are the address types whose account keys are cached
+var sealedAddressTypes = []string{AddressTypeP2TR, AddressTypeP2WPKH, AddressTypeP2SHP2WPKH, AddressTypeP2PKH}
+
+// setAccountKeys caches the public keys of an account for every address type
+func setAccountKeys(w *btcWallet, seed []byte, network string, account uint32) error {
+	if w.AccountKeys == nil {
+		w.AccountKeys = make(map[string]string)
+	}
+	for _, addressType := range sealedAddressTypes {
+		accountPubKey, err := wallet.AccountPublicKey(seed, network, account, addressType)
+		if err != nil {
+			return err
+		}
+		w.AccountKeys[accountKeyID(account, addressType)] = accountPubKey
+	}
+	return nil
+}
+
+// addWalletAccountKeys caches the public keys of a new account of a sealed
+// wallet, so its addresses can be derived without decrypting the seed again
+func addWalletAccountKeys(ctx context.Context, s logical.Storage, w *btcWallet, network string, account uint32) error {
+	if w.SealedSeed == "" {
+		return nil
+	}
+	seed, err := walletSeed(ctx, s, w)
+	if err != nil {
+		return err
+	}
+	return setAccountKeys(w, seed, network, account)
+}
+
+// walletAddressInfo derives an address of a wallet. Sealed wallets use the
+// cached account public key and fall back to decrypting the seed.
+func walletAddressInfo(ctx context.Context, s logical.Storage, w *btcWallet, network string, account, change, index uint32, addressType string) (*wallet.AddressInfo, error) {
+	if len(w.Seed) == 0 {
+		if accountPubKey := w.AccountKeys[accountKeyID(account, addressType)]; accountPubKey != "" {
+			return wallet.GenerateAddressInfoFromAccountKey(accountPubKey, network, account, change, index, addressType)
+		}
+	}
+
+	seed, err := walletSeed(ctx, s, w)
+	if err != nil {
+		return nil, err
+	}
+	return wallet.GenerateAddressInfoForAccount(seed, network, account, change, index, addressType)
+}
+
+// walletAccountXpub returns the exported extended public key of an account
+// (see wallet.GetAccountXpubForAccount) without decrypting a sealed seed
+func walletAccountXpub(ctx context.Context, s logical.Storage, w *btcWallet, network string, account uint32, addressType string) (string, string, error) {
+	if len(w.Seed) == 0 {
+		if accountPubKey := w.AccountKeys[accountKeyID(account, addressType)]; accountPubKey != "" {
+			return wallet.AccountXpubFromPublicKey(accountPubKey, network, account, addressType)
+		}
+	}
+
+	seed, err := walletSeed(ctx, s, w)
+	if err != nil {
+		return "", "", err
+	}
+	return wallet.GetAccountXpubForAccount(seed, network, account, addressType)
+}
+
+// sealWalletWithKey encrypts the plaintext seed of a wallet with a data key
+// and caches the public keys of its accounts. The wallet is not saved.
+func sealWalletWithKey(w *btcWallet, network string, key []byte, version int) error {
+	seed := w.Seed
+	for _, account := range w.accountIndices() {
+		if err := setAccountKeys(w, seed, network, account); err != nil {
+			return err
+		}
+	}
+
+	sealed, err := sealSeed(key, version, w.Name, seed)
+	if err != nil {
+		return err
+	}
+	w.SealedSeed = sealed
+	w.Seed = nil
+	return nil
+}
+
+// sealNewWallet seals the seed of a wallet being created when seed
+// encryption is enabled. The wallet is not saved.
+func sealNewWallet(ctx context.Context, s logical.Storage, w *btcWallet, network string) error {
+	config, err := getSeedEncryptionConfig(ctx, s)
+	if err != nil {
+		return err
+	}
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	keyring, err := getSeedKeyring(ctx, s)
+	if err != nil {
+		return err
+	}
+	dataKey := keyring.current()
+	if dataKey == nil {
+		return fmt.Errorf("seed encryption is enabled but no data key exists")
+	}
+
+	key, err := dataKey.unwrap(ctx, config)
+	if err != nil {
+		return err
+	}
+	return sealWalletWithKey(w, network, key, dataKey.Version)
+}
+
+// getSeedEncryptionConfig retrieves the seed encryption config, or nil if it
+// was never written
+func getSeedEncryptionConfig(ctx context.Context, s logical.Storage) (*seedEncryptionConfig, error) {
+	entry, err := s.Get(ctx, seedEncryptionStoragePath)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving seed encryption config: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	config := new(seedEncryptionConfig)
+	if err := entry.DecodeJSON(config); err != nil {
+		return nil, fmt.Errorf("error decoding seed encryption config: %w", err)
+	}
+	return config, nil
+}
+
+// getSeedKeyring retrieves the seed data keys, or nil if none exist
+func getSeedKeyring(ctx context.Context, s logical.Storage) (*seedKeyring, error) {
+	entry, err := s.Get(ctx, seedKeyringStoragePath)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving seed keyring: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	keyring := new(seedKeyring)
+	if err := entry.DecodeJSON(keyring); err != nil {
+		return nil, fmt.Errorf("error decoding seed keyring: %w", err)
+	}
+	return keyring, nil
+}
+
+// saveSeedKeyring saves the seed data keys
+func saveSeedKeyring(ctx context.Context, s logical.Storage, keyring *seedKeyring) error {
+	entry, err := logical.StorageEntryJSON(seedKeyringStoragePath, keyring)
+	if err != nil {
+		return fmt.Errorf("error creating storage entry: %w", err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return fmt.Errorf("error saving seed keyring: %w", err)
+	}
+	return nil
+}
+
+// kekID identifies the Transit key of a config, ignoring how it is reached
+func (c *seedEncryptionConfig) kekID() string {
+	if c == nil || c.TransitKey == "" {
+		return ""
+	}
+	mount := c.TransitMount
+	if mount == "" {
+		mount = defaultTransitMount
+	}
+	return c.TransitNamespace + "|" + strings.Trim(mount, "/") + "|" + c.TransitKey
+}
+
+// unwrapAll returns the plaintext of every data key version
+func (k *seedKeyring) unwrapAll(ctx context.Context, config *seedEncryptionConfig) (map[int][]byte, error) {
+	keys := make(map[int][]byte, len(k.Keys))
+	for version, dataKey := range k.Keys {
+		key, err := dataKey.unwrap(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		keys[version] = key
+	}
+	return keys, nil
+}
+
+// rewrap re-encrypts every data key version from the KEK of one config to
+// the KEK of another (or the latest version of the same Transit key)
+func (k *seedKeyring) rewrap(ctx context.Context, from, to *seedEncryptionConfig) error {
+	keys, err := k.unwrapAll(ctx, from)
+	if err != nil {
+		return err
+	}
+	for version, key := range keys {
+		if err := k.Keys[version].wrap(ctx, to, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resealWallets encrypts every wallet seed with the current data key:
+// plaintext seeds are sealed and seeds sealed with an older version are
+// re-encrypted in place. Deleted wallets awaiting purge are included. It
+// returns the number of wallets rewritten.
+func (b *btcBackend) resealWallets(ctx context.Context, s logical.Storage, config *seedEncryptionConfig, keyring *seedKeyring) (int, error) {
+	keys, err := keyring.unwrapAll(ctx, config)
+	if err != nil {
+		return 0, err
+	}
+
+	return b.updateWalletSeeds(ctx, s, func(w *btcWallet) (bool, error) {
+		return resealWallet(ctx, s, w, keys, keyring.CurrentVersion)
+	})
+}
+
+// resealWallet seals the seed of a wallet with the current data key unless
+// it already is. The wallet is not saved.
+func resealWallet(ctx context.Context, s logical.Storage, w *btcWallet, keys map[int][]byte, current int) (bool, error) {
+	if len(w.Seed) == 0 {
+		if w.SealedSeed == "" {
+			return false, nil
+		}
+		version, _, err := parseSealedSeed(w.SealedSeed)
+		if err != nil {
+			return false, fmt.Errorf("wallet %q: %w", w.Name, err)
+		}
+		if version == current {
+			return false, nil
+		}
+		if keys[version] == nil {
+			return false, fmt.Errorf("seed data key version %d of wallet %q not found", version, w.Name)
+		}
+		if w.Seed, err = openSeed(keys[version], w.Name, w.SealedSeed); err != nil {
+			return false, err
+		}
+	}
+
+	network, err := walletNetwork(ctx, s, w)
+	if err != nil {
+		return false, err
+	}
+	if err := sealWalletWithKey(w, network, keys[current], current); err != nil {
+		return false, fmt.Errorf("failed to seal wallet %q: %w", w.Name, err)
+	}
+	return true, nil
+}
+
+// unsealWallets stores every sealed wallet seed in plaintext again,
+// including those of deleted wallets awaiting purge, and returns the number
+// of wallets rewritten
+func (b *btcBackend) unsealWallets(ctx context.Context, s logical.Storage, config *seedEncryptionConfig, keyring *seedKeyring) (int, error) {
+	keys, err := keyring.unwrapAll(ctx, config)
+	if err != nil {
+		return 0, err
+	}
+
+	return b.updateWalletSeeds(ctx, s, func(w *btcWallet) (bool, error) {
+		if w.SealedSeed == "" {
+			return false, nil
+		}
+		version, _, err := parseSealedSeed(w.SealedSeed)
+		if err != nil {
+			return false, fmt.Errorf("wallet %q: %w", w.Name, err)
+		}
+		if keys[version] == nil {
+			return false, fmt.Errorf("seed data key version %d of wallet %q not found", version, w.Name)
+		}
+		if w.Seed, err = openSeed(keys[version], w.Name, w.SealedSeed); err != nil {
+			return false, err
+		}
+		w.SealedSeed = ""
+		w.AccountKeys = nil
+		return true, nil
+	})
+}
+
+// updateWalletSeeds applies update to every wallet and deleted wallet, and
+// saves those it changed. It returns the number of wallets saved.
+func (b *btcBackend) updateWalletSeeds(ctx context.Context, s logical.Storage, update func(w *btcWallet) (bool, error)) (int, error) {
+	names, err := s.List(ctx, walletsStoragePrefix)
+	if err != nil {
+		return 0, fmt.Errorf("error listing wallets: %w", err)
+	}
+
+	// Each wallet is read and written under its lock, so a concurrent spend
+	// saving its counters is neither lost nor overwritten
+	updateWallet := func(name string) (bool, error) {
+		defer b.lockWallet(name)()
+
+		w, err := getWallet(ctx, s, name)
+		if err != nil || w == nil {
+			return false, err
+		}
+		changed, err := update(w)
+		if err != nil || !changed {
+			return false, err
+		}
+		return true, saveWallet(ctx, s, w)
+	}
+
+	var count int
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		changed, err := updateWallet(name)
+		if err != nil {
+			return count, err
+		}
+		if changed {
+			count++
+		}
+	}
+
+	deleted, err := listDeletedWallets(ctx, s)
+	if err != nil {
+		return count, err
+	}
+	for _, d := range deleted {
+		changed, err := update(d.Wallet)
+		if err != nil {
+			return count, err
+		}
+		if !changed {
+			continue
+		}
+		if err := saveDeletedWallet(ctx, s, d); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -1,5 +1,7 @@
 package btc
 
+import "encoding/hex"
+
 // UTXOInfo represents detailed UTXO information
 type UTXOInfo struct {
 	TxID          string `json:"txid"`
@@ -7,7 +9,45 @@ type UTXOInfo struct {
 	Value         int64  `json:"value"`
 	Address       string `json:"address"`
 	AddressIndex  uint32 `json:"address_index"`
+	Change        bool   `json:"change,omitempty"` // True if the address is on the change chain
+	AddressType   string `json:"address_type"`
 	ScriptHash    string `json:"scripthash"`
 	Height        int64  `json:"height"`
 	Confirmations int64  `json:"confirmations"`
+
+	// SilentPaymentTweak is the hex tweak of an output received at the
+	// account's silent payment address, which has no address index
+	SilentPaymentTweak string `json:"silent_payment_tweak,omitempty"`
+}
+
+// chain returns the BIP44 change level of the UTXO's address (0 external, 1 internal)
+func (u *UTXOInfo) chain() uint32 {
+	if u.Change {
+		return 1
+	}
+	return 0
+}
+
+// silentPaymentTweak returns the decoded silent payment tweak, or nil for
+// outputs of derived addresses
+func (u *UTXOInfo) silentPaymentTweak() []byte {
+	tweak, _ := hex.DecodeString(u.SilentPaymentTweak)
+	return tweak
+}
+
+// confirmationsAt returns the confirmations of an output mined at height
+// with the chain tip at currentBlockHeight. Height 0 is the mempool.
+func confirmationsAt(height, currentBlockHeight int64) int64 {
+	if height <= 0 {
+		return 0
+	}
+	if currentBlockHeight <= 0 {
+		// Block height unknown but UTXO is in a block - treat as 1 confirmation minimum
+		return 1
+	}
+	confirmations := currentBlockHeight - height + 1
+	if confirmations < 0 {
+		confirmations = 0 // Sanity check for reorgs
+	}
+	return confirmations
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 
+	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
@@ -59,6 +60,65 @@ func GenerateP2TRAddress(key *hdkeychain.ExtendedKey, network string) (string, e
 	return addr.EncodeAddress(), nil
 }
 
+// GenerateP2PKHAddress generates a legacy (base58) pay-to-pubkey-hash address from an extended key
+func GenerateP2PKHAddress(key *hdkeychain.ExtendedKey, network string) (string, error) {
+	params, err := NetworkParams(network)
+	if err != nil {
+		return "", err
+	}
+
+	pubKey, err := key.ECPubKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to get public key: %w", err)
+	}
+
+	// Create P2PKH address (1... for mainnet, m.../n... for testnet)
+	pubKeyHash := btcutil.Hash160(pubKey.SerializeCompressed())
+	addr, err := btcutil.NewAddressPubKeyHash(pubKeyHash, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to create P2PKH address: %w", err)
+	}
+
+	return addr.EncodeAddress(), nil
+}
+
+// GenerateP2SHP2WPKHAddress generates a nested SegWit (P2SH-wrapped P2WPKH) address from an extended key
+// Uses BIP49 address encoding (3... for mainnet, 2... for testnet)
+func GenerateP2SHP2WPKHAddress(key *hdkeychain.ExtendedKey, network string) (string, error) {
+	params, err := NetworkParams(network)
+	if err != nil {
+		return "", err
+	}
+
+	pubKey, err := key.ECPubKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to get public key: %w", err)
+	}
+
+	redeemScript, err := NestedP2WPKHRedeemScript(pubKey)
+	if err != nil {
+		return "", err
+	}
+
+	addr, err := btcutil.NewAddressScriptHash(redeemScript, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to create P2SH-P2WPKH address: %w", err)
+	}
+
+	return addr.EncodeAddress(), nil
+}
+
+// NestedP2WPKHRedeemScript returns the P2SH redeem script of a nested SegWit
+// address, which is the P2WPKH witness program: OP_0 <20-byte pubkey hash>
+func NestedP2WPKHRedeemScript(pubKey *btcec.PublicKey) ([]byte, error) {
+	pubKeyHash := btcutil.Hash160(pubKey.SerializeCompressed())
+	script, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(pubKeyHash).Script()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redeem script: %w", err)
+	}
+	return script, nil
+}
+
 // GenerateAddressFromSeed generates an address for a specific index from a seed
 // Uses the default P2WPKH address type (for backwards compatibility)
 func GenerateAddressFromSeed(seed []byte, network string, index uint32) (string, error) {
@@ -67,16 +127,31 @@ func GenerateAddressFromSeed(seed []byte, network string, index uint32) (string,
 
 // GenerateAddressFromSeedForType generates an address for a specific index and address type
 func GenerateAddressFromSeedForType(seed []byte, network string, index uint32, addressType string) (string, error) {
-	key, err := DeriveReceivingKeyForType(seed, network, index, addressType)
+	return GenerateAddressForAccount(seed, network, 0, 0, index, addressType)
+}
+
+// GenerateAddressForAccount generates an address for any account, chain and index
+// Path: m/purpose'/coin'/account'/change/index
+func GenerateAddressForAccount(seed []byte, network string, account, change, index uint32, addressType string) (string, error) {
+	key, err := DeriveKeyForAccount(seed, network, account, change, index, addressType)
 	if err != nil {
 		return "", err
 	}
 
+	return addressForKey(key, network, addressType)
+}
+
+// addressForKey encodes the address of a derived key for an address type
+func addressForKey(key *hdkeychain.ExtendedKey, network string, addressType string) (string, error) {
 	switch addressType {
 	case AddressTypeP2TR:
 		return GenerateP2TRAddress(key, network)
 	case AddressTypeP2WPKH:
 		return GenerateP2WPKHAddress(key, network)
+	case AddressTypeP2SHP2WPKH:
+		return GenerateP2SHP2WPKHAddress(key, network)
+	case AddressTypeP2PKH:
+		return GenerateP2PKHAddress(key, network)
 	default:
 		return "", fmt.Errorf("unsupported address type: %s", addressType)
 	}
@@ -85,22 +160,10 @@ func GenerateAddressFromSeedForType(seed []byte, network string, index uint32, a
 // GenerateChangeAddressFromSeedForType generates a change address (internal chain) for a specific index
 // Change addresses use derivation path m/purpose'/coin'/0'/1/index (note chain=1)
 func GenerateChangeAddressFromSeedForType(seed []byte, network string, index uint32, addressType string) (string, error) {
-	key, err := DeriveChangeKeyForType(seed, network, index, addressType)
-	if err != nil {
-		return "", err
-	}
-
-	switch addressType {
-	case AddressTypeP2TR:
-		return GenerateP2TRAddress(key, network)
-	case AddressTypeP2WPKH:
-		return GenerateP2WPKHAddress(key, network)
-	default:
-		return "", fmt.Errorf("unsupported address type: %s", addressType)
-	}
+	return GenerateAddressForAccount(seed, network, 0, 1, index, addressType)
 }
 
-// GetScriptPubKey returns the scriptPubKey for a P2WPKH address
+// GetScriptPubKey returns the scriptPubKey for an address of any type
 func GetScriptPubKey(address string, network string) ([]byte, error) {
 	params, err := NetworkParams(network)
 	if err != nil {
@@ -138,13 +201,20 @@ func AddressToScriptHash(address string, network string) (string, error) {
 	return hex.EncodeToString(hash[:]), nil
 }
 
-// ValidateAddress checks if an address is valid for the given network
+// ValidateAddress checks if an address is valid for the given network.
+// Silent payment addresses are valid, but have no scriptPubKey until the
+// inputs paying them are known (see SilentPaymentDestination).
 func ValidateAddress(address string, network string) error {
 	params, err := NetworkParams(network)
 	if err != nil {
 		return err
 	}
 
+	if IsSilentPaymentAddress(address) {
+		_, _, err := DecodeSilentPaymentAddress(address, network)
+		return err
+	}
+
 	addr, err := btcutil.DecodeAddress(address, params)
 	if err != nil {
 		return fmt.Errorf("invalid address: %w", err)
@@ -191,6 +261,7 @@ type AddressInfo struct {
 	Index          uint32 `json:"index"`
 	DerivationPath string `json:"derivation_path"`
 	ScriptHash     string `json:"scripthash"`
+	AddressType    string `json:"address_type"`
 }
 
 // GenerateAddressInfo generates complete address information
@@ -201,11 +272,41 @@ func GenerateAddressInfo(seed []byte, network string, index uint32) (*AddressInf
 
 // GenerateAddressInfoForType generates complete address information for a specific address type
 func GenerateAddressInfoForType(seed []byte, network string, index uint32, addressType string) (*AddressInfo, error) {
-	address, err := GenerateAddressFromSeedForType(seed, network, index, addressType)
+	return GenerateAddressInfoForAccount(seed, network, 0, 0, index, addressType)
+}
+
+// GenerateAddressInfoForAccount generates complete address information for any account and chain
+func GenerateAddressInfoForAccount(seed []byte, network string, account, change, index uint32, addressType string) (*AddressInfo, error) {
+	address, err := GenerateAddressForAccount(seed, network, account, change, index, addressType)
 	if err != nil {
 		return nil, err
 	}
 
+	return newAddressInfo(address, network, account, change, index, addressType)
+}
+
+// GenerateAddressInfoFromAccountKey generates complete address information
+// from an account public key (see AccountPublicKey), without the seed
+func GenerateAddressInfoFromAccountKey(accountPubKey string, network string, account, change, index uint32, addressType string) (*AddressInfo, error) {
+	accountKey, err := hdkeychain.NewKeyFromString(accountPubKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid account public key: %w", err)
+	}
+
+	key, err := DeriveAddressKey(accountKey, change, index)
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := addressForKey(key, network, addressType)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAddressInfo(address, network, account, change, index, addressType)
+}
+
+func newAddressInfo(address string, network string, account, change, index uint32, addressType string) (*AddressInfo, error) {
 	scripthash, err := AddressToScriptHash(address, network)
 	if err != nil {
 		return nil, err
@@ -214,7 +315,8 @@ func GenerateAddressInfoForType(seed []byte, network string, index uint32, addre
 	return &AddressInfo{
 		Address:        address,
 		Index:          index,
-		DerivationPath: DerivationPathForType(network, 0, index, addressType),
+		DerivationPath: DerivationPathForAccount(network, account, change, index, addressType),
 		ScriptHash:     scripthash,
+		AddressType:    addressType,
 	}, nil
 }
@@ -19,6 +19,7 @@ func TestGenerateP2WPKHAddress(t *testing.T) {
 		{"mainnet index 1", "mainnet", 1, "bc1q"},
 		{"testnet4 index 0", "testnet4", 0, "tb1q"},
 		{"testnet4 index 1", "testnet4", 1, "tb1q"},
+		{"regtest index 0", "regtest", 0, "bcrt1q"},
 	}
 
 	for _, tt := range tests {
@@ -59,6 +60,7 @@ func TestGenerateP2TRAddress(t *testing.T) {
 		{"mainnet index 1", "mainnet", 1, "bc1p"},
 		{"testnet4 index 0", "testnet4", 0, "tb1p"},
 		{"testnet4 index 1", "testnet4", 1, "tb1p"},
+		{"regtest index 0", "regtest", 0, "bcrt1p"},
 	}
 
 	for _, tt := range tests {
@@ -641,3 +643,121 @@ func TestAddressGenerationBIP84Vectors(t *testing.T) {
 		}
 	})
 }
+
+func TestGenerateAddressForAccount(t *testing.T) {
+	// BIP84 test vector mnemonic: abandon ... about
+	seedHex := "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+	seed, _ := hex.DecodeString(seedHex)
+
+	t.Run("BIP84 first change address", func(t *testing.T) {
+		// m/84'/0'/0'/1/0
+		expected := "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"
+		address, err := GenerateAddressForAccount(seed, "mainnet", 0, 1, 0, AddressTypeP2WPKH)
+		if err != nil {
+			t.Fatalf("GenerateAddressForAccount() error = %v", err)
+		}
+		if address != expected {
+			t.Errorf("BIP84 vector mismatch:\ngot:  %s\nwant: %s", address, expected)
+		}
+	})
+
+	t.Run("accounts are independent", func(t *testing.T) {
+		addr0, _ := GenerateAddressForAccount(seed, "mainnet", 0, 0, 0, AddressTypeP2WPKH)
+		addr1, err := GenerateAddressForAccount(seed, "mainnet", 1, 0, 0, AddressTypeP2WPKH)
+		if err != nil {
+			t.Fatalf("GenerateAddressForAccount() error = %v", err)
+		}
+		if addr0 == addr1 {
+			t.Error("account 0 and account 1 should produce different addresses")
+		}
+	})
+
+	t.Run("address info carries account path", func(t *testing.T) {
+		info, err := GenerateAddressInfoForAccount(seed, "mainnet", 2, 1, 4, AddressTypeP2TR)
+		if err != nil {
+			t.Fatalf("GenerateAddressInfoForAccount() error = %v", err)
+		}
+		if info.DerivationPath != "m/86'/0'/2'/1/4" {
+			t.Errorf("DerivationPath = %s, want m/86'/0'/2'/1/4", info.DerivationPath)
+		}
+	})
+}
+
+func TestAddressGenerationBIP44BIP49Vectors(t *testing.T) {
+	// Mnemonic: abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about
+	seedHex := "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+	seed, _ := hex.DecodeString(seedHex)
+
+	tests := []struct {
+		name     string
+		network  string
+		addrType string
+		path     string
+		expected string
+	}{
+		{"BIP44 first address", "mainnet", AddressTypeP2PKH, "m/44'/0'/0'/0/0", "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+		{"BIP49 first address", "mainnet", AddressTypeP2SHP2WPKH, "m/49'/0'/0'/0/0", "37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf"},
+		{"BIP49 testnet first address", "testnet4", AddressTypeP2SHP2WPKH, "m/49'/1'/0'/0/0", "2Mww8dCYPUpKHofjgcXcBCEGmniw9CoaiD2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := GenerateAddressInfoForType(seed, tt.network, 0, tt.addrType)
+			if err != nil {
+				t.Fatalf("GenerateAddressInfoForType() error = %v", err)
+			}
+			if info.Address != tt.expected {
+				t.Errorf("vector mismatch:\ngot:  %s\nwant: %s", info.Address, tt.expected)
+			}
+			if info.DerivationPath != tt.path {
+				t.Errorf("DerivationPath = %s, want %s", info.DerivationPath, tt.path)
+			}
+			if info.ScriptHash == "" {
+				t.Error("ScriptHash should not be empty")
+			}
+
+			detected, err := GetAddressType(info.Address, tt.network)
+			if err != nil {
+				t.Fatalf("GetAddressType() error = %v", err)
+			}
+			want := "p2pkh"
+			if tt.addrType == AddressTypeP2SHP2WPKH {
+				want = "p2sh"
+			}
+			if detected != want {
+				t.Errorf("GetAddressType() = %s, want %s", detected, want)
+			}
+		})
+	}
+}
+
+func TestGenerateAddressInfoFromAccountKey(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+
+	for _, network := range []string{"mainnet", "regtest"} {
+		for _, addressType := range []string{AddressTypeP2WPKH, AddressTypeP2TR, AddressTypeP2SHP2WPKH, AddressTypeP2PKH} {
+			accountPubKey, err := AccountPublicKey(seed, network, 2, addressType)
+			if err != nil {
+				t.Fatalf("AccountPublicKey(%s, %s) error = %v", network, addressType, err)
+			}
+
+			for _, change := range []uint32{0, 1} {
+				want, err := GenerateAddressInfoForAccount(seed, network, 2, change, 7, addressType)
+				if err != nil {
+					t.Fatalf("GenerateAddressInfoForAccount() error = %v", err)
+				}
+				got, err := GenerateAddressInfoFromAccountKey(accountPubKey, network, 2, change, 7, addressType)
+				if err != nil {
+					t.Fatalf("GenerateAddressInfoFromAccountKey() error = %v", err)
+				}
+				if *got != *want {
+					t.Errorf("%s %s change %d: GenerateAddressInfoFromAccountKey() = %+v, want %+v", network, addressType, change, got, want)
+				}
+			}
+		}
+	}
+
+	if _, err := GenerateAddressInfoFromAccountKey("not-a-key", "mainnet", 0, 0, 0, AddressTypeP2WPKH); err == nil {
+		t.Error("GenerateAddressInfoFromAccountKey() accepted an invalid key")
+	}
+}
@@ -0,0 +1,125 @@
+package wallet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FeeRate is a fee rate in millisatoshis per vbyte, which holds the decimal
+// sat/vB rates fee estimators quote: 1.5 sat/vB is 1500
+type FeeRate int64
+
+const (
+	// msatPerSat is the number of millisatoshis in a satoshi
+	msatPerSat = 1000
+
+	// MinRelayFeeRate is the lowest fee rate nodes relay by default, 1 sat/vB
+	MinRelayFeeRate FeeRate = 1 * msatPerSat
+)
+
+// SatPerVByte returns the fee rate of whole satoshis per vbyte
+func SatPerVByte(satPerVByte int64) FeeRate {
+	return FeeRate(satPerVByte * msatPerSat)
+}
+
+// ParseFeeRate parses a decimal fee rate in sat/vB with up to three decimals,
+// e.g. "2.3"
+func ParseFeeRate(s string) (FeeRate, error) {
+	s = strings.TrimSpace(s)
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid fee rate %q", s)
+	}
+	if len(frac) > 3 {
+		return 0, fmt.Errorf("fee rate %q has more than millisatoshi precision", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	sats, err := strconv.ParseUint(whole, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fee rate %q", s)
+	}
+	var msats uint64
+	if frac != "" {
+		msats, err = strconv.ParseUint(frac+strings.Repeat("0", 3-len(frac)), 10, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid fee rate %q", s)
+		}
+	}
+	return FeeRate(sats*msatPerSat + msats), nil
+}
+
+// String formats the fee rate in sat/vB, e.g. "1.5"
+func (r FeeRate) String() string {
+	s := strconv.FormatFloat(r.SatPerVByte(), 'f', 3, 64)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// SatPerVByte returns the fee rate in sat/vB
+func (r FeeRate) SatPerVByte() float64 {
+	return float64(r) / msatPerSat
+}
+
+// FeeForVSize returns the fee of vsize vbytes at the rate, rounded up to a
+// whole satoshi so the rate is never undershot
+func (r FeeRate) FeeForVSize(vsize int) int64 {
+	return (int64(vsize)*int64(r) + msatPerSat - 1) / msatPerSat
+}
+
+// EffectiveFeeRate returns the rate paid by a fee of fee satoshis for vsize
+// vbytes, rounded down to a millisatoshi
+func EffectiveFeeRate(fee int64, vsize int) FeeRate {
+	if vsize <= 0 {
+		return 0
+	}
+	return FeeRate(fee * msatPerSat / int64(vsize))
+}
+
+// Fee is how a transaction pays for its size: at Rate, or a fixed Amount in
+// satoshis when Amount is set
+type Fee struct {
+	Rate   FeeRate
+	Amount int64
+}
+
+// Validate checks what can be checked before the size of the transaction is
+// known: the fee must be positive, and a rate must be between the minimum
+// relay fee rate and MaxReasonableFeeRate
+func (f Fee) Validate() error {
+	if f.Amount < 0 {
+		return fmt.Errorf("fee must be positive")
+	}
+	if f.Amount > 0 {
+		return nil
+	}
+	if f.Rate < MinRelayFeeRate {
+		return fmt.Errorf("fee_rate %s sat/vB is below the minimum relay fee rate of %s sat/vB", f.Rate, MinRelayFeeRate)
+	}
+	if f.Rate > SatPerVByte(MaxReasonableFeeRate) {
+		return fmt.Errorf("fee_rate %s sat/vB exceeds safety limit of %d sat/vB - this would be extremely expensive", f.Rate, MaxReasonableFeeRate)
+	}
+	return nil
+}
+
+// ForVSize returns the fee paid by a transaction of vsize vbytes. A fixed
+// amount must pay at least the minimum relay fee rate, and no more than
+// MaxReasonableFeeRate.
+func (f Fee) ForVSize(vsize int) (int64, error) {
+	if err := f.Validate(); err != nil {
+		return 0, err
+	}
+	if f.Amount == 0 {
+		return f.Rate.FeeForVSize(vsize), nil
+	}
+
+	if minimum := MinRelayFeeRate.FeeForVSize(vsize); f.Amount < minimum {
+		return 0, fmt.Errorf("fee %d is below the minimum relay fee of %d for %d vbytes", f.Amount, minimum, vsize)
+	}
+	if rate := EffectiveFeeRate(f.Amount, vsize); rate > SatPerVByte(MaxReasonableFeeRate) {
+		return 0, fmt.Errorf("fee %d pays %s sat/vB, which exceeds safety limit of %d sat/vB", f.Amount, rate, MaxReasonableFeeRate)
+	}
+	return f.Amount, nil
+}
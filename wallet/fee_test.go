@@ -0,0 +1,174 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseFeeRate(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    FeeRate
+		wantErr bool
+	}{
+		{"10", 10000, false},
+		{"1.5", 1500, false},
+		{"2.3", 2300, false},
+		{"0.125", 125, false},
+		{".5", 500, false},
+		{"3.", 3000, false},
+		{" 4 ", 4000, false},
+		{"1.2345", 0, true},
+		{"-1", 0, true},
+		{"1e3", 0, true},
+		{"", 0, true},
+		{".", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFeeRate(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFeeRate(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseFeeRate(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFeeRate(t *testing.T) {
+	if got := FeeRate(1500).String(); got != "1.5" {
+		t.Errorf("String() = %q, want 1.5", got)
+	}
+	if got := SatPerVByte(10).String(); got != "10" {
+		t.Errorf("String() = %q, want 10", got)
+	}
+
+	// Fees round up so the rate is never undershot
+	if got := FeeRate(1500).FeeForVSize(141); got != 212 {
+		t.Errorf("FeeForVSize() = %d, want 212", got)
+	}
+	if got := FeeRate(2000).FeeForVSize(141); got != 282 {
+		t.Errorf("FeeForVSize() = %d, want 282", got)
+	}
+	if got := EffectiveFeeRate(212, 141); got != 1503 {
+		t.Errorf("EffectiveFeeRate() = %d, want 1503", got)
+	}
+}
+
+func TestFeeForVSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		fee     Fee
+		want    int64
+		wantErr bool
+	}{
+		{"decimal rate", Fee{Rate: 2300}, 460, false},
+		{"fixed amount", Fee{Amount: 2000}, 2000, false},
+		{"rate below relay minimum", Fee{Rate: 999}, 0, true},
+		{"amount below relay minimum", Fee{Amount: 199}, 0, true},
+		{"rate above safety limit", Fee{Rate: SatPerVByte(MaxReasonableFeeRate + 1)}, 0, true},
+		{"amount above safety limit", Fee{Amount: 200 * (MaxReasonableFeeRate + 1)}, 0, true},
+		{"negative amount", Fee{Amount: -1}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.fee.ForVSize(200)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ForVSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ForVSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildTransactionWithFee(t *testing.T) {
+	seed, _ := hex.DecodeString("5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4")
+	info, err := GenerateAddressInfo(seed, "mainnet", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptPubKey, _ := GetScriptPubKey(info.Address, "mainnet")
+	utxo := UTXO{
+		TxID:         "0000000000000000000000000000000000000000000000000000000000000001",
+		Value:        100000,
+		Address:      info.Address,
+		ScriptPubKey: scriptPubKey,
+	}
+	outputs := []TxOutput{{Address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", Value: 50000}}
+
+	t.Run("decimal rate", func(t *testing.T) {
+		result, err := BuildTransactionWithFee(seed, "mainnet", []UTXO{utxo}, outputs, info.Address, Fee{Rate: 1500}, 0)
+		if err != nil {
+			t.Fatalf("BuildTransactionWithFee() error = %v", err)
+		}
+		// The signed transaction can come out a vbyte under the estimate
+		if want := FeeRate(1500).FeeForVSize(result.VSize); result.Fee < want || result.Fee > want+2 {
+			t.Errorf("fee %d for %d vbytes, want about %d at 1.5 sat/vB", result.Fee, result.VSize, want)
+		}
+	})
+
+	t.Run("fixed amount", func(t *testing.T) {
+		result, err := BuildTransactionWithFee(seed, "mainnet", []UTXO{utxo}, outputs, info.Address, Fee{Amount: 2000}, 0)
+		if err != nil {
+			t.Fatalf("BuildTransactionWithFee() error = %v", err)
+		}
+		if result.Fee != 2000 || result.ChangeAmount != 48000 {
+			t.Errorf("fee %d, change %d, want 2000, 48000", result.Fee, result.ChangeAmount)
+		}
+
+		consolidated, err := BuildConsolidationTransactionWithFee(seed, "mainnet", []UTXO{utxo}, outputs[0].Address, Fee{Amount: 2000}, 0)
+		if err != nil {
+			t.Fatalf("BuildConsolidationTransactionWithFee() error = %v", err)
+		}
+		if consolidated.Fee != 2000 || consolidated.TotalOutput != 98000 {
+			t.Errorf("fee %d, output %d, want 2000, 98000", consolidated.Fee, consolidated.TotalOutput)
+		}
+	})
+
+	t.Run("fixed amount with dust change", func(t *testing.T) {
+		// 400 sats would be left for change, below the dust limit
+		pay := []TxOutput{{Address: outputs[0].Address, Value: 97600}}
+		plan, err := PlanTransaction([]UTXO{utxo}, pay, info.Address, "mainnet", Fee{Amount: 2000})
+		if err != nil {
+			t.Fatalf("PlanTransaction() error = %v", err)
+		}
+		if plan.Fee != 2400 || plan.ChangeAmount != 0 {
+			t.Errorf("plan fee %d, change %d, want the dust added to the fee: 2400, 0", plan.Fee, plan.ChangeAmount)
+		}
+
+		result, err := BuildTransactionWithFee(seed, "mainnet", []UTXO{utxo}, pay, info.Address, Fee{Amount: 2000}, 0)
+		if err != nil {
+			t.Fatalf("BuildTransactionWithFee() error = %v", err)
+		}
+		if result.Fee != plan.Fee || result.ChangeAmount != 0 {
+			t.Errorf("fee %d, change %d, want the plan's %d, 0", result.Fee, result.ChangeAmount, plan.Fee)
+		}
+	})
+
+	t.Run("below relay minimum", func(t *testing.T) {
+		if _, err := BuildTransactionWithFee(seed, "mainnet", []UTXO{utxo}, outputs, info.Address, Fee{Amount: 50}, 0); err == nil {
+			t.Error("BuildTransactionWithFee() expected error")
+		}
+		if _, err := BuildTransactionWithFee(seed, "mainnet", []UTXO{utxo}, outputs, info.Address, Fee{Rate: 500}, 0); err == nil {
+			t.Error("BuildTransactionWithFee() expected error")
+		}
+	})
+
+	t.Run("selection covers a fixed amount", func(t *testing.T) {
+		change := func([]UTXO) (string, error) { return info.Address, nil }
+		pay := []TxOutput{{Address: outputs[0].Address, Value: 97000}}
+		selected, plan, err := SelectUTXOsForOutputs([]UTXO{utxo}, pay, "mainnet", Fee{Amount: 3000}, change)
+		if err != nil || len(selected) != 1 || plan.Fee != 3000 {
+			t.Errorf("SelectUTXOsForOutputs() = %d UTXOs, plan %+v, error %v", len(selected), plan, err)
+		}
+		pay[0].Value = 97001
+		if _, _, err := SelectUTXOsForOutputs([]UTXO{utxo}, pay, "mainnet", Fee{Amount: 3000}, change); err == nil {
+			t.Error("SelectUTXOsForOutputs() expected insufficient funds")
+		}
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
@@ -14,6 +16,12 @@ const (
 	// SeedLength is the recommended seed length (256 bits)
 	SeedLength = 32
 
+	// BIP44Purpose is the purpose for legacy (P2PKH)
+	BIP44Purpose = 44
+
+	// BIP49Purpose is the purpose for nested SegWit (P2SH-P2WPKH)
+	BIP49Purpose = 49
+
 	// BIP84Purpose is the purpose for native SegWit (P2WPKH)
 	BIP84Purpose = 84
 
@@ -26,11 +34,32 @@ const (
 	// CoinTypeBitcoinTestnet is the coin type for Bitcoin testnet
 	CoinTypeBitcoinTestnet = 1
 
+	// MaxAccount is the highest BIP44 account index (accounts are hardened)
+	MaxAccount = hdkeychain.HardenedKeyStart - 1
+
 	// Address type constants
-	AddressTypeP2WPKH = "p2wpkh"
-	AddressTypeP2TR   = "p2tr"
+	AddressTypeP2WPKH     = "p2wpkh"
+	AddressTypeP2TR       = "p2tr"
+	AddressTypeP2PKH      = "p2pkh"
+	AddressTypeP2SHP2WPKH = "p2sh-p2wpkh"
 )
 
+// PurposeForAddressType returns the BIP43 purpose used to derive keys of an address type
+func PurposeForAddressType(addressType string) (uint32, error) {
+	switch addressType {
+	case AddressTypeP2TR:
+		return BIP86Purpose, nil
+	case AddressTypeP2WPKH:
+		return BIP84Purpose, nil
+	case AddressTypeP2SHP2WPKH:
+		return BIP49Purpose, nil
+	case AddressTypeP2PKH:
+		return BIP44Purpose, nil
+	default:
+		return 0, fmt.Errorf("unknown address type: %s", addressType)
+	}
+}
+
 // NetworkParams returns the chain configuration for the given network name
 func NetworkParams(network string) (*chaincfg.Params, error) {
 	switch network {
@@ -41,9 +70,24 @@ func NetworkParams(network string) (*chaincfg.Params, error) {
 		return &chaincfg.TestNet3Params, nil
 	case "signet":
 		return &chaincfg.SigNetParams, nil
+	case "regtest":
+		// Regtest uses bcrt1... addresses and testnet extended key versions
+		return &chaincfg.RegressionNetParams, nil
 	default:
-		return nil, fmt.Errorf("unknown network: %s (supported: mainnet, testnet4, signet)", network)
+		if params, ok := customNetworkParams(network); ok {
+			return params, nil
+		}
+		return nil, fmt.Errorf("unknown network: %s (supported: mainnet, testnet4, signet, regtest)", network)
+	}
+}
+
+// CoinTypeForNetwork returns the BIP44 coin type of a network: 0 for mainnet,
+// 1 for every test network
+func CoinTypeForNetwork(network string) uint32 {
+	if network == "mainnet" {
+		return CoinTypeBitcoin
 	}
+	return CoinTypeBitcoinTestnet
 }
 
 // GenerateSeed creates a cryptographically secure random seed
@@ -67,6 +111,8 @@ func DeriveAccountKey(seed []byte, network string, account uint32) (*hdkeychain.
 }
 
 // DeriveAccountKeyForType derives the account extended key for a specific address type
+// BIP44 Path: m/44'/coin_type'/account' (P2PKH)
+// BIP49 Path: m/49'/coin_type'/account' (P2SH-P2WPKH)
 // BIP84 Path: m/84'/coin_type'/account' (P2WPKH)
 // BIP86 Path: m/86'/coin_type'/account' (P2TR)
 func DeriveAccountKeyForType(seed []byte, network string, account uint32, addressType string) (*hdkeychain.ExtendedKey, error) {
@@ -82,28 +128,19 @@ func DeriveAccountKeyForType(seed []byte, network string, account uint32, addres
 	}
 
 	// Determine purpose based on address type
-	var purpose uint32
-	switch addressType {
-	case AddressTypeP2TR:
-		purpose = BIP86Purpose
-	case AddressTypeP2WPKH:
-		purpose = BIP84Purpose
-	default:
-		return nil, fmt.Errorf("unknown address type: %s", addressType)
+	purpose, err := PurposeForAddressType(addressType)
+	if err != nil {
+		return nil, err
 	}
 
-	// Derive purpose: m/84' or m/86'
+	// Derive purpose: m/44', m/49', m/84' or m/86'
 	purposeKey, err := masterKey.Derive(hdkeychain.HardenedKeyStart + purpose)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive purpose key: %w", err)
 	}
 
-	// Derive coin type: m/purpose'/0' for mainnet, m/purpose'/1' for testnet4/signet
-	coinType := CoinTypeBitcoin
-	if network == "testnet4" || network == "signet" {
-		coinType = CoinTypeBitcoinTestnet
-	}
-	coinTypeKey, err := purposeKey.Derive(hdkeychain.HardenedKeyStart + uint32(coinType))
+	// Derive coin type: m/purpose'/0' for mainnet, m/purpose'/1' for test networks
+	coinTypeKey, err := purposeKey.Derive(hdkeychain.HardenedKeyStart + CoinTypeForNetwork(network))
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive coin type key: %w", err)
 	}
@@ -146,12 +183,22 @@ func DeriveReceivingKey(seed []byte, network string, index uint32) (*hdkeychain.
 // BIP84 Path: m/84'/coin_type'/0'/0/index (P2WPKH)
 // BIP86 Path: m/86'/coin_type'/0'/0/index (P2TR)
 func DeriveReceivingKeyForType(seed []byte, network string, index uint32, addressType string) (*hdkeychain.ExtendedKey, error) {
-	accountKey, err := DeriveAccountKeyForType(seed, network, 0, addressType)
+	return DeriveKeyForAccount(seed, network, 0, 0, index, addressType)
+}
+
+// DeriveKeyForAccount derives the key for any account, chain and index
+// Path: m/purpose'/coin_type'/account'/change/index
+func DeriveKeyForAccount(seed []byte, network string, account, change, index uint32, addressType string) (*hdkeychain.ExtendedKey, error) {
+	if account > MaxAccount {
+		return nil, fmt.Errorf("account %d out of range", account)
+	}
+
+	accountKey, err := DeriveAccountKeyForType(seed, network, account, addressType)
 	if err != nil {
 		return nil, err
 	}
 
-	return DeriveAddressKey(accountKey, 0, index)
+	return DeriveAddressKey(accountKey, change, index)
 }
 
 // DeriveChangeKey derives a key for change (internal chain) using BIP84
@@ -164,12 +211,7 @@ func DeriveChangeKey(seed []byte, network string, index uint32) (*hdkeychain.Ext
 // BIP84 Path: m/84'/coin_type'/0'/1/index (P2WPKH)
 // BIP86 Path: m/86'/coin_type'/0'/1/index (P2TR)
 func DeriveChangeKeyForType(seed []byte, network string, index uint32, addressType string) (*hdkeychain.ExtendedKey, error) {
-	accountKey, err := DeriveAccountKeyForType(seed, network, 0, addressType)
-	if err != nil {
-		return nil, err
-	}
-
-	return DeriveAddressKey(accountKey, 1, index)
+	return DeriveKeyForAccount(seed, network, 0, 1, index, addressType)
 }
 
 // GetPrivateKey extracts the EC private key from an extended key
@@ -203,15 +245,64 @@ func DerivationPath(network string, change, index uint32) string {
 
 // DerivationPathForType returns the derivation path string for an address with a specific type
 func DerivationPathForType(network string, change, index uint32, addressType string) string {
-	coinType := CoinTypeBitcoin
-	if network == "testnet4" || network == "signet" {
-		coinType = CoinTypeBitcoinTestnet
+	return DerivationPathForAccount(network, 0, change, index, addressType)
+}
+
+// DerivationPathForAccount returns the derivation path string for an address in any account
+func DerivationPathForAccount(network string, account, change, index uint32, addressType string) string {
+	return fmt.Sprintf("%s/%d/%d", AccountDerivationPath(network, account, addressType), change, index)
+}
+
+// AccountDerivationPath returns the account-level path, e.g. m/86'/0'/1'
+func AccountDerivationPath(network string, account uint32, addressType string) string {
+	coinType := CoinTypeForNetwork(network)
+	purpose, err := PurposeForAddressType(addressType)
+	if err != nil {
+		purpose = BIP84Purpose
+	}
+	return fmt.Sprintf("m/%d'/%d'/%d'", purpose, coinType, account)
+}
+
+// AddressTypeForDerivationPath returns the address type implied by the
+// purpose of a BIP44-style path, or "" if the purpose is not recognized
+func AddressTypeForDerivationPath(path string) string {
+	switch {
+	case strings.HasPrefix(path, fmt.Sprintf("m/%d'/", BIP84Purpose)):
+		return AddressTypeP2WPKH
+	case strings.HasPrefix(path, fmt.Sprintf("m/%d'/", BIP86Purpose)):
+		return AddressTypeP2TR
+	case strings.HasPrefix(path, fmt.Sprintf("m/%d'/", BIP49Purpose)):
+		return AddressTypeP2SHP2WPKH
+	case strings.HasPrefix(path, fmt.Sprintf("m/%d'/", BIP44Purpose)):
+		return AddressTypeP2PKH
+	default:
+		return ""
+	}
+}
+
+// ParseDerivationPath extracts the account, change and index from a
+// BIP44-style path of the form m/purpose'/coin'/account'/change/index
+func ParseDerivationPath(path string) (account, change, index uint32, err error) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 6 || parts[0] != "m" {
+		return 0, 0, 0, fmt.Errorf("invalid derivation path %q", path)
 	}
-	purpose := BIP84Purpose
-	if addressType == AddressTypeP2TR {
-		purpose = BIP86Purpose
+
+	var values [5]uint32
+	for i, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		// purpose, coin and account must be hardened; change and index must not
+		if hardened != (i < 3) {
+			return 0, 0, 0, fmt.Errorf("invalid derivation path %q", path)
+		}
+		n, err := strconv.ParseUint(strings.TrimRight(part, "'h"), 10, 31)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid derivation path %q: %w", path, err)
+		}
+		values[i] = uint32(n)
 	}
-	return fmt.Sprintf("m/%d'/%d'/0'/%d/%d", purpose, coinType, change, index)
+
+	return values[2], values[3], values[4], nil
 }
 
 // SLIP-0132 version bytes for extended public keys
@@ -221,52 +312,76 @@ var (
 	zpubVersion = [4]byte{0x04, 0xb2, 0x47, 0x46}
 	// BIP84 vpub (testnet native segwit) - version 0x045f1cf6
 	vpubVersion = [4]byte{0x04, 0x5f, 0x1c, 0xf6}
+	// BIP49 ypub (mainnet nested segwit) - version 0x049d7cb2
+	ypubVersion = [4]byte{0x04, 0x9d, 0x7c, 0xb2}
+	// BIP49 upub (testnet nested segwit) - version 0x044a5262
+	upubVersion = [4]byte{0x04, 0x4a, 0x52, 0x62}
 )
 
 // GetAccountXpub returns the account-level extended public key for watch-only wallet import.
 // For BIP84 (p2wpkh), returns zpub (mainnet) or vpub (testnet) format per SLIP-0132.
-// For BIP86 (p2tr), returns standard xpub/tpub format (no SLIP-0132 standard exists).
+// For BIP49 (p2sh-p2wpkh), returns ypub (mainnet) or upub (testnet) format per SLIP-0132.
+// For BIP44 (p2pkh) and BIP86 (p2tr), returns standard xpub/tpub format.
 // The returned key can be imported into wallets like Sparrow as a watch-only wallet.
 func GetAccountXpub(seed []byte, network string, addressType string) (string, string, error) {
-	// Derive the account key (private)
-	accountKey, err := DeriveAccountKeyForType(seed, network, 0, addressType)
+	return GetAccountXpubForAccount(seed, network, 0, addressType)
+}
+
+// GetAccountXpubForAccount returns the extended public key for any account.
+// See GetAccountXpub for the encoding rules.
+func GetAccountXpubForAccount(seed []byte, network string, account uint32, addressType string) (string, string, error) {
+	if account > MaxAccount {
+		return "", "", fmt.Errorf("account %d out of range", account)
+	}
+
+	accountPubKey, err := AccountPublicKey(seed, network, account, addressType)
+	if err != nil {
+		return "", "", err
+	}
+
+	return AccountXpubFromPublicKey(accountPubKey, network, account, addressType)
+}
+
+// AccountPublicKey returns the neutered account-level extended key of an
+// address type in the standard xpub/tpub encoding. Receive and change
+// addresses can be derived from it without the seed.
+func AccountPublicKey(seed []byte, network string, account uint32, addressType string) (string, error) {
+	accountKey, err := DeriveAccountKeyForType(seed, network, account, addressType)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to derive account key: %w", err)
+		return "", fmt.Errorf("failed to derive account key: %w", err)
 	}
 
-	// Get the public key version (neutered)
 	accountPubKey, err := accountKey.Neuter()
 	if err != nil {
-		return "", "", fmt.Errorf("failed to neuter account key: %w", err)
+		return "", fmt.Errorf("failed to neuter account key: %w", err)
 	}
 
+	return accountPubKey.String(), nil
+}
+
+// AccountXpubFromPublicKey converts an account public key returned by
+// AccountPublicKey to the export format of GetAccountXpubForAccount
+func AccountXpubFromPublicKey(accountPubKey string, network string, account uint32, addressType string) (string, string, error) {
 	// Get the derivation path for documentation
-	coinType := CoinTypeBitcoin
-	if network == "testnet4" || network == "signet" {
-		coinType = CoinTypeBitcoinTestnet
-	}
-	purpose := BIP84Purpose
-	if addressType == AddressTypeP2TR {
-		purpose = BIP86Purpose
-	}
-	derivationPath := fmt.Sprintf("m/%d'/%d'/0'", purpose, coinType)
+	derivationPath := AccountDerivationPath(network, account, addressType)
 
-	// For BIP84, convert to SLIP-0132 format (zpub/vpub)
-	if addressType == AddressTypeP2WPKH {
-		xpubStr := accountPubKey.String()
-		converted, err := convertToSlip132(xpubStr, network)
+	// For BIP84 and BIP49, convert to SLIP-0132 format (zpub/vpub, ypub/upub)
+	if addressType == AddressTypeP2WPKH || addressType == AddressTypeP2SHP2WPKH {
+		converted, err := convertToSlip132(accountPubKey, network, addressType)
 		if err != nil {
 			return "", "", fmt.Errorf("failed to convert to SLIP-0132: %w", err)
 		}
 		return converted, derivationPath, nil
 	}
 
-	// For BIP86, return standard format (no SLIP-0132 standard for Taproot)
-	return accountPubKey.String(), derivationPath, nil
+	// For BIP44 and BIP86, return standard format (SLIP-0132 uses xpub for
+	// legacy and defines no version for Taproot)
+	return accountPubKey, derivationPath, nil
 }
 
-// convertToSlip132 converts a standard xpub/tpub to SLIP-0132 zpub/vpub format
-func convertToSlip132(xpub string, network string) (string, error) {
+// convertToSlip132 converts a standard xpub/tpub to the SLIP-0132 format of
+// the address type: zpub/vpub for p2wpkh, ypub/upub for p2sh-p2wpkh
+func convertToSlip132(xpub string, network string, addressType string) (string, error) {
 	// Decode the base58check encoded xpub
 	decoded, version, err := decodeBase58Check(xpub)
 	if err != nil {
@@ -286,9 +401,14 @@ func convertToSlip132(xpub string, network string) (string, error) {
 
 	// Replace version bytes with SLIP-0132 version
 	var newVersion [4]byte
-	if network == "mainnet" {
+	switch {
+	case addressType == AddressTypeP2SHP2WPKH && network == "mainnet":
+		newVersion = ypubVersion
+	case addressType == AddressTypeP2SHP2WPKH:
+		newVersion = upubVersion
+	case network == "mainnet":
 		newVersion = zpubVersion
-	} else {
+	default:
 		newVersion = vpubVersion
 	}
 
@@ -3,6 +3,7 @@ package wallet
 import (
 	"bytes"
 	"encoding/hex"
+	"strings"
 	"testing"
 
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
@@ -42,6 +43,7 @@ func TestNetworkParams(t *testing.T) {
 	}{
 		{"mainnet", "mainnet", false},
 		{"testnet4", "testnet4", false},
+		{"regtest", "regtest", false},
 		{"invalid", "invalid", true},
 		{"empty", "", true},
 	}
@@ -540,6 +542,24 @@ func TestNetworkParamsSignet(t *testing.T) {
 	}
 }
 
+func TestCoinTypeForNetwork(t *testing.T) {
+	tests := []struct {
+		network string
+		want    uint32
+	}{
+		{"mainnet", CoinTypeBitcoin},
+		{"testnet4", CoinTypeBitcoinTestnet},
+		{"signet", CoinTypeBitcoinTestnet},
+		{"regtest", CoinTypeBitcoinTestnet},
+	}
+
+	for _, tt := range tests {
+		if got := CoinTypeForNetwork(tt.network); got != tt.want {
+			t.Errorf("CoinTypeForNetwork(%q) = %d, want %d", tt.network, got, tt.want)
+		}
+	}
+}
+
 func TestHardenedKeyDerivation(t *testing.T) {
 	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
 
@@ -668,3 +688,150 @@ func TestGetAccountXpub(t *testing.T) {
 		}
 	})
 }
+
+func TestDerivationPathForAccount(t *testing.T) {
+	tests := []struct {
+		network     string
+		account     uint32
+		change      uint32
+		index       uint32
+		addressType string
+		want        string
+	}{
+		{"mainnet", 0, 0, 0, AddressTypeP2WPKH, "m/84'/0'/0'/0/0"},
+		{"mainnet", 3, 1, 7, AddressTypeP2WPKH, "m/84'/0'/3'/1/7"},
+		{"testnet4", 1, 0, 5, AddressTypeP2TR, "m/86'/1'/1'/0/5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got := DerivationPathForAccount(tt.network, tt.account, tt.change, tt.index, tt.addressType)
+			if got != tt.want {
+				t.Errorf("DerivationPathForAccount() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDerivationPath(t *testing.T) {
+	tests := []struct {
+		path        string
+		wantAccount uint32
+		wantChange  uint32
+		wantIndex   uint32
+		wantErr     bool
+	}{
+		{"m/84'/0'/0'/0/0", 0, 0, 0, false},
+		{"m/86'/1'/2'/1/15", 2, 1, 15, false},
+		{"m/84h/0h/5h/0/3", 5, 0, 3, false},
+		{"m/84'/0'/0'", 0, 0, 0, true},
+		{"m/84'/0'/0/0/0", 0, 0, 0, true},
+		{"m/84'/0'/0'/0'/0", 0, 0, 0, true},
+		{"84'/0'/0'/0/0", 0, 0, 0, true},
+		{"m/84'/0'/x'/0/0", 0, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			account, change, index, err := ParseDerivationPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDerivationPath(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if account != tt.wantAccount || change != tt.wantChange || index != tt.wantIndex {
+				t.Errorf("ParseDerivationPath(%q) = %d/%d/%d, want %d/%d/%d", tt.path,
+					account, change, index, tt.wantAccount, tt.wantChange, tt.wantIndex)
+			}
+		})
+	}
+}
+
+func TestGetAccountXpubForAccount(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+
+	xpub0, _, err := GetAccountXpubForAccount(seed, "mainnet", 0, AddressTypeP2WPKH)
+	if err != nil {
+		t.Fatalf("GetAccountXpubForAccount() error = %v", err)
+	}
+	legacy, _, _ := GetAccountXpub(seed, "mainnet", AddressTypeP2WPKH)
+	if xpub0 != legacy {
+		t.Error("account 0 xpub should match GetAccountXpub()")
+	}
+
+	xpub1, path, err := GetAccountXpubForAccount(seed, "mainnet", 1, AddressTypeP2WPKH)
+	if err != nil {
+		t.Fatalf("GetAccountXpubForAccount() error = %v", err)
+	}
+	if xpub1 == xpub0 {
+		t.Error("different accounts should have different xpubs")
+	}
+	if path != "m/84'/0'/1'" {
+		t.Errorf("GetAccountXpubForAccount() path = %s, want m/84'/0'/1'", path)
+	}
+
+	if _, _, err := GetAccountXpubForAccount(seed, "mainnet", MaxAccount+1, AddressTypeP2WPKH); err == nil {
+		t.Error("GetAccountXpubForAccount() should reject hardened account index")
+	}
+}
+
+func TestAddressTypeForDerivationPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"m/84'/0'/0'/0/0", AddressTypeP2WPKH},
+		{"m/86'/1'/2'/1/5", AddressTypeP2TR},
+		{"m/44'/0'/0'/0/0", AddressTypeP2PKH},
+		{"m/49'/1'/0'/1/3", AddressTypeP2SHP2WPKH},
+		{"m/45'/0'/0'/0/0", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := AddressTypeForDerivationPath(tt.path); got != tt.want {
+			t.Errorf("AddressTypeForDerivationPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGetAccountXpubLegacyAndNested(t *testing.T) {
+	// Mnemonic: abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about
+	seedHex := "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+	seed, _ := hex.DecodeString(seedHex)
+
+	tests := []struct {
+		name     string
+		network  string
+		addrType string
+		prefix   string
+		path     string
+		expected string
+	}{
+		{"BIP49 mainnet ypub", "mainnet", AddressTypeP2SHP2WPKH, "ypub", "m/49'/0'/0'",
+			"ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9azLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP"},
+		{"BIP49 testnet upub", "testnet4", AddressTypeP2SHP2WPKH, "upub", "m/49'/1'/0'", ""},
+		{"BIP44 mainnet xpub", "mainnet", AddressTypeP2PKH, "xpub", "m/44'/0'/0'",
+			"xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj"},
+		{"BIP44 testnet tpub", "testnet4", AddressTypeP2PKH, "tpub", "m/44'/1'/0'", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xpub, path, err := GetAccountXpub(seed, tt.network, tt.addrType)
+			if err != nil {
+				t.Fatalf("GetAccountXpub() error = %v", err)
+			}
+			if !strings.HasPrefix(xpub, tt.prefix) {
+				t.Errorf("GetAccountXpub() = %s, want prefix %s", xpub, tt.prefix)
+			}
+			if tt.expected != "" && xpub != tt.expected {
+				t.Errorf("vector mismatch:\ngot:  %s\nwant: %s", xpub, tt.expected)
+			}
+			if path != tt.path {
+				t.Errorf("GetAccountXpub() path = %s, want %s", path, tt.path)
+			}
+		})
+	}
+}
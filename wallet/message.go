@@ -0,0 +1,310 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Message signature formats
+const (
+	MessageFormatBIP322 = "bip322"
+	MessageFormatLegacy = "legacy"
+)
+
+// bip322Tag is the BIP340 tag of the BIP322 message hash
+const bip322Tag = "BIP0322-signed-message"
+
+// legacyMessageMagic prefixes messages signed with the legacy signmessage
+// scheme
+const legacyMessageMagic = "Bitcoin Signed Message:\n"
+
+// Header byte ranges of legacy compact signatures. BIP137 encodes the
+// address type in the header; 27-30 marks an uncompressed key.
+const (
+	legacyHeaderP2PKHUncompressed = 27
+	legacyHeaderP2PKH             = 31
+	legacyHeaderP2SHP2WPKH        = 35
+	legacyHeaderP2WPKH            = 39
+)
+
+// BIP322MessageHash returns the tagged hash a BIP322 signature commits to
+func BIP322MessageHash(message string) [32]byte {
+	return *chainhash.TaggedHash([]byte(bip322Tag), []byte(message))
+}
+
+// bip322ToSpend builds the virtual transaction whose only output pays the
+// signing address
+func bip322ToSpend(scriptPubKey []byte, message string) (*wire.MsgTx, error) {
+	hash := BIP322MessageHash(message)
+	sigScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(hash[:]).Script()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := wire.NewMsgTx(0)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: 0xffffffff},
+		SignatureScript:  sigScript,
+		Sequence:         0,
+	})
+	tx.AddTxOut(wire.NewTxOut(0, scriptPubKey))
+	return tx, nil
+}
+
+// bip322ToSign builds the virtual transaction spending the to_spend output,
+// whose input witness is the signature
+func bip322ToSign(toSpend *wire.MsgTx) *wire.MsgTx {
+	tx := wire.NewMsgTx(0)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: toSpend.TxHash(), Index: 0},
+		Sequence:         0,
+	})
+	tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	return tx
+}
+
+// SignMessageBIP322 creates a BIP322 simple signature of message for a
+// P2WPKH or P2TR address controlled by privKey
+func SignMessageBIP322(privKey *btcec.PrivateKey, address, network, message string) (string, error) {
+	scriptPubKey, err := GetScriptPubKey(address, network)
+	if err != nil {
+		return "", err
+	}
+	addressType, err := GetAddressType(address, network)
+	if err != nil {
+		return "", err
+	}
+
+	toSpend, err := bip322ToSpend(scriptPubKey, message)
+	if err != nil {
+		return "", fmt.Errorf("failed to build to_spend transaction: %w", err)
+	}
+	toSign := bip322ToSign(toSpend)
+	prevOutFetcher := txscript.NewCannedPrevOutputFetcher(scriptPubKey, 0)
+	sigHashes := txscript.NewTxSigHashes(toSign, prevOutFetcher)
+
+	var witness wire.TxWitness
+	switch addressType {
+	case AddressTypeP2WPKH:
+		witness, err = txscript.WitnessSignature(toSign, sigHashes, 0, 0, scriptPubKey, txscript.SigHashAll, privKey, true)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign message: %w", err)
+		}
+	case AddressTypeP2TR:
+		sig, err := txscript.RawTxInTaprootSignature(toSign, sigHashes, 0, 0, scriptPubKey, nil, txscript.SigHashDefault, privKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign message: %w", err)
+		}
+		witness = wire.TxWitness{sig}
+	default:
+		return "", fmt.Errorf("BIP322 signing is supported for p2wpkh and p2tr addresses, not %s", addressType)
+	}
+
+	// The signature must satisfy the address, which also catches a key
+	// that does not belong to it
+	toSign.TxIn[0].Witness = witness
+	if err := verifyBIP322(scriptPubKey, toSign, prevOutFetcher); err != nil {
+		return "", fmt.Errorf("key does not sign for %s: %w", address, err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeWitness(&buf, witness); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// SignMessageLegacy creates a Bitcoin Core style compact signature of
+// message, with the BIP137 header for the address type of the key
+func SignMessageLegacy(privKey *btcec.PrivateKey, addressType, message string) (string, error) {
+	var header byte
+	switch addressType {
+	case AddressTypeP2PKH:
+		header = legacyHeaderP2PKH
+	case AddressTypeP2SHP2WPKH:
+		header = legacyHeaderP2SHP2WPKH
+	case AddressTypeP2WPKH:
+		header = legacyHeaderP2WPKH
+	default:
+		return "", fmt.Errorf("legacy message signing is not defined for %s addresses", addressType)
+	}
+
+	sig := ecdsa.SignCompact(privKey, legacyMessageHash(message), true)
+	// SignCompact sets 31+recid for a compressed key
+	sig[0] = header + (sig[0]-legacyHeaderP2PKH)&3
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// VerifyMessage checks a BIP322 simple or legacy signature of message by
+// address, and returns the format of the signature
+func VerifyMessage(address, network, message, signature string) (string, error) {
+	params, err := NetworkParams(network)
+	if err != nil {
+		return "", err
+	}
+	addr, err := btcutil.DecodeAddress(address, params)
+	if err != nil {
+		return "", fmt.Errorf("invalid address: %w", err)
+	}
+	if !addr.IsForNet(params) {
+		return "", fmt.Errorf("address is not for %s network", network)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return "", fmt.Errorf("signature is not valid base64: %w", err)
+	}
+
+	// A 65-byte blob with a compact signature header is a legacy signature;
+	// a BIP322 witness never starts with a count that high
+	if len(raw) == 65 && raw[0] >= legacyHeaderP2PKHUncompressed && raw[0] < legacyHeaderP2WPKH+4 {
+		if err := verifyLegacyMessage(addr, params, message, raw); err != nil {
+			return "", err
+		}
+		return MessageFormatLegacy, nil
+	}
+
+	witness, err := readWitness(raw)
+	if err != nil {
+		return "", fmt.Errorf("signature is neither a legacy nor a BIP322 simple signature: %w", err)
+	}
+	scriptPubKey, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to create scriptPubKey: %w", err)
+	}
+	if !txscript.IsWitnessProgram(scriptPubKey) {
+		return "", fmt.Errorf("BIP322 simple signatures require a segwit address")
+	}
+
+	toSpend, err := bip322ToSpend(scriptPubKey, message)
+	if err != nil {
+		return "", fmt.Errorf("failed to build to_spend transaction: %w", err)
+	}
+	toSign := bip322ToSign(toSpend)
+	toSign.TxIn[0].Witness = witness
+	if err := verifyBIP322(scriptPubKey, toSign, txscript.NewCannedPrevOutputFetcher(scriptPubKey, 0)); err != nil {
+		return "", fmt.Errorf("invalid signature: %w", err)
+	}
+	return MessageFormatBIP322, nil
+}
+
+// verifyBIP322 runs the script of the to_spend output against the to_sign
+// transaction
+func verifyBIP322(scriptPubKey []byte, toSign *wire.MsgTx, prevOutFetcher txscript.PrevOutputFetcher) error {
+	sigHashes := txscript.NewTxSigHashes(toSign, prevOutFetcher)
+	vm, err := txscript.NewEngine(scriptPubKey, toSign, 0, txscript.StandardVerifyFlags, nil, sigHashes, 0, prevOutFetcher)
+	if err != nil {
+		return err
+	}
+	return vm.Execute()
+}
+
+// verifyLegacyMessage recovers the signing key of a compact signature and
+// checks that it controls addr
+func verifyLegacyMessage(addr btcutil.Address, params *chaincfg.Params, message string, sig []byte) error {
+	header := sig[0]
+	compressed := header >= legacyHeaderP2PKH
+
+	// RecoverCompact only knows the P2PKH headers
+	normalized := append([]byte{}, sig...)
+	normalized[0] = legacyHeaderP2PKHUncompressed + (header-legacyHeaderP2PKHUncompressed)&3
+	if compressed {
+		normalized[0] += 4
+	}
+
+	pubKey, _, err := ecdsa.RecoverCompact(normalized, legacyMessageHash(message))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+
+	var serialized []byte
+	if compressed {
+		serialized = pubKey.SerializeCompressed()
+	} else {
+		serialized = pubKey.SerializeUncompressed()
+	}
+	keyHash := btcutil.Hash160(serialized)
+
+	// Wallets disagree on headers for segwit addresses, so any address of
+	// the recovered key is accepted regardless of the header
+	var candidates []btcutil.Address
+	if a, err := btcutil.NewAddressPubKeyHash(keyHash, params); err == nil {
+		candidates = append(candidates, a)
+	}
+	if compressed {
+		if a, err := btcutil.NewAddressWitnessPubKeyHash(keyHash, params); err == nil {
+			candidates = append(candidates, a)
+		}
+		if redeemScript, err := NestedP2WPKHRedeemScript(pubKey); err == nil {
+			if a, err := btcutil.NewAddressScriptHash(redeemScript, params); err == nil {
+				candidates = append(candidates, a)
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		if candidate.EncodeAddress() == addr.EncodeAddress() {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid signature: signed by a different key")
+}
+
+// legacyMessageHash is the double SHA256 of the magic-prefixed message
+func legacyMessageHash(message string) []byte {
+	var buf bytes.Buffer
+	_ = wire.WriteVarString(&buf, 0, legacyMessageMagic)
+	_ = wire.WriteVarString(&buf, 0, message)
+	first := sha256.Sum256(buf.Bytes())
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// writeWitness serializes a witness stack the way it appears in a
+// transaction
+func writeWitness(buf *bytes.Buffer, witness wire.TxWitness) error {
+	if err := wire.WriteVarInt(buf, 0, uint64(len(witness))); err != nil {
+		return err
+	}
+	for _, item := range witness {
+		if err := wire.WriteVarBytes(buf, 0, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readWitness parses a serialized witness stack, rejecting trailing data
+func readWitness(raw []byte) (wire.TxWitness, error) {
+	r := bytes.NewReader(raw)
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || count > uint64(len(raw)) {
+		return nil, fmt.Errorf("invalid witness item count %d", count)
+	}
+
+	witness := make(wire.TxWitness, count)
+	for i := range witness {
+		item, err := wire.ReadVarBytes(r, 0, txscript.MaxScriptSize, "witness item")
+		if err != nil {
+			return nil, err
+		}
+		witness[i] = item
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after witness", r.Len())
+	}
+	return witness, nil
+}
@@ -0,0 +1,111 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// proofOfReservesPrefix prefixes the challenge message in the BIP127
+// commitment
+const proofOfReservesPrefix = "Proof-of-Reserves: "
+
+// ProofOfReservesCommitment returns the txid of the non-existent output
+// spent by the first input of a BIP127 proof, which commits to message
+func ProofOfReservesCommitment(message string) chainhash.Hash {
+	return chainhash.Hash(sha256.Sum256([]byte(proofOfReservesPrefix + message)))
+}
+
+// ProofOfReservesCommitmentOutput returns the output assumed spent by the
+// commitment input. It is never on chain, which makes the proof invalid as a
+// transaction.
+func ProofOfReservesCommitmentOutput() *wire.TxOut {
+	return wire.NewTxOut(0, []byte{txscript.OP_TRUE})
+}
+
+// BuildProofOfReserves builds and signs a BIP127 proof of reserves spending
+// utxos. The first input spends the commitment to message, and the single
+// output sends the total to OP_TRUE, so the transaction can never be mined.
+func BuildProofOfReserves(seed []byte, network string, utxos []UTXO, message string) (*wire.MsgTx, error) {
+	if len(utxos) == 0 {
+		return nil, fmt.Errorf("no UTXOs to prove")
+	}
+
+	tx := wire.NewMsgTx(1)
+	commitment := wire.OutPoint{Hash: ProofOfReservesCommitment(message), Index: 0}
+	tx.AddTxIn(wire.NewTxIn(&commitment, nil, nil))
+
+	var total int64
+	for _, utxo := range utxos {
+		txHash, err := chainhash.NewHashFromStr(utxo.TxID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid txid %s: %w", utxo.TxID, err)
+		}
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(txHash, uint32(utxo.Vout)), nil, nil))
+		total += utxo.Value
+	}
+	tx.AddTxOut(wire.NewTxOut(total, []byte{txscript.OP_TRUE}))
+
+	prevOuts := map[wire.OutPoint]*wire.TxOut{commitment: ProofOfReservesCommitmentOutput()}
+	if err := signInputsFrom(seed, network, tx, 1, utxos, prevOuts); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// VerifyProofOfReserves checks that tx is a BIP127 proof committing to
+// message whose inputs are validly signed, and returns the total proven.
+// prevOuts holds the output spent by each input; the one of the commitment
+// input is ignored. Whether the outputs are still unspent is up to the
+// caller.
+func VerifyProofOfReserves(tx *wire.MsgTx, prevOuts []*wire.TxOut, message string) (int64, error) {
+	if len(tx.TxIn) < 2 {
+		return 0, fmt.Errorf("proof has no inputs besides the commitment")
+	}
+	if len(prevOuts) != len(tx.TxIn) {
+		return 0, fmt.Errorf("proof has %d inputs but %d spent outputs", len(tx.TxIn), len(prevOuts))
+	}
+
+	commitment := wire.OutPoint{Hash: ProofOfReservesCommitment(message), Index: 0}
+	if tx.TxIn[0].PreviousOutPoint != commitment {
+		return 0, fmt.Errorf("proof does not commit to the message")
+	}
+	if len(tx.TxOut) != 1 || !bytes.Equal(tx.TxOut[0].PkScript, []byte{txscript.OP_TRUE}) {
+		return 0, fmt.Errorf("proof must have a single OP_TRUE output")
+	}
+
+	fetcherOuts := map[wire.OutPoint]*wire.TxOut{commitment: ProofOfReservesCommitmentOutput()}
+	var total int64
+	for i := 1; i < len(tx.TxIn); i++ {
+		outPoint := tx.TxIn[i].PreviousOutPoint
+		if _, ok := fetcherOuts[outPoint]; ok {
+			return 0, fmt.Errorf("input %d spends %s twice", i, outPoint)
+		}
+		if prevOuts[i] == nil {
+			return 0, fmt.Errorf("input %d has no spent output", i)
+		}
+		fetcherOuts[outPoint] = prevOuts[i]
+		total += prevOuts[i].Value
+	}
+	if tx.TxOut[0].Value != total {
+		return 0, fmt.Errorf("proof output %d does not match the input total %d", tx.TxOut[0].Value, total)
+	}
+
+	prevOutFetcher := txscript.NewMultiPrevOutFetcher(fetcherOuts)
+	sigHashes := txscript.NewTxSigHashes(tx, prevOutFetcher)
+	for i := 1; i < len(tx.TxIn); i++ {
+		vm, err := txscript.NewEngine(prevOuts[i].PkScript, tx, i, txscript.StandardVerifyFlags, nil, sigHashes, prevOuts[i].Value, prevOutFetcher)
+		if err != nil {
+			return 0, fmt.Errorf("input %d: %w", i, err)
+		}
+		if err := vm.Execute(); err != nil {
+			return 0, fmt.Errorf("input %d has an invalid signature: %w", i, err)
+		}
+	}
+
+	return total, nil
+}
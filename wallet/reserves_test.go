@@ -0,0 +1,70 @@
+package wallet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestProofOfReserves(t *testing.T) {
+	seed := make([]byte, 32)
+
+	var utxos []UTXO
+	for i, addressType := range []string{AddressTypeP2WPKH, AddressTypeP2TR, AddressTypeP2SHP2WPKH, AddressTypeP2PKH} {
+		address, err := GenerateAddressForAccount(seed, "mainnet", 0, 0, uint32(i), addressType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		script, err := GetScriptPubKey(address, "mainnet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		utxos = append(utxos, UTXO{
+			TxID:         strings.Repeat("0"+string(rune('1'+i)), 32),
+			Vout:         i,
+			Value:        int64(10000 * (i + 1)),
+			Address:      address,
+			AddressIndex: uint32(i),
+			ScriptPubKey: script,
+			AddressType:  addressType,
+		})
+	}
+
+	tx, err := BuildProofOfReserves(seed, "mainnet", utxos, "audit 2026-Q3")
+	if err != nil {
+		t.Fatalf("BuildProofOfReserves() error = %v", err)
+	}
+	if len(tx.TxIn) != len(utxos)+1 || len(tx.TxOut) != 1 || tx.TxOut[0].Value != 100000 {
+		t.Fatalf("proof has %d inputs and outputs %v", len(tx.TxIn), tx.TxOut)
+	}
+
+	prevOuts := []*wire.TxOut{ProofOfReservesCommitmentOutput()}
+	for _, utxo := range utxos {
+		prevOuts = append(prevOuts, wire.NewTxOut(utxo.Value, utxo.ScriptPubKey))
+	}
+
+	total, err := VerifyProofOfReserves(tx, prevOuts, "audit 2026-Q3")
+	if err != nil || total != 100000 {
+		t.Fatalf("VerifyProofOfReserves() = %d, %v, want 100000", total, err)
+	}
+
+	if _, err := VerifyProofOfReserves(tx, prevOuts, "audit 2026-Q4"); err == nil || !strings.Contains(err.Error(), "commit") {
+		t.Errorf("VerifyProofOfReserves(other message) error = %v", err)
+	}
+
+	// Claiming a larger value breaks the segwit signatures and the total
+	inflated := append([]*wire.TxOut{}, prevOuts...)
+	inflated[1] = wire.NewTxOut(prevOuts[1].Value*10, prevOuts[1].PkScript)
+	if _, err := VerifyProofOfReserves(tx, inflated, "audit 2026-Q3"); err == nil {
+		t.Error("VerifyProofOfReserves(inflated value) expected error")
+	}
+
+	forged := tx.Copy()
+	forged.TxOut[0].Value += 90000
+	forgedOuts := append([]*wire.TxOut{}, prevOuts...)
+	forgedOuts[1] = wire.NewTxOut(prevOuts[1].Value+90000, prevOuts[1].PkScript)
+	if _, err := VerifyProofOfReserves(forged, forgedOuts, "audit 2026-Q3"); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("VerifyProofOfReserves(forged) error = %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// DefaultSignetHRP is the bech32 prefix of the public signet
+const DefaultSignetHRP = "tb"
+
+// SignetOptions describes a custom signet (BIP325)
+type SignetOptions struct {
+	// Challenge is the block signing challenge script
+	Challenge []byte
+	// HRP is the bech32 human-readable part of addresses (default: tb)
+	HRP string
+	// Magic overrides the network magic derived from the challenge (0 = derive)
+	Magic uint32
+}
+
+var (
+	customNetworksMu sync.RWMutex
+	customNetworks   = make(map[string]*chaincfg.Params)
+)
+
+// SignetMagic returns the network magic of a signet challenge: the first four
+// bytes of the double SHA-256 of the challenge serialized as a script push
+func SignetMagic(challenge []byte) uint32 {
+	var buf bytes.Buffer
+	_ = wire.WriteVarBytes(&buf, 0, challenge)
+	hash := chainhash.DoubleHashB(buf.Bytes())
+	return binary.LittleEndian.Uint32(hash[:4])
+}
+
+// FormatMagic renders a network magic as its four message-start bytes in hex,
+// the way Bitcoin Core prints it (e.g. 0a03cf40 for the public signet)
+func FormatMagic(magic uint32) string {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], magic)
+	return hex.EncodeToString(b[:])
+}
+
+// ParseMagic parses a network magic written as four message-start bytes in hex
+func ParseMagic(s string) (uint32, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 4 {
+		return 0, fmt.Errorf("network magic must be 4 bytes of hex, e.g. 0a03cf40")
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+// RegisterCustomSignet builds the chain parameters of a custom signet and
+// returns the network name to pass to NetworkParams and the address helpers.
+// The name is derived from the magic and HRP, so registering the same signet
+// again is a no-op and different signets never collide.
+func RegisterCustomSignet(opts SignetOptions) (string, error) {
+	if err := validateSignetOptions(opts); err != nil {
+		return "", err
+	}
+
+	hrp := opts.HRP
+	if hrp == "" {
+		hrp = DefaultSignetHRP
+	}
+	magic := opts.Magic
+	if magic == 0 {
+		magic = SignetMagic(opts.Challenge)
+	}
+
+	name := "signet-" + FormatMagic(magic)
+	if hrp != DefaultSignetHRP {
+		name += "-" + hrp
+	}
+
+	customNetworksMu.Lock()
+	defer customNetworksMu.Unlock()
+
+	if _, ok := customNetworks[name]; ok {
+		return name, nil
+	}
+
+	// All signets share the genesis block; only the challenge, magic and
+	// address prefix differ
+	params := chaincfg.CustomSignetParams(opts.Challenge, nil)
+	params.Name = name
+	params.Net = wire.BitcoinNet(magic)
+	params.Bech32HRPSegwit = hrp
+
+	// btcutil only decodes segwit addresses whose prefix is registered
+	if !chaincfg.IsBech32SegwitPrefix(hrp + "1") {
+		if err := chaincfg.Register(&params); err != nil {
+			if errors.Is(err, chaincfg.ErrDuplicateNet) {
+				return "", fmt.Errorf("network magic %s is already registered with a different address prefix", FormatMagic(magic))
+			}
+			return "", fmt.Errorf("failed to register signet parameters: %w", err)
+		}
+	}
+
+	customNetworks[name] = &params
+	return name, nil
+}
+
+func validateSignetOptions(opts SignetOptions) error {
+	if len(opts.Challenge) == 0 {
+		return fmt.Errorf("signet challenge is required")
+	}
+	if len(opts.Challenge) > txscript.MaxScriptSize {
+		return fmt.Errorf("signet challenge exceeds %d bytes", txscript.MaxScriptSize)
+	}
+	tokenizer := txscript.MakeScriptTokenizer(0, opts.Challenge)
+	for tokenizer.Next() {
+	}
+	if err := tokenizer.Err(); err != nil {
+		return fmt.Errorf("invalid signet challenge script: %w", err)
+	}
+
+	if opts.HRP == "" {
+		return nil
+	}
+	if len(opts.HRP) > 83 {
+		return fmt.Errorf("address prefix must be at most 83 characters")
+	}
+	for _, c := range opts.HRP {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return fmt.Errorf("address prefix must contain only lowercase letters and digits")
+		}
+	}
+	switch opts.HRP {
+	case chaincfg.MainNetParams.Bech32HRPSegwit, chaincfg.RegressionNetParams.Bech32HRPSegwit, chaincfg.SimNetParams.Bech32HRPSegwit:
+		return fmt.Errorf("address prefix %q belongs to another network", opts.HRP)
+	}
+	return nil
+}
+
+// customNetworkParams returns the parameters of a registered custom network
+func customNetworkParams(network string) (*chaincfg.Params, bool) {
+	customNetworksMu.RLock()
+	defer customNetworksMu.RUnlock()
+	params, ok := customNetworks[network]
+	return params, ok
+}
+
+// IsCustomNetwork reports whether network names a registered custom signet
+func IsCustomNetwork(network string) bool {
+	_, ok := customNetworkParams(network)
+	return ok
+}
@@ -0,0 +1,115 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// publicSignetChallenge is the 1-of-2 multisig challenge of the public signet
+const publicSignetChallenge = "512103ad5e0edad18cb1f0fc0d28a3d4f1f3e445640337489abb10404f2d1e086be430210359ef5021964fe22d6f8e05b2463c9540ce96883fe3b278760f048f5189f2e6c452ae"
+
+func TestSignetMagic(t *testing.T) {
+	challenge, _ := hex.DecodeString(publicSignetChallenge)
+
+	magic := SignetMagic(challenge)
+	if magic != uint32(chaincfg.SigNetParams.Net) {
+		t.Errorf("SignetMagic(public signet) = %s, want %s", FormatMagic(magic), FormatMagic(uint32(chaincfg.SigNetParams.Net)))
+	}
+	if got := FormatMagic(magic); got != "0a03cf40" {
+		t.Errorf("FormatMagic() = %s, want 0a03cf40", got)
+	}
+
+	parsed, err := ParseMagic("0a03cf40")
+	if err != nil || parsed != magic {
+		t.Errorf("ParseMagic(0a03cf40) = %d, %v, want %d", parsed, err, magic)
+	}
+	for _, bad := range []string{"", "0a03cf", "0a03cf4000", "zz03cf40"} {
+		if _, err := ParseMagic(bad); err == nil {
+			t.Errorf("ParseMagic(%q) expected error", bad)
+		}
+	}
+}
+
+func TestRegisterCustomSignet(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+
+	t.Run("custom prefix", func(t *testing.T) {
+		// OP_TRUE challenge, as used by many private test signets
+		name, err := RegisterCustomSignet(SignetOptions{Challenge: []byte{0x51}, HRP: "sbt"})
+		if err != nil {
+			t.Fatalf("RegisterCustomSignet() error = %v", err)
+		}
+		if !strings.HasPrefix(name, "signet-") || !strings.HasSuffix(name, "-sbt") {
+			t.Errorf("name = %q, want signet-<magic>-sbt", name)
+		}
+
+		again, err := RegisterCustomSignet(SignetOptions{Challenge: []byte{0x51}, HRP: "sbt"})
+		if err != nil || again != name {
+			t.Errorf("re-registering = %q, %v, want %q", again, err, name)
+		}
+
+		for _, addressType := range []string{AddressTypeP2WPKH, AddressTypeP2TR} {
+			addr, err := GenerateAddressFromSeedForType(seed, name, 0, addressType)
+			if err != nil {
+				t.Fatalf("GenerateAddressFromSeedForType(%s) error = %v", addressType, err)
+			}
+			if !strings.HasPrefix(addr, "sbt1") {
+				t.Errorf("%s address = %s, want sbt1 prefix", addressType, addr)
+			}
+			if err := ValidateAddress(addr, name); err != nil {
+				t.Errorf("ValidateAddress(%s) error = %v", addr, err)
+			}
+			if _, err := AddressToScriptHash(addr, name); err != nil {
+				t.Errorf("AddressToScriptHash(%s) error = %v", addr, err)
+			}
+		}
+
+		// Public signet addresses belong to a different network
+		if err := ValidateAddress("tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", name); err == nil {
+			t.Error("ValidateAddress() accepted a tb1 address on a custom prefix signet")
+		}
+
+		path := DerivationPathForType(name, 0, 0, AddressTypeP2WPKH)
+		if path != "m/84'/1'/0'/0/0" {
+			t.Errorf("derivation path = %s, want coin type 1", path)
+		}
+	})
+
+	t.Run("default prefix", func(t *testing.T) {
+		name, err := RegisterCustomSignet(SignetOptions{Challenge: []byte{0x51}, Magic: 0x11223344})
+		if err != nil {
+			t.Fatalf("RegisterCustomSignet() error = %v", err)
+		}
+		if name != "signet-44332211" {
+			t.Errorf("name = %q, want signet-44332211", name)
+		}
+		addr, err := GenerateAddressFromSeed(seed, name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(addr, "tb1q") {
+			t.Errorf("address = %s, want tb1q prefix", addr)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			name string
+			opts SignetOptions
+		}{
+			{"no challenge", SignetOptions{}},
+			{"truncated push", SignetOptions{Challenge: []byte{0x21, 0x03}}},
+			{"uppercase prefix", SignetOptions{Challenge: []byte{0x51}, HRP: "SB"}},
+			{"mainnet prefix", SignetOptions{Challenge: []byte{0x51}, HRP: "bc"}},
+			{"regtest prefix", SignetOptions{Challenge: []byte{0x51}, HRP: "bcrt"}},
+		}
+		for _, tt := range tests {
+			if _, err := RegisterCustomSignet(tt.opts); err == nil {
+				t.Errorf("%s: expected error", tt.name)
+			}
+		}
+	})
+}
@@ -0,0 +1,627 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// BIP352Purpose is the purpose of silent payment scan and spend keys
+	BIP352Purpose = 352
+
+	// silentPaymentVersion is the only silent payment address version
+	silentPaymentVersion = 0
+
+	// silentPaymentKeysSize is the size of the address payload: the
+	// compressed scan and spend public keys
+	silentPaymentKeysSize = 2 * compressedPubKeySize
+)
+
+// BIP352 tagged hash tags
+var (
+	silentPaymentInputsTag       = []byte("BIP0352/Inputs")
+	silentPaymentSharedSecretTag = []byte("BIP0352/SharedSecret")
+	silentPaymentLabelTag        = []byte("BIP0352/Label")
+)
+
+// numsPoint is the x coordinate of the BIP341 NUMS point H. Script-path
+// spends with H as internal key have no key holder and don't count as inputs.
+var numsPoint = []byte{
+	0x50, 0x92, 0x9b, 0x74, 0xc1, 0xa0, 0x49, 0x54, 0xb7, 0x8b, 0x4b, 0x60, 0x35, 0xe9, 0x7a, 0x5e,
+	0x07, 0x8a, 0x5a, 0x0f, 0x28, 0xec, 0x96, 0xd5, 0x47, 0xbf, 0xee, 0x9a, 0xce, 0x80, 0x3a, 0xc0,
+}
+
+// SilentPaymentKeys are the BIP352 scan and spend keys of an account
+type SilentPaymentKeys struct {
+	Scan  *btcec.PrivateKey
+	Spend *btcec.PrivateKey
+}
+
+// DeriveSilentPaymentKeys derives the silent payment keys of an account
+// Scan path: m/352'/coin_type'/account'/1'/0
+// Spend path: m/352'/coin_type'/account'/0'/0
+func DeriveSilentPaymentKeys(seed []byte, network string, account uint32) (*SilentPaymentKeys, error) {
+	if account > MaxAccount {
+		return nil, fmt.Errorf("account %d out of range", account)
+	}
+
+	params, err := NetworkParams(network)
+	if err != nil {
+		return nil, err
+	}
+
+	masterKey, err := hdkeychain.NewMaster(seed, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create master key: %w", err)
+	}
+
+	accountKey := masterKey
+	for _, child := range []uint32{BIP352Purpose, CoinTypeForNetwork(network), account} {
+		accountKey, err = accountKey.Derive(hdkeychain.HardenedKeyStart + child)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive silent payment account key: %w", err)
+		}
+	}
+
+	derive := func(branch uint32) (*btcec.PrivateKey, error) {
+		branchKey, err := accountKey.Derive(hdkeychain.HardenedKeyStart + branch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive silent payment key: %w", err)
+		}
+		key, err := branchKey.Derive(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive silent payment key: %w", err)
+		}
+		return GetPrivateKey(key)
+	}
+
+	scan, err := derive(1)
+	if err != nil {
+		return nil, err
+	}
+	spend, err := derive(0)
+	if err != nil {
+		return nil, err
+	}
+	return &SilentPaymentKeys{Scan: scan, Spend: spend}, nil
+}
+
+// Address returns the silent payment address of the keys
+func (k *SilentPaymentKeys) Address(network string) (string, error) {
+	return k.ScanKeys().Address(network)
+}
+
+// ScanKeys returns the keys that find payments to the address, which cannot
+// spend them
+func (k *SilentPaymentKeys) ScanKeys() *SilentPaymentScanKeys {
+	return &SilentPaymentScanKeys{Scan: k.Scan, Spend: k.Spend.PubKey()}
+}
+
+// SilentPaymentScanKeys are the scan private key and spend public key of a
+// silent payment address, and the labels payments may use
+type SilentPaymentScanKeys struct {
+	Scan   *btcec.PrivateKey
+	Spend  *btcec.PublicKey
+	Labels []uint32
+}
+
+// Address returns the silent payment address of the keys
+func (k *SilentPaymentScanKeys) Address(network string) (string, error) {
+	return EncodeSilentPaymentAddress(k.Scan.PubKey(), k.Spend, network)
+}
+
+// LabelAddress returns the address of label m, whose spend key is
+// B_m = B_spend + hash(b_scan || m)·G. Label 0 is reserved for change.
+func (k *SilentPaymentScanKeys) LabelAddress(network string, m uint32) (string, error) {
+	labelKey, _, err := k.label(m)
+	if err != nil {
+		return "", err
+	}
+	var spendPoint, labelPoint, labeled btcec.JacobianPoint
+	k.Spend.AsJacobian(&spendPoint)
+	labelKey.AsJacobian(&labelPoint)
+	btcec.AddNonConst(&spendPoint, &labelPoint, &labeled)
+	labeled.ToAffine()
+	if labeled.X.IsZero() && labeled.Y.IsZero() {
+		return "", fmt.Errorf("invalid silent payment label %d", m)
+	}
+	return EncodeSilentPaymentAddress(k.Scan.PubKey(), btcec.NewPublicKey(&labeled.X, &labeled.Y), network)
+}
+
+// label returns the point and scalar of label m's tweak
+func (k *SilentPaymentScanKeys) label(m uint32) (*btcec.PublicKey, []byte, error) {
+	var ser32 [4]byte
+	binary.BigEndian.PutUint32(ser32[:], m)
+	scan := k.Scan.Key.Bytes()
+	hash := chainhash.TaggedHash(silentPaymentLabelTag, scan[:], ser32[:])
+
+	var t btcec.ModNScalar
+	if t.SetBytes((*[32]byte)(hash)) != 0 {
+		return nil, nil, fmt.Errorf("invalid silent payment label %d", m)
+	}
+	return btcec.PrivKeyFromScalar(&t).PubKey(), hash[:], nil
+}
+
+// silentPaymentHRP returns the human-readable part of silent payment
+// addresses on a network: sp on mainnet, tsp on every test network
+func silentPaymentHRP(network string) string {
+	if network == "mainnet" {
+		return "sp"
+	}
+	return "tsp"
+}
+
+// EncodeSilentPaymentAddress returns the version 0 silent payment address of
+// a scan and spend public key
+func EncodeSilentPaymentAddress(scan, spend *btcec.PublicKey, network string) (string, error) {
+	payload := append(scan.SerializeCompressed(), spend.SerializeCompressed()...)
+	data, err := bech32.ConvertBits(payload, 8, 5, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode silent payment address: %w", err)
+	}
+	// Silent payment addresses are longer than the 90 characters bech32
+	// allows, which EncodeM doesn't enforce
+	return bech32.EncodeM(silentPaymentHRP(network), append([]byte{silentPaymentVersion}, data...))
+}
+
+// IsSilentPaymentAddress reports whether address looks like a silent payment
+// address of any network, valid or not
+func IsSilentPaymentAddress(address string) bool {
+	hrp, _, found := strings.Cut(strings.ToLower(address), "1")
+	return found && (hrp == "sp" || hrp == "tsp")
+}
+
+// DecodeSilentPaymentAddress returns the scan and spend public keys of a
+// silent payment address on the network
+func DecodeSilentPaymentAddress(address, network string) (scan, spend *btcec.PublicKey, err error) {
+	hrp, data, version, err := bech32.DecodeNoLimitWithVersion(address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid silent payment address: %w", err)
+	}
+	if version != bech32.VersionM {
+		return nil, nil, fmt.Errorf("invalid silent payment address: not bech32m")
+	}
+	if hrp != silentPaymentHRP(network) {
+		return nil, nil, fmt.Errorf("silent payment address is not for network %s", network)
+	}
+	if len(data) == 0 || data[0] != silentPaymentVersion {
+		return nil, nil, fmt.Errorf("unsupported silent payment address version")
+	}
+
+	payload, err := bech32.ConvertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid silent payment address: %w", err)
+	}
+	if len(payload) != silentPaymentKeysSize {
+		return nil, nil, fmt.Errorf("invalid silent payment address: %d byte payload", len(payload))
+	}
+
+	scan, err = btcec.ParsePubKey(payload[:compressedPubKeySize])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid silent payment scan key: %w", err)
+	}
+	spend, err = btcec.ParsePubKey(payload[compressedPubKeySize:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid silent payment spend key: %w", err)
+	}
+	return scan, spend, nil
+}
+
+// SilentPaymentInputKey is the private key of an input spent to a silent
+// payment. Taproot keys are used with an even Y coordinate, as BIP341 does.
+type SilentPaymentInputKey struct {
+	Key     *btcec.PrivateKey
+	Taproot bool
+}
+
+// SilentPaymentOutputKey returns the x-only Taproot output key a sender
+// spending outpoints with keys pays to the k-th output of a silent payment
+// address with the given scan and spend keys. Every outpoint of the
+// transaction is needed, but only the keys of the inputs BIP352 counts.
+func SilentPaymentOutputKey(keys []SilentPaymentInputKey, outpoints []wire.OutPoint, scan, spend *btcec.PublicKey, k uint32) ([]byte, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no inputs can pay a silent payment")
+	}
+
+	var a btcec.ModNScalar
+	for _, input := range keys {
+		d := input.Key.Key
+		if input.Taproot && input.Key.PubKey().SerializeCompressed()[0] == 0x03 {
+			d.Negate()
+		}
+		a.Add(&d)
+	}
+	if a.IsZero() {
+		return nil, fmt.Errorf("input keys sum to zero")
+	}
+
+	var sumA btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(&a, &sumA)
+	inputHash, err := silentPaymentInputHash(outpoints, &sumA)
+	if err != nil {
+		return nil, err
+	}
+
+	// ecdh = input_hash·a·B_scan
+	var scanPoint, ecdh btcec.JacobianPoint
+	scan.AsJacobian(&scanPoint)
+	inputHash.Mul(&a)
+	btcec.ScalarMultNonConst(inputHash, &scanPoint, &ecdh)
+
+	outputKey, _, err := silentPaymentOutputKey(&ecdh, spend, k)
+	if err != nil {
+		return nil, err
+	}
+	return schnorr.SerializePubKey(outputKey), nil
+}
+
+// SilentPaymentDestination returns the Taproot address that pays the silent
+// payment address from utxos. It depends only on the keys and outpoints of
+// utxos, so the transaction must spend exactly these inputs, in any order.
+func SilentPaymentDestination(seed []byte, network string, utxos []UTXO, address string) (string, error) {
+	scan, spend, err := DecodeSilentPaymentAddress(address, network)
+	if err != nil {
+		return "", err
+	}
+	params, err := NetworkParams(network)
+	if err != nil {
+		return "", err
+	}
+
+	keys := make([]SilentPaymentInputKey, 0, len(utxos))
+	outpoints := make([]wire.OutPoint, 0, len(utxos))
+	for _, utxo := range utxos {
+		txHash, err := chainhash.NewHashFromStr(utxo.TxID)
+		if err != nil {
+			return "", fmt.Errorf("invalid txid %s: %w", utxo.TxID, err)
+		}
+		outpoints = append(outpoints, wire.OutPoint{Hash: *txHash, Index: uint32(utxo.Vout)})
+
+		privKey, err := utxoPrivateKey(seed, network, utxo)
+		if err != nil {
+			return "", err
+		}
+		taproot := utxo.AddressType == AddressTypeP2TR
+		if taproot && len(utxo.SilentPaymentTweak) == 0 {
+			// BIP86 outputs commit to the tweaked key
+			privKey = txscript.TweakTaprootPrivKey(*privKey, nil)
+		}
+		keys = append(keys, SilentPaymentInputKey{Key: privKey, Taproot: taproot})
+	}
+
+	outputKey, err := SilentPaymentOutputKey(keys, outpoints, scan, spend, 0)
+	if err != nil {
+		return "", err
+	}
+	taprootAddress, err := btcutil.NewAddressTaproot(outputKey, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode silent payment output: %w", err)
+	}
+	return taprootAddress.EncodeAddress(), nil
+}
+
+// SilentPaymentPlaceholder returns a Taproot address of the silent payment
+// address's spend key. It has the size of the real output, so it can stand
+// in for it while inputs are selected and fees estimated, but must never be
+// paid.
+func SilentPaymentPlaceholder(address, network string) (string, error) {
+	_, spend, err := DecodeSilentPaymentAddress(address, network)
+	if err != nil {
+		return "", err
+	}
+	params, err := NetworkParams(network)
+	if err != nil {
+		return "", err
+	}
+	placeholder, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(spend), params)
+	if err != nil {
+		return "", err
+	}
+	return placeholder.EncodeAddress(), nil
+}
+
+// SilentPaymentOutput is an output of a transaction paid to the wallet's
+// silent payment address, with the tweak of its spend key. Outputs paid to
+// a label address have Labeled set, and their tweak includes the label's.
+type SilentPaymentOutput struct {
+	Vout    uint32
+	Value   int64
+	Tweak   []byte
+	Labeled bool
+	Label   uint32
+}
+
+// ScanSilentPayments returns the outputs of tx paid to the silent payment
+// address of keys or to one of its labels. prevOuts are the outputs spent by
+// the inputs of tx, in order.
+func ScanSilentPayments(tx *wire.MsgTx, prevOuts []*wire.TxOut, keys *SilentPaymentScanKeys) ([]SilentPaymentOutput, error) {
+	if len(prevOuts) != len(tx.TxIn) {
+		return nil, fmt.Errorf("got %d spent outputs for %d inputs", len(prevOuts), len(tx.TxIn))
+	}
+
+	taprootOutputs := make(map[string]uint32)
+	for vout, out := range tx.TxOut {
+		if txscript.IsPayToTaproot(out.PkScript) {
+			taprootOutputs[string(out.PkScript[2:])] = uint32(vout)
+		}
+	}
+	if len(taprootOutputs) == 0 {
+		return nil, nil
+	}
+
+	var sumA btcec.JacobianPoint
+	var found bool
+	outpoints := make([]wire.OutPoint, len(tx.TxIn))
+	for i, txIn := range tx.TxIn {
+		outpoints[i] = txIn.PreviousOutPoint
+
+		// Transactions spending unknown future witness versions are skipped
+		if version, _, err := txscript.ExtractWitnessProgramInfo(prevOuts[i].PkScript); err == nil && version > 1 {
+			return nil, nil
+		}
+
+		pubKey := silentPaymentInputPubKey(txIn, prevOuts[i].PkScript)
+		if pubKey == nil {
+			continue
+		}
+		var point btcec.JacobianPoint
+		pubKey.AsJacobian(&point)
+		btcec.AddNonConst(&sumA, &point, &sumA)
+		found = true
+	}
+	// Inputs whose keys cancel out can't be scanned
+	sumA.ToAffine()
+	if !found || (sumA.X.IsZero() && sumA.Y.IsZero()) {
+		return nil, nil
+	}
+
+	inputHash, err := silentPaymentInputHash(outpoints, &sumA)
+	if err != nil {
+		return nil, err
+	}
+
+	// ecdh = input_hash·b_scan·A
+	var ecdh btcec.JacobianPoint
+	inputHash.Mul(&keys.Scan.Key)
+	btcec.ScalarMultNonConst(inputHash, &sumA, &ecdh)
+
+	// An output paid to label m is P_k + label_m·G, so subtracting P_k from
+	// either point with the output's x coordinate gives the label's point
+	labels := make(map[string]uint32, len(keys.Labels))
+	labelTweaks := make(map[uint32][]byte, len(keys.Labels))
+	for _, m := range keys.Labels {
+		labelKey, tweak, err := keys.label(m)
+		if err != nil {
+			return nil, err
+		}
+		labels[string(labelKey.SerializeCompressed())] = m
+		labelTweaks[m] = tweak
+	}
+
+	var outputs []SilentPaymentOutput
+	for k := uint32(0); len(taprootOutputs) > 0; k++ {
+		outputKey, tweak, err := silentPaymentOutputKey(&ecdh, keys.Spend, k)
+		if err != nil {
+			return nil, err
+		}
+
+		output := SilentPaymentOutput{Tweak: tweak}
+		vout, ok := taprootOutputs[string(schnorr.SerializePubKey(outputKey))]
+		if !ok && len(labels) > 0 {
+			vout, output.Label, ok = matchSilentPaymentLabel(taprootOutputs, outputKey, labels)
+			if ok {
+				output.Labeled = true
+				output.Tweak = addScalars(tweak, labelTweaks[output.Label])
+			}
+		}
+		if !ok {
+			break
+		}
+
+		delete(taprootOutputs, string(tx.TxOut[vout].PkScript[2:]))
+		output.Vout = vout
+		output.Value = tx.TxOut[vout].Value
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// matchSilentPaymentLabel returns the output whose key is outputKey plus the
+// point of one of labels, which are keyed by compressed point
+func matchSilentPaymentLabel(taprootOutputs map[string]uint32, outputKey *btcec.PublicKey, labels map[string]uint32) (uint32, uint32, bool) {
+	var negP btcec.JacobianPoint
+	outputKey.AsJacobian(&negP)
+	negP.Y.Negate(1)
+	negP.Y.Normalize()
+
+	for xOnly, vout := range taprootOutputs {
+		output, err := schnorr.ParsePubKey([]byte(xOnly))
+		if err != nil {
+			continue
+		}
+		var point btcec.JacobianPoint
+		output.AsJacobian(&point)
+		for _, negate := range []bool{false, true} {
+			candidate := point
+			if negate {
+				candidate.Y.Negate(1)
+				candidate.Y.Normalize()
+			}
+			var label btcec.JacobianPoint
+			btcec.AddNonConst(&candidate, &negP, &label)
+			label.ToAffine()
+			if label.X.IsZero() && label.Y.IsZero() {
+				continue
+			}
+			if m, ok := labels[string(btcec.NewPublicKey(&label.X, &label.Y).SerializeCompressed())]; ok {
+				return vout, m, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// addScalars returns a + b mod n of two 32-byte scalars
+func addScalars(a, b []byte) []byte {
+	var x, y btcec.ModNScalar
+	x.SetByteSlice(a)
+	y.SetByteSlice(b)
+	x.Add(&y)
+	sum := x.Bytes()
+	return sum[:]
+}
+
+// SilentPaymentSpendKey returns the private key of a silent payment output:
+// the spend key plus the output's tweak. It signs the Taproot key path
+// directly, without a BIP86 tweak.
+func SilentPaymentSpendKey(seed []byte, network string, account uint32, tweak []byte) (*btcec.PrivateKey, error) {
+	keys, err := DeriveSilentPaymentKeys(seed, network, account)
+	if err != nil {
+		return nil, err
+	}
+
+	var t btcec.ModNScalar
+	if len(tweak) != chainhash.HashSize || t.SetByteSlice(tweak) {
+		return nil, fmt.Errorf("invalid silent payment tweak")
+	}
+	d := keys.Spend.Key
+	d.Add(&t)
+	if d.IsZero() {
+		return nil, fmt.Errorf("invalid silent payment tweak")
+	}
+	return btcec.PrivKeyFromScalar(&d), nil
+}
+
+// silentPaymentInputPubKey returns the public key BIP352 takes from an input
+// spending pkScript, or nil if the input doesn't count
+func silentPaymentInputPubKey(txIn *wire.TxIn, pkScript []byte) *btcec.PublicKey {
+	switch {
+	case txscript.IsPayToTaproot(pkScript):
+		witness := txIn.Witness
+		if len(witness) > 1 && len(witness[len(witness)-1]) > 0 && witness[len(witness)-1][0] == txscript.TaprootAnnexTag {
+			witness = witness[:len(witness)-1]
+		}
+		// A script-path spend with the NUMS internal key has no key holder
+		if len(witness) > 1 {
+			controlBlock := witness[len(witness)-1]
+			if len(controlBlock) >= 33 && bytes.Equal(controlBlock[1:33], numsPoint) {
+				return nil
+			}
+		}
+		pubKey, err := schnorr.ParsePubKey(pkScript[2:])
+		if err != nil {
+			return nil
+		}
+		return pubKey
+
+	case txscript.IsPayToWitnessPubKeyHash(pkScript):
+		return compressedWitnessPubKey(txIn.Witness)
+
+	case txscript.IsPayToScriptHash(pkScript):
+		// Only P2SH-P2WPKH counts: the scriptSig pushes the witness program
+		pushes, err := txscript.PushedData(txIn.SignatureScript)
+		if err != nil || len(pushes) != 1 || !txscript.IsPayToWitnessPubKeyHash(pushes[0]) {
+			return nil
+		}
+		return compressedWitnessPubKey(txIn.Witness)
+
+	case txscript.IsPayToPubKeyHash(pkScript):
+		// The scriptSig can be anything that satisfies the script, so look
+		// for the last compressed key that hashes to the script's hash
+		pushes, err := txscript.PushedData(txIn.SignatureScript)
+		if err != nil {
+			return nil
+		}
+		for i := len(pushes) - 1; i >= 0; i-- {
+			if len(pushes[i]) == compressedPubKeySize && bytes.Equal(btcutil.Hash160(pushes[i]), pkScript[3:23]) {
+				if pubKey, err := btcec.ParsePubKey(pushes[i]); err == nil {
+					return pubKey
+				}
+			}
+		}
+		return nil
+
+	default:
+		return nil
+	}
+}
+
+// compressedWitnessPubKey returns the compressed public key ending a P2WPKH
+// witness, or nil if the key is uncompressed or invalid
+func compressedWitnessPubKey(witness wire.TxWitness) *btcec.PublicKey {
+	if len(witness) != 2 || len(witness[1]) != compressedPubKeySize {
+		return nil
+	}
+	pubKey, err := btcec.ParsePubKey(witness[1])
+	if err != nil {
+		return nil
+	}
+	return pubKey
+}
+
+// silentPaymentInputHash returns input_hash: the tagged hash of the smallest
+// outpoint of the transaction and the sum of the input public keys A
+func silentPaymentInputHash(outpoints []wire.OutPoint, sumA *btcec.JacobianPoint) (*btcec.ModNScalar, error) {
+	var smallest []byte
+	for _, outpoint := range outpoints {
+		serialized := serializeOutPoint(outpoint)
+		if smallest == nil || bytes.Compare(serialized, smallest) < 0 {
+			smallest = serialized
+		}
+	}
+
+	hash := chainhash.TaggedHash(silentPaymentInputsTag, smallest, serializeJacobian(sumA))
+	var inputHash btcec.ModNScalar
+	if inputHash.SetBytes((*[32]byte)(hash)) != 0 {
+		return nil, fmt.Errorf("invalid silent payment input hash")
+	}
+	return &inputHash, nil
+}
+
+// silentPaymentOutputKey returns the key P_k = B_spend + t_k·G of the k-th
+// output paid with the shared secret ecdh, and its tweak t_k
+func silentPaymentOutputKey(ecdh *btcec.JacobianPoint, spend *btcec.PublicKey, k uint32) (*btcec.PublicKey, []byte, error) {
+	var ser32 [4]byte
+	binary.BigEndian.PutUint32(ser32[:], k)
+	hash := chainhash.TaggedHash(silentPaymentSharedSecretTag, serializeJacobian(ecdh), ser32[:])
+
+	var t btcec.ModNScalar
+	if t.SetBytes((*[32]byte)(hash)) != 0 {
+		return nil, nil, fmt.Errorf("invalid silent payment tweak")
+	}
+
+	var tG, spendPoint, p btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(&t, &tG)
+	spend.AsJacobian(&spendPoint)
+	btcec.AddNonConst(&spendPoint, &tG, &p)
+	p.ToAffine()
+
+	return btcec.NewPublicKey(&p.X, &p.Y), hash[:], nil
+}
+
+// serializeJacobian returns the compressed encoding of a point
+func serializeJacobian(point *btcec.JacobianPoint) []byte {
+	affine := *point
+	affine.ToAffine()
+	return btcec.NewPublicKey(&affine.X, &affine.Y).SerializeCompressed()
+}
+
+// serializeOutPoint returns the txid and little-endian index of an outpoint
+// as they appear in a transaction
+func serializeOutPoint(outpoint wire.OutPoint) []byte {
+	serialized := make([]byte, chainhash.HashSize+4)
+	copy(serialized, outpoint.Hash[:])
+	binary.LittleEndian.PutUint32(serialized[chainhash.HashSize:], outpoint.Index)
+	return serialized
+}
@@ -0,0 +1,588 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestSilentPaymentAddress(t *testing.T) {
+	seed, _ := hex.DecodeString("5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4")
+
+	keys, err := DeriveSilentPaymentKeys(seed, "mainnet", 0)
+	if err != nil {
+		t.Fatalf("DeriveSilentPaymentKeys() error = %v", err)
+	}
+	address, err := keys.Address("mainnet")
+	if err != nil {
+		t.Fatalf("Address() error = %v", err)
+	}
+	if !strings.HasPrefix(address, "sp1q") || len(address) != 116 {
+		t.Errorf("Address() = %s, want a 116 character sp1q... address", address)
+	}
+
+	scan, spend, err := DecodeSilentPaymentAddress(address, "mainnet")
+	if err != nil {
+		t.Fatalf("DecodeSilentPaymentAddress() error = %v", err)
+	}
+	if !scan.IsEqual(keys.Scan.PubKey()) || !spend.IsEqual(keys.Spend.PubKey()) {
+		t.Error("DecodeSilentPaymentAddress() did not return the encoded keys")
+	}
+	if _, _, err := DecodeSilentPaymentAddress(address, "regtest"); err == nil {
+		t.Error("DecodeSilentPaymentAddress() accepted a mainnet address on regtest")
+	}
+	if _, _, err := DecodeSilentPaymentAddress("bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", "mainnet"); err == nil {
+		t.Error("DecodeSilentPaymentAddress() accepted a Taproot address")
+	}
+
+	// Accounts and networks have their own keys
+	other, err := DeriveSilentPaymentKeys(seed, "mainnet", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Scan.PubKey().IsEqual(keys.Scan.PubKey()) {
+		t.Error("account 1 has the scan key of account 0")
+	}
+	testKeys, err := DeriveSilentPaymentKeys(seed, "regtest", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAddress, _ := testKeys.Address("regtest")
+	if !strings.HasPrefix(testAddress, "tsp1q") {
+		t.Errorf("Address() = %s, want tsp1q...", testAddress)
+	}
+	if testKeys.Spend.PubKey().IsEqual(keys.Spend.PubKey()) {
+		t.Error("regtest has the spend key of mainnet")
+	}
+}
+
+// silentPaymentSender is a key spending an input of a test transaction
+type silentPaymentSender struct {
+	key      *btcec.PrivateKey
+	pkScript []byte
+	txIn     *wire.TxIn
+}
+
+// newSilentPaymentSender returns a sender input of the address type,
+// signed with placeholder signatures: scanning only reads the public keys
+func newSilentPaymentSender(t *testing.T, keyByte byte, addressType string, index uint32) silentPaymentSender {
+	t.Helper()
+
+	key, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{keyByte}, 32))
+	pubKey := key.PubKey().SerializeCompressed()
+	txIn := wire.NewTxIn(&wire.OutPoint{Hash: chainhash.HashH([]byte{keyByte}), Index: index}, nil, nil)
+
+	var pkScript []byte
+	switch addressType {
+	case AddressTypeP2TR:
+		pkScript = append([]byte{txscript.OP_1, txscript.OP_DATA_32}, schnorr.SerializePubKey(key.PubKey())...)
+		txIn.Witness = wire.TxWitness{make([]byte, 64)}
+	case AddressTypeP2PKH:
+		pkScript, _ = txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+			AddData(btcutil.Hash160(pubKey)).AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).Script()
+		txIn.SignatureScript, _ = txscript.NewScriptBuilder().AddData(make([]byte, 71)).AddData(pubKey).Script()
+	default:
+		pkScript = append([]byte{txscript.OP_0, txscript.OP_DATA_20}, btcutil.Hash160(pubKey)...)
+		txIn.Witness = wire.TxWitness{make([]byte, 71), pubKey}
+	}
+	return silentPaymentSender{key: key, pkScript: pkScript, txIn: txIn}
+}
+
+func TestScanSilentPayments(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	keys, err := DeriveSilentPaymentKeys(seed, "regtest", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	senders := []silentPaymentSender{
+		newSilentPaymentSender(t, 0x11, AddressTypeP2WPKH, 3),
+		newSilentPaymentSender(t, 0x22, AddressTypeP2TR, 0),
+		newSilentPaymentSender(t, 0x33, AddressTypeP2PKH, 1),
+	}
+
+	tx := wire.NewMsgTx(2)
+	var prevOuts []*wire.TxOut
+	var inputKeys []SilentPaymentInputKey
+	var outpoints []wire.OutPoint
+	for _, sender := range senders {
+		tx.AddTxIn(sender.txIn)
+		prevOuts = append(prevOuts, wire.NewTxOut(100000, sender.pkScript))
+		inputKeys = append(inputKeys, SilentPaymentInputKey{Key: sender.key, Taproot: txscript.IsPayToTaproot(sender.pkScript)})
+		outpoints = append(outpoints, sender.txIn.PreviousOutPoint)
+	}
+
+	// Two outputs to the wallet, after an unrelated Taproot output
+	tx.AddTxOut(wire.NewTxOut(1000, append([]byte{txscript.OP_1, txscript.OP_DATA_32}, bytes.Repeat([]byte{0x02}, 32)...)))
+	for k, value := range []int64{20000, 30000} {
+		outputKey, err := SilentPaymentOutputKey(inputKeys, outpoints, keys.Scan.PubKey(), keys.Spend.PubKey(), uint32(k))
+		if err != nil {
+			t.Fatalf("SilentPaymentOutputKey() error = %v", err)
+		}
+		tx.AddTxOut(wire.NewTxOut(value, append([]byte{txscript.OP_1, txscript.OP_DATA_32}, outputKey...)))
+	}
+
+	t.Run("finds outputs", func(t *testing.T) {
+		found, err := ScanSilentPayments(tx, prevOuts, keys.ScanKeys())
+		if err != nil {
+			t.Fatalf("ScanSilentPayments() error = %v", err)
+		}
+		if len(found) != 2 || found[0].Vout != 1 || found[1].Vout != 2 || found[1].Value != 30000 {
+			t.Fatalf("ScanSilentPayments() = %+v, want vouts 1 and 2", found)
+		}
+
+		// The tweaked spend key controls the output key directly
+		for _, output := range found {
+			privKey, err := SilentPaymentSpendKey(seed, "regtest", 0, output.Tweak)
+			if err != nil {
+				t.Fatalf("SilentPaymentSpendKey() error = %v", err)
+			}
+			if got := schnorr.SerializePubKey(privKey.PubKey()); !bytes.Equal(got, tx.TxOut[output.Vout].PkScript[2:]) {
+				t.Errorf("spend key of output %d is %x, want %x", output.Vout, got, tx.TxOut[output.Vout].PkScript[2:])
+			}
+		}
+	})
+
+	t.Run("finds label outputs", func(t *testing.T) {
+		scanKeys := keys.ScanKeys()
+		scanKeys.Labels = []uint32{1, 7}
+		labelAddress, err := scanKeys.LabelAddress("regtest", 7)
+		if err != nil {
+			t.Fatalf("LabelAddress() error = %v", err)
+		}
+		_, labelSpend, err := DecodeSilentPaymentAddress(labelAddress, "regtest")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// k keeps counting across the labels of one scan key
+		labeled := tx.Copy()
+		outputKey, err := SilentPaymentOutputKey(inputKeys, outpoints, keys.Scan.PubKey(), labelSpend, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		labeled.AddTxOut(wire.NewTxOut(40000, append([]byte{txscript.OP_1, txscript.OP_DATA_32}, outputKey...)))
+
+		found, err := ScanSilentPayments(labeled, prevOuts, scanKeys)
+		if err != nil {
+			t.Fatalf("ScanSilentPayments() error = %v", err)
+		}
+		if len(found) != 3 || found[2].Vout != 3 || !found[2].Labeled || found[2].Label != 7 || found[0].Labeled {
+			t.Fatalf("ScanSilentPayments() = %+v, want vout 3 at label 7", found)
+		}
+		privKey, err := SilentPaymentSpendKey(seed, "regtest", 0, found[2].Tweak)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := schnorr.SerializePubKey(privKey.PubKey()); !bytes.Equal(got, outputKey) {
+			t.Errorf("spend key of the label output is %x, want %x", got, outputKey)
+		}
+
+		// Without the label the output is not found
+		if found, _ := ScanSilentPayments(labeled, prevOuts, keys.ScanKeys()); len(found) != 2 {
+			t.Errorf("ScanSilentPayments() without labels found %d outputs, want 2", len(found))
+		}
+	})
+
+	t.Run("other wallet", func(t *testing.T) {
+		other, _ := DeriveSilentPaymentKeys(seed, "regtest", 1)
+		found, err := ScanSilentPayments(tx, prevOuts, other.ScanKeys())
+		if err != nil || len(found) != 0 {
+			t.Errorf("ScanSilentPayments() = %+v, %v, want nothing", found, err)
+		}
+	})
+
+	t.Run("NUMS script path input is skipped", func(t *testing.T) {
+		skipped := tx.Copy()
+		controlBlock := append([]byte{0xc0}, numsPoint...)
+		skipped.TxIn[1].Witness = wire.TxWitness{{txscript.OP_TRUE}, controlBlock}
+		if found, _ := ScanSilentPayments(skipped, prevOuts, keys.ScanKeys()); len(found) != 0 {
+			t.Errorf("ScanSilentPayments() counted a NUMS script path input")
+		}
+	})
+
+	t.Run("future witness version skips the transaction", func(t *testing.T) {
+		futurePrevOuts := append([]*wire.TxOut(nil), prevOuts...)
+		futurePrevOuts = append(futurePrevOuts, wire.NewTxOut(1000, append([]byte{txscript.OP_2, txscript.OP_DATA_32}, make([]byte, 32)...)))
+		future := tx.Copy()
+		future.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 9}, nil, wire.TxWitness{{0x01}}))
+		if found, _ := ScanSilentPayments(future, futurePrevOuts, keys.ScanKeys()); len(found) != 0 {
+			t.Errorf("ScanSilentPayments() scanned a transaction spending witness v2")
+		}
+	})
+
+	t.Run("spends the detected output", func(t *testing.T) {
+		found, _ := ScanSilentPayments(tx, prevOuts, keys.ScanKeys())
+		script := tx.TxOut[found[0].Vout].PkScript
+		utxo := UTXO{
+			TxID:               tx.TxHash().String(),
+			Vout:               int(found[0].Vout),
+			Value:              found[0].Value,
+			ScriptPubKey:       script,
+			AddressType:        AddressTypeP2TR,
+			SilentPaymentTweak: found[0].Tweak,
+		}
+		outputs := []TxOutput{{Address: "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080", Value: 10000}}
+		result, err := BuildTransactionWithFee(seed, "regtest", []UTXO{utxo}, outputs, outputs[0].Address, Fee{Rate: SatPerVByte(2)}, 0)
+		if err != nil {
+			t.Fatalf("BuildTransactionWithFee() error = %v", err)
+		}
+
+		raw, _ := hex.DecodeString(result.Hex)
+		spend := wire.NewMsgTx(2)
+		if err := spend.Deserialize(bytes.NewReader(raw)); err != nil {
+			t.Fatal(err)
+		}
+		fetcher := txscript.NewCannedPrevOutputFetcher(script, utxo.Value)
+		vm, err := txscript.NewEngine(script, spend, 0, txscript.StandardVerifyFlags,
+			nil, txscript.NewTxSigHashes(spend, fetcher), utxo.Value, fetcher)
+		if err != nil {
+			t.Fatalf("txscript.NewEngine() error = %v", err)
+		}
+		if err := vm.Execute(); err != nil {
+			t.Errorf("signature does not verify against the silent payment output: %v", err)
+		}
+	})
+}
+
+func TestSilentPaymentDestination(t *testing.T) {
+	receiverSeed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	receiver, err := DeriveSilentPaymentKeys(receiverSeed, "regtest", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, _ := receiver.Address("regtest")
+
+	if err := ValidateAddress(address, "regtest"); err != nil {
+		t.Errorf("ValidateAddress(%s) error = %v", address, err)
+	}
+	if err := ValidateAddress(address, "mainnet"); err == nil {
+		t.Error("ValidateAddress() accepted a test network silent payment address on mainnet")
+	}
+
+	// The sender spends a BIP86 and a BIP84 output of its own seed
+	seed, _ := hex.DecodeString("5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4")
+	var utxos []UTXO
+	for i, addressType := range []string{AddressTypeP2TR, AddressTypeP2WPKH} {
+		info, err := GenerateAddressInfoForAccount(seed, "regtest", 0, 0, uint32(i), addressType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		script, _ := GetScriptPubKey(info.Address, "regtest")
+		utxos = append(utxos, UTXO{
+			TxID:         chainhash.HashH([]byte{byte(i)}).String(),
+			Vout:         i,
+			Value:        50000,
+			Address:      info.Address,
+			AddressIndex: uint32(i),
+			ScriptPubKey: script,
+			AddressType:  addressType,
+		})
+	}
+
+	destination, err := SilentPaymentDestination(seed, "regtest", utxos, address)
+	if err != nil {
+		t.Fatalf("SilentPaymentDestination() error = %v", err)
+	}
+	if addressType, _ := GetAddressType(destination, "regtest"); addressType != AddressTypeP2TR {
+		t.Errorf("destination %s is %s, want p2tr", destination, addressType)
+	}
+
+	// The output depends on the input set, not its order
+	reversed, _ := SilentPaymentDestination(seed, "regtest", []UTXO{utxos[1], utxos[0]}, address)
+	if reversed != destination {
+		t.Errorf("reordered inputs pay %s, want %s", reversed, destination)
+	}
+	single, _ := SilentPaymentDestination(seed, "regtest", utxos[:1], address)
+	if single == destination {
+		t.Error("a different input set pays the same output")
+	}
+
+	// The receiver finds the payment in the signed transaction
+	result, err := BuildTransactionWithFee(seed, "regtest", utxos, []TxOutput{{Address: destination, Value: 70000}}, utxos[1].Address, Fee{Rate: SatPerVByte(2)}, 0)
+	if err != nil {
+		t.Fatalf("BuildTransactionWithFee() error = %v", err)
+	}
+	raw, _ := hex.DecodeString(result.Hex)
+	tx := wire.NewMsgTx(2)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	prevOuts := make([]*wire.TxOut, len(tx.TxIn))
+	for i, txIn := range tx.TxIn {
+		for _, utxo := range utxos {
+			if txIn.PreviousOutPoint.Hash.String() == utxo.TxID && int(txIn.PreviousOutPoint.Index) == utxo.Vout {
+				prevOuts[i] = wire.NewTxOut(utxo.Value, utxo.ScriptPubKey)
+			}
+		}
+	}
+
+	found, err := ScanSilentPayments(tx, prevOuts, receiver.ScanKeys())
+	if err != nil {
+		t.Fatalf("ScanSilentPayments() error = %v", err)
+	}
+	if len(found) != 1 || found[0].Value != 70000 {
+		t.Errorf("ScanSilentPayments() = %+v, want the 70000 sat payment", found)
+	}
+}
+
+// bip352VectorsFile is the send_and_receive_test_vectors.json of BIP352,
+// from https://github.com/bitcoin/bips/tree/master/bip-0352
+var bip352VectorsFile = filepath.Join("testdata", "bip352_send_and_receive_test_vectors.json")
+
+type bip352Input struct {
+	TxID        string `json:"txid"`
+	Vout        uint32 `json:"vout"`
+	ScriptSig   string `json:"scriptSig"`
+	TxInWitness string `json:"txinwitness"`
+	Prevout     struct {
+		ScriptPubKey struct {
+			Hex string `json:"hex"`
+		} `json:"scriptPubKey"`
+	} `json:"prevout"`
+	PrivateKey string `json:"private_key"`
+}
+
+type bip352Vector struct {
+	Comment string `json:"comment"`
+	Sending []struct {
+		Given struct {
+			Vin        []bip352Input     `json:"vin"`
+			Recipients []json.RawMessage `json:"recipients"`
+		} `json:"given"`
+		Expected struct {
+			Outputs json.RawMessage `json:"outputs"`
+		} `json:"expected"`
+	} `json:"sending"`
+	Receiving []struct {
+		Given struct {
+			Vin         []bip352Input `json:"vin"`
+			Outputs     []string      `json:"outputs"`
+			KeyMaterial struct {
+				SpendPrivKey string `json:"spend_priv_key"`
+				ScanPrivKey  string `json:"scan_priv_key"`
+			} `json:"key_material"`
+			Labels []uint32 `json:"labels"`
+		} `json:"given"`
+		Expected struct {
+			Addresses []string `json:"addresses"`
+			Outputs   []struct {
+				PubKey       string `json:"pub_key"`
+				PrivKeyTweak string `json:"priv_key_tweak"`
+			} `json:"outputs"`
+		} `json:"expected"`
+	} `json:"receiving"`
+}
+
+// txIn returns the input and the output it spends
+func (in *bip352Input) txIn(t *testing.T) (*wire.TxIn, *wire.TxOut) {
+	t.Helper()
+
+	hash, err := chainhash.NewHashFromStr(in.TxID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txIn := wire.NewTxIn(&wire.OutPoint{Hash: *hash, Index: in.Vout}, mustHex(t, in.ScriptSig), nil)
+	if raw := mustHex(t, in.TxInWitness); len(raw) > 0 {
+		r := bytes.NewReader(raw)
+		count, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := uint64(0); i < count; i++ {
+			item, err := wire.ReadVarBytes(r, 0, wire.MaxMessagePayload, "witness item")
+			if err != nil {
+				t.Fatal(err)
+			}
+			txIn.Witness = append(txIn.Witness, item)
+		}
+	}
+	return txIn, wire.NewTxOut(0, mustHex(t, in.Prevout.ScriptPubKey.Hex))
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+	return b
+}
+
+// bip352Recipient returns the address of a recipient, which vector versions
+// give as a string, an [address, amount] pair or an object
+func bip352Recipient(t *testing.T, raw json.RawMessage) string {
+	t.Helper()
+	var address string
+	if json.Unmarshal(raw, &address) == nil {
+		return address
+	}
+	var pair []json.RawMessage
+	if json.Unmarshal(raw, &pair) == nil && len(pair) > 0 && json.Unmarshal(pair[0], &address) == nil {
+		return address
+	}
+	var object struct {
+		Address string `json:"address"`
+	}
+	if json.Unmarshal(raw, &object) == nil && object.Address != "" {
+		return object.Address
+	}
+	t.Fatalf("unknown recipient %s", raw)
+	return ""
+}
+
+// bip352OutputSets returns the acceptable output sets, which vector versions
+// give as one list or a list of alternative lists
+func bip352OutputSets(t *testing.T, raw json.RawMessage) [][]string {
+	t.Helper()
+	var sets [][]string
+	if json.Unmarshal(raw, &sets) == nil {
+		return sets
+	}
+	var single []string
+	if err := json.Unmarshal(raw, &single); err != nil {
+		t.Fatalf("unknown expected outputs %s", raw)
+	}
+	return [][]string{single}
+}
+
+func sortedCopy(values []string) []string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func TestSilentPaymentVectors(t *testing.T) {
+	raw, err := os.ReadFile(bip352VectorsFile)
+	if err != nil {
+		t.Fatalf("reading the BIP352 vectors: %v", err)
+	}
+	var vectors []bip352Vector
+	if err := json.Unmarshal(raw, &vectors); err != nil {
+		t.Fatalf("invalid vectors: %v", err)
+	}
+	if len(vectors) == 0 {
+		t.Fatalf("%s has no vectors", bip352VectorsFile)
+	}
+
+	for _, vector := range vectors {
+		t.Run(vector.Comment, func(t *testing.T) {
+			for _, sending := range vector.Sending {
+				var keys []SilentPaymentInputKey
+				var outpoints []wire.OutPoint
+				futureVersion := false
+				for _, in := range sending.Given.Vin {
+					txIn, prevOut := in.txIn(t)
+					outpoints = append(outpoints, txIn.PreviousOutPoint)
+					if version, _, err := txscript.ExtractWitnessProgramInfo(prevOut.PkScript); err == nil && version > 1 {
+						futureVersion = true
+					}
+					if silentPaymentInputPubKey(txIn, prevOut.PkScript) == nil {
+						continue
+					}
+					key, _ := btcec.PrivKeyFromBytes(mustHex(t, in.PrivateKey))
+					keys = append(keys, SilentPaymentInputKey{Key: key, Taproot: txscript.IsPayToTaproot(prevOut.PkScript)})
+				}
+
+				// k counts the recipients sharing a scan key
+				var got []string
+				counts := make(map[string]uint32)
+				for _, recipient := range sending.Given.Recipients {
+					if futureVersion {
+						break
+					}
+					scan, spend, err := DecodeSilentPaymentAddress(bip352Recipient(t, recipient), "mainnet")
+					if err != nil {
+						t.Fatalf("DecodeSilentPaymentAddress() error = %v", err)
+					}
+					scanID := string(scan.SerializeCompressed())
+					outputKey, err := SilentPaymentOutputKey(keys, outpoints, scan, spend, counts[scanID])
+					if err != nil {
+						break
+					}
+					counts[scanID]++
+					got = append(got, hex.EncodeToString(outputKey))
+				}
+
+				matched := false
+				for _, want := range bip352OutputSets(t, sending.Expected.Outputs) {
+					if strings.Join(sortedCopy(want), ",") == strings.Join(sortedCopy(got), ",") {
+						matched = true
+						break
+					}
+				}
+				if !matched {
+					t.Errorf("sending outputs = %v, want one of %s", got, sending.Expected.Outputs)
+				}
+			}
+
+			for _, receiving := range vector.Receiving {
+				tx := wire.NewMsgTx(2)
+				var prevOuts []*wire.TxOut
+				for _, in := range receiving.Given.Vin {
+					txIn, prevOut := in.txIn(t)
+					tx.AddTxIn(txIn)
+					prevOuts = append(prevOuts, prevOut)
+				}
+				for _, output := range receiving.Given.Outputs {
+					tx.AddTxOut(wire.NewTxOut(0, append([]byte{txscript.OP_1, txscript.OP_DATA_32}, mustHex(t, output)...)))
+				}
+
+				scan, _ := btcec.PrivKeyFromBytes(mustHex(t, receiving.Given.KeyMaterial.ScanPrivKey))
+				spend, _ := btcec.PrivKeyFromBytes(mustHex(t, receiving.Given.KeyMaterial.SpendPrivKey))
+				keys := &SilentPaymentScanKeys{Scan: scan, Spend: spend.PubKey(), Labels: receiving.Given.Labels}
+
+				address, err := keys.Address("mainnet")
+				if err != nil {
+					t.Fatal(err)
+				}
+				addresses := []string{address}
+				for _, m := range keys.Labels {
+					labelAddress, err := keys.LabelAddress("mainnet", m)
+					if err != nil {
+						t.Fatal(err)
+					}
+					addresses = append(addresses, labelAddress)
+				}
+				if strings.Join(sortedCopy(addresses), ",") != strings.Join(sortedCopy(receiving.Expected.Addresses), ",") {
+					t.Errorf("addresses = %v, want %v", addresses, receiving.Expected.Addresses)
+				}
+
+				found, err := ScanSilentPayments(tx, prevOuts, keys)
+				if err != nil {
+					t.Fatalf("ScanSilentPayments() error = %v", err)
+				}
+				var got, want []string
+				for _, output := range found {
+					got = append(got, hex.EncodeToString(tx.TxOut[output.Vout].PkScript[2:])+":"+hex.EncodeToString(output.Tweak))
+
+					// The tweaked spend key controls the output
+					var d btcec.ModNScalar
+					d.SetByteSlice(output.Tweak)
+					d.Add(&spend.Key)
+					if xOnly := schnorr.SerializePubKey(btcec.PrivKeyFromScalar(&d).PubKey()); !bytes.Equal(xOnly, tx.TxOut[output.Vout].PkScript[2:]) {
+						t.Errorf("tweaked spend key of output %d is %x", output.Vout, xOnly)
+					}
+				}
+				for _, output := range receiving.Expected.Outputs {
+					want = append(want, output.PubKey+":"+output.PrivKeyTweak)
+				}
+				if strings.Join(sortedCopy(got), ",") != strings.Join(sortedCopy(want), ",") {
+					t.Errorf("received outputs = %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,486 @@
+package wallet
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// SLIP-39 Shamir secret sharing of a master secret
+// (https://github.com/satoshilabs/slips/blob/master/slip-0039.md)
+
+const (
+	slip39RadixBits          = 10
+	slip39MetadataWords      = 7 // identifier (2), group parameters (2) and checksum (3)
+	slip39ChecksumWords      = 3
+	slip39DigestLength       = 4
+	slip39DigestIndex        = 254
+	slip39SecretIndex        = 255
+	slip39RoundCount         = 4
+	slip39BaseIterationCount = 10000
+	slip39MinSecretLength    = 16
+
+	// Slip39MaxShareCount is the maximum number of groups, and of members in a group
+	Slip39MaxShareCount = 16
+	// Slip39DefaultIterationExponent is the PBKDF2 iteration exponent of new shares
+	Slip39DefaultIterationExponent = 1
+)
+
+// Slip39Group is the member threshold and share count of a SLIP-39 group
+type Slip39Group struct {
+	Threshold int
+	Count     int
+}
+
+// slip39Share is one decoded SLIP-39 mnemonic
+type slip39Share struct {
+	identifier        uint16
+	extendable        bool
+	iterationExponent int
+	groupIndex        int
+	groupThreshold    int
+	groupCount        int
+	memberIndex       int
+	memberThreshold   int
+	value             []byte
+}
+
+// GenerateSlip39Shares splits masterSecret into SLIP-39 mnemonics. Any
+// groupThreshold of the groups, each with its own member threshold of
+// shares, recover the secret. The result holds the mnemonics of each group.
+func GenerateSlip39Shares(groupThreshold int, groups []Slip39Group, masterSecret []byte, passphrase string, iterationExponent int) ([][]string, error) {
+	if len(masterSecret) < slip39MinSecretLength || len(masterSecret)%2 != 0 {
+		return nil, fmt.Errorf("master secret must be an even number of bytes, at least %d", slip39MinSecretLength)
+	}
+	if len(groups) == 0 || len(groups) > Slip39MaxShareCount {
+		return nil, fmt.Errorf("group count must be between 1 and %d", Slip39MaxShareCount)
+	}
+	if groupThreshold < 1 || groupThreshold > len(groups) {
+		return nil, fmt.Errorf("group threshold must be between 1 and the group count (%d)", len(groups))
+	}
+	for i, group := range groups {
+		if group.Count < 1 || group.Count > Slip39MaxShareCount {
+			return nil, fmt.Errorf("group %d: share count must be between 1 and %d", i+1, Slip39MaxShareCount)
+		}
+		if group.Threshold < 1 || group.Threshold > group.Count {
+			return nil, fmt.Errorf("group %d: threshold must be between 1 and the share count (%d)", i+1, group.Count)
+		}
+		if group.Threshold == 1 && group.Count > 1 {
+			return nil, fmt.Errorf("group %d: a 1-of-%d group would hand out copies of one share; use 1-of-1", i+1, group.Count)
+		}
+	}
+	if iterationExponent < 0 || iterationExponent > 15 {
+		return nil, fmt.Errorf("iteration exponent must be between 0 and 15")
+	}
+	if err := validateSlip39Passphrase(passphrase); err != nil {
+		return nil, err
+	}
+
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate share identifier: %w", err)
+	}
+	identifier := binary.BigEndian.Uint16(id[:]) & 0x7fff
+
+	encrypted, err := slip39Feistel(masterSecret, passphrase, iterationExponent, identifier, true, false)
+	if err != nil {
+		return nil, err
+	}
+
+	groupSecrets, err := slip39Split(groupThreshold, len(groups), encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	mnemonics := make([][]string, len(groups))
+	for groupIndex, group := range groups {
+		memberSecrets, err := slip39Split(group.Threshold, group.Count, groupSecrets[groupIndex])
+		if err != nil {
+			return nil, err
+		}
+		for memberIndex, value := range memberSecrets {
+			share := &slip39Share{
+				identifier:        identifier,
+				extendable:        true,
+				iterationExponent: iterationExponent,
+				groupIndex:        groupIndex,
+				groupThreshold:    groupThreshold,
+				groupCount:        len(groups),
+				memberIndex:       memberIndex,
+				memberThreshold:   group.Threshold,
+				value:             value,
+			}
+			mnemonics[groupIndex] = append(mnemonics[groupIndex], share.mnemonic())
+		}
+	}
+	return mnemonics, nil
+}
+
+// CombineSlip39Shares recovers the master secret from SLIP-39 mnemonics.
+// Extra shares and incomplete groups are ignored as long as enough groups
+// are complete. A wrong passphrase yields a different secret, not an error.
+func CombineSlip39Shares(mnemonics []string, passphrase string) ([]byte, error) {
+	if len(mnemonics) == 0 {
+		return nil, fmt.Errorf("no shares given")
+	}
+	if err := validateSlip39Passphrase(passphrase); err != nil {
+		return nil, err
+	}
+
+	var shares []*slip39Share
+	for i, mnemonic := range mnemonics {
+		share, err := parseSlip39Share(mnemonic)
+		if err != nil {
+			return nil, fmt.Errorf("share %d: %w", i+1, err)
+		}
+		shares = append(shares, share)
+	}
+
+	first := shares[0]
+	groups := make(map[int]map[int]*slip39Share)
+	memberThresholds := make(map[int]int)
+	for i, share := range shares {
+		if share.identifier != first.identifier || share.extendable != first.extendable ||
+			share.iterationExponent != first.iterationExponent || share.groupThreshold != first.groupThreshold ||
+			share.groupCount != first.groupCount || len(share.value) != len(first.value) {
+			return nil, fmt.Errorf("share %d does not belong to the same secret as share 1", i+1)
+		}
+
+		members := groups[share.groupIndex]
+		if members == nil {
+			members = make(map[int]*slip39Share)
+			groups[share.groupIndex] = members
+			memberThresholds[share.groupIndex] = share.memberThreshold
+		}
+		if share.memberThreshold != memberThresholds[share.groupIndex] {
+			return nil, fmt.Errorf("share %d: member threshold differs from other shares of group %d", i+1, share.groupIndex+1)
+		}
+		if existing := members[share.memberIndex]; existing != nil && subtle.ConstantTimeCompare(existing.value, share.value) != 1 {
+			return nil, fmt.Errorf("share %d conflicts with another share of group %d member %d", i+1, share.groupIndex+1, share.memberIndex+1)
+		}
+		members[share.memberIndex] = share
+	}
+
+	var groupIndices []int
+	for groupIndex, members := range groups {
+		if len(members) >= memberThresholds[groupIndex] {
+			groupIndices = append(groupIndices, groupIndex)
+		}
+	}
+	if len(groupIndices) < first.groupThreshold {
+		return nil, fmt.Errorf("%d of %d groups are complete, %d are required", len(groupIndices), first.groupCount, first.groupThreshold)
+	}
+	sort.Ints(groupIndices)
+	groupIndices = groupIndices[:first.groupThreshold]
+
+	groupXs := make([]byte, 0, len(groupIndices))
+	groupSecrets := make([][]byte, 0, len(groupIndices))
+	for _, groupIndex := range groupIndices {
+		members := groups[groupIndex]
+		var memberIndices []int
+		for memberIndex := range members {
+			memberIndices = append(memberIndices, memberIndex)
+		}
+		sort.Ints(memberIndices)
+		memberIndices = memberIndices[:memberThresholds[groupIndex]]
+
+		xs := make([]byte, 0, len(memberIndices))
+		ys := make([][]byte, 0, len(memberIndices))
+		for _, memberIndex := range memberIndices {
+			xs = append(xs, byte(memberIndex))
+			ys = append(ys, members[memberIndex].value)
+		}
+		secret, err := slip39Recover(len(xs), xs, ys)
+		if err != nil {
+			return nil, fmt.Errorf("group %d: %w", groupIndex+1, err)
+		}
+		groupXs = append(groupXs, byte(groupIndex))
+		groupSecrets = append(groupSecrets, secret)
+	}
+
+	encrypted, err := slip39Recover(first.groupThreshold, groupXs, groupSecrets)
+	if err != nil {
+		return nil, err
+	}
+	return slip39Feistel(encrypted, passphrase, first.iterationExponent, first.identifier, first.extendable, true)
+}
+
+// validateSlip39Passphrase checks that a passphrase is printable ASCII
+func validateSlip39Passphrase(passphrase string) error {
+	for _, c := range passphrase {
+		if c < 32 || c > 126 {
+			return fmt.Errorf("passphrase must contain only printable ASCII characters")
+		}
+	}
+	return nil
+}
+
+// mnemonic encodes the share as words
+func (s *slip39Share) mnemonic() string {
+	extendable := 0
+	if s.extendable {
+		extendable = 1
+	}
+	idExp := int(s.identifier)<<5 | extendable<<4 | s.iterationExponent
+	params := s.groupIndex<<16 | (s.groupThreshold-1)<<12 | (s.groupCount-1)<<8 | s.memberIndex<<4 | (s.memberThreshold - 1)
+	data := []int{idExp >> 10, idExp & 1023, params >> 10, params & 1023}
+
+	valueWords := (len(s.value)*8 + slip39RadixBits - 1) / slip39RadixBits
+	value := new(big.Int).SetBytes(s.value)
+	mask := big.NewInt(1023)
+	for i := valueWords - 1; i >= 0; i-- {
+		word := new(big.Int).Rsh(value, uint(i*slip39RadixBits))
+		data = append(data, int(word.And(word, mask).Int64()))
+	}
+
+	checksum := slip39Polymod(slip39Customization(s.extendable), append(data, 0, 0, 0)) ^ 1
+	for i := slip39ChecksumWords - 1; i >= 0; i-- {
+		data = append(data, (checksum>>(i*slip39RadixBits))&1023)
+	}
+
+	words := make([]string, len(data))
+	for i, index := range data {
+		words[i] = slip39Words[index]
+	}
+	return strings.Join(words, " ")
+}
+
+// parseSlip39Share decodes a mnemonic and verifies its checksum. Words may
+// be abbreviated to their first four letters.
+func parseSlip39Share(mnemonic string) (*slip39Share, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	minWords := slip39MetadataWords + (slip39MinSecretLength*8+slip39RadixBits-1)/slip39RadixBits
+	if len(words) < minWords {
+		return nil, fmt.Errorf("mnemonic must have at least %d words, got %d", minWords, len(words))
+	}
+	paddingBits := (slip39RadixBits * (len(words) - slip39MetadataWords)) % 16
+	if paddingBits > 8 {
+		return nil, fmt.Errorf("invalid mnemonic length of %d words", len(words))
+	}
+
+	data := make([]int, len(words))
+	for i, word := range words {
+		index, ok := slip39WordIndex[word]
+		if !ok {
+			return nil, fmt.Errorf("word %d (%q) is not in the SLIP-39 wordlist", i+1, word)
+		}
+		data[i] = index
+	}
+
+	idExp := data[0]<<10 | data[1]
+	share := &slip39Share{
+		identifier:        uint16(idExp >> 5),
+		extendable:        (idExp>>4)&1 == 1,
+		iterationExponent: idExp & 15,
+	}
+	if slip39Polymod(slip39Customization(share.extendable), data) != 1 {
+		return nil, fmt.Errorf("invalid mnemonic checksum")
+	}
+
+	params := data[2]<<10 | data[3]
+	share.groupIndex = params >> 16
+	share.groupThreshold = (params>>12)&15 + 1
+	share.groupCount = (params>>8)&15 + 1
+	share.memberIndex = (params >> 4) & 15
+	share.memberThreshold = params&15 + 1
+	if share.groupThreshold > share.groupCount {
+		return nil, fmt.Errorf("group threshold %d exceeds the group count %d", share.groupThreshold, share.groupCount)
+	}
+
+	valueData := data[4 : len(data)-slip39ChecksumWords]
+	value := new(big.Int)
+	for _, word := range valueData {
+		value.Lsh(value, slip39RadixBits)
+		value.Or(value, big.NewInt(int64(word)))
+	}
+	byteCount := (slip39RadixBits*len(valueData) - paddingBits) / 8
+	if value.BitLen() > byteCount*8 {
+		return nil, fmt.Errorf("invalid mnemonic padding")
+	}
+	share.value = value.FillBytes(make([]byte, byteCount))
+	return share, nil
+}
+
+// slip39WordIndex maps each word and its four-letter prefix to its index
+var slip39WordIndex = func() map[string]int {
+	index := make(map[string]int, 2*len(slip39Words))
+	for i, word := range slip39Words {
+		index[word] = i
+		index[word[:4]] = i
+	}
+	return index
+}()
+
+// slip39Customization is the checksum customization string of a share
+func slip39Customization(extendable bool) string {
+	if extendable {
+		return "shamir_extendable"
+	}
+	return "shamir"
+}
+
+// slip39Polymod computes the RS1024 checksum over the customization string and words
+func slip39Polymod(customization string, data []int) int {
+	gen := [10]int{0xe0e040, 0x1c1c080, 0x3838100, 0x7070200, 0xe0e0009, 0x1c0c2412, 0x38086c24, 0x3090fc48, 0x21b1f890, 0x3f3f120}
+	chk := 1
+	step := func(v int) {
+		b := chk >> 20
+		chk = (chk&0xfffff)<<10 ^ v
+		for i := 0; i < 10; i++ {
+			if (b>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	for i := 0; i < len(customization); i++ {
+		step(int(customization[i]))
+	}
+	for _, v := range data {
+		step(v)
+	}
+	return chk
+}
+
+// slip39Feistel encrypts or decrypts a master secret with the passphrase
+// using the four-round Feistel network of SLIP-39
+func slip39Feistel(secret []byte, passphrase string, iterationExponent int, identifier uint16, extendable, decrypt bool) ([]byte, error) {
+	half := len(secret) / 2
+	left := append([]byte(nil), secret[:half]...)
+	right := append([]byte(nil), secret[half:]...)
+
+	var saltPrefix []byte
+	if !extendable {
+		saltPrefix = binary.BigEndian.AppendUint16([]byte("shamir"), identifier)
+	}
+	iterations := (slip39BaseIterationCount << iterationExponent) / slip39RoundCount
+
+	for round := 0; round < slip39RoundCount; round++ {
+		i := round
+		if decrypt {
+			i = slip39RoundCount - 1 - round
+		}
+		salt := append(append([]byte(nil), saltPrefix...), right...)
+		f, err := pbkdf2.Key(sha256.New, string(rune(i))+passphrase, salt, iterations, len(right))
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive round key: %w", err)
+		}
+		for j := range f {
+			f[j] ^= left[j]
+		}
+		left, right = right, f
+	}
+	return append(right, left...), nil
+}
+
+// slip39Split splits secret into count shares, any threshold of which recover it
+func slip39Split(threshold, count int, secret []byte) ([][]byte, error) {
+	shares := make([][]byte, count)
+	if threshold == 1 {
+		for i := range shares {
+			shares[i] = append([]byte(nil), secret...)
+		}
+		return shares, nil
+	}
+
+	randomShares := threshold - 2
+	xs := make([]byte, 0, threshold)
+	ys := make([][]byte, 0, threshold)
+	for i := 0; i < randomShares; i++ {
+		shares[i] = make([]byte, len(secret))
+		if _, err := rand.Read(shares[i]); err != nil {
+			return nil, fmt.Errorf("failed to generate share: %w", err)
+		}
+		xs = append(xs, byte(i))
+		ys = append(ys, shares[i])
+	}
+
+	randomPart := make([]byte, len(secret)-slip39DigestLength)
+	if _, err := rand.Read(randomPart); err != nil {
+		return nil, fmt.Errorf("failed to generate share: %w", err)
+	}
+	digest := append(slip39Digest(randomPart, secret), randomPart...)
+	xs = append(xs, slip39DigestIndex, slip39SecretIndex)
+	ys = append(ys, digest, secret)
+
+	for i := randomShares; i < count; i++ {
+		shares[i] = slip39Interpolate(xs, ys, byte(i))
+	}
+	return shares, nil
+}
+
+// slip39Recover recovers a secret from threshold shares and checks its digest
+func slip39Recover(threshold int, xs []byte, ys [][]byte) ([]byte, error) {
+	if threshold == 1 {
+		return ys[0], nil
+	}
+
+	secret := slip39Interpolate(xs, ys, slip39SecretIndex)
+	digestShare := slip39Interpolate(xs, ys, slip39DigestIndex)
+	if !hmac.Equal(digestShare[:slip39DigestLength], slip39Digest(digestShare[slip39DigestLength:], secret)) {
+		return nil, fmt.Errorf("share digest mismatch: the shares are corrupt or do not belong together")
+	}
+	return secret, nil
+}
+
+// slip39Digest is the digest share prefix: HMAC-SHA256(randomPart, secret)[:4]
+func slip39Digest(randomPart, secret []byte) []byte {
+	mac := hmac.New(sha256.New, randomPart)
+	mac.Write(secret)
+	return mac.Sum(nil)[:slip39DigestLength]
+}
+
+// gf256Exp and gf256Log are the exponent and logarithm tables of GF(256)
+// with the Rijndael polynomial and generator 3
+var gf256Exp, gf256Log = func() ([255]byte, [256]int) {
+	var exp [255]byte
+	var log [256]int
+	poly := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(poly)
+		log[poly] = i
+		poly = poly<<1 ^ poly
+		if poly&0x100 != 0 {
+			poly ^= 0x11b
+		}
+	}
+	return exp, log
+}()
+
+// slip39Interpolate evaluates at x the polynomial through the points (xs, ys)
+func slip39Interpolate(xs []byte, ys [][]byte, x byte) []byte {
+	for i, xi := range xs {
+		if xi == x {
+			return append([]byte(nil), ys[i]...)
+		}
+	}
+
+	logProd := 0
+	for _, xi := range xs {
+		logProd += gf256Log[xi^x]
+	}
+
+	result := make([]byte, len(ys[0]))
+	for i, xi := range xs {
+		logBasis := logProd - gf256Log[xi^x]
+		for j, xj := range xs {
+			if j != i {
+				logBasis -= gf256Log[xi^xj]
+			}
+		}
+		logBasis = (logBasis%255 + 255) % 255
+
+		for k, v := range ys[i] {
+			if v != 0 {
+				result[k] ^= gf256Exp[(gf256Log[v]+logBasis)%255]
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,231 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestSlip39Wordlist(t *testing.T) {
+	prefixes := make(map[string]bool)
+	for i, word := range slip39Words {
+		if len(word) < 4 || len(word) > 8 {
+			t.Errorf("word %d (%s) is not 4 to 8 letters", i, word)
+		}
+		if i > 0 && word <= slip39Words[i-1] {
+			t.Errorf("word %d (%s) is out of order", i, word)
+		}
+		if prefixes[word[:4]] {
+			t.Errorf("word %d (%s) shares its prefix with another word", i, word)
+		}
+		prefixes[word[:4]] = true
+	}
+}
+
+// Shares from the test vectors of the SLIP-39 reference implementation
+// (vectors.json), all with passphrase "TREZOR"
+var (
+	slip39Vector128 = "duckling enlarge academic academic agency result length solution fridge kidney coal piece deal husband erode duke ajar critical decision keyboard"
+	slip39Vector256 = "theory painting academic academic armed sweater year military elder discuss acne wildlife boring employer fused large satoshi bundle carbon diagnose anatomy hamster leaves tracks paces beyond phantom capital marvel lips brave detect luck"
+
+	// 2-of-3 member shares in a single group
+	slip39VectorMembers = []string{
+		"shadow pistol academic always adequate wildlife fancy gross oasis cylinder mustang wrist rescue view short owner flip making coding armed",
+		"shadow pistol academic acid actress prayer class unknown daughter sweater depict flip twice unkind craft early superior advocate guest smoking",
+	}
+
+	// The threshold of groups, each with its member threshold: one share of
+	// a 1-of-1 group and three shares of a 3-of-n group
+	slip39VectorGroups = []string{
+		"eraser senior beard romp adorn nuclear spill corner cradle style ancient family general leader ambition exchange unusual garlic promise voice",
+		"eraser senior ceramic snake clay various huge numb argue hesitate auction category timber browser greatest hanger petition script leaf pickup",
+		"eraser senior ceramic shaft dynamic become junior wrist silver peasant force math alto coal amazing segment yelp velvet image paces",
+		"eraser senior ceramic round column hawk trust auction smug shame alive greatest sheriff living perfect corner chest sled fumes adequate",
+	}
+
+	// An extendable share (identifier not mixed into the encryption)
+	slip39VectorExtendable = "testify swimming academic academic column loyalty smear include exotic bedroom exotic wrist lobe cover grief golden smart junior estimate learn"
+)
+
+func TestCombineSlip39SharesVectors(t *testing.T) {
+	g := slip39VectorGroups
+	tests := []struct {
+		name      string
+		mnemonics []string
+		secret    string
+	}{
+		{"single 128-bit share", []string{slip39Vector128}, "bb54aac4b89dc868ba37d9cc21b2cece"},
+		{"single 256-bit share", []string{slip39Vector256}, "989baf9dcaad5b10ca33dfd8cc75e42477025dce88ae83e75a230086a0e00e92"},
+		{"2-of-3 members", slip39VectorMembers, "b43ceb7e57a0ea8766221624d01b0864"},
+		{"2-of-3 members reversed", []string{slip39VectorMembers[1], slip39VectorMembers[0]}, "b43ceb7e57a0ea8766221624d01b0864"},
+		{"groups", g, "7c3397a292a5941682d7a4ae2d898d11"},
+		{"groups reordered", []string{g[3], g[1], g[0], g[2]}, "7c3397a292a5941682d7a4ae2d898d11"},
+		{"extendable", []string{slip39VectorExtendable}, "1679b4516e0ee5954351d288a838f45e"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret, err := CombineSlip39Shares(tt.mnemonics, "TREZOR")
+			if err != nil {
+				t.Fatalf("CombineSlip39Shares() error = %v", err)
+			}
+			if got := hex.EncodeToString(secret); got != tt.secret {
+				t.Errorf("CombineSlip39Shares() = %s, want %s", got, tt.secret)
+			}
+		})
+	}
+}
+
+// Invalid share sets built from the reference vectors
+func TestCombineSlip39SharesInvalidVectors(t *testing.T) {
+	g := slip39VectorGroups
+	tests := []struct {
+		name      string
+		mnemonics []string
+		wantErr   string
+	}{
+		// The vector shares with their last word changed
+		{"invalid checksum 128-bit", []string{strings.Replace(slip39Vector128, "decision keyboard", "decision kidney", 1)}, "checksum"},
+		{"invalid checksum 256-bit", []string{strings.Replace(slip39Vector256, "detect luck", "detect lunar", 1)}, "checksum"},
+		{"invalid checksum in a group", []string{g[0], g[1], g[2], strings.Replace(g[3], "fumes adequate", "fumes acid", 1)}, "checksum"},
+		{"insufficient members", slip39VectorMembers[:1], "complete"},
+		{"insufficient members in a group", g[:3], "complete"},
+		{"missing group", g[1:], "complete"},
+		{"shares of different secrets", []string{slip39VectorMembers[0], slip39VectorMembers[1], g[0]}, "does not belong"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CombineSlip39Shares(tt.mnemonics, "TREZOR")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CombineSlip39Shares() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSlip39RoundTrip(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	groups := []Slip39Group{{Threshold: 2, Count: 3}, {Threshold: 3, Count: 5}, {Threshold: 1, Count: 1}}
+
+	shares, err := GenerateSlip39Shares(2, groups, seed, "", 0)
+	if err != nil {
+		t.Fatalf("GenerateSlip39Shares() error = %v", err)
+	}
+	for i, group := range shares {
+		if len(group) != groups[i].Count {
+			t.Fatalf("group %d has %d shares, want %d", i, len(group), groups[i].Count)
+		}
+		if words := len(strings.Fields(group[0])); words != 33 {
+			t.Errorf("share of a 256-bit seed has %d words, want 33", words)
+		}
+	}
+
+	combinations := map[string][]string{
+		"groups 1 and 2":               {shares[0][0], shares[0][2], shares[1][1], shares[1][3], shares[1][4]},
+		"groups 1 and 3":               {shares[2][0], shares[0][1], shares[0][0]},
+		"extra shares":                 {shares[0][0], shares[0][1], shares[0][2], shares[2][0], shares[1][0]},
+		"abbreviated and capitalized":  {abbreviate(shares[2][0]), strings.ToUpper(shares[0][1]), shares[0][2]},
+		"duplicate shares are ignored": {shares[2][0], shares[2][0], shares[0][1], shares[0][1], shares[0][2]},
+	}
+	for name, mnemonics := range combinations {
+		t.Run(name, func(t *testing.T) {
+			secret, err := CombineSlip39Shares(mnemonics, "")
+			if err != nil {
+				t.Fatalf("CombineSlip39Shares() error = %v", err)
+			}
+			if !bytes.Equal(secret, seed) {
+				t.Errorf("CombineSlip39Shares() = %x, want %x", secret, seed)
+			}
+		})
+	}
+
+	t.Run("passphrase", func(t *testing.T) {
+		shares, err := GenerateSlip39Shares(1, []Slip39Group{{Threshold: 2, Count: 2}}, seed, "correct horse", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secret, err := CombineSlip39Shares(shares[0], "correct horse")
+		if err != nil || !bytes.Equal(secret, seed) {
+			t.Errorf("CombineSlip39Shares(passphrase) = %x, %v, want %x", secret, err, seed)
+		}
+		secret, err = CombineSlip39Shares(shares[0], "wrong horse")
+		if err != nil || bytes.Equal(secret, seed) {
+			t.Errorf("CombineSlip39Shares(wrong passphrase) = %x, %v, want another secret", secret, err)
+		}
+	})
+}
+
+func TestCombineSlip39SharesErrors(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	shares, err := GenerateSlip39Shares(2, []Slip39Group{{Threshold: 2, Count: 3}, {Threshold: 3, Count: 5}}, seed, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateSlip39Shares(1, []Slip39Group{{Threshold: 2, Count: 3}}, seed, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Swapping two value words breaks the share checksum
+	words := strings.Fields(shares[1][0])
+	words[10], words[11] = words[11], words[10]
+
+	tests := []struct {
+		name      string
+		mnemonics []string
+		wantErr   string
+	}{
+		{"too few groups", []string{shares[0][0], shares[0][1]}, "1 of 2 groups are complete"},
+		{"incomplete group", []string{shares[0][0], shares[0][1], shares[1][0], shares[1][1]}, "1 of 2 groups are complete"},
+		{"different secrets", []string{shares[0][0], other[0][0]}, "does not belong"},
+		{"unknown word", []string{"bitcoin " + strings.SplitN(shares[0][0], " ", 2)[1]}, "not in the SLIP-39 wordlist"},
+		{"too short", []string{"duckling enlarge academic"}, "at least 20 words"},
+		{"corrupted share", []string{shares[0][0], shares[0][1], strings.Join(words, " "), shares[1][1], shares[1][2]}, "checksum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CombineSlip39Shares(tt.mnemonics, "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CombineSlip39Shares() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateSlip39SharesValidation(t *testing.T) {
+	seed := make([]byte, 32)
+	tests := []struct {
+		name           string
+		groupThreshold int
+		groups         []Slip39Group
+		secret         []byte
+		passphrase     string
+	}{
+		{"short secret", 1, []Slip39Group{{2, 3}}, make([]byte, 8), ""},
+		{"odd secret", 1, []Slip39Group{{2, 3}}, make([]byte, 17), ""},
+		{"no groups", 1, nil, seed, ""},
+		{"group threshold above group count", 2, []Slip39Group{{2, 3}}, seed, ""},
+		{"member threshold above count", 1, []Slip39Group{{4, 3}}, seed, ""},
+		{"too many members", 1, []Slip39Group{{2, 17}}, seed, ""},
+		{"1-of-n group", 1, []Slip39Group{{1, 3}}, seed, ""},
+		{"non-ASCII passphrase", 1, []Slip39Group{{2, 3}}, seed, "pässword"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := GenerateSlip39Shares(tt.groupThreshold, tt.groups, tt.secret, tt.passphrase, 0); err == nil {
+				t.Error("GenerateSlip39Shares() expected error")
+			}
+		})
+	}
+}
+
+// abbreviate shortens every word of a mnemonic to its first four letters
+func abbreviate(mnemonic string) string {
+	words := strings.Fields(mnemonic)
+	for i, word := range words {
+		words[i] = word[:4]
+	}
+	return strings.Join(words, " ")
+}
@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"math/rand/v2"
 	"sort"
 
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
@@ -19,14 +23,78 @@ type UTXO struct {
 	Value        int64
 	Address      string
 	AddressIndex uint32
+	Account      uint32 // BIP44 account the address belongs to
+	Change       uint32 // 0 for receiving, 1 for change addresses
 	ScriptPubKey []byte
-	AddressType  string // p2wpkh or p2tr - determines signing method
+	AddressType  string // p2wpkh, p2tr, p2sh-p2wpkh or p2pkh - determines signing method
+	Sequence     uint32 // nSequence of the spending input, e.g. a BIP68 relative timelock (0: SequenceRBF)
+
+	// SilentPaymentTweak is set on P2TR outputs received at the account's
+	// silent payment address, which are signed with the tweaked spend key
+	SilentPaymentTweak []byte
 }
 
-// TxOutput represents a transaction output
+// TxOutput represents a transaction output. An output with OpReturn set is
+// a zero-value OP_RETURN output carrying that data instead of a payment.
 type TxOutput struct {
-	Address string
-	Value   int64
+	Address  string
+	Value    int64
+	OpReturn []byte
+}
+
+// script returns the scriptPubKey of the output
+func (o TxOutput) script(params *chaincfg.Params) ([]byte, error) {
+	if o.OpReturn != nil {
+		script, err := txscript.NullDataScript(o.OpReturn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OP_RETURN data: %w", err)
+		}
+		return script, nil
+	}
+
+	addr, err := btcutil.DecodeAddress(o.Address, params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %s: %w", o.Address, err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create script for %s: %w", o.Address, err)
+	}
+	return pkScript, nil
+}
+
+// OpReturnOutputVSize returns the size of an OP_RETURN output carrying data
+func OpReturnOutputVSize(data []byte) int {
+	script, err := txscript.NullDataScript(data)
+	if err != nil {
+		return 0
+	}
+	return wire.NewTxOut(0, script).SerializeSize()
+}
+
+// validateOutputs checks outputs are standard: payments above the dust limit
+// and at most one zero-value OP_RETURN output within the relay size limit
+func validateOutputs(outputs []TxOutput) error {
+	opReturns := 0
+	for _, out := range outputs {
+		if out.OpReturn == nil {
+			if out.Value < DustLimit {
+				return fmt.Errorf("output value %d is below dust limit %d", out.Value, DustLimit)
+			}
+			continue
+		}
+		opReturns++
+		if opReturns > 1 {
+			return fmt.Errorf("a transaction can have only one OP_RETURN output")
+		}
+		if out.Value != 0 {
+			return fmt.Errorf("OP_RETURN output must have zero value, got %d", out.Value)
+		}
+		if len(out.OpReturn) > MaxOpReturnSize {
+			return fmt.Errorf("OP_RETURN data of %d bytes exceeds the limit of %d bytes", len(out.OpReturn), MaxOpReturnSize)
+		}
+	}
+	return nil
 }
 
 // TransactionResult contains the result of building a transaction
@@ -66,6 +134,23 @@ const (
 	// 8 (value) + 1 (script length) + 34 (OP_1 + 32-byte witness program) = 43 bytes
 	P2TROutputSize = 43
 
+	// P2PKHInputSize is the size of a legacy P2PKH input in bytes (no witness discount)
+	// 36 (outpoint) + 1 (script length) + 107 (signature + compressed pubkey) + 4 (sequence) = 148 bytes
+	P2PKHInputSize = 148
+
+	// P2PKHOutputSize is the size of a P2PKH output in bytes
+	// 8 (value) + 1 (script length) + 25 (OP_DUP OP_HASH160 <20> OP_EQUALVERIFY OP_CHECKSIG) = 34 bytes
+	P2PKHOutputSize = 34
+
+	// P2SHP2WPKHInputSize is the virtual size of a nested SegWit input in vbytes
+	// Non-witness: 36 (outpoint) + 1 + 23 (redeem script push) + 4 (sequence) = 64 bytes
+	// Witness: 108 bytes / 4 = 27 vbytes, total ~91 vbytes
+	P2SHP2WPKHInputSize = 91
+
+	// P2SHOutputSize is the size of a P2SH output in bytes
+	// 8 (value) + 1 (script length) + 23 (OP_HASH160 <20> OP_EQUAL) = 32 bytes
+	P2SHOutputSize = 32
+
 	// TxOverhead is the base transaction overhead
 	TxOverhead = 10
 
@@ -79,8 +164,118 @@ const (
 
 	// SequenceFinal is the final sequence number (no RBF, default in many implementations)
 	SequenceFinal = 0xFFFFFFFF
+
+	// MaxOpReturnSize is the most data an OP_RETURN output can carry and
+	// still be relayed by nodes with the default datacarriersize
+	MaxOpReturnSize = txscript.MaxDataCarrierSize
+
+	// LockTimeThreshold is the nLockTime from which a locktime is a Unix
+	// timestamp rather than a block height
+	LockTimeThreshold = txscript.LockTimeThreshold
+)
+
+// Anti-fee-sniping backdating as done by Bitcoin Core: one in
+// feeSnipingBackdateOdds transactions is locked up to feeSnipingMaxBackdate-1
+// blocks below the tip, so transactions that are slow to propagate do not
+// stand out
+const (
+	feeSnipingBackdateOdds = 10
+	feeSnipingMaxBackdate  = 100
 )
 
+// AntiFeeSnipingLockTime returns the locktime for a transaction built when
+// the chain tip is at tipHeight. Locking to the tip discourages miners from
+// reorging the last block to take its fees, and matches the locktimes of
+// Bitcoin Core. It returns 0 when the tip is unknown.
+func AntiFeeSnipingLockTime(tipHeight int64) uint32 {
+	return antiFeeSnipingLockTime(tipHeight, rand.Int64N)
+}
+
+func antiFeeSnipingLockTime(tipHeight int64, randN func(int64) int64) uint32 {
+	if tipHeight <= 0 || tipHeight >= LockTimeThreshold {
+		return 0
+	}
+
+	lockTime := tipHeight
+	if randN(feeSnipingBackdateOdds) == 0 {
+		lockTime = max(lockTime-randN(feeSnipingMaxBackdate), 0)
+	}
+	return uint32(lockTime)
+}
+
+// sequence returns the nSequence of the input spending the UTXO
+func (u *UTXO) sequence() uint32 {
+	if u.Sequence == 0 {
+		return SequenceRBF
+	}
+	return u.Sequence
+}
+
+// RelativeLock decodes the BIP68 relative timelock of an input sequence:
+// a number of blocks, or of seconds when seconds is true. ok is false when
+// the sequence does not enable a relative timelock.
+func RelativeLock(sequence uint32) (value uint32, seconds bool, ok bool) {
+	if sequence&wire.SequenceLockTimeDisabled != 0 {
+		return 0, false, false
+	}
+	value = sequence & wire.SequenceLockTimeMask
+	if sequence&wire.SequenceLockTimeIsSeconds != 0 {
+		return value << wire.SequenceLockTimeGranularity, true, true
+	}
+	return value, false, true
+}
+
+// ValidateTimelocks checks that the input sequences of utxos are consistent
+// with lockTime: a locktime is only enforced if no input is final, and a
+// relative timelock may only use the bits BIP68 defines
+func ValidateTimelocks(lockTime uint32, utxos []UTXO) error {
+	for _, utxo := range utxos {
+		sequence := utxo.sequence()
+		if lockTime != 0 && sequence == SequenceFinal {
+			return fmt.Errorf("input %s:%d has sequence 0x%x, which disables locktime", utxo.TxID, utxo.Vout, sequence)
+		}
+		if _, _, ok := RelativeLock(sequence); ok {
+			if undefined := sequence &^ (wire.SequenceLockTimeIsSeconds | wire.SequenceLockTimeMask); undefined != 0 {
+				return fmt.Errorf("input %s:%d has sequence 0x%x, which sets bits BIP68 does not define", utxo.TxID, utxo.Vout, sequence)
+			}
+		}
+	}
+	return nil
+}
+
+// newTxWithInputs creates a transaction spending utxos with the given
+// nLockTime. Version 2 is used when an input has a relative timelock, which
+// BIP68 only enforces from that version on.
+func newTxWithInputs(utxos []UTXO, lockTime uint32) (*wire.MsgTx, error) {
+	if err := ValidateTimelocks(lockTime, utxos); err != nil {
+		return nil, err
+	}
+
+	version := int32(wire.TxVersion)
+	for _, utxo := range utxos {
+		if _, _, ok := RelativeLock(utxo.sequence()); ok {
+			version = 2
+		}
+	}
+
+	tx := wire.NewMsgTx(version)
+	tx.LockTime = lockTime
+
+	// Inputs signal Replace-By-Fee (BIP125) unless they set their own sequence
+	for _, utxo := range utxos {
+		txHash, err := chainhash.NewHashFromStr(utxo.TxID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid txid %s: %w", utxo.TxID, err)
+		}
+
+		outpoint := wire.NewOutPoint(txHash, uint32(utxo.Vout))
+		txIn := wire.NewTxIn(outpoint, nil, nil)
+		txIn.Sequence = utxo.sequence()
+		tx.AddTxIn(txIn)
+	}
+	return tx, nil
+}
+
 // ValidateFeeRate checks if the fee rate is within reasonable bounds
 // Returns an error message if the fee rate is dangerously high, empty string otherwise
 func ValidateFeeRate(feeRate int64) string {
@@ -95,11 +290,26 @@ func IsFeeRateUnreasonable(feeRate int64) bool {
 	return feeRate > MaxReasonableFeeRate
 }
 
-// SelectUTXOs selects UTXOs to cover the target amount plus fee
-// Uses a simple "largest first" strategy
-func SelectUTXOs(utxos []UTXO, targetAmount int64, feeRate int64) ([]UTXO, int64, error) {
+// SelectUTXOsForOutputs selects UTXOs, largest first, until they pay outputs
+// and the fee of the transaction they would make, and returns the selection
+// with its plan. Every candidate is sized with EstimateVSizeForOutputs, the
+// estimate the transaction builders charge, so the selection never falls
+// short of the fee of the signed transaction. changeAddress returns the
+// change address for a candidate selection, since a change policy may depend
+// on the inputs.
+func SelectUTXOsForOutputs(utxos []UTXO, outputs []TxOutput, network string, fee Fee, changeAddress func([]UTXO) (string, error)) ([]UTXO, *FeePlan, error) {
 	if len(utxos) == 0 {
-		return nil, 0, fmt.Errorf("no UTXOs available")
+		return nil, nil, fmt.Errorf("no UTXOs available")
+	}
+	if err := fee.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if err := validateOutputs(outputs); err != nil {
+		return nil, nil, err
+	}
+	var totalOutput int64
+	for _, out := range outputs {
+		totalOutput += out.Value
 	}
 
 	// Sort UTXOs by value (largest first)
@@ -110,50 +320,71 @@ func SelectUTXOs(utxos []UTXO, targetAmount int64, feeRate int64) ([]UTXO, int64
 	})
 
 	var selected []UTXO
-	var totalInput int64
-
-	// Estimate initial fee (1 output, no change)
-	estimatedFee := EstimateFeeForTypes(0, 1, feeRate, "", "")
-
+	var totalInput, estimatedFee int64
 	for _, utxo := range sorted {
 		selected = append(selected, utxo)
 		totalInput += utxo.Value
 
-		// Recalculate fee with current number of inputs using actual address types
-		// Assume 2 outputs (payment + change) - use input type for change output
-		inputType := utxo.AddressType
-		if inputType == "" {
-			inputType = AddressTypeP2WPKH
+		// The fee without change is the least the selection must cover
+		noChange, _, err := EstimateFeeForOutputs(selected, outputs, network, fee)
+		if err != nil {
+			return nil, nil, err
+		}
+		estimatedFee = noChange
+		if totalInput < totalOutput+noChange {
+			continue
 		}
-		estimatedFee = EstimateFeeForUTXOs(selected, 2, feeRate, inputType)
 
-		if totalInput >= targetAmount+estimatedFee {
-			return selected, estimatedFee, nil
+		change, err := changeAddress(selected)
+		if err != nil {
+			return nil, nil, err
 		}
+		plan, err := PlanTransaction(selected, outputs, change, network, fee)
+		if err != nil {
+			return nil, nil, err
+		}
+		return selected, plan, nil
 	}
 
-	return nil, 0, fmt.Errorf("insufficient funds: have %d, need %d + %d fee",
-		totalInput, targetAmount, estimatedFee)
+	return nil, nil, fmt.Errorf("insufficient funds: have %d, need %d + %d fee",
+		totalInput, totalOutput, estimatedFee)
 }
 
-// estimateFee calculates the estimated fee for a transaction (legacy, assumes P2WPKH)
-func estimateFee(numInputs, numOutputs int, feeRate int64) int64 {
-	// Use int64 throughout to prevent overflow with extreme inputs
-	vsize := int64(TxOverhead) + (int64(numInputs) * int64(P2WPKHInputSize)) + (int64(numOutputs) * int64(P2WPKHOutputSize))
-	return vsize * feeRate
+// InputVSize returns the estimated virtual size of an input spending the address type
+// Unknown types are treated as P2WPKH
+func InputVSize(addressType string) int {
+	switch addressType {
+	case AddressTypeP2TR:
+		return P2TRInputSize
+	case AddressTypeP2SHP2WPKH:
+		return P2SHP2WPKHInputSize
+	case AddressTypeP2PKH:
+		return P2PKHInputSize
+	default:
+		return P2WPKHInputSize
+	}
 }
 
-// EstimateFeeForTypes calculates fee with proper input/output sizes based on address types
-func EstimateFeeForTypes(numInputs, numOutputs int, feeRate int64, inputType, outputType string) int64 {
-	inputSize := int64(P2WPKHInputSize)
-	if inputType == AddressTypeP2TR {
-		inputSize = int64(P2TRInputSize)
+// OutputVSize returns the size of an output paying to the address type. Besides
+// the wallet address types it accepts the "p2sh" and "p2wsh" types reported by
+// GetAddressType; unknown types are treated as P2WPKH.
+func OutputVSize(addressType string) int {
+	switch addressType {
+	case AddressTypeP2TR, "p2wsh":
+		return P2TROutputSize
+	case AddressTypeP2SHP2WPKH, "p2sh":
+		return P2SHOutputSize
+	case AddressTypeP2PKH:
+		return P2PKHOutputSize
+	default:
+		return P2WPKHOutputSize
 	}
+}
 
-	outputSize := int64(P2WPKHOutputSize)
-	if outputType == AddressTypeP2TR {
-		outputSize = int64(P2TROutputSize)
-	}
+// EstimateFeeForTypes calculates fee with proper input/output sizes based on address types
+func EstimateFeeForTypes(numInputs, numOutputs int, feeRate int64, inputType, outputType string) int64 {
+	inputSize := int64(InputVSize(inputType))
+	outputSize := int64(OutputVSize(outputType))
 
 	// Use int64 throughout to prevent overflow with extreme inputs
 	vsize := int64(TxOverhead) + (int64(numInputs) * inputSize) + (int64(numOutputs) * outputSize)
@@ -165,17 +396,10 @@ func EstimateFeeForUTXOs(utxos []UTXO, numOutputs int, feeRate int64, outputType
 	// Use int64 throughout to prevent overflow with extreme inputs
 	var inputVSize int64
 	for _, utxo := range utxos {
-		if utxo.AddressType == AddressTypeP2TR {
-			inputVSize += int64(P2TRInputSize)
-		} else {
-			inputVSize += int64(P2WPKHInputSize)
-		}
+		inputVSize += int64(InputVSize(utxo.AddressType))
 	}
 
-	outputSize := int64(P2WPKHOutputSize)
-	if outputType == AddressTypeP2TR {
-		outputSize = int64(P2TROutputSize)
-	}
+	outputSize := int64(OutputVSize(outputType))
 
 	vsize := int64(TxOverhead) + inputVSize + (int64(numOutputs) * outputSize)
 	return vsize * feeRate
@@ -189,74 +413,70 @@ func BuildTransaction(
 	outputs []TxOutput,
 	changeAddress string,
 	feeRate int64,
+) (*TransactionResult, error) {
+	return BuildTransactionWithLockTime(seed, network, utxos, outputs, changeAddress, feeRate, 0)
+}
+
+// BuildTransactionWithLockTime builds and signs a transaction that cannot be
+// mined before lockTime, a block height or (from LockTimeThreshold on) a
+// Unix timestamp. Input sequences are taken from the UTXOs.
+func BuildTransactionWithLockTime(
+	seed []byte,
+	network string,
+	utxos []UTXO,
+	outputs []TxOutput,
+	changeAddress string,
+	feeRate int64,
+	lockTime uint32,
+) (*TransactionResult, error) {
+	return BuildTransactionWithFee(seed, network, utxos, outputs, changeAddress, Fee{Rate: SatPerVByte(feeRate)}, lockTime)
+}
+
+// BuildTransactionWithFee builds and signs a transaction paying fee, at a
+// rate or as a fixed amount, that cannot be mined before lockTime
+func BuildTransactionWithFee(
+	seed []byte,
+	network string,
+	utxos []UTXO,
+	outputs []TxOutput,
+	changeAddress string,
+	fee Fee,
+	lockTime uint32,
 ) (*TransactionResult, error) {
 	params, err := NetworkParams(network)
 	if err != nil {
 		return nil, err
 	}
 
-	// Calculate total output value
+	// Fee and change are sized on the transaction signed with dummy signatures
+	plan, err := PlanTransaction(utxos, outputs, changeAddress, network, fee)
+	if err != nil {
+		return nil, err
+	}
+	changeAmount := plan.ChangeAmount
+	changeNeeded := changeAmount > 0
+
 	var totalOutput int64
 	for _, out := range outputs {
-		if out.Value < DustLimit {
-			return nil, fmt.Errorf("output value %d is below dust limit %d", out.Value, DustLimit)
-		}
 		totalOutput += out.Value
 	}
-
-	// Calculate total input value
 	var totalInput int64
 	for _, utxo := range utxos {
 		totalInput += utxo.Value
 	}
 
-	// Calculate fee
-	numOutputs := len(outputs)
-	changeNeeded := false
-	estimatedFee := estimateFee(len(utxos), numOutputs, feeRate)
-
-	changeAmount := totalInput - totalOutput - estimatedFee
-	if changeAmount > DustLimit {
-		changeNeeded = true
-		numOutputs++
-		estimatedFee = estimateFee(len(utxos), numOutputs, feeRate)
-		changeAmount = totalInput - totalOutput - estimatedFee
-	} else if changeAmount < 0 {
-		return nil, fmt.Errorf("insufficient funds: have %d, need %d + %d fee",
-			totalInput, totalOutput, estimatedFee)
-	} else {
-		// Change is dust, add to fee
-		changeAmount = 0
-	}
-
 	// Create transaction
-	tx := wire.NewMsgTx(wire.TxVersion)
-
-	// Add inputs with RBF-enabled sequence number (BIP125)
-	for _, utxo := range utxos {
-		txHash, err := chainhash.NewHashFromStr(utxo.TxID)
-		if err != nil {
-			return nil, fmt.Errorf("invalid txid %s: %w", utxo.TxID, err)
-		}
-
-		outpoint := wire.NewOutPoint(txHash, uint32(utxo.Vout))
-		txIn := wire.NewTxIn(outpoint, nil, nil)
-		txIn.Sequence = SequenceRBF // Enable Replace-By-Fee for fee bumping
-		tx.AddTxIn(txIn)
+	tx, err := newTxWithInputs(utxos, lockTime)
+	if err != nil {
+		return nil, err
 	}
 
 	// Add outputs
 	for _, out := range outputs {
-		addr, err := btcutil.DecodeAddress(out.Address, params)
+		pkScript, err := out.script(params)
 		if err != nil {
-			return nil, fmt.Errorf("invalid address %s: %w", out.Address, err)
+			return nil, err
 		}
-
-		pkScript, err := txscript.PayToAddrScript(addr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create script for %s: %w", out.Address, err)
-		}
-
 		tx.AddTxOut(wire.NewTxOut(out.Value, pkScript))
 	}
 
@@ -276,9 +496,51 @@ func BuildTransaction(
 	}
 
 	// Sign inputs
-	prevOuts := make(map[wire.OutPoint]*wire.TxOut)
+	if err := signInputs(seed, network, tx, utxos); err != nil {
+		return nil, err
+	}
+
+	// Serialize transaction
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return nil, fmt.Errorf("failed to serialize transaction: %w", err)
+	}
+
+	txHex := hex.EncodeToString(buf.Bytes())
+
+	// Calculate actual fee
+	actualFee := totalInput - totalOutput
+	if changeNeeded {
+		actualFee -= changeAmount
+	}
+
+	return &TransactionResult{
+		TxID:         tx.TxHash().String(),
+		Hex:          txHex,
+		Fee:          actualFee,
+		TotalInput:   totalInput,
+		TotalOutput:  totalOutput,
+		ChangeAmount: changeAmount,
+		Size:         buf.Len(),
+		VSize:        txVSize(tx),
+	}, nil
+}
+
+// signInputs signs every input of tx with the key of the corresponding UTXO,
+// using the spending method of the UTXO's address type
+func signInputs(seed []byte, network string, tx *wire.MsgTx, utxos []UTXO) error {
+	return signInputsFrom(seed, network, tx, 0, utxos, nil)
+}
+
+// signInputsFrom signs the inputs of tx from index first on with the keys of
+// utxos. prevOuts supplies the outputs spent by the inputs the wallet does
+// not sign, which taproot signatures commit to.
+func signInputsFrom(seed []byte, network string, tx *wire.MsgTx, first int, utxos []UTXO, prevOuts map[wire.OutPoint]*wire.TxOut) error {
+	if prevOuts == nil {
+		prevOuts = make(map[wire.OutPoint]*wire.TxOut)
+	}
 	for i, utxo := range utxos {
-		prevOuts[tx.TxIn[i].PreviousOutPoint] = &wire.TxOut{
+		prevOuts[tx.TxIn[first+i].PreviousOutPoint] = &wire.TxOut{
 			Value:    utxo.Value,
 			PkScript: utxo.ScriptPubKey,
 		}
@@ -287,27 +549,36 @@ func BuildTransaction(
 	prevOutFetcher := txscript.NewMultiPrevOutFetcher(prevOuts)
 	sigHashes := txscript.NewTxSigHashes(tx, prevOutFetcher)
 
-	for i, utxo := range utxos {
+	for n, utxo := range utxos {
+		i := first + n
+
 		// Determine address type - default to P2WPKH for backwards compatibility
 		addrType := utxo.AddressType
 		if addrType == "" {
 			addrType = AddressTypeP2WPKH
 		}
 
-		// Derive the key for this UTXO using the appropriate derivation path
-		key, err := DeriveReceivingKeyForType(seed, network, utxo.AddressIndex, addrType)
+		privKey, err := utxoPrivateKey(seed, network, utxo)
 		if err != nil {
-			return nil, fmt.Errorf("failed to derive key for input %d: %w", i, err)
+			return fmt.Errorf("failed to derive key for input %d: %w", i, err)
 		}
 
-		privKey, err := GetPrivateKey(key)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get private key for input %d: %w", i, err)
+		if len(utxo.SilentPaymentTweak) > 0 {
+			// The output key is the tweaked spend key itself, with no BIP86 tweak
+			sigHash, err := txscript.CalcTaprootSignatureHash(sigHashes, txscript.SigHashDefault, tx, i, prevOutFetcher)
+			if err != nil {
+				return fmt.Errorf("failed to compute sighash for input %d: %w", i, err)
+			}
+			sig, err := schnorr.Sign(privKey, sigHash)
+			if err != nil {
+				return fmt.Errorf("failed to create Schnorr signature for input %d: %w", i, err)
+			}
+			tx.TxIn[i].Witness = wire.TxWitness{sig.Serialize()}
+			continue
 		}
 
-		var witness wire.TxWitness
-
-		if addrType == AddressTypeP2TR {
+		switch addrType {
+		case AddressTypeP2TR:
 			// P2TR key-path spending: Schnorr signature
 			sig, err := txscript.RawTxInTaprootSignature(
 				tx,
@@ -320,13 +591,56 @@ func BuildTransaction(
 				privKey,
 			)
 			if err != nil {
-				return nil, fmt.Errorf("failed to create Schnorr signature for input %d: %w", i, err)
+				return fmt.Errorf("failed to create Schnorr signature for input %d: %w", i, err)
 			}
 			// P2TR key-path witness is just the signature
-			witness = wire.TxWitness{sig}
-		} else {
+			tx.TxIn[i].Witness = wire.TxWitness{sig}
+
+		case AddressTypeP2PKH:
+			// P2PKH: ECDSA signature in the scriptSig, no witness
+			sigScript, err := txscript.SignatureScript(
+				tx,
+				i,
+				utxo.ScriptPubKey,
+				txscript.SigHashAll,
+				privKey,
+				true, // compressed
+			)
+			if err != nil {
+				return fmt.Errorf("failed to sign input %d: %w", i, err)
+			}
+			tx.TxIn[i].SignatureScript = sigScript
+
+		case AddressTypeP2SHP2WPKH:
+			// P2SH-P2WPKH: the scriptSig pushes the redeem script (the P2WPKH
+			// witness program), which is also what the witness signature commits to
+			redeemScript, err := NestedP2WPKHRedeemScript(privKey.PubKey())
+			if err != nil {
+				return err
+			}
+			witness, err := txscript.WitnessSignature(
+				tx,
+				sigHashes,
+				i,
+				utxo.Value,
+				redeemScript,
+				txscript.SigHashAll,
+				privKey,
+				true, // compressed
+			)
+			if err != nil {
+				return fmt.Errorf("failed to sign input %d: %w", i, err)
+			}
+			sigScript, err := txscript.NewScriptBuilder().AddData(redeemScript).Script()
+			if err != nil {
+				return fmt.Errorf("failed to create scriptSig for input %d: %w", i, err)
+			}
+			tx.TxIn[i].SignatureScript = sigScript
+			tx.TxIn[i].Witness = witness
+
+		default:
 			// P2WPKH: ECDSA signature
-			witness, err = txscript.WitnessSignature(
+			witness, err := txscript.WitnessSignature(
 				tx,
 				sigHashes,
 				i,
@@ -337,42 +651,189 @@ func BuildTransaction(
 				true, // compressed
 			)
 			if err != nil {
-				return nil, fmt.Errorf("failed to sign input %d: %w", i, err)
+				return fmt.Errorf("failed to sign input %d: %w", i, err)
 			}
+			tx.TxIn[i].Witness = witness
 		}
+	}
 
-		tx.TxIn[i].Witness = witness
+	return nil
+}
+
+// utxoPrivateKey derives the private key of a UTXO: the key at its
+// derivation path, or the tweaked spend key of a silent payment output.
+// Unknown address types are treated as P2WPKH.
+func utxoPrivateKey(seed []byte, network string, utxo UTXO) (*btcec.PrivateKey, error) {
+	if len(utxo.SilentPaymentTweak) > 0 {
+		return SilentPaymentSpendKey(seed, network, utxo.Account, utxo.SilentPaymentTweak)
 	}
 
-	// Serialize transaction
-	var buf bytes.Buffer
-	if err := tx.Serialize(&buf); err != nil {
-		return nil, fmt.Errorf("failed to serialize transaction: %w", err)
+	addrType := utxo.AddressType
+	if addrType == "" {
+		addrType = AddressTypeP2WPKH
+	}
+	key, err := DeriveKeyForAccount(seed, network, utxo.Account, utxo.Change, utxo.AddressIndex, addrType)
+	if err != nil {
+		return nil, err
 	}
+	return GetPrivateKey(key)
+}
 
-	txHex := hex.EncodeToString(buf.Bytes())
+// Sizes of the dummy signatures used to measure unsigned transactions: the
+// longest DER signature with a low S value plus its sighash byte, and a
+// BIP340 signature with the default sighash
+const (
+	dummyECDSASignatureSize   = 72
+	dummySchnorrSignatureSize = 64
+	compressedPubKeySize      = 33
+	p2wpkhRedeemScriptSize    = 22
+)
 
-	// Calculate actual fee
-	actualFee := totalInput - totalOutput
-	if changeNeeded {
-		actualFee -= changeAmount
+// dummySignInput fills in the scriptSig and witness of an input spending the
+// address type with placeholders the size of the real ones. Unknown types are
+// treated as P2WPKH.
+func dummySignInput(txIn *wire.TxIn, addressType string) {
+	sig := make([]byte, dummyECDSASignatureSize)
+	pubKey := make([]byte, compressedPubKeySize)
+
+	switch addressType {
+	case AddressTypeP2TR:
+		txIn.Witness = wire.TxWitness{make([]byte, dummySchnorrSignatureSize)}
+	case AddressTypeP2PKH:
+		sigScript, _ := txscript.NewScriptBuilder().AddData(sig).AddData(pubKey).Script()
+		txIn.SignatureScript = sigScript
+	case AddressTypeP2SHP2WPKH:
+		sigScript, _ := txscript.NewScriptBuilder().AddData(make([]byte, p2wpkhRedeemScriptSize)).Script()
+		txIn.SignatureScript = sigScript
+		txIn.Witness = wire.TxWitness{sig, pubKey}
+	default:
+		txIn.Witness = wire.TxWitness{sig, pubKey}
 	}
+}
 
-	return &TransactionResult{
-		TxID:         tx.TxHash().String(),
-		Hex:          txHex,
-		Fee:          actualFee,
-		TotalInput:   totalInput,
-		TotalOutput:  totalOutput,
-		ChangeAmount: changeAmount,
-		Size:         buf.Len(),
-		VSize:        tx.SerializeSizeStripped() + (tx.SerializeSize()-tx.SerializeSizeStripped()+3)/4,
-	}, nil
+// txVSize returns the virtual size of tx: its weight divided by four,
+// rounded up
+func txVSize(tx *wire.MsgTx) int {
+	return (tx.SerializeSizeStripped()*3 + tx.SerializeSize() + 3) / 4
 }
 
-// EstimateTransactionFee estimates the fee for a transaction
-func EstimateTransactionFee(numInputs, numOutputs int, feeRate int64) int64 {
-	return estimateFee(numInputs, numOutputs, feeRate)
+// EstimateVSize returns the virtual size of the signed transaction spending
+// utxos to outputAddresses. The transaction is built for real and signed with
+// dummy signatures as long as the real ones can be, so the size is exact for
+// Taproot inputs and at most a vbyte over for ECDSA inputs whose signature
+// comes out shorter.
+func EstimateVSize(utxos []UTXO, outputAddresses []string, network string) (int, error) {
+	return EstimateVSizeForOutputs(utxos, addressOutputs(outputAddresses), network)
+}
+
+// EstimateVSizeForOutputs returns the virtual size of the signed transaction
+// spending utxos to outputs, including any OP_RETURN output
+func EstimateVSizeForOutputs(utxos []UTXO, outputs []TxOutput, network string) (int, error) {
+	params, err := NetworkParams(network)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := newTxWithInputs(utxos, 0)
+	if err != nil {
+		return 0, err
+	}
+	for i, utxo := range utxos {
+		dummySignInput(tx.TxIn[i], utxo.AddressType)
+	}
+
+	for _, out := range outputs {
+		pkScript, err := out.script(params)
+		if err != nil {
+			return 0, err
+		}
+		tx.AddTxOut(wire.NewTxOut(out.Value, pkScript))
+	}
+
+	return txVSize(tx), nil
+}
+
+// addressOutputs returns outputs paying to addresses, for sizing
+func addressOutputs(addresses []string) []TxOutput {
+	outputs := make([]TxOutput, 0, len(addresses))
+	for _, address := range addresses {
+		outputs = append(outputs, TxOutput{Address: address})
+	}
+	return outputs
+}
+
+// EstimateFee returns the fee and virtual size of spending utxos to
+// outputAddresses, paying fee at a rate or as a fixed amount
+func EstimateFee(utxos []UTXO, outputAddresses []string, network string, fee Fee) (int64, int, error) {
+	return EstimateFeeForOutputs(utxos, addressOutputs(outputAddresses), network, fee)
+}
+
+// EstimateFeeForOutputs returns the fee and virtual size of spending utxos to
+// outputs, paying fee at a rate or as a fixed amount
+func EstimateFeeForOutputs(utxos []UTXO, outputs []TxOutput, network string, fee Fee) (int64, int, error) {
+	vsize, err := EstimateVSizeForOutputs(utxos, outputs, network)
+	if err != nil {
+		return 0, 0, err
+	}
+	amount, err := fee.ForVSize(vsize)
+	if err != nil {
+		return 0, 0, err
+	}
+	return amount, vsize, nil
+}
+
+// FeePlan is the fee and change of a transaction worked out before signing
+type FeePlan struct {
+	Fee          int64
+	VSize        int
+	ChangeAmount int64 // 0 when the change would be dust and is left to the fee
+}
+
+// PlanTransaction works out the fee and change of spending utxos to outputs
+// paying fee, returning change to changeAddress. BuildTransaction spends
+// exactly this plan, so it can be shown ahead of a send. Change too small to
+// be worth an output is left to the fee, even when the fee is a fixed amount:
+// the plan's Fee is then more than fee.Amount, and callers should say so.
+func PlanTransaction(utxos []UTXO, outputs []TxOutput, changeAddress, network string, fee Fee) (*FeePlan, error) {
+	if err := validateOutputs(outputs); err != nil {
+		return nil, err
+	}
+	var totalOutput int64
+	for _, out := range outputs {
+		totalOutput += out.Value
+	}
+
+	var totalInput int64
+	for _, utxo := range utxos {
+		totalInput += utxo.Value
+	}
+
+	noChange, vsize, err := EstimateFeeForOutputs(utxos, outputs, network, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	changeAmount := totalInput - totalOutput - noChange
+	if changeAmount < 0 {
+		return nil, fmt.Errorf("insufficient funds: have %d, need %d + %d fee",
+			totalInput, totalOutput, noChange)
+	}
+	if changeAmount <= DustLimit {
+		// Change is dust, add to fee
+		return &FeePlan{Fee: totalInput - totalOutput, VSize: vsize}, nil
+	}
+
+	withChangeOutputs := append(append([]TxOutput(nil), outputs...), TxOutput{Address: changeAddress})
+	withChange, withChangeVSize, err := EstimateFeeForOutputs(utxos, withChangeOutputs, network, fee)
+	if err != nil {
+		return nil, err
+	}
+	changeAmount = totalInput - totalOutput - withChange
+	if changeAmount <= DustLimit {
+		// The change output costs more than it would leave
+		return &FeePlan{Fee: totalInput - totalOutput, VSize: vsize}, nil
+	}
+	return &FeePlan{Fee: withChange, VSize: withChangeVSize, ChangeAmount: changeAmount}, nil
 }
 
 // BuildConsolidationTransaction creates a transaction that sends all UTXO value
@@ -384,6 +845,33 @@ func BuildConsolidationTransaction(
 	utxos []UTXO,
 	destinationAddress string,
 	feeRate int64,
+) (*TransactionResult, error) {
+	return BuildConsolidationTransactionWithLockTime(seed, network, utxos, destinationAddress, feeRate, 0)
+}
+
+// BuildConsolidationTransactionWithLockTime builds and signs a consolidation
+// transaction that cannot be mined before lockTime
+func BuildConsolidationTransactionWithLockTime(
+	seed []byte,
+	network string,
+	utxos []UTXO,
+	destinationAddress string,
+	feeRate int64,
+	lockTime uint32,
+) (*TransactionResult, error) {
+	return BuildConsolidationTransactionWithFee(seed, network, utxos, destinationAddress, Fee{Rate: SatPerVByte(feeRate)}, lockTime)
+}
+
+// BuildConsolidationTransactionWithFee builds and signs a consolidation
+// transaction paying fee, at a rate or as a fixed amount, that cannot be
+// mined before lockTime
+func BuildConsolidationTransactionWithFee(
+	seed []byte,
+	network string,
+	utxos []UTXO,
+	destinationAddress string,
+	fee Fee,
+	lockTime uint32,
 ) (*TransactionResult, error) {
 	if len(utxos) < 1 {
 		return nil, fmt.Errorf("need at least 1 UTXO, got %d", len(utxos))
@@ -400,38 +888,24 @@ func BuildConsolidationTransaction(
 		totalInput += utxo.Value
 	}
 
-	// Detect output address type for proper fee calculation
-	outputType := AddressTypeP2WPKH
-	if detectedType, err := GetAddressType(destinationAddress, network); err == nil && detectedType == "p2tr" {
-		outputType = AddressTypeP2TR
+	feeAmount, _, err := EstimateFee(utxos, []string{destinationAddress}, network, fee)
+	if err != nil {
+		return nil, err
 	}
 
-	// Calculate fee using proper address-type-aware estimation
-	fee := EstimateFeeForUTXOs(utxos, 1, feeRate, outputType)
-
 	// Calculate output value
-	outputValue := totalInput - fee
+	outputValue := totalInput - feeAmount
 	if outputValue <= 0 {
-		return nil, fmt.Errorf("insufficient funds: total input %d, fee %d", totalInput, fee)
+		return nil, fmt.Errorf("insufficient funds: total input %d, fee %d", totalInput, feeAmount)
 	}
 	if outputValue < DustLimit {
 		return nil, fmt.Errorf("output value %d is below dust limit %d", outputValue, DustLimit)
 	}
 
 	// Create transaction
-	tx := wire.NewMsgTx(wire.TxVersion)
-
-	// Add inputs with RBF-enabled sequence number (BIP125)
-	for _, utxo := range utxos {
-		txHash, err := chainhash.NewHashFromStr(utxo.TxID)
-		if err != nil {
-			return nil, fmt.Errorf("invalid txid %s: %w", utxo.TxID, err)
-		}
-
-		outpoint := wire.NewOutPoint(txHash, uint32(utxo.Vout))
-		txIn := wire.NewTxIn(outpoint, nil, nil)
-		txIn.Sequence = SequenceRBF // Enable Replace-By-Fee for fee bumping
-		tx.AddTxIn(txIn)
+	tx, err := newTxWithInputs(utxos, lockTime)
+	if err != nil {
+		return nil, err
 	}
 
 	// Add single output
@@ -448,72 +922,8 @@ func BuildConsolidationTransaction(
 	tx.AddTxOut(wire.NewTxOut(outputValue, pkScript))
 
 	// Sign inputs
-	prevOuts := make(map[wire.OutPoint]*wire.TxOut)
-	for i, utxo := range utxos {
-		prevOuts[tx.TxIn[i].PreviousOutPoint] = &wire.TxOut{
-			Value:    utxo.Value,
-			PkScript: utxo.ScriptPubKey,
-		}
-	}
-
-	prevOutFetcher := txscript.NewMultiPrevOutFetcher(prevOuts)
-	sigHashes := txscript.NewTxSigHashes(tx, prevOutFetcher)
-
-	for i, utxo := range utxos {
-		// Determine address type - default to P2WPKH for backwards compatibility
-		addrType := utxo.AddressType
-		if addrType == "" {
-			addrType = AddressTypeP2WPKH
-		}
-
-		// Derive the key for this UTXO using the appropriate derivation path
-		key, err := DeriveReceivingKeyForType(seed, network, utxo.AddressIndex, addrType)
-		if err != nil {
-			return nil, fmt.Errorf("failed to derive key for input %d: %w", i, err)
-		}
-
-		privKey, err := GetPrivateKey(key)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get private key for input %d: %w", i, err)
-		}
-
-		var witness wire.TxWitness
-
-		if addrType == AddressTypeP2TR {
-			// P2TR key-path spending: Schnorr signature
-			sig, err := txscript.RawTxInTaprootSignature(
-				tx,
-				sigHashes,
-				i,
-				utxo.Value,
-				utxo.ScriptPubKey,
-				nil, // No tap leaf (key-path spend)
-				txscript.SigHashDefault,
-				privKey,
-			)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create Schnorr signature for input %d: %w", i, err)
-			}
-			// P2TR key-path witness is just the signature
-			witness = wire.TxWitness{sig}
-		} else {
-			// P2WPKH: ECDSA signature
-			witness, err = txscript.WitnessSignature(
-				tx,
-				sigHashes,
-				i,
-				utxo.Value,
-				utxo.ScriptPubKey,
-				txscript.SigHashAll,
-				privKey,
-				true, // compressed
-			)
-			if err != nil {
-				return nil, fmt.Errorf("failed to sign input %d: %w", i, err)
-			}
-		}
-
-		tx.TxIn[i].Witness = witness
+	if err := signInputs(seed, network, tx, utxos); err != nil {
+		return nil, err
 	}
 
 	// Serialize transaction
@@ -527,11 +937,11 @@ func BuildConsolidationTransaction(
 	return &TransactionResult{
 		TxID:         tx.TxHash().String(),
 		Hex:          txHex,
-		Fee:          fee,
+		Fee:          feeAmount,
 		TotalInput:   totalInput,
 		TotalOutput:  outputValue,
 		ChangeAmount: 0, // No change in consolidation
 		Size:         buf.Len(),
-		VSize:        tx.SerializeSizeStripped() + (tx.SerializeSize()-tx.SerializeSizeStripped()+3)/4,
+		VSize:        txVSize(tx),
 	}, nil
 }
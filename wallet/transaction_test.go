@@ -1,11 +1,30 @@
 package wallet
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
 )
 
+// selectionAddress is the destination and change of the selection tests
+const selectionAddress = "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+
+// selectionUTXO returns a P2WPKH UTXO whose txid is derived from name
+func selectionUTXO(name string, value int64) UTXO {
+	return UTXO{TxID: chainhash.HashH([]byte(name)).String(), Value: value, AddressType: AddressTypeP2WPKH}
+}
+
+// selectionChange returns selectionAddress as the change of any selection
+func selectionChange([]UTXO) (string, error) {
+	return selectionAddress, nil
+}
+
 func TestSelectUTXOs(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -18,7 +37,7 @@ func TestSelectUTXOs(t *testing.T) {
 		{
 			name: "single UTXO sufficient",
 			utxos: []UTXO{
-				{TxID: "abc", Vout: 0, Value: 100000},
+				selectionUTXO("abc", 100000),
 			},
 			targetAmount: 50000,
 			feeRate:      10,
@@ -28,9 +47,9 @@ func TestSelectUTXOs(t *testing.T) {
 		{
 			name: "multiple UTXOs needed",
 			utxos: []UTXO{
-				{TxID: "abc", Vout: 0, Value: 30000},
-				{TxID: "def", Vout: 0, Value: 30000},
-				{TxID: "ghi", Vout: 0, Value: 30000},
+				selectionUTXO("abc", 30000),
+				selectionUTXO("def", 30000),
+				selectionUTXO("ghi", 30000),
 			},
 			targetAmount: 50000,
 			feeRate:      10,
@@ -40,9 +59,9 @@ func TestSelectUTXOs(t *testing.T) {
 		{
 			name: "selects largest first",
 			utxos: []UTXO{
-				{TxID: "small1", Vout: 0, Value: 10000},
-				{TxID: "large", Vout: 0, Value: 100000},
-				{TxID: "small2", Vout: 0, Value: 10000},
+				selectionUTXO("small1", 10000),
+				selectionUTXO("large", 100000),
+				selectionUTXO("small2", 10000),
 			},
 			targetAmount: 50000,
 			feeRate:      10,
@@ -59,7 +78,7 @@ func TestSelectUTXOs(t *testing.T) {
 		{
 			name: "insufficient funds",
 			utxos: []UTXO{
-				{TxID: "abc", Vout: 0, Value: 1000},
+				selectionUTXO("abc", 1000),
 			},
 			targetAmount: 50000,
 			feeRate:      10,
@@ -68,7 +87,7 @@ func TestSelectUTXOs(t *testing.T) {
 		{
 			name: "exact amount with fee",
 			utxos: []UTXO{
-				{TxID: "abc", Vout: 0, Value: 52000}, // Just enough for 50000 + ~1400 fee
+				selectionUTXO("abc", 52000), // Just enough for 50000 + ~1400 fee
 			},
 			targetAmount: 50000,
 			feeRate:      10,
@@ -79,17 +98,18 @@ func TestSelectUTXOs(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			selected, fee, err := SelectUTXOs(tt.utxos, tt.targetAmount, tt.feeRate)
+			outputs := []TxOutput{{Address: selectionAddress, Value: tt.targetAmount}}
+			selected, plan, err := SelectUTXOsForOutputs(tt.utxos, outputs, "mainnet", Fee{Rate: SatPerVByte(tt.feeRate)}, selectionChange)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("SelectUTXOs() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("SelectUTXOsForOutputs() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if !tt.wantErr {
 				if len(selected) != tt.wantCount {
-					t.Errorf("SelectUTXOs() selected %d UTXOs, want %d", len(selected), tt.wantCount)
+					t.Errorf("SelectUTXOsForOutputs() selected %d UTXOs, want %d", len(selected), tt.wantCount)
 				}
-				if fee <= 0 {
-					t.Errorf("SelectUTXOs() fee = %d, want > 0", fee)
+				if plan.Fee <= 0 {
+					t.Errorf("SelectUTXOsForOutputs() fee = %d, want > 0", plan.Fee)
 				}
 
 				// Verify selected UTXOs have sufficient value
@@ -97,66 +117,49 @@ func TestSelectUTXOs(t *testing.T) {
 				for _, utxo := range selected {
 					totalValue += utxo.Value
 				}
-				if totalValue < tt.targetAmount+fee {
-					t.Errorf("SelectUTXOs() total value %d < target %d + fee %d",
-						totalValue, tt.targetAmount, fee)
+				if totalValue != tt.targetAmount+plan.Fee+plan.ChangeAmount {
+					t.Errorf("SelectUTXOsForOutputs() total value %d != target %d + fee %d + change %d",
+						totalValue, tt.targetAmount, plan.Fee, plan.ChangeAmount)
 				}
 			}
 		})
 	}
 }
 
-func TestEstimateFee(t *testing.T) {
-	tests := []struct {
-		name       string
-		numInputs  int
-		numOutputs int
-		feeRate    int64
-		wantMin    int64
-		wantMax    int64
-	}{
-		{
-			name:       "1 input 1 output",
-			numInputs:  1,
-			numOutputs: 1,
-			feeRate:    10,
-			wantMin:    500,  // At least 50 vbytes * 10 sat/vbyte
-			wantMax:    2000, // At most 200 vbytes * 10 sat/vbyte
-		},
-		{
-			name:       "1 input 2 outputs",
-			numInputs:  1,
-			numOutputs: 2,
-			feeRate:    10,
-			wantMin:    500,
-			wantMax:    2500,
-		},
-		{
-			name:       "2 inputs 2 outputs",
-			numInputs:  2,
-			numOutputs: 2,
-			feeRate:    10,
-			wantMin:    1000,
-			wantMax:    3500,
-		},
-		{
-			name:       "high fee rate",
-			numInputs:  1,
-			numOutputs: 2,
-			feeRate:    100,
-			wantMin:    5000,
-			wantMax:    25000,
-		},
+func TestSelectUTXOsForOutputsSizing(t *testing.T) {
+	// Legacy inputs are sized as signed, not from a per-type table
+	utxos := []UTXO{
+		{TxID: chainhash.HashH([]byte("a")).String(), Value: 30000, AddressType: AddressTypeP2PKH},
+		{TxID: chainhash.HashH([]byte("b")).String(), Value: 30000, AddressType: AddressTypeP2PKH},
+		{TxID: chainhash.HashH([]byte("c")).String(), Value: 30000, AddressType: AddressTypeP2PKH},
+	}
+	outputs := []TxOutput{
+		{Address: selectionAddress, Value: 50000},
+		{OpReturn: []byte("selection covers the data output too")},
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			fee := EstimateTransactionFee(tt.numInputs, tt.numOutputs, tt.feeRate)
-			if fee < tt.wantMin || fee > tt.wantMax {
-				t.Errorf("EstimateTransactionFee() = %d, want between %d and %d",
-					fee, tt.wantMin, tt.wantMax)
-			}
-		})
+	selected, plan, err := SelectUTXOsForOutputs(utxos, outputs, "mainnet", Fee{Rate: SatPerVByte(20)}, selectionChange)
+	if err != nil {
+		t.Fatalf("SelectUTXOsForOutputs() error = %v", err)
+	}
+
+	sizedOutputs := outputs
+	if plan.ChangeAmount > 0 {
+		sizedOutputs = append(append([]TxOutput(nil), outputs...), TxOutput{Address: selectionAddress})
+	}
+	vsize, err := EstimateVSizeForOutputs(selected, sizedOutputs, "mainnet")
+	if err != nil {
+		t.Fatalf("EstimateVSizeForOutputs() error = %v", err)
+	}
+	if plan.VSize != vsize || plan.Fee < SatPerVByte(20).FeeForVSize(vsize) {
+		t.Errorf("plan = %+v, want the fee of %d vbytes at 20 sat/vB", plan, vsize)
+	}
+
+	// Two inputs can't pay 59000 and the fee; the third is added
+	outputs[0].Value = 59000
+	selected, _, err = SelectUTXOsForOutputs(utxos, outputs, "mainnet", Fee{Rate: SatPerVByte(20)}, selectionChange)
+	if err != nil || len(selected) != 3 {
+		t.Errorf("SelectUTXOsForOutputs() = %d UTXOs, error %v, want 3", len(selected), err)
 	}
 }
 
@@ -429,22 +432,23 @@ func TestTransactionSizes(t *testing.T) {
 func TestSelectUTXOsOrdering(t *testing.T) {
 	// Verify that largest UTXOs are selected first
 	utxos := []UTXO{
-		{TxID: "small", Vout: 0, Value: 1000},
-		{TxID: "large", Vout: 0, Value: 100000},
-		{TxID: "medium", Vout: 0, Value: 50000},
+		selectionUTXO("small", 1000),
+		selectionUTXO("large", 100000),
+		selectionUTXO("medium", 50000),
 	}
 
-	selected, _, err := SelectUTXOs(utxos, 40000, 10)
+	outputs := []TxOutput{{Address: selectionAddress, Value: 40000}}
+	selected, _, err := SelectUTXOsForOutputs(utxos, outputs, "mainnet", Fee{Rate: SatPerVByte(10)}, selectionChange)
 	if err != nil {
-		t.Fatalf("SelectUTXOs() error = %v", err)
+		t.Fatalf("SelectUTXOsForOutputs() error = %v", err)
 	}
 
 	// Should select the large one first (100000 > 40000 + fee)
 	if len(selected) != 1 {
-		t.Errorf("SelectUTXOs() selected %d UTXOs, want 1", len(selected))
+		t.Errorf("SelectUTXOsForOutputs() selected %d UTXOs, want 1", len(selected))
 	}
-	if selected[0].TxID != "large" {
-		t.Errorf("SelectUTXOs() selected UTXO %q, want 'large'", selected[0].TxID)
+	if selected[0].Value != 100000 {
+		t.Errorf("SelectUTXOsForOutputs() selected a %d sat UTXO, want the 100000 sat one", selected[0].Value)
 	}
 }
 
@@ -998,3 +1002,456 @@ func TestTransactionSizesP2TR(t *testing.T) {
 		t.Errorf("P2TROutputSize = %d, expected ~43", P2TROutputSize)
 	}
 }
+
+func TestBuildTransactionSignsWithAccountAndChainKey(t *testing.T) {
+	seedHex := "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+	seed, _ := hex.DecodeString(seedHex)
+
+	for _, addrType := range []string{AddressTypeP2WPKH, AddressTypeP2TR, AddressTypeP2SHP2WPKH, AddressTypeP2PKH} {
+		t.Run(addrType, func(t *testing.T) {
+			// UTXO on the change chain of account 2
+			info, err := GenerateAddressInfoForAccount(seed, "mainnet", 2, 1, 3, addrType)
+			if err != nil {
+				t.Fatalf("GenerateAddressInfoForAccount() error = %v", err)
+			}
+			scriptPubKey, _ := GetScriptPubKey(info.Address, "mainnet")
+
+			utxo := UTXO{
+				TxID:         "0000000000000000000000000000000000000000000000000000000000000001",
+				Vout:         0,
+				Value:        100000,
+				Address:      info.Address,
+				AddressIndex: 3,
+				Account:      2,
+				Change:       1,
+				ScriptPubKey: scriptPubKey,
+				AddressType:  addrType,
+			}
+			dest, _ := GenerateAddressFromSeed(seed, "mainnet", 0)
+
+			result, err := BuildTransaction(seed, "mainnet", []UTXO{utxo},
+				[]TxOutput{{Address: dest, Value: 50000}}, dest, 10)
+			if err != nil {
+				t.Fatalf("BuildTransaction() error = %v", err)
+			}
+
+			raw, _ := hex.DecodeString(result.Hex)
+			tx := wire.NewMsgTx(wire.TxVersion)
+			if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+				t.Fatalf("failed to decode transaction: %v", err)
+			}
+
+			fetcher := txscript.NewCannedPrevOutputFetcher(scriptPubKey, utxo.Value)
+			vm, err := txscript.NewEngine(scriptPubKey, tx, 0, txscript.StandardVerifyFlags,
+				nil, txscript.NewTxSigHashes(tx, fetcher), utxo.Value, fetcher)
+			if err != nil {
+				t.Fatalf("txscript.NewEngine() error = %v", err)
+			}
+			if err := vm.Execute(); err != nil {
+				t.Errorf("signature does not verify against the account %d change key: %v", utxo.Account, err)
+			}
+		})
+	}
+}
+
+func TestLegacyAndNestedSizes(t *testing.T) {
+	tests := []struct {
+		addrType   string
+		inputSize  int
+		outputSize int
+	}{
+		{AddressTypeP2WPKH, P2WPKHInputSize, P2WPKHOutputSize},
+		{AddressTypeP2TR, P2TRInputSize, P2TROutputSize},
+		{AddressTypeP2SHP2WPKH, P2SHP2WPKHInputSize, P2SHOutputSize},
+		{AddressTypeP2PKH, P2PKHInputSize, P2PKHOutputSize},
+		{"", P2WPKHInputSize, P2WPKHOutputSize},
+	}
+
+	for _, tt := range tests {
+		if got := InputVSize(tt.addrType); got != tt.inputSize {
+			t.Errorf("InputVSize(%q) = %d, want %d", tt.addrType, got, tt.inputSize)
+		}
+		if got := OutputVSize(tt.addrType); got != tt.outputSize {
+			t.Errorf("OutputVSize(%q) = %d, want %d", tt.addrType, got, tt.outputSize)
+		}
+	}
+
+	// A legacy input costs more than twice a native SegWit input
+	legacy := EstimateFeeForTypes(1, 1, 10, AddressTypeP2PKH, AddressTypeP2PKH)
+	nested := EstimateFeeForTypes(1, 1, 10, AddressTypeP2SHP2WPKH, AddressTypeP2SHP2WPKH)
+	native := EstimateFeeForTypes(1, 1, 10, AddressTypeP2WPKH, AddressTypeP2WPKH)
+	if !(legacy > nested && nested > native) {
+		t.Errorf("expected legacy (%d) > nested (%d) > native (%d) fees", legacy, nested, native)
+	}
+}
+
+func TestBuildTransactionLegacyInputFee(t *testing.T) {
+	seedHex := "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+	seed, _ := hex.DecodeString(seedHex)
+
+	info, err := GenerateAddressInfoForAccount(seed, "mainnet", 0, 0, 0, AddressTypeP2PKH)
+	if err != nil {
+		t.Fatalf("GenerateAddressInfoForAccount() error = %v", err)
+	}
+	scriptPubKey, _ := GetScriptPubKey(info.Address, "mainnet")
+	utxo := UTXO{
+		TxID:         "0000000000000000000000000000000000000000000000000000000000000001",
+		Value:        100000,
+		Address:      info.Address,
+		ScriptPubKey: scriptPubKey,
+		AddressType:  AddressTypeP2PKH,
+	}
+	dest, _ := GenerateAddressFromSeed(seed, "mainnet", 0)
+
+	result, err := BuildTransaction(seed, "mainnet", []UTXO{utxo},
+		[]TxOutput{{Address: dest, Value: 50000}}, dest, 10)
+	if err != nil {
+		t.Fatalf("BuildTransaction() error = %v", err)
+	}
+
+	// The fee must cover the real size of the signed legacy transaction
+	if result.Fee < int64(result.VSize)*10 {
+		t.Errorf("fee %d is below 10 sat/vB for a %d vbyte transaction", result.Fee, result.VSize)
+	}
+}
+
+func TestRelativeLock(t *testing.T) {
+	tests := []struct {
+		name     string
+		sequence uint32
+		value    uint32
+		seconds  bool
+		ok       bool
+	}{
+		{"rbf", SequenceRBF, 0, false, false},
+		{"final", SequenceFinal, 0, false, false},
+		{"144 blocks", 144, 144, false, true},
+		{"512 second units", wire.SequenceLockTimeIsSeconds | 10, 5120, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, seconds, ok := RelativeLock(tt.sequence)
+			if value != tt.value || seconds != tt.seconds || ok != tt.ok {
+				t.Errorf("RelativeLock(0x%x) = %d, %v, %v, want %d, %v, %v", tt.sequence, value, seconds, ok, tt.value, tt.seconds, tt.ok)
+			}
+		})
+	}
+}
+
+func TestBuildTransactionWithLockTime(t *testing.T) {
+	seed, _ := hex.DecodeString("5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4")
+	addrInfo, err := GenerateAddressInfo(seed, "mainnet", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptPubKey, err := GetScriptPubKey(addrInfo.Address, "mainnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utxo := UTXO{
+		TxID:         "0000000000000000000000000000000000000000000000000000000000000001",
+		Value:        100000,
+		Address:      addrInfo.Address,
+		ScriptPubKey: scriptPubKey,
+	}
+	outputs := []TxOutput{{Address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", Value: 50000}}
+
+	decode := func(t *testing.T, result *TransactionResult) *wire.MsgTx {
+		t.Helper()
+		raw, _ := hex.DecodeString(result.Hex)
+		tx := wire.NewMsgTx(0)
+		if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	t.Run("sets locktime and keeps RBF sequence", func(t *testing.T) {
+		result, err := BuildTransactionWithLockTime(seed, "mainnet", []UTXO{utxo}, outputs, addrInfo.Address, 10, 900000)
+		if err != nil {
+			t.Fatalf("BuildTransactionWithLockTime() error = %v", err)
+		}
+		tx := decode(t, result)
+		if tx.LockTime != 900000 || tx.TxIn[0].Sequence != SequenceRBF || tx.Version != wire.TxVersion {
+			t.Errorf("locktime %d, sequence 0x%x, version %d", tx.LockTime, tx.TxIn[0].Sequence, tx.Version)
+		}
+	})
+
+	t.Run("relative timelock uses version 2", func(t *testing.T) {
+		csv := utxo
+		csv.Sequence = 144
+		result, err := BuildConsolidationTransactionWithLockTime(seed, "mainnet", []UTXO{csv}, outputs[0].Address, 10, 0)
+		if err != nil {
+			t.Fatalf("BuildConsolidationTransactionWithLockTime() error = %v", err)
+		}
+		tx := decode(t, result)
+		if tx.Version != 2 || tx.TxIn[0].Sequence != 144 {
+			t.Errorf("version %d, sequence %d, want 2, 144", tx.Version, tx.TxIn[0].Sequence)
+		}
+	})
+
+	t.Run("final sequence disables locktime", func(t *testing.T) {
+		final := utxo
+		final.Sequence = SequenceFinal
+		if _, err := BuildTransactionWithLockTime(seed, "mainnet", []UTXO{final}, outputs, addrInfo.Address, 10, 900000); err == nil {
+			t.Error("BuildTransactionWithLockTime() expected error")
+		}
+	})
+
+	t.Run("undefined relative lock bits", func(t *testing.T) {
+		odd := utxo
+		odd.Sequence = 1<<20 | 144
+		if err := ValidateTimelocks(0, []UTXO{odd}); err == nil {
+			t.Error("ValidateTimelocks() expected error")
+		}
+	})
+}
+
+func TestAntiFeeSnipingLockTime(t *testing.T) {
+	// randN stubs the random source with fixed draws
+	randN := func(draws ...int64) func(int64) int64 {
+		return func(n int64) int64 {
+			draw := draws[0]
+			draws = draws[1:]
+			if draw >= n {
+				t.Fatalf("draw %d out of range [0, %d)", draw, n)
+			}
+			return draw
+		}
+	}
+
+	tests := []struct {
+		name   string
+		tip    int64
+		randN  func(int64) int64
+		expect uint32
+	}{
+		{"locks to the tip", 900000, randN(3), 900000},
+		{"backdates one in ten", 900000, randN(0, 42), 899958},
+		{"backdating stops at zero", 20, randN(0, 99), 0},
+		{"unknown tip", 0, nil, 0},
+		{"tip beyond the height range", LockTimeThreshold, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := antiFeeSnipingLockTime(tt.tip, tt.randN); got != tt.expect {
+				t.Errorf("antiFeeSnipingLockTime(%d) = %d, want %d", tt.tip, got, tt.expect)
+			}
+		})
+	}
+
+	t.Run("stays within the backdating window", func(t *testing.T) {
+		for i := 0; i < 1000; i++ {
+			if got := AntiFeeSnipingLockTime(900000); got > 900000 || got < 900000-feeSnipingMaxBackdate+1 {
+				t.Fatalf("AntiFeeSnipingLockTime(900000) = %d", got)
+			}
+		}
+	})
+
+	t.Run("built transactions carry the locktime", func(t *testing.T) {
+		seed := make([]byte, 32)
+		address, err := GenerateAddressForAccount(seed, "mainnet", 0, 0, 0, AddressTypeP2WPKH)
+		if err != nil {
+			t.Fatal(err)
+		}
+		script, _ := GetScriptPubKey(address, "mainnet")
+		utxos := []UTXO{{TxID: strings.Repeat("01", 32), Value: 100000, Address: address, ScriptPubKey: script}}
+
+		result, err := BuildConsolidationTransactionWithLockTime(seed, "mainnet", utxos, address, 2, AntiFeeSnipingLockTime(900000))
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := hex.DecodeString(result.Hex)
+		tx := wire.NewMsgTx(0)
+		if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+			t.Fatal(err)
+		}
+		if tx.LockTime == 0 || tx.LockTime > 900000 || tx.TxIn[0].Sequence != SequenceRBF {
+			t.Errorf("locktime %d, sequence 0x%x", tx.LockTime, tx.TxIn[0].Sequence)
+		}
+	})
+}
+
+func TestEstimateVSize(t *testing.T) {
+	seed, _ := hex.DecodeString("5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4")
+	dest := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+
+	utxoOfType := func(t *testing.T, index uint32, addressType string) UTXO {
+		t.Helper()
+		info, err := GenerateAddressInfoForAccount(seed, "mainnet", 0, 0, index, addressType)
+		if err != nil {
+			t.Fatalf("GenerateAddressInfoForAccount() error = %v", err)
+		}
+		scriptPubKey, _ := GetScriptPubKey(info.Address, "mainnet")
+		return UTXO{
+			TxID:         fmt.Sprintf("%064x", index+1),
+			Value:        100000,
+			Address:      info.Address,
+			AddressIndex: index,
+			ScriptPubKey: scriptPubKey,
+			AddressType:  addressType,
+		}
+	}
+
+	tests := []struct {
+		name  string
+		types []string
+	}{
+		{"p2wpkh", []string{AddressTypeP2WPKH}},
+		{"p2tr", []string{AddressTypeP2TR, AddressTypeP2TR}},
+		{"p2sh-p2wpkh", []string{AddressTypeP2SHP2WPKH}},
+		{"p2pkh", []string{AddressTypeP2PKH}},
+		{"mixed", []string{AddressTypeP2WPKH, AddressTypeP2TR, AddressTypeP2SHP2WPKH, AddressTypeP2PKH}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var utxos []UTXO
+			ecdsaInputs := 0
+			for i, addressType := range tt.types {
+				utxos = append(utxos, utxoOfType(t, uint32(i), addressType))
+				if addressType != AddressTypeP2TR {
+					ecdsaInputs++
+				}
+			}
+
+			estimated, err := EstimateVSize(utxos, []string{dest}, "mainnet")
+			if err != nil {
+				t.Fatalf("EstimateVSize() error = %v", err)
+			}
+			result, err := BuildConsolidationTransaction(seed, "mainnet", utxos, dest, 10)
+			if err != nil {
+				t.Fatalf("BuildConsolidationTransaction() error = %v", err)
+			}
+
+			// Dummy signatures are as long as real ones get; a shorter ECDSA
+			// signature saves at most a byte of script or a quarter vbyte of witness
+			if result.VSize > estimated || estimated-result.VSize > ecdsaInputs {
+				t.Errorf("estimated vsize %d, signed vsize %d", estimated, result.VSize)
+			}
+			if result.Fee != int64(estimated)*10 {
+				t.Errorf("fee %d, want %d at 10 sat/vB", result.Fee, estimated*10)
+			}
+			if ecdsaInputs == 0 && estimated != result.VSize {
+				t.Errorf("taproot estimate %d is not exact, signed vsize %d", estimated, result.VSize)
+			}
+		})
+	}
+
+	t.Run("invalid output address", func(t *testing.T) {
+		if _, err := EstimateVSize([]UTXO{utxoOfType(t, 0, AddressTypeP2WPKH)}, []string{"not-an-address"}, "mainnet"); err == nil {
+			t.Error("EstimateVSize() expected error")
+		}
+	})
+}
+
+func TestPlanTransaction(t *testing.T) {
+	seed, _ := hex.DecodeString("5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4")
+	info, err := GenerateAddressInfoForAccount(seed, "mainnet", 0, 0, 0, AddressTypeP2TR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptPubKey, _ := GetScriptPubKey(info.Address, "mainnet")
+	utxo := UTXO{
+		TxID:         "0000000000000000000000000000000000000000000000000000000000000001",
+		Value:        100000,
+		Address:      info.Address,
+		ScriptPubKey: scriptPubKey,
+		AddressType:  AddressTypeP2TR,
+	}
+	dest := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+
+	t.Run("matches the built transaction", func(t *testing.T) {
+		outputs := []TxOutput{{Address: dest, Value: 50000}}
+		plan, err := PlanTransaction([]UTXO{utxo}, outputs, info.Address, "mainnet", Fee{Rate: SatPerVByte(7)})
+		if err != nil {
+			t.Fatalf("PlanTransaction() error = %v", err)
+		}
+		result, err := BuildTransaction(seed, "mainnet", []UTXO{utxo}, outputs, info.Address, 7)
+		if err != nil {
+			t.Fatalf("BuildTransaction() error = %v", err)
+		}
+		if plan.Fee != result.Fee || plan.ChangeAmount != result.ChangeAmount || plan.VSize != result.VSize {
+			t.Errorf("plan %+v, built fee %d change %d vsize %d", plan, result.Fee, result.ChangeAmount, result.VSize)
+		}
+		if plan.Fee != int64(result.VSize)*7 {
+			t.Errorf("fee %d is not 7 sat/vB of %d vbytes", plan.Fee, result.VSize)
+		}
+	})
+
+	t.Run("dust change goes to the fee", func(t *testing.T) {
+		outputs := []TxOutput{{Address: dest, Value: 99000}}
+		plan, err := PlanTransaction([]UTXO{utxo}, outputs, info.Address, "mainnet", Fee{Rate: SatPerVByte(5)})
+		if err != nil {
+			t.Fatalf("PlanTransaction() error = %v", err)
+		}
+		if plan.ChangeAmount != 0 || plan.Fee != 1000 {
+			t.Errorf("change %d, fee %d, want 0, 1000", plan.ChangeAmount, plan.Fee)
+		}
+	})
+
+	t.Run("insufficient funds", func(t *testing.T) {
+		outputs := []TxOutput{{Address: dest, Value: 99990}}
+		if _, err := PlanTransaction([]UTXO{utxo}, outputs, info.Address, "mainnet", Fee{Rate: SatPerVByte(5)}); err == nil {
+			t.Error("PlanTransaction() expected error")
+		}
+	})
+}
+
+func TestBuildTransactionOpReturn(t *testing.T) {
+	seed, _ := hex.DecodeString("5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4")
+	info, err := GenerateAddressInfo(seed, "mainnet", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptPubKey, _ := GetScriptPubKey(info.Address, "mainnet")
+	utxo := UTXO{
+		TxID:         "0000000000000000000000000000000000000000000000000000000000000001",
+		Value:        100000,
+		Address:      info.Address,
+		ScriptPubKey: scriptPubKey,
+	}
+	dest := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	data := bytes.Repeat([]byte{0xab}, 32)
+	outputs := []TxOutput{{Address: dest, Value: 50000}, {OpReturn: data}}
+
+	result, err := BuildTransaction(seed, "mainnet", []UTXO{utxo}, outputs, info.Address, 10)
+	if err != nil {
+		t.Fatalf("BuildTransaction() error = %v", err)
+	}
+	raw, _ := hex.DecodeString(result.Hex)
+	tx := wire.NewMsgTx(0)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TxOut) != 3 {
+		t.Fatalf("transaction has %d outputs, want payment, OP_RETURN and change", len(tx.TxOut))
+	}
+	pushes, err := txscript.PushedData(tx.TxOut[1].PkScript)
+	if tx.TxOut[1].Value != 0 || txscript.GetScriptClass(tx.TxOut[1].PkScript) != txscript.NullDataTy ||
+		err != nil || len(pushes) != 1 || !bytes.Equal(pushes[0], data) {
+		t.Errorf("OP_RETURN output = %x with value %d", tx.TxOut[1].PkScript, tx.TxOut[1].Value)
+	}
+
+	// The data output is sized and paid for
+	withoutData, err := BuildTransaction(seed, "mainnet", []UTXO{utxo}, outputs[:1], info.Address, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.VSize - withoutData.VSize; got != OpReturnOutputVSize(data) {
+		t.Errorf("OP_RETURN output adds %d vbytes, want %d", got, OpReturnOutputVSize(data))
+	}
+	if result.Fee != withoutData.Fee+int64(OpReturnOutputVSize(data))*10 {
+		t.Errorf("fee %d with OP_RETURN, %d without", result.Fee, withoutData.Fee)
+	}
+
+	for name, outputs := range map[string][]TxOutput{
+		"oversized data": {{Address: dest, Value: 50000}, {OpReturn: make([]byte, MaxOpReturnSize+1)}},
+		"two OP_RETURNs": {{Address: dest, Value: 50000}, {OpReturn: data}, {OpReturn: data}},
+		"nonzero value":  {{Address: dest, Value: 50000}, {OpReturn: data, Value: 1000}},
+	} {
+		if _, err := BuildTransaction(seed, "mainnet", []UTXO{utxo}, outputs, info.Address, 10); err == nil {
+			t.Errorf("%s: BuildTransaction() expected error", name)
+		}
+	}
+}